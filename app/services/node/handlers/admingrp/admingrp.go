@@ -0,0 +1,112 @@
+// Package admingrp maintains the group of handlers for operating a running
+// node.
+package admingrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/sys/validate"
+	"github.com/ardanlabs/blockchain/business/web/errs"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
+	"github.com/ardanlabs/blockchain/foundation/events"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"go.uber.org/zap"
+)
+
+// Handlers manages the set of admin endpoints.
+type Handlers struct {
+	Log      *zap.SugaredLogger
+	State    *state.State
+	Evts     *events.Events
+	Webhooks *webhook.Dispatcher
+	Auth     *auth.Auth
+}
+
+// ListWebhooks returns the registered webhooks. The secrets are not returned.
+func (h Handlers) ListWebhooks(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	hooks := h.Webhooks.Hooks()
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+
+	return web.Respond(ctx, w, hooks, http.StatusOK)
+}
+
+// AddWebhook registers a webhook or replaces the webhook with the same id.
+func (h Handlers) AddWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var hook webhook.Hook
+	if err := web.Decode(r, &hook); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := hook.Validate(); err != nil {
+		h.audit(ctx, r, "webhook.add", hook.ID, err)
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	err := h.Webhooks.AddHook(hook)
+	h.audit(ctx, r, "webhook.add", hook.ID, err)
+	if err != nil {
+		return err
+	}
+
+	hook.Secret = ""
+	return web.Respond(ctx, w, hook, http.StatusCreated)
+}
+
+// RemoveWebhook removes the webhook with the specified id.
+func (h Handlers) RemoveWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id := web.Param(r, "id")
+
+	err := h.Webhooks.RemoveHook(id)
+	h.audit(ctx, r, "webhook.remove", id, err)
+	if err != nil {
+		if errors.Is(err, webhook.ErrNotFound) {
+			return errs.NewTrusted(err, http.StatusNotFound)
+		}
+		return err
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// PendingWebhooks returns the deliveries waiting to be delivered.
+func (h Handlers) PendingWebhooks(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.Webhooks.Pending(), http.StatusOK)
+}
+
+// DeadLetters returns the deliveries that failed too many times.
+func (h Handlers) DeadLetters(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	dead, err := h.Webhooks.DeadLetters()
+	if err != nil {
+		return err
+	}
+
+	if dead == nil {
+		dead = []webhook.Delivery{}
+	}
+
+	return web.Respond(ctx, w, dead, http.StatusOK)
+}
+
+// =============================================================================
+
+// audit publishes the audit event for an action taken by the operator.
+func (h Handlers) audit(ctx context.Context, r *http.Request, action string, target string, err error) {
+	ev := state.AdminAction{
+		Action:  action,
+		Target:  target,
+		Remote:  r.RemoteAddr,
+		TraceID: web.GetTraceID(ctx),
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	h.Evts.Publish(ev)
+}
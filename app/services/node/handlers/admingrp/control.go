@@ -0,0 +1,244 @@
+package admingrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ardanlabs/blockchain/business/sys/validate"
+	"github.com/ardanlabs/blockchain/business/web/errs"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// defaultBanDuration is used when a ban request doesn't specify a duration.
+const defaultBanDuration = 24 * time.Hour
+
+// mining represents the mining status of the node.
+type mining struct {
+	Enabled     bool               `json:"enabled"`
+	Allowed     bool               `json:"allowed"`
+	Beneficiary database.AccountID `json:"beneficiary"`
+}
+
+// miningRequest represents a request to pause or resume mining.
+type miningRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// peerRequest represents a request to add a peer.
+type peerRequest struct {
+	Host string `json:"host" validate:"required"`
+}
+
+// banRequest represents a request to ban a peer. The duration is in the
+// format accepted by time.ParseDuration.
+type banRequest struct {
+	Duration string `json:"duration"`
+}
+
+// beneficiaryRequest represents a request to change the beneficiary.
+type beneficiaryRequest struct {
+	Account database.AccountID `json:"account" validate:"required,len=42,startswith=0x,hexadecimal"`
+}
+
+// Mining returns the mining status of the node. Mining is allowed when it's
+// enabled and the node isn't being resynced.
+func (h Handlers) Mining(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	resp := mining{
+		Enabled:     !h.State.IsMiningPaused(),
+		Allowed:     h.State.IsMiningAllowed(),
+		Beneficiary: h.State.Beneficiary(),
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// SetMining pauses or resumes mining.
+func (h Handlers) SetMining(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req miningRequest
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	h.State.PauseMining(!req.Enabled)
+
+	action := "mining.resume"
+	if !req.Enabled {
+		action = "mining.pause"
+	}
+	h.audit(ctx, r, action, "", nil)
+
+	return h.Mining(ctx, w, r)
+}
+
+// SetBeneficiary changes the account that receives the mining rewards.
+func (h Handlers) SetBeneficiary(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req beneficiaryRequest
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(req); err != nil {
+		h.audit(ctx, r, "beneficiary.set", string(req.Account), err)
+		return fmt.Errorf("validating payload: %w", err)
+	}
+
+	err := h.State.SetBeneficiary(req.Account)
+	h.audit(ctx, r, "beneficiary.set", string(req.Account), err)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	return h.Mining(ctx, w, r)
+}
+
+// Reorganize resets the blockchain and resyncs it from the peers. The
+// resync runs in the background.
+func (h Handlers) Reorganize(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	err := h.State.Reorganize()
+	h.audit(ctx, r, "reorganize", "", err)
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusAccepted)
+}
+
+// EvictTx removes the transaction with the specified hash from the mempool.
+func (h Handlers) EvictTx(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	hash := web.Param(r, "hash")
+
+	tx, err := h.State.EvictTx(hash)
+	h.audit(ctx, r, "mempool.evict", hash, err)
+	if err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			return errs.NewTrusted(fmt.Errorf("transaction %q not in mempool", hash), http.StatusNotFound)
+		}
+		return err
+	}
+
+	return web.Respond(ctx, w, tx, http.StatusOK)
+}
+
+// FlushMempool removes every transaction from the mempool.
+func (h Handlers) FlushMempool(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	removed := h.State.FlushMempool()
+	h.audit(ctx, r, "mempool.flush", "", nil)
+
+	resp := struct {
+		Removed int `json:"removed"`
+	}{
+		Removed: removed,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// AddPeer adds a peer to the known peer list. The peer completes the
+// handshake the next time the node contacts it.
+func (h Handlers) AddPeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req peerRequest
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(req); err != nil {
+		h.audit(ctx, r, "peer.add", req.Host, err)
+		return fmt.Errorf("validating payload: %w", err)
+	}
+
+	var err error
+	if h.State.IsPeerBanned(req.Host) {
+		err = fmt.Errorf("peer %q is banned", req.Host)
+	}
+	h.audit(ctx, r, "peer.add", req.Host, err)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	status := http.StatusOK
+	if h.State.AddKnownPeer(peer.New(req.Host)) {
+		status = http.StatusCreated
+	}
+
+	return web.Respond(ctx, w, peer.New(req.Host), status)
+}
+
+// RemovePeer removes a peer from the known peer list.
+func (h Handlers) RemovePeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	host := web.Param(r, "host")
+
+	var err error
+	if _, exists := h.State.KnownPeer(host); !exists {
+		err = fmt.Errorf("peer %q is not known", host)
+	}
+	h.audit(ctx, r, "peer.remove", host, err)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusNotFound)
+	}
+
+	h.State.RemoveKnownPeer(peer.New(host))
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// UnpinPeer clears the identity public key a peer is bound to so the host
+// can complete a handshake with a new key.
+func (h Handlers) UnpinPeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	host := web.Param(r, "host")
+
+	var err error
+	if !h.State.UnpinPeer(host) {
+		err = fmt.Errorf("peer %q is not known", host)
+	}
+	h.audit(ctx, r, "peer.unpin", host, err)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusNotFound)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// BanPeer bans a peer for the requested duration.
+func (h Handlers) BanPeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	host := web.Param(r, "host")
+
+	var req banRequest
+	if r.ContentLength != 0 {
+		if err := web.Decode(r, &req); err != nil {
+			return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+		}
+	}
+
+	duration := defaultBanDuration
+	var err error
+	if req.Duration != "" {
+		duration, err = time.ParseDuration(req.Duration)
+		if err == nil && duration <= 0 {
+			err = errors.New("duration must be positive")
+		}
+	}
+	h.audit(ctx, r, "peer.ban", host, err)
+	if err != nil {
+		return errs.NewTrusted(fmt.Errorf("invalid duration: %w", err), http.StatusBadRequest)
+	}
+
+	h.State.BanPeer(host, duration)
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// UnbanPeer lifts the ban on a peer.
+func (h Handlers) UnbanPeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	host := web.Param(r, "host")
+
+	h.State.UnbanPeer(host)
+	h.audit(ctx, r, "peer.unban", host, nil)
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
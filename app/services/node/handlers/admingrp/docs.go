@@ -0,0 +1,133 @@
+package admingrp
+
+import (
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+)
+
+// SchemeAdminToken is the name of the security scheme for the admin token.
+const SchemeAdminToken = "adminToken"
+
+// SecuritySchemes returns the way the operator provides credentials, keyed
+// by the name of the security scheme.
+func SecuritySchemes() map[string]openapi.SecurityScheme {
+	return map[string]openapi.SecurityScheme{
+		SchemeAdminToken: {
+			Type:        "http",
+			Description: "Admin token the node is configured with.",
+			Scheme:      "bearer",
+		},
+	}
+}
+
+// Operations describes the admin routes for the OpenAPI document, keyed by
+// the method and path of the route.
+func Operations() map[string]openapi.Operation {
+	notFound := map[string]openapi.Response{
+		"404": {Description: "Not found."},
+	}
+
+	ops := map[string]openapi.Operation{
+		"GET /v1/admin/mining": {
+			Summary:  "Get the mining status",
+			Response: mining{},
+		},
+		"PUT /v1/admin/mining": {
+			Summary:  "Pause or resume mining",
+			Request:  miningRequest{},
+			Response: mining{},
+		},
+		"PUT /v1/admin/beneficiary": {
+			Summary:  "Change the account that receives the mining rewards",
+			Request:  beneficiaryRequest{},
+			Response: mining{},
+		},
+		"POST /v1/admin/reorganize": {
+			Summary:     "Reset the blockchain and resync it from the peers",
+			Description: "The resync runs in the background.",
+			Status:      http.StatusAccepted,
+		},
+		"DELETE /v1/admin/mempool": {
+			Summary: "Remove every transaction from the mempool",
+			Response: struct {
+				Removed int `json:"removed"`
+			}{},
+		},
+		"DELETE /v1/admin/mempool/:hash": {
+			Summary:   "Remove a transaction from the mempool",
+			Response:  database.BlockTx{},
+			Responses: notFound,
+		},
+		"POST /v1/admin/peers": {
+			Summary:     "Add a peer to the known peer list",
+			Description: "Responds with 201 when the peer wasn't known.",
+			Request:     peerRequest{},
+			Response:    peer.Peer{},
+		},
+		"DELETE /v1/admin/peers/:host": {
+			Summary:   "Remove a peer from the known peer list",
+			Status:    http.StatusNoContent,
+			Responses: notFound,
+		},
+		"DELETE /v1/admin/peers/:host/key": {
+			Summary:     "Unpin the identity key of a peer",
+			Description: "A host is bound to the identity key of its first handshake. Unpinning lets the next handshake from the host bind a new key.",
+			Status:      http.StatusNoContent,
+			Responses:   notFound,
+		},
+		"PUT /v1/admin/peers/:host/ban": {
+			Summary: "Ban a peer",
+			RequestBody: &openapi.RequestBody{
+				Description: "The duration defaults to 24h when there is no body.",
+			},
+			Request: banRequest{},
+			Status:  http.StatusNoContent,
+		},
+		"DELETE /v1/admin/peers/:host/ban": {
+			Summary: "Lift the ban on a peer",
+			Status:  http.StatusNoContent,
+		},
+		"GET /v1/admin/webhooks": {
+			Summary:  "List the webhooks",
+			Response: []webhook.Hook{},
+		},
+		"POST /v1/admin/webhooks": {
+			Summary:  "Register a webhook or replace the webhook with the same id",
+			Request:  webhook.Hook{},
+			Response: webhook.Hook{},
+			Status:   http.StatusCreated,
+		},
+		"DELETE /v1/admin/webhooks/:id": {
+			Summary:   "Remove a webhook",
+			Status:    http.StatusNoContent,
+			Responses: notFound,
+		},
+		"GET /v1/admin/webhooks/pending": {
+			Summary:  "List the deliveries waiting to be delivered",
+			Response: []webhook.Delivery{},
+		},
+		"GET /v1/admin/webhooks/deadletters": {
+			Summary:  "List the deliveries that failed too many times",
+			Response: []webhook.Delivery{},
+		},
+		"POST /v1/admin/tokens": {
+			Summary:     "Issue a token for a client of the public API",
+			Description: "The ttl is in the format accepted by time.ParseDuration and defaults to 24h.",
+			Request:     tokenRequest{},
+			Response:    token{},
+			Status:      http.StatusCreated,
+		},
+	}
+
+	for key, op := range ops {
+		op.Tags = []string{"admin"}
+		op.Security = []openapi.SecurityRequirement{{SchemeAdminToken: {}}}
+		ops[key] = op
+	}
+
+	return ops
+}
@@ -0,0 +1,58 @@
+package admingrp
+
+import (
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/mid"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
+	"github.com/ardanlabs/blockchain/foundation/events"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"go.uber.org/zap"
+)
+
+// Config contains all the mandatory systems required by handlers.
+type Config struct {
+	Log      *zap.SugaredLogger
+	State    *state.State
+	Evts     *events.Events
+	Webhooks *webhook.Dispatcher
+	Auth     *auth.Auth
+	Token    string
+}
+
+// Routes binds all the admin routes. Every route requires the admin token.
+func Routes(app *web.App, cfg Config) {
+	adm := Handlers{
+		Log:      cfg.Log,
+		State:    cfg.State,
+		Evts:     cfg.Evts,
+		Webhooks: cfg.Webhooks,
+		Auth:     cfg.Auth,
+	}
+
+	const version = "v1"
+
+	auth := mid.AdminAuth(cfg.Token)
+
+	app.Handle(http.MethodGet, version, "/admin/mining", adm.Mining, auth)
+	app.Handle(http.MethodPut, version, "/admin/mining", adm.SetMining, auth)
+	app.Handle(http.MethodPut, version, "/admin/beneficiary", adm.SetBeneficiary, auth)
+	app.Handle(http.MethodPost, version, "/admin/reorganize", adm.Reorganize, auth)
+	app.Handle(http.MethodDelete, version, "/admin/mempool", adm.FlushMempool, auth)
+	app.Handle(http.MethodDelete, version, "/admin/mempool/:hash", adm.EvictTx, auth)
+	app.Handle(http.MethodPost, version, "/admin/peers", adm.AddPeer, auth)
+	app.Handle(http.MethodDelete, version, "/admin/peers/:host", adm.RemovePeer, auth)
+	app.Handle(http.MethodDelete, version, "/admin/peers/:host/key", adm.UnpinPeer, auth)
+	app.Handle(http.MethodPut, version, "/admin/peers/:host/ban", adm.BanPeer, auth)
+	app.Handle(http.MethodDelete, version, "/admin/peers/:host/ban", adm.UnbanPeer, auth)
+
+	app.Handle(http.MethodGet, version, "/admin/webhooks", adm.ListWebhooks, auth)
+	app.Handle(http.MethodPost, version, "/admin/webhooks", adm.AddWebhook, auth)
+	app.Handle(http.MethodDelete, version, "/admin/webhooks/:id", adm.RemoveWebhook, auth)
+	app.Handle(http.MethodGet, version, "/admin/webhooks/pending", adm.PendingWebhooks, auth)
+	app.Handle(http.MethodGet, version, "/admin/webhooks/deadletters", adm.DeadLetters, auth)
+
+	app.Handle(http.MethodPost, version, "/admin/tokens", adm.IssueToken, auth)
+}
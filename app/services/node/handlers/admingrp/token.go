@@ -0,0 +1,61 @@
+package admingrp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ardanlabs/blockchain/business/sys/validate"
+	"github.com/ardanlabs/blockchain/business/web/errs"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// defaultTokenTTL is used when a token request doesn't specify a ttl.
+const defaultTokenTTL = 24 * time.Hour
+
+// tokenRequest represents a request to issue a token for a client of the
+// public API. The ttl is in the format accepted by time.ParseDuration.
+type tokenRequest struct {
+	Subject string   `json:"subject" validate:"required"`
+	Scopes  []string `json:"scopes" validate:"required,min=1"`
+	TTL     string   `json:"ttl"`
+}
+
+// token represents a token issued for a client of the public API.
+type token struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IssueToken produces a JWT for a client of the public API. This requires
+// the node to be configured with a JWT secret.
+func (h Handlers) IssueToken(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req tokenRequest
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(req); err != nil {
+		h.audit(ctx, r, "token.issue", req.Subject, err)
+		return fmt.Errorf("validating payload: %w", err)
+	}
+
+	ttl := defaultTokenTTL
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			return errs.NewTrusted(fmt.Errorf("invalid ttl %q", req.TTL), http.StatusBadRequest)
+		}
+	}
+
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+
+	tkn, err := h.Auth.GenerateToken(req.Subject, req.Scopes, ttl)
+	h.audit(ctx, r, "token.issue", req.Subject, err)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, token{Token: tkn, ExpiresAt: expiresAt}, http.StatusCreated)
+}
@@ -3,31 +3,91 @@ package checkgrp
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"go.uber.org/zap"
 )
 
+// The set of checks performed for readiness.
+const (
+	checkSync    = "sync"
+	checkLag     = "lag"
+	checkPeers   = "peers"
+	checkStorage = "storage"
+)
+
 // Handlers manages the set of check endpoints.
 type Handlers struct {
 	Build string
 	Log   *zap.SugaredLogger
+	State *state.State
+
+	// MaxSyncLag is the number of blocks the node can be behind its best
+	// peer and still be ready.
+	MaxSyncLag uint64
+
+	// MinPeers is the number of reachable peers required to be ready.
+	MinPeers int
 }
 
-// Readiness checks if the database is ready and if not will return a 500 status.
-// Do not respond by just returning an error because further up in the call
-// stack it will interpret that as a non-trusted error.
+// reason represents a check that failed and why.
+type reason struct {
+	Check  string `json:"check"`
+	Reason string `json:"reason"`
+}
+
+// Readiness checks if the node is ready to serve requests and if not will
+// return a 500 status. The node is not ready while the blockchain is being
+// resynced, when it's too far behind its best peer, when there are not
+// enough reachable peers or when blocks can't be written to storage. Do not
+// respond by just returning an error because further up in the call stack
+// it will interpret that as a non-trusted error.
 func (h Handlers) Readiness(w http.ResponseWriter, r *http.Request) {
 	status := "ok"
 	statusCode := http.StatusOK
 
-	// TODO: NOT SURE WHAT TO DO RIGHT NOW
+	height := h.State.LatestBlock().Header.Number
+	best := h.State.BestPeerHeight()
+	peers := h.State.ReachablePeers()
+
+	reasons := []reason{}
+
+	if h.State.IsSyncing() {
+		reasons = append(reasons, reason{Check: checkSync, Reason: "blockchain is being resynced from peers"})
+	}
+
+	if best > height && best-height > h.MaxSyncLag {
+		reasons = append(reasons, reason{Check: checkLag, Reason: fmt.Sprintf("%d blocks behind the best peer, max %d", best-height, h.MaxSyncLag)})
+	}
+
+	if peers < h.MinPeers {
+		reasons = append(reasons, reason{Check: checkPeers, Reason: fmt.Sprintf("%d reachable peers, min %d", peers, h.MinPeers)})
+	}
+
+	if err := h.State.CheckStorage(); err != nil {
+		reasons = append(reasons, reason{Check: checkStorage, Reason: err.Error()})
+	}
+
+	if len(reasons) > 0 {
+		status = "not ready"
+		statusCode = http.StatusInternalServerError
+	}
 
 	data := struct {
-		Status string `json:"status"`
+		Status         string   `json:"status"`
+		Height         uint64   `json:"height"`
+		BestPeerHeight uint64   `json:"best_peer_height"`
+		Peers          int      `json:"peers"`
+		Reasons        []reason `json:"reasons"`
 	}{
-		Status: status,
+		Status:         status,
+		Height:         height,
+		BestPeerHeight: best,
+		Peers:          peers,
+		Reasons:        reasons,
 	}
 
 	if err := response(w, statusCode, data); err != nil {
@@ -0,0 +1,50 @@
+package graphqlgrp
+
+import (
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+)
+
+// Operations describes the GraphQL routes for the OpenAPI document, keyed by
+// the method and path of the route.
+func Operations() map[string]openapi.Operation {
+	const description = "Errors in the query are reported in the GraphQL response."
+
+	ops := map[string]openapi.Operation{
+		"GET /v1/graphql": auth.Describe(auth.ScopeRead, openapi.Operation{
+			Summary:     "Execute a GraphQL query from the query string",
+			Description: description,
+			Parameters: []openapi.Parameter{
+				{Name: "query", In: openapi.InQuery, Required: true, Schema: &openapi.Schema{Type: "string"}},
+				{Name: "operationName", In: openapi.InQuery, Schema: &openapi.Schema{Type: "string"}},
+				{Name: "variables", In: openapi.InQuery, Description: "JSON object with the values of the variables.", Schema: &openapi.Schema{Type: "string"}},
+			},
+			Response: graphql.Response{},
+		}),
+		"POST /v1/graphql": auth.Describe(auth.ScopeRead, openapi.Operation{
+			Summary:     "Execute a GraphQL query",
+			Description: description,
+			Request:     graphql.Request{},
+			Response:    graphql.Response{},
+		}),
+		"GET /v1/graphql/schema": auth.Describe(auth.ScopeRead, openapi.Operation{
+			Summary: "Get the schema in the GraphQL schema definition language",
+			Responses: map[string]openapi.Response{
+				"200": {
+					Description: "The schema.",
+					Content: map[string]openapi.MediaType{
+						"text/plain": {Schema: &openapi.Schema{Type: "string"}},
+					},
+				},
+			},
+		}),
+	}
+
+	for key, op := range ops {
+		op.Tags = []string{"graphql"}
+		ops[key] = op
+	}
+
+	return ops
+}
@@ -0,0 +1,95 @@
+// Package graphqlgrp maintains the group of handlers for the GraphQL API.
+package graphqlgrp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"go.uber.org/zap"
+)
+
+// maxBodySize is the largest request a client can post.
+const maxBodySize = 1 << 20
+
+// Handlers manages the set of GraphQL endpoints.
+type Handlers struct {
+	Log    *zap.SugaredLogger
+	Schema *graphql.Schema
+}
+
+// Query executes a GraphQL query. A query can be posted as JSON or provided
+// in the query string of a GET request. Errors in the query are reported in
+// the GraphQL response.
+func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req graphql.Request
+
+	switch r.Method {
+	case http.MethodGet:
+		qs := r.URL.Query()
+		req.Query = qs.Get("query")
+		req.OperationName = qs.Get("operationName")
+
+		if vars := qs.Get("variables"); vars != "" {
+			if err := decode([]byte(vars), &req.Variables); err != nil {
+				return web.Respond(ctx, w, errorResponse("variables: %s", err), http.StatusBadRequest)
+			}
+		}
+
+	default:
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("unable to read payload: %w", err)
+		}
+
+		if err := decode(body, &req); err != nil {
+			return web.Respond(ctx, w, errorResponse("unable to decode payload: %s", err), http.StatusBadRequest)
+		}
+	}
+
+	if req.Query == "" {
+		return web.Respond(ctx, w, errorResponse("query is required"), http.StatusBadRequest)
+	}
+
+	resp := h.Schema.Execute(ctx, req)
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// SDL returns the schema in the GraphQL schema definition language.
+func (h Handlers) SDL(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	web.SetStatusCode(ctx, http.StatusOK)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.WriteString(w, h.Schema.SDL()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// decode unmarshals the JSON, keeping numbers as json.Number so large
+// values aren't rounded.
+func decode(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
+
+// errorResponse constructs a GraphQL response for a request that can't be
+// executed.
+func errorResponse(format string, args ...any) graphql.Response {
+	return graphql.Response{
+		Errors: []*graphql.Error{{Message: fmt.Sprintf(format, args...)}},
+	}
+}
@@ -0,0 +1,45 @@
+package graphqlgrp
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/mid"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/nameservice"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"go.uber.org/zap"
+)
+
+// Config contains all the mandatory systems required by handlers.
+type Config struct {
+	Log   *zap.SugaredLogger
+	State *state.State
+	NS    *nameservice.NameService
+}
+
+// Routes binds all the GraphQL routes.
+func Routes(app *web.App, cfg Config) {
+
+	// The schema is fixed, so failing to build it is a bug that needs to
+	// stop the node on startup.
+	schema, err := newSchema(cfg.State, cfg.NS)
+	if err != nil {
+		panic(fmt.Sprintf("graphql schema: %s", err))
+	}
+
+	gql := Handlers{
+		Log:    cfg.Log,
+		Schema: schema,
+	}
+
+	const version = "v1"
+
+	// The schema only has queries so reading is all that's required.
+	read := mid.Scope(auth.ScopeRead)
+
+	app.Handle(http.MethodGet, version, "/graphql", gql.Query, read)
+	app.Handle(http.MethodPost, version, "/graphql", gql.Query, read)
+	app.Handle(http.MethodGet, version, "/graphql/schema", gql.SDL, read)
+}
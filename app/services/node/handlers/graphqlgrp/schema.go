@@ -0,0 +1,784 @@
+package graphqlgrp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+	"github.com/ardanlabs/blockchain/foundation/nameservice"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Limits on the size of a page.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// uint64Type represents the unsigned 64 bit values used for balances, block
+// numbers and timestamps, which don't fit in a GraphQL Int.
+var uint64Type = &graphql.Scalar{
+	Name:        "Uint64",
+	Description: "An unsigned 64-bit integer. Values can be provided as a number or a decimal string.",
+	Serialize: func(v any) (any, error) {
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return rv.Uint(), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if rv.Int() >= 0 {
+				return uint64(rv.Int()), nil
+			}
+		}
+		return nil, fmt.Errorf("Uint64 cannot represent value: %v", v)
+	},
+	Parse: func(v any) (any, error) {
+		switch v := v.(type) {
+		case int64:
+			if v >= 0 {
+				return uint64(v), nil
+			}
+		case float64:
+			if v >= 0 && v == math.Trunc(v) && v < math.MaxUint64 {
+				return uint64(v), nil
+			}
+		case json.Number:
+			return strconv.ParseUint(v.String(), 10, 64)
+		case string:
+			return strconv.ParseUint(v, 10, 64)
+		}
+		return nil, fmt.Errorf("Uint64 cannot represent value: %v", v)
+	},
+}
+
+// pageInfoType describes where a page sits within the full list.
+var pageInfoType = &graphql.Object{
+	Name:        "PageInfo",
+	Description: "Information about a page of results.",
+	Fields: graphql.Fields{
+		"hasNextPage":     {Type: graphql.NonNullOf(graphql.Boolean)},
+		"hasPreviousPage": {Type: graphql.NonNullOf(graphql.Boolean)},
+		"startCursor":     {Type: graphql.String},
+		"endCursor":       {Type: graphql.String},
+	},
+}
+
+// =============================================================================
+
+// txSource is the value a Transaction resolves from. A transaction in the
+// mempool has no block.
+type txSource struct {
+	tx    database.BlockTx
+	block *database.Block
+	index int
+}
+
+// edge is a node in a page with the cursor that identifies its position.
+type edge struct {
+	cursor string
+	node   any
+}
+
+// connection is a page of results. The total is only calculated when the
+// client asks for it. The end cursor is set when the next page starts after
+// a position other than the last edge.
+type connection struct {
+	edges     []edge
+	hasNext   bool
+	hasPrev   bool
+	endCursor string
+	total     func() (int, error)
+}
+
+// page holds the pagination arguments for a connection.
+type page struct {
+	first int
+	after string
+}
+
+// =============================================================================
+
+// schema builds the types and resolvers over the state of the node.
+type schema struct {
+	state *state.State
+	ns    *nameservice.NameService
+}
+
+// newSchema constructs the GraphQL schema for the node.
+func newSchema(st *state.State, ns *nameservice.NameService) (*graphql.Schema, error) {
+	s := schema{
+		state: st,
+		ns:    ns,
+	}
+
+	blockType := &graphql.Object{Name: "Block", Description: "A block in the chain."}
+	txType := &graphql.Object{Name: "Transaction", Description: "A transaction in a block or in the mempool."}
+	accountType := &graphql.Object{Name: "Account", Description: "An account and its balance."}
+
+	blockConn := connectionType("Block", blockType)
+	txConn := connectionType("Transaction", txType)
+	accountConn := connectionType("Account", accountType)
+
+	blockType.Fields = s.blockFields(txConn)
+	txType.Fields = s.txFields(blockType)
+	accountType.Fields = s.accountFields()
+
+	query := graphql.Object{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"block": {
+				Description: "Returns the block with the number or hash, or the latest block if neither is provided.",
+				Type:        blockType,
+				Args: graphql.Args{
+					"number": {Type: uint64Type},
+					"hash":   {Type: graphql.String},
+				},
+				Resolve: s.block,
+			},
+			"blocks": {
+				Description: "Returns a page of blocks in ascending order, optionally limited to a range of numbers and to blocks with transactions for an account. A page for an account can hold fewer blocks than asked for, continue from the endCursor while hasNextPage is true.",
+				Type:        graphql.NonNullOf(blockConn),
+				Args: pageArgs(graphql.Args{
+					"account": {Type: graphql.String},
+					"from":    {Type: uint64Type},
+					"to":      {Type: uint64Type},
+				}),
+				Resolve: s.blocks,
+			},
+			"transaction": {
+				Description: "Returns the transaction with the hash from the mempool or the chain.",
+				Type:        txType,
+				Args: graphql.Args{
+					"hash": {Type: graphql.NonNullOf(graphql.String)},
+				},
+				Resolve: s.transaction,
+			},
+			"account": {
+				Description: "Returns the account with the id.",
+				Type:        accountType,
+				Args: graphql.Args{
+					"id": {Type: graphql.NonNullOf(graphql.String)},
+				},
+				Resolve: s.account,
+			},
+			"accounts": {
+				Description: "Returns a page of accounts ordered by id.",
+				Type:        graphql.NonNullOf(accountConn),
+				Args:        pageArgs(nil),
+				Resolve:     s.accounts,
+			},
+			"mempool": {
+				Description: "Returns a page of the uncommitted transactions, optionally limited to an account.",
+				Type:        graphql.NonNullOf(txConn),
+				Args: pageArgs(graphql.Args{
+					"account": {Type: graphql.String},
+				}),
+				Resolve: s.mempool,
+			},
+		},
+	}
+
+	return graphql.NewSchema(&query)
+}
+
+// blockFields returns the fields of the Block type.
+func (s schema) blockFields(txConn *graphql.Object) graphql.Fields {
+	header := func(fn func(h database.BlockHeader) any) graphql.ResolveFunc {
+		return func(p graphql.ResolveParams) (any, error) {
+			return fn(p.Source.(database.Block).Header), nil
+		}
+	}
+
+	return graphql.Fields{
+		"number":        {Type: graphql.NonNullOf(uint64Type), Resolve: header(func(h database.BlockHeader) any { return h.Number })},
+		"prevBlockHash": {Type: graphql.NonNullOf(graphql.String), Resolve: header(func(h database.BlockHeader) any { return h.PrevBlockHash })},
+		"timestamp":     {Type: graphql.NonNullOf(uint64Type), Resolve: header(func(h database.BlockHeader) any { return h.TimeStamp })},
+		"beneficiary":   {Type: graphql.NonNullOf(graphql.String), Resolve: header(func(h database.BlockHeader) any { return h.BeneficiaryID })},
+		"difficulty":    {Type: graphql.NonNullOf(graphql.Int), Resolve: header(func(h database.BlockHeader) any { return h.Difficulty })},
+		"miningReward":  {Type: graphql.NonNullOf(uint64Type), Resolve: header(func(h database.BlockHeader) any { return h.MiningReward })},
+		"stateRoot":     {Type: graphql.NonNullOf(graphql.String), Resolve: header(func(h database.BlockHeader) any { return h.StateRoot })},
+		"transRoot":     {Type: graphql.NonNullOf(graphql.String), Resolve: header(func(h database.BlockHeader) any { return h.TransRoot })},
+		"nonce":         {Type: graphql.NonNullOf(uint64Type), Resolve: header(func(h database.BlockHeader) any { return h.Nonce })},
+		"hash": {
+			Type: graphql.NonNullOf(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(database.Block).Hash(), nil
+			},
+		},
+		"transactionCount": {
+			Type: graphql.NonNullOf(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return len(p.Source.(database.Block).MerkleTree.Values()), nil
+			},
+		},
+		"transactions": {
+			Description: "Returns a page of the transactions in the block.",
+			Type:        graphql.NonNullOf(txConn),
+			Args:        pageArgs(nil),
+			Resolve:     s.blockTransactions,
+		},
+	}
+}
+
+// txFields returns the fields of the Transaction type.
+func (s schema) txFields(blockType *graphql.Object) graphql.Fields {
+	tx := func(fn func(tx database.BlockTx) any) graphql.ResolveFunc {
+		return func(p graphql.ResolveParams) (any, error) {
+			return fn(p.Source.(txSource).tx), nil
+		}
+	}
+
+	return graphql.Fields{
+		"hash":      {Type: graphql.NonNullOf(graphql.String), Resolve: tx(func(tx database.BlockTx) any { return tx.HashHex() })},
+		"from":      {Type: graphql.NonNullOf(graphql.String), Resolve: tx(func(tx database.BlockTx) any { return tx.FromID })},
+		"fromName":  {Type: graphql.NonNullOf(graphql.String), Resolve: tx(func(tx database.BlockTx) any { return s.ns.Lookup(tx.FromID) })},
+		"to":        {Type: graphql.NonNullOf(graphql.String), Resolve: tx(func(tx database.BlockTx) any { return tx.ToID })},
+		"toName":    {Type: graphql.NonNullOf(graphql.String), Resolve: tx(func(tx database.BlockTx) any { return s.ns.Lookup(tx.ToID) })},
+		"chainId":   {Type: graphql.NonNullOf(graphql.Int), Resolve: tx(func(tx database.BlockTx) any { return tx.ChainID })},
+		"nonce":     {Type: graphql.NonNullOf(uint64Type), Resolve: tx(func(tx database.BlockTx) any { return tx.Nonce })},
+		"value":     {Type: graphql.NonNullOf(uint64Type), Resolve: tx(func(tx database.BlockTx) any { return tx.Value })},
+		"tip":       {Type: graphql.NonNullOf(uint64Type), Resolve: tx(func(tx database.BlockTx) any { return tx.Tip })},
+		"data":      {Type: graphql.NonNullOf(graphql.String), Resolve: tx(func(tx database.BlockTx) any { return hexutil.Encode(tx.Data) })},
+		"timestamp": {Type: graphql.NonNullOf(uint64Type), Resolve: tx(func(tx database.BlockTx) any { return tx.TimeStamp })},
+		"gasPrice":  {Type: graphql.NonNullOf(uint64Type), Resolve: tx(func(tx database.BlockTx) any { return tx.GasPrice })},
+		"gasUnits":  {Type: graphql.NonNullOf(uint64Type), Resolve: tx(func(tx database.BlockTx) any { return tx.GasUnits })},
+		"signature": {Type: graphql.NonNullOf(graphql.String), Resolve: tx(func(tx database.BlockTx) any { return tx.SignatureString() })},
+		"block": {
+			Description: "The block holding the transaction, null while it's in the mempool.",
+			Type:        blockType,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				src := p.Source.(txSource)
+				if src.block == nil {
+					return nil, nil
+				}
+				return *src.block, nil
+			},
+		},
+		"index": {
+			Description: "The position of the transaction in its block.",
+			Type:        graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				src := p.Source.(txSource)
+				if src.block == nil {
+					return nil, nil
+				}
+				return src.index, nil
+			},
+		},
+		"proof": {
+			Description: "The Merkle proof the transaction is in its block. It's only calculated when selected.",
+			Type:        graphql.ListOf(graphql.NonNullOf(graphql.String)),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				proof, _, err := merkleProof(p.Source.(txSource))
+				return proof, err
+			},
+		},
+		"proofOrder": {
+			Description: "The order to apply the hashes of the Merkle proof.",
+			Type:        graphql.ListOf(graphql.NonNullOf(graphql.Int)),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				_, order, err := merkleProof(p.Source.(txSource))
+				return order, err
+			},
+		},
+	}
+}
+
+// accountFields returns the fields of the Account type.
+func (s schema) accountFields() graphql.Fields {
+	return graphql.Fields{
+		"id": {Type: graphql.NonNullOf(graphql.String)},
+		"name": {
+			Type: graphql.NonNullOf(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return s.ns.Lookup(database.AccountID(p.Source.(map[string]any)["id"].(string))), nil
+			},
+		},
+		"balance": {Type: graphql.NonNullOf(uint64Type)},
+		"nonce":   {Type: graphql.NonNullOf(uint64Type)},
+	}
+}
+
+// =============================================================================
+
+// block resolves a single block by number or hash.
+func (s schema) block(p graphql.ResolveParams) (any, error) {
+	if hash, ok := p.Args["hash"].(string); ok {
+		block, err := s.state.QueryBlockByHash(hash)
+		if err != nil {
+			if errors.Is(err, state.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return block, nil
+	}
+
+	number, ok := p.Args["number"].(uint64)
+	if !ok {
+		latest := s.state.LatestBlock()
+		if latest.Header.Number == 0 {
+			return nil, nil
+		}
+		return latest, nil
+	}
+
+	if number == 0 || number > s.state.LatestBlock().Header.Number {
+		return nil, nil
+	}
+
+	blocks := s.state.QueryBlocksByNumber(number, number)
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	return blocks[0], nil
+}
+
+// blocks resolves a page of blocks.
+func (s schema) blocks(p graphql.ResolveParams) (any, error) {
+	pg, err := pageFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := s.state.LatestBlock().Header.Number
+
+	from, to := uint64(1), latest
+	if v, ok := p.Args["from"].(uint64); ok && v > from {
+		from = v
+	}
+	if v, ok := p.Args["to"].(uint64); ok && v < to {
+		to = v
+	}
+
+	q := state.BlockQuery{
+		From:  from,
+		To:    to,
+		Limit: max(pg.first, 1),
+	}
+
+	if pg.after != "" {
+		if q.After, err = decodeNumberCursor("block", pg.after); err != nil {
+			return nil, err
+		}
+	}
+
+	if account, ok := p.Args["account"].(string); ok {
+		if q.AccountID, err = database.ToAccountID(account); err != nil {
+			return nil, err
+		}
+	}
+
+	conn := connection{
+		hasPrev: q.After >= from,
+	}
+
+	// The scan for an account is limited per query, so a page can end
+	// early or be empty and the cursor continues where the scan stopped.
+	blocks, next, err := s.state.QueryBlocks(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if pg.first == 0 {
+		conn.hasNext = len(blocks) > 0 || next != 0
+		blocks = nil
+	}
+
+	for _, block := range blocks {
+		conn.edges = append(conn.edges, edge{cursor: encodeCursor("block", strconv.FormatUint(block.Header.Number, 10)), node: block})
+	}
+
+	if next != 0 && pg.first > 0 {
+		conn.hasNext = true
+		conn.endCursor = encodeCursor("block", strconv.FormatUint(next, 10))
+	}
+
+	conn.total = func() (int, error) {
+		if from > to {
+			return 0, nil
+		}
+		if q.AccountID == "" {
+			return int(to - from + 1), nil
+		}
+
+		// Counting the blocks for an account reads every block in the
+		// range, so it's only done for ranges within the scan limit.
+		if to-from >= state.MaxBlocksScanned {
+			return 0, fmt.Errorf("totalCount with an account requires a range of at most %d blocks", state.MaxBlocksScanned)
+		}
+
+		blocks, _, err := s.state.QueryBlocks(state.BlockQuery{AccountID: q.AccountID, From: from, To: to})
+		if err != nil {
+			return 0, err
+		}
+		return len(blocks), nil
+	}
+
+	return conn, nil
+}
+
+// blockTransactions resolves a page of the transactions in a block.
+func (s schema) blockTransactions(p graphql.ResolveParams) (any, error) {
+	pg, err := pageFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	block := p.Source.(database.Block)
+	values := block.MerkleTree.Values()
+
+	start := 0
+	if pg.after != "" {
+		index, err := decodeNumberCursor("blocktx", pg.after)
+		if err != nil {
+			return nil, err
+		}
+		start = int(index) + 1
+	}
+
+	end := min(start+pg.first, len(values))
+	start = min(start, end)
+
+	conn := connection{
+		hasNext: end < len(values),
+		hasPrev: start > 0,
+		total:   func() (int, error) { return len(values), nil },
+	}
+
+	for i := start; i < end; i++ {
+		conn.edges = append(conn.edges, edge{
+			cursor: encodeCursor("blocktx", strconv.Itoa(i)),
+			node:   txSource{tx: values[i], block: &block, index: i},
+		})
+	}
+
+	return conn, nil
+}
+
+// transaction resolves a transaction by hash.
+func (s schema) transaction(p graphql.ResolveParams) (any, error) {
+	hash := p.Args["hash"].(string)
+
+	tx, block, err := s.state.QueryTransaction(hash)
+	if err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if block.Header.Number == 0 {
+		return txSource{tx: tx}, nil
+	}
+
+	for i, btx := range block.MerkleTree.Values() {
+		if btx.HashHex() == hash {
+			return txSource{tx: tx, block: &block, index: i}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("transaction %s not found in block %d", hash, block.Header.Number)
+}
+
+// account resolves an account by id.
+func (s schema) account(p graphql.ResolveParams) (any, error) {
+	accountID, err := database.ToAccountID(p.Args["id"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := s.state.QueryAccount(accountID)
+	if err != nil {
+		return nil, nil
+	}
+
+	return accountSource(accountID, account), nil
+}
+
+// accounts resolves a page of accounts ordered by id.
+func (s schema) accounts(p graphql.ResolveParams) (any, error) {
+	pg, err := pageFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := s.state.Accounts()
+
+	ids := make([]string, 0, len(accounts))
+	for id := range accounts {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	start := 0
+	if pg.after != "" {
+		after, err := decodeCursor("account", pg.after)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(ids), func(i int) bool { return ids[i] > after })
+	}
+
+	end := min(start+pg.first, len(ids))
+
+	conn := connection{
+		hasNext: end < len(ids),
+		hasPrev: start > 0,
+		total:   func() (int, error) { return len(ids), nil },
+	}
+
+	for _, id := range ids[start:end] {
+		accountID := database.AccountID(id)
+		conn.edges = append(conn.edges, edge{
+			cursor: encodeCursor("account", id),
+			node:   accountSource(accountID, accounts[accountID]),
+		})
+	}
+
+	return conn, nil
+}
+
+// mempool resolves a page of the uncommitted transactions.
+func (s schema) mempool(p graphql.ResolveParams) (any, error) {
+	pg, err := pageFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	var accountID database.AccountID
+	if account, ok := p.Args["account"].(string); ok {
+		if accountID, err = database.ToAccountID(account); err != nil {
+			return nil, err
+		}
+	}
+
+	var trans []database.BlockTx
+	for _, tx := range s.state.Mempool() {
+		if accountID != "" && tx.FromID != accountID && tx.ToID != accountID {
+			continue
+		}
+		trans = append(trans, tx)
+	}
+
+	// The order of the mempool changes as transactions come and go, so the
+	// cursor is the hash of the last transaction seen.
+	start := 0
+	if pg.after != "" {
+		hash, err := decodeCursor("mempool", pg.after)
+		if err != nil {
+			return nil, err
+		}
+
+		start = -1
+		for i, tx := range trans {
+			if tx.HashHex() == hash {
+				start = i + 1
+				break
+			}
+		}
+		if start == -1 {
+			return nil, errors.New("cursor refers to a transaction no longer in the mempool")
+		}
+	}
+
+	end := min(start+pg.first, len(trans))
+
+	conn := connection{
+		hasNext: end < len(trans),
+		hasPrev: start > 0,
+		total:   func() (int, error) { return len(trans), nil },
+	}
+
+	for _, tx := range trans[start:end] {
+		conn.edges = append(conn.edges, edge{
+			cursor: encodeCursor("mempool", tx.HashHex()),
+			node:   txSource{tx: tx},
+		})
+	}
+
+	return conn, nil
+}
+
+// =============================================================================
+
+// connectionType constructs the connection and edge types for a node type.
+func connectionType(name string, node *graphql.Object) *graphql.Object {
+	edgeType := &graphql.Object{
+		Name: name + "Edge",
+		Fields: graphql.Fields{
+			"cursor": {
+				Type: graphql.NonNullOf(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(edge).cursor, nil
+				},
+			},
+			"node": {
+				Type: graphql.NonNullOf(node),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(edge).node, nil
+				},
+			},
+		},
+	}
+
+	return &graphql.Object{
+		Name:        name + "Connection",
+		Description: fmt.Sprintf("A page of %s values.", name),
+		Fields: graphql.Fields{
+			"edges": {
+				Type: graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(edgeType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					edges := p.Source.(connection).edges
+					if edges == nil {
+						edges = []edge{}
+					}
+					return edges, nil
+				},
+			},
+			"nodes": {
+				Type: graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(node))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					edges := p.Source.(connection).edges
+					nodes := make([]any, len(edges))
+					for i, e := range edges {
+						nodes[i] = e.node
+					}
+					return nodes, nil
+				},
+			},
+			"pageInfo": {
+				Type: graphql.NonNullOf(pageInfoType),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					conn := p.Source.(connection)
+					info := map[string]any{
+						"hasNextPage":     conn.hasNext,
+						"hasPreviousPage": conn.hasPrev,
+					}
+					if len(conn.edges) > 0 {
+						info["startCursor"] = conn.edges[0].cursor
+						info["endCursor"] = conn.edges[len(conn.edges)-1].cursor
+					}
+					if conn.endCursor != "" {
+						info["endCursor"] = conn.endCursor
+					}
+					return info, nil
+				},
+			},
+			"totalCount": {
+				Description: "The number of values in the full list, which can be expensive to calculate.",
+				Type:        graphql.NonNullOf(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(connection).total()
+				},
+			},
+		},
+	}
+}
+
+// pageArgs adds the pagination arguments to the set of arguments.
+func pageArgs(args graphql.Args) graphql.Args {
+	if args == nil {
+		args = graphql.Args{}
+	}
+
+	args["first"] = &graphql.Argument{
+		Description:  fmt.Sprintf("The number of values to return, at most %d.", maxPageSize),
+		Type:         graphql.Int,
+		DefaultValue: defaultPageSize,
+	}
+	args["after"] = &graphql.Argument{
+		Description: "Returns the values after the cursor.",
+		Type:        graphql.String,
+	}
+
+	return args
+}
+
+// pageFromArgs validates the pagination arguments.
+func pageFromArgs(args map[string]any) (page, error) {
+	first, _ := args["first"].(int)
+	if first < 0 || first > maxPageSize {
+		return page{}, fmt.Errorf("first must be between 0 and %d", maxPageSize)
+	}
+
+	after, _ := args["after"].(string)
+
+	return page{first: first, after: after}, nil
+}
+
+// encodeCursor constructs an opaque cursor for a position in a list.
+func encodeCursor(kind string, value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(kind + ":" + value))
+}
+
+// decodeCursor returns the position held by a cursor of the specified kind.
+func decodeCursor(kind string, cursor string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.New("invalid cursor")
+	}
+
+	value, found := strings.CutPrefix(string(data), kind+":")
+	if !found {
+		return "", errors.New("invalid cursor")
+	}
+
+	return value, nil
+}
+
+// decodeNumberCursor returns the number held by a cursor of the specified
+// kind.
+func decodeNumberCursor(kind string, cursor string) (uint64, error) {
+	value, err := decodeCursor(kind, cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return number, nil
+}
+
+// =============================================================================
+
+// accountSource constructs the value an Account resolves from.
+func accountSource(accountID database.AccountID, account database.Account) map[string]any {
+	return map[string]any{
+		"id":      string(accountID),
+		"balance": account.Balance,
+		"nonce":   account.Nonce,
+	}
+}
+
+// merkleProof calculates the proof the transaction is in its block.
+func merkleProof(src txSource) ([]string, []int64, error) {
+	if src.block == nil {
+		return nil, nil, nil
+	}
+
+	rawProof, order, err := src.block.MerkleTree.Proof(src.tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proof := make([]string, len(rawProof))
+	for i, rp := range rawProof {
+		proof[i] = hexutil.Encode(rp)
+	}
+
+	return proof, order, nil
+}
@@ -0,0 +1,245 @@
+// Package p2pgrp maintains the group of handlers for node to node access
+// over the streaming protocol.
+package p2pgrp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/business/sys/validate"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/p2p"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/trace"
+	"go.uber.org/zap"
+)
+
+// Handlers manages the set of node to node messages.
+type Handlers struct {
+	Log    *zap.SugaredLogger
+	State  *state.State
+	Tracer *trace.Tracer
+}
+
+// Handle processes a request from a peer. The public key is the identity
+// the peer proved when it connected. Each request is handled inside a span
+// that continues the trace of the peer.
+func (h Handlers) Handle(ctx context.Context, publicKey string, typ p2p.MsgType, payload []byte) (resp any, err error) {
+	ctx, span := h.Tracer.Start(ctx, "p2p "+typ.String(), trace.Attr("peer.public_key", publicKey))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	return h.handle(ctx, publicKey, typ, payload)
+}
+
+// handle routes the request to the handler for the message type.
+func (h Handlers) handle(ctx context.Context, publicKey string, typ p2p.MsgType, payload []byte) (any, error) {
+
+	// The handshake is the only message accepted from an unknown identity
+	// since it's how a node becomes known.
+	if typ == p2p.MsgHandshake {
+		return h.handshake(publicKey, payload)
+	}
+
+	if !h.State.IsPeerKey(publicKey) {
+		return nil, identity.ErrUnknownIdentity
+	}
+
+	switch typ {
+	case p2p.MsgStatus:
+		return h.status()
+
+	case p2p.MsgMempool:
+		return h.State.Mempool(), nil
+
+	case p2p.MsgTxAnnounce:
+		return h.txAnnounce(ctx, publicKey, payload)
+
+	case p2p.MsgTxRequest:
+		return h.txRequest(payload)
+
+	case p2p.MsgBlockAnnounce:
+		return h.blockAnnounce(ctx, publicKey, payload)
+
+	case p2p.MsgHeaders:
+		return h.headers(payload)
+
+	case p2p.MsgBodies:
+		return h.bodies(payload)
+
+	case p2p.MsgBlockTxs:
+		return h.blockTxs(payload)
+	}
+
+	return nil, fmt.Errorf("unsupported message type %s", typ)
+}
+
+// =============================================================================
+
+// handshake is called by a node on first contact so it can be added to the
+// known peer list. This node's handshake information is returned.
+func (h Handlers) handshake(publicKey string, payload []byte) (any, error) {
+	var pr peer.Peer
+	if err := json.Unmarshal(payload, &pr); err != nil {
+		return nil, fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := validate.Check(pr); err != nil {
+		return nil, fmt.Errorf("validating payload: %w", err)
+	}
+
+	// The host is bound to the identity of its first handshake, so a handshake
+	// that claims a known host with a different identity is rejected by the
+	// state.
+	if pr.PublicKey != publicKey {
+		return nil, errors.New("handshake public key doesn't match the connection identity")
+	}
+
+	_, known := h.State.KnownPeer(pr.Host)
+
+	if err := h.State.AcceptPeerHandshake(pr); err != nil {
+		h.Log.Infow("rejecting peer", "host", pr.Host, "ERROR", err)
+		return nil, err
+	}
+
+	if !known {
+		h.Log.Infow("adding peer", "host", pr.Host, "version", pr.NodeVersion)
+	}
+
+	return h.State.Handshake(), nil
+}
+
+// status returns the current status of the node.
+func (h Handlers) status() (any, error) {
+	latestBlock := h.State.LatestBlock()
+
+	status := peer.PeerStatus{
+		LatestBlockHash:   latestBlock.Hash(),
+		LatestBlockNumber: latestBlock.Header.Number,
+		KnownPeers:        h.State.KnownExternalPeers(),
+		Scores:            h.State.PeerScores(),
+	}
+
+	return status, nil
+}
+
+// txAnnounce takes a batch of transaction hashes announced by a peer and
+// requests the transactions this node is missing.
+func (h Handlers) txAnnounce(ctx context.Context, publicKey string, payload []byte) (any, error) {
+	var ann peer.TxAnnounce
+	if err := json.Unmarshal(payload, &ann); err != nil {
+		return nil, fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := validate.Check(ann); err != nil {
+		return nil, fmt.Errorf("validating payload: %w", err)
+	}
+
+	return nil, h.State.ProcessTxAnnounce(ctx, publicKey, ann)
+}
+
+// txRequest returns the transactions in the mempool that match the
+// hashes requested by a peer.
+func (h Handlers) txRequest(payload []byte) (any, error) {
+	var req peer.TxRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := validate.Check(req); err != nil {
+		return nil, fmt.Errorf("validating payload: %w", err)
+	}
+
+	txs := h.State.MempoolByHashes(req.Hashes)
+	if txs == nil {
+		txs = []database.BlockTx{}
+	}
+
+	return txs, nil
+}
+
+// blockAnnounce takes a compact block received from a peer, rebuilds the
+// block from the mempool, validates it and if that passes, adds the block
+// to the local blockchain.
+func (h Handlers) blockAnnounce(ctx context.Context, publicKey string, payload []byte) (any, error) {
+	var cb peer.CompactBlock
+	if err := json.Unmarshal(payload, &cb); err != nil {
+		return nil, fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := validate.Check(cb); err != nil {
+		return nil, fmt.Errorf("validating payload: %w", err)
+	}
+
+	if err := h.State.ProcessCompactBlock(ctx, publicKey, cb); err != nil {
+		switch {
+		case errors.Is(err, state.ErrBlockSeen):
+			return nil, nil
+
+		case errors.Is(err, database.ErrChainForked):
+			h.State.Reorganize()
+		}
+
+		return nil, errors.New("block not accepted")
+	}
+
+	return nil, nil
+}
+
+// headers returns the headers of the blocks starting at the requested block
+// number, up to peer.MaxBlocksPerRequest blocks. The peer requests the bodies
+// of the blocks separately.
+func (h Handlers) headers(payload []byte) (any, error) {
+	var req peer.BlocksRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	blocks := h.State.QueryBlocksForPeer(req.From)
+
+	headers := make([]peer.BlockHeader, len(blocks))
+	for i, block := range blocks {
+		headers[i] = peer.BlockHeader{
+			Hash:   block.Hash(),
+			Header: block.Header,
+		}
+	}
+
+	return headers, nil
+}
+
+// bodies returns the transactions of the blocks requested by a peer that
+// has received their headers.
+func (h Handlers) bodies(payload []byte) (any, error) {
+	var req peer.BodiesRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := validate.Check(req); err != nil {
+		return nil, fmt.Errorf("validating payload: %w", err)
+	}
+
+	return h.State.QueryBlockBodies(req.Blocks)
+}
+
+// blockTxs returns the transactions at the positions in a block requested by
+// a peer that is filling in a compact block.
+func (h Handlers) blockTxs(payload []byte) (any, error) {
+	var req peer.BlockTxRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := validate.Check(req); err != nil {
+		return nil, fmt.Errorf("validating payload: %w", err)
+	}
+
+	return h.State.QueryBlockTxs(req.Number, req.Hash, req.Indexes)
+}
@@ -0,0 +1,103 @@
+package private
+
+import (
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+)
+
+// SchemeNodeSignature is the name of the security scheme for requests signed
+// by the identity key of a node.
+const SchemeNodeSignature = "nodeSignature"
+
+// SecuritySchemes returns the way a node provides credentials, keyed by the
+// name of the security scheme.
+func SecuritySchemes() map[string]openapi.SecurityScheme {
+	return map[string]openapi.SecurityScheme{
+		SchemeNodeSignature: {
+			Type: "apiKey",
+			Description: "Signature of the request by the identity key of the node. The public key and the time of the request are sent in the " +
+				identity.HeaderPublicKey + " and " + identity.HeaderTimestamp + " headers.",
+			Name: identity.HeaderSignature,
+			In:   openapi.InHeader,
+		},
+	}
+}
+
+// Operations describes the private routes for the OpenAPI document, keyed by
+// the method and path of the route.
+func Operations() map[string]openapi.Operation {
+	notAccepted := map[string]openapi.Response{
+		"406": {Description: "The block was not accepted."},
+	}
+
+	ops := map[string]openapi.Operation{
+		"POST /v1/node/peers": {
+			Summary:     "Exchange handshake information with a node",
+			Description: "Accepted from an unknown node since it's how a node becomes known. The public key must be the one that signed the request.",
+			Request:     peer.Peer{},
+			Response:    peer.Peer{},
+		},
+		"GET /v1/node/status": {
+			Summary:  "Get the status of the node",
+			Response: peer.PeerStatus{},
+		},
+		"GET /v1/node/block/list/:from/:to": {
+			Summary:     "List the blocks in a range of block numbers",
+			Description: "Either number can be latest. A node that is further behind asks for the next set.",
+			Response:    []database.BlockData{},
+			Responses: map[string]openapi.Response{
+				"204": {Description: "No blocks in the range."},
+			},
+		},
+		"POST /v1/node/block/propose": {
+			Summary:   "Propose a new block",
+			Request:   database.BlockData{},
+			Response:  status{},
+			Responses: notAccepted,
+		},
+		"POST /v1/node/block/compact": {
+			Summary:     "Propose a new block in the compact format",
+			Description: "The block is rebuilt from the transactions in the mempool.",
+			Request:     peer.CompactBlock{},
+			Response:    status{},
+			Responses:   notAccepted,
+		},
+		"POST /v1/node/block/txs": {
+			Summary:  "Get the transactions at positions in a block",
+			Request:  peer.BlockTxRequest{},
+			Response: []database.BlockTx{},
+		},
+		"POST /v1/node/tx/submit": {
+			Summary:  "Submit a transaction received by another node",
+			Request:  database.BlockTx{},
+			Response: status{},
+		},
+		"POST /v1/node/tx/announce": {
+			Summary:     "Announce transaction hashes",
+			Description: "The node requests the transactions it doesn't already have.",
+			Request:     peer.TxAnnounce{},
+			Status:      http.StatusNoContent,
+		},
+		"POST /v1/node/tx/request": {
+			Summary:  "Get the transactions in the mempool that match a set of hashes",
+			Request:  peer.TxRequest{},
+			Response: []database.BlockTx{},
+		},
+		"GET /v1/node/tx/list": {
+			Summary:  "List the transactions in the mempool",
+			Response: []database.BlockTx{},
+		},
+	}
+
+	for key, op := range ops {
+		op.Tags = []string{"private"}
+		op.Security = []openapi.SecurityRequirement{{SchemeNodeSignature: {}}}
+		ops[key] = op
+	}
+
+	return ops
+}
@@ -0,0 +1,5 @@
+package private
+
+type status struct {
+	Status string `json:"status"`
+}
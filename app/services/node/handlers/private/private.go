@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/ardanlabs/blockchain/business/sys/validate"
 	"github.com/ardanlabs/blockchain/business/web/errs"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
@@ -34,25 +36,74 @@ func (h Handlers) SubmitNodeTransaction(ctx context.Context, w http.ResponseWrit
 	// Decode the JSON in the post call into a block transaction.
 	var tx database.BlockTx
 	if err := web.Decode(r, &tx); err != nil {
-		return fmt.Errorf("unable to decode payload: %w", err)
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(tx); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
 	}
 
 	// Ask the state package to add this transaction to the mempool and perform
 	// any other business logic.
 	h.Log.Infow("add tran", "traceid", v.TraceID, "sig:nonce", tx, "fron", tx.FromID, "to", tx.ToID, "value", tx.Value, "tip", tx.Tip)
-	if err := h.State.UpsertNodeTransaction(tx); err != nil {
+	if err := h.State.UpsertNodeTransaction(ctx, tx); err != nil {
 		return errs.NewTrusted(err, http.StatusBadRequest)
 	}
 
-	resp := struct {
-		Status string `json:"status"`
-	}{
+	resp := status{
 		Status: "transactions added to mempool",
 	}
 
 	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
+// AnnounceTxs takes a batch of transaction hashes announced by a peer and
+// requests the transactions this node is missing.
+func (h Handlers) AnnounceTxs(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var ann peer.TxAnnounce
+	if err := web.Decode(r, &ann); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(ann); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
+	}
+
+	publicKey := identity.GetPublicKey(ctx)
+
+	h.Log.Infow("tx announce", "traceid", v.TraceID, "publickey", publicKey, "hashes", len(ann.Hashes))
+	if err := h.State.ProcessTxAnnounce(ctx, publicKey, ann); err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// RequestTxs returns the transactions in the mempool that match the
+// hashes requested by a peer.
+func (h Handlers) RequestTxs(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req peer.TxRequest
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(req); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
+	}
+
+	txs := h.State.MempoolByHashes(req.Hashes)
+	if txs == nil {
+		txs = []database.BlockTx{}
+	}
+
+	return web.Respond(ctx, w, txs, http.StatusOK)
+}
+
 // ProposeBlock takes a block received from a peer, validates it and
 // if that passes, adds the block to the local blockchain.
 func (h Handlers) ProposeBlock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -60,7 +111,11 @@ func (h Handlers) ProposeBlock(ctx context.Context, w http.ResponseWriter, r *ht
 	// Decode the JSON in the post call into a file system block.
 	var blockData database.BlockData
 	if err := web.Decode(r, &blockData); err != nil {
-		return fmt.Errorf("unable to decode payload: %w", err)
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(blockData); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
 	}
 
 	// Convert the block data into a block. This action will create a merkle
@@ -72,40 +127,111 @@ func (h Handlers) ProposeBlock(ctx context.Context, w http.ResponseWriter, r *ht
 
 	// Ask the state package to validate the proposed block. If the block
 	// passes validation, it will be added to the blockchain database.
-	if err := h.State.ProcessProposedBlock(block); err != nil {
-		if errors.Is(err, database.ErrChainForked) {
+	return h.proposeResponse(ctx, w, h.State.ProcessProposedBlock(ctx, block))
+}
+
+// ProposeCompactBlock takes a compact block received from a peer, rebuilds
+// the block from the mempool, validates it and if that passes, adds the block
+// to the local blockchain.
+func (h Handlers) ProposeCompactBlock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+	// Decode the JSON in the post call into a compact block.
+	var cb peer.CompactBlock
+	if err := web.Decode(r, &cb); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(cb); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
+	}
+
+	// Ask the state package to rebuild and validate the proposed block. If
+	// the block passes validation, it will be added to the blockchain database.
+	return h.proposeResponse(ctx, w, h.State.ProcessCompactBlock(ctx, identity.GetPublicKey(ctx), cb))
+}
+
+// BlockTxs returns the transactions at the positions in a block requested by
+// a peer that is filling in a compact block.
+func (h Handlers) BlockTxs(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req peer.BlockTxRequest
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(req); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
+	}
+
+	txs, err := h.State.QueryBlockTxs(req.Number, req.Hash, req.Indexes)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, txs, http.StatusOK)
+}
+
+// proposeResponse responds to a peer based on the result of processing
+// a proposed block.
+func (h Handlers) proposeResponse(ctx context.Context, w http.ResponseWriter, err error) error {
+	if err != nil {
+		switch {
+		case errors.Is(err, state.ErrBlockSeen):
+			resp := status{
+				Status: "already accepted",
+			}
+			return web.Respond(ctx, w, resp, http.StatusOK)
+
+		case errors.Is(err, database.ErrChainForked):
 			h.State.Reorganize()
 		}
 
 		return errs.NewTrusted(errors.New("block not accepted"), http.StatusNotAcceptable)
 	}
 
-	resp := struct {
-		Status string `json:"status"`
-	}{
+	resp := status{
 		Status: "accepted",
 	}
 
 	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
-// SubmitPeer is called by a node so they can be added to the known peer list.
+// SubmitPeer is called by a node on first contact so they can be added to the
+// known peer list. The node provides its handshake information and receives
+// this node's handshake information in return.
 func (h Handlers) SubmitPeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	v, err := web.GetValues(ctx)
 	if err != nil {
 		return web.NewShutdownError("web value missing from context")
 	}
 
-	var peer peer.Peer
-	if err := web.Decode(r, &peer); err != nil {
-		return fmt.Errorf("unable to decode payload: %w", err)
+	var pr peer.Peer
+	if err := web.Decode(r, &pr); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
 	}
 
-	if !h.State.AddKnownPeer(peer) {
-		h.Log.Infow("adding peer", "traceid", v.TraceID, "host", peer.Host)
+	if err := validate.Check(pr); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
 	}
 
-	return web.Respond(ctx, w, nil, http.StatusOK)
+	if pr.PublicKey != identity.GetPublicKey(ctx) {
+		return errs.NewTrusted(errors.New("handshake public key doesn't match the request signature"), http.StatusUnauthorized)
+	}
+
+	_, known := h.State.KnownPeer(pr.Host)
+
+	if err := h.State.AcceptPeerHandshake(pr); err != nil {
+		h.Log.Infow("rejecting peer", "traceid", v.TraceID, "host", pr.Host, "ERROR", err)
+		if errors.Is(err, peer.ErrKeyMismatch) {
+			return errs.NewTrusted(err, http.StatusConflict)
+		}
+		return errs.NewTrusted(err, http.StatusNotAcceptable)
+	}
+
+	if !known {
+		h.Log.Infow("adding peer", "traceid", v.TraceID, "host", pr.Host, "version", pr.NodeVersion)
+	}
+
+	return web.Respond(ctx, w, h.State.Handshake(), http.StatusOK)
 }
 
 // Status returns the current status of the node.
@@ -116,12 +242,14 @@ func (h Handlers) Status(ctx context.Context, w http.ResponseWriter, r *http.Req
 		LatestBlockHash:   latestBlock.Hash(),
 		LatestBlockNumber: latestBlock.Header.Number,
 		KnownPeers:        h.State.KnownExternalPeers(),
+		Scores:            h.State.PeerScores(),
 	}
 
 	return web.Respond(ctx, w, status, http.StatusOK)
 }
 
-// BlocksByNumber returns all the blocks based on the specified to/from values.
+// BlocksByNumber returns the blocks based on the specified to/from values, up
+// to peer.MaxBlocksPerRequest blocks.
 func (h Handlers) BlocksByNumber(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	fromStr := web.Param(r, "from")
 	if fromStr == "latest" || fromStr == "" {
@@ -146,6 +274,17 @@ func (h Handlers) BlocksByNumber(ctx context.Context, w http.ResponseWriter, r *
 		return errs.NewTrusted(errors.New("from greater than to"), http.StatusBadRequest)
 	}
 
+	// Limit the range so a single request can't read the whole chain. A peer
+	// that is further behind asks for the next set.
+	latest := h.State.LatestBlock().Header.Number
+	if from == state.QueryLastest {
+		from = latest
+	}
+	to = min(to, latest)
+	if from <= to && to-from >= peer.MaxBlocksPerRequest {
+		to = from + peer.MaxBlocksPerRequest - 1
+	}
+
 	blocks := h.State.QueryBlocksByNumber(from, to)
 	if len(blocks) == 0 {
 		return web.Respond(ctx, w, nil, http.StatusNoContent)
@@ -2,6 +2,10 @@ package private
 
 import (
 	"net/http"
+	"time"
+
+	"github.com/ardanlabs/blockchain/business/web/mid"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/events"
@@ -16,6 +20,10 @@ type Config struct {
 	State *state.State
 	NS    *nameservice.NameService
 	Evts  *events.Events
+
+	// BindPeerCerts requires peers connecting over TLS to present a
+	// certificate for the identity key that signs their requests.
+	BindPeerCerts bool
 }
 
 // Routes binds all the private routes.
@@ -28,10 +36,24 @@ func Routes(app *web.App, cfg Config) {
 
 	const version = "v1"
 
-	app.Handle(http.MethodPost, version, "/node/peers", prv.SubmitPeer)
-	app.Handle(http.MethodGet, version, "/node/status", prv.Status)
-	app.Handle(http.MethodGet, version, "/node/block/list/:from/:to", prv.BlocksByNumber)
-	app.Handle(http.MethodPost, version, "/node/block/propose", prv.ProposeBlock)
-	app.Handle(http.MethodPost, version, "/node/tx/submit", prv.SubmitNodeTransaction)
-	app.Handle(http.MethodGet, version, "/node/tx/list", prv.Mempool)
+	// Every request must be signed by a node identity key within this window
+	// of the current time.
+	const signatureWindow = 30 * time.Second
+
+	authen := mid.Authenticate(identity.NewVerifier(signatureWindow, cfg.BindPeerCerts))
+	authz := mid.Authorize(cfg.State.IsPeerKey)
+
+	// The handshake is the only call accepted from an unknown identity since
+	// it's how a node becomes known. The handler checks the handshake carries
+	// the same public key that signed the request.
+	app.Handle(http.MethodPost, version, "/node/peers", prv.SubmitPeer, authen)
+	app.Handle(http.MethodGet, version, "/node/status", prv.Status, authen, authz)
+	app.Handle(http.MethodGet, version, "/node/block/list/:from/:to", prv.BlocksByNumber, authen, authz)
+	app.Handle(http.MethodPost, version, "/node/block/propose", prv.ProposeBlock, authen, authz)
+	app.Handle(http.MethodPost, version, "/node/block/compact", prv.ProposeCompactBlock, authen, authz)
+	app.Handle(http.MethodPost, version, "/node/block/txs", prv.BlockTxs, authen, authz)
+	app.Handle(http.MethodPost, version, "/node/tx/submit", prv.SubmitNodeTransaction, authen, authz)
+	app.Handle(http.MethodPost, version, "/node/tx/announce", prv.AnnounceTxs, authen, authz)
+	app.Handle(http.MethodPost, version, "/node/tx/request", prv.RequestTxs, authen, authz)
+	app.Handle(http.MethodGet, version, "/node/tx/list", prv.Mempool, authen, authz)
 }
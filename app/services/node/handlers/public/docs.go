@@ -0,0 +1,138 @@
+package public
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+)
+
+// Operations describes the public routes for the OpenAPI document, keyed by
+// the method and path of the route.
+func Operations() map[string]openapi.Operation {
+	account := openapi.Parameter{
+		Name:        "account",
+		In:          openapi.InPath,
+		Description: "Account id starting with 0x.",
+		Required:    true,
+		Schema:      &openapi.Schema{Type: "string", Pattern: "^0x[0-9a-fA-F]{40}$"},
+	}
+
+	accounts := openapi.Operation{
+		Summary:  "List the balances of the accounts",
+		Response: actInfo{},
+	}
+	accountsByID := accounts
+	accountsByID.Summary = "Get the balance of an account"
+	accountsByID.Parameters = []openapi.Parameter{account}
+
+	blocks := openapi.Operation{
+		Summary:     "List a page of blocks",
+		Description: "The cursor for the next page is returned in the X-Next-Cursor and Link headers.",
+		Parameters:  blockQueryParams(),
+		Response:    []block{},
+		Responses: map[string]openapi.Response{
+			"204": {Description: "No blocks match the query."},
+		},
+	}
+	blocksByAccount := blocks
+	blocksByAccount.Summary = "List a page of blocks with transactions for an account"
+	blocksByAccount.Parameters = append([]openapi.Parameter{account}, blocks.Parameters...)
+
+	mempool := openapi.Operation{
+		Summary:  "List the transactions in the mempool",
+		Response: []tx{},
+	}
+	mempoolByAccount := mempool
+	mempoolByAccount.Summary = "List the transactions in the mempool for an account"
+	mempoolByAccount.Parameters = []openapi.Parameter{account}
+
+	submit := openapi.Operation{
+		Summary:     "Submit a signed transaction",
+		Description: "The transaction is added to the mempool and shared with the peers.",
+		Request:     database.SignedTx{},
+		Response:    status{},
+	}
+
+	ops := map[string]openapi.Operation{
+		"GET /v1/events": auth.Describe(auth.ScopeRead, openapi.Operation{
+			Summary:     "Subscribe to events over a websocket",
+			Description: "The client sends subscribe and unsubscribe requests over the websocket to choose the events it receives.",
+			Status:      http.StatusSwitchingProtocols,
+		}),
+		"GET /v1/events/stream": auth.Describe(auth.ScopeRead, openapi.Operation{
+			Summary:     "Stream events as server-sent events",
+			Description: "Block events carry the block number as the event id so a client that reconnects resumes after the last block it received.",
+			Parameters: []openapi.Parameter{
+				{Name: "kinds", In: openapi.InQuery, Description: "Comma separated list of newHeads, transactions or mempool. Defaults to newHeads,transactions.", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "account", In: openapi.InQuery, Description: "Only send transactions from or to this account.", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "fromBlock", In: openapi.InQuery, Description: "Replay the blocks starting with this block number.", Schema: &openapi.Schema{Type: "integer"}},
+				{Name: "Last-Event-ID", In: openapi.InHeader, Description: "Number of the last block received. Takes precedence over fromBlock.", Schema: &openapi.Schema{Type: "integer"}},
+			},
+			Responses: map[string]openapi.Response{
+				"200": {
+					Description: "Stream of events.",
+					Content: map[string]openapi.MediaType{
+						"text/event-stream": {Schema: &openapi.Schema{Type: "string"}},
+					},
+				},
+			},
+		}),
+		"GET /v1/genesis/list": auth.Describe(auth.ScopeRead, openapi.Operation{
+			Summary:  "Get the genesis information",
+			Response: genesis.Genesis{},
+		}),
+		"GET /v1/accounts/list":          auth.Describe(auth.ScopeRead, accounts),
+		"GET /v1/accounts/list/:account": auth.Describe(auth.ScopeRead, accountsByID),
+		"GET /v1/blocks/list":            auth.Describe(auth.ScopeRead, blocks),
+		"GET /v1/blocks/list/:account":   auth.Describe(auth.ScopeRead, blocksByAccount),
+		"GET /v1/blocks/range/:from/:to": auth.Describe(auth.ScopeRead, openapi.Operation{
+			Summary:     "List the blocks in a range of block numbers",
+			Description: fmt.Sprintf("Either number can be latest. At most %d blocks are returned, ask again from the next number for more.", peer.MaxBlocksPerRequest),
+			Response:    []database.BlockData{},
+			Responses: map[string]openapi.Response{
+				"204": {Description: "No blocks in the range."},
+			},
+		}),
+		"GET /v1/tx/uncommitted/list":          auth.Describe(auth.ScopeRead, mempool),
+		"GET /v1/tx/uncommitted/list/:account": auth.Describe(auth.ScopeRead, mempoolByAccount),
+		"POST /v1/tx/submit":                   auth.Describe(auth.ScopeSubmit, submit),
+		"POST /v1/tx/proof/:block/":            auth.Describe(auth.ScopeSubmit, submit),
+	}
+
+	for key, op := range ops {
+		op.Tags = []string{"public"}
+		ops[key] = op
+	}
+
+	return ops
+}
+
+// blockQueryParams describes the query string read by parseBlockQuery.
+func blockQueryParams() []openapi.Parameter {
+	param := func(name string, typ string, description string) openapi.Parameter {
+		return openapi.Parameter{
+			Name:        name,
+			In:          openapi.InQuery,
+			Description: description,
+			Schema:      &openapi.Schema{Type: typ},
+		}
+	}
+
+	return []openapi.Parameter{
+		param("limit", "integer", "Number of blocks to return, default 100 and at most 1000."),
+		param("cursor", "integer", "Value of X-Next-Cursor from the previous page."),
+		param("offset", "integer", "Number of matching blocks to skip."),
+		param("from", "integer", "Lowest block number to include."),
+		param("to", "integer", "Highest block number to include."),
+		param("since", "string", "Earliest block time to include, unix milliseconds or RFC3339."),
+		param("until", "string", "Latest block time to include, unix milliseconds or RFC3339."),
+		param("order", "string", "asc (default) or desc."),
+		param("txs", "boolean", "Include the transactions, default true."),
+		param("proofs", "boolean", "Include the Merkle proof for each transaction, default true."),
+	}
+}
@@ -47,3 +47,7 @@ type block struct {
 	Nonce         uint64             `json:"nonce"`
 	Transactions  []tx               `json:"txs"`
 }
+
+type status struct {
+	Status string `json:"status"`
+}
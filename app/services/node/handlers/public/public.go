@@ -3,17 +3,23 @@ package public
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/ardanlabs/blockchain/business/sys/validate"
 	"github.com/ardanlabs/blockchain/business/web/errs"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/events"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
 	"github.com/ardanlabs/blockchain/foundation/web"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
@@ -27,7 +33,8 @@ type Handlers struct {
 	Evts  *events.Events
 }
 
-// Events handles a web socket to provide events to a client.
+// Events handles a web socket to provide events to a client. The client
+// sends subscribe and unsubscribe requests to choose the events it receives.
 func (h Handlers) Events(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	v, err := web.GetValues(ctx)
 	if err != nil {
@@ -44,24 +51,62 @@ func (h Handlers) Events(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 	defer c.Close()
 
-	// This provides a channel for receiving events from the blockchain.
-	ch := h.Evts.Acquire(v.TraceID)
-	defer h.Evts.Release(v.TraceID)
+	// Since a message will be dropped if the websocket receiver is not ready
+	// to receive, this arbitrary buffer should give the receiver enough time
+	// to not lose a message. Websocket send could take long. Blocks that are
+	// dropped are replayed from storage.
+	const messageBuffer = 256
+
+	// This provides a subscription for receiving events from the blockchain.
+	// The trace id comes from the client and isn't unique, so every
+	// subscription is given its own id.
+	subID := uuid.NewString()
+	sub, err := h.Evts.Subscribe(subID, messageBuffer)
+	if err != nil {
+		return err
+	}
+	defer h.Evts.Unsubscribe(subID)
+
+	h.Log.Infow("websocket subscribe", "traceid", v.TraceID, "subid", subID)
+
+	// Read the client requests on a separate goroutine since only one
+	// goroutine can read from the websocket.
+	done := make(chan struct{})
+	defer close(done)
+	requests := readRequests(c, done)
+
+	st := stream{
+		state: h.State,
+		send:  func(n notification) error { return c.WriteJSON(n) },
+	}
 
 	// Starting a ticker to send a ping message over the websocket.
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
-	// Block waiting for events from the blockchain or ticker.
+	// Block waiting for requests from the client, events from the blockchain
+	// or the ticker.
 	for {
 		select {
-		case msg, wd := <-ch:
+		case req, wd := <-requests:
+
+			// If the client has gone away, release the websocket.
+			if !wd {
+				return nil
+			}
+
+			if err := h.handleRequest(c, &st, req); err != nil {
+				return err
+			}
+
+		case msg, wd := <-sub.C():
 
 			// If the channel is closed, release the websocket.
 			if !wd {
 				return nil
 			}
 
-			if err := c.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			if err := st.dispatch(msg); err != nil {
 				return err
 			}
 
@@ -73,6 +118,211 @@ func (h Handlers) Events(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 }
 
+// handleRequest processes a subscribe or unsubscribe request from a client.
+func (h Handlers) handleRequest(c *websocket.Conn, st *stream, req subRequest) error {
+	resp := subResponse{
+		ID: req.ID,
+	}
+
+	switch {
+	case req.err != nil:
+		resp.Error = fmt.Sprintf("invalid request: %s", req.err)
+
+	case req.Method == "subscribe":
+
+		// Once the subscription is acknowledged, any error comes from
+		// writing to the client or reading historical blocks.
+		var acked bool
+		ack := func(id string) error {
+			acked = true
+			resp.Result = map[string]string{"subscription": id}
+			return c.WriteJSON(resp)
+		}
+
+		err := st.subscribe(req.Params, ack)
+		if acked {
+			return err
+		}
+		resp.Error = err.Error()
+
+	case req.Method == "unsubscribe":
+		if err := st.unsubscribe(req.Params.Subscription); err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		resp.Result = map[string]string{"subscription": req.Params.Subscription}
+
+	default:
+		resp.Error = fmt.Sprintf("unknown method %q", req.Method)
+	}
+
+	return c.WriteJSON(resp)
+}
+
+// readRequests reads the requests sent by the client until the websocket
+// is closed. A request that can't be decoded is answered with an error.
+func readRequests(c *websocket.Conn, done <-chan struct{}) <-chan subRequest {
+	requests := make(chan subRequest)
+
+	go func() {
+		defer close(requests)
+
+		for {
+			_, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var req subRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				req = subRequest{err: err}
+			}
+
+			select {
+			case requests <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return requests
+}
+
+// Stream handles a server-sent events stream of block and transaction events
+// for clients that can't upgrade to a websocket. Block based events carry the
+// block number as the event id so a client that reconnects with the
+// Last-Event-ID header resumes after the last block it received.
+func (h Handlers) Stream(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	sq, err := parseStreamQuery(r)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	latest := h.State.LatestBlock().Header.Number
+	if sq.fromBlock != 0 && latest >= sq.fromBlock && latest-sq.fromBlock >= maxReplayBlocks {
+		return errs.NewTrusted(fmt.Errorf("fromBlock is more than %d blocks behind the latest block %d", maxReplayBlocks, latest), http.StatusBadRequest)
+	}
+
+	// The stream is long lived so the write timeout for the server
+	// can't apply.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	// This provides a subscription for receiving events from the blockchain.
+	// The trace id comes from the client and isn't unique, so every
+	// subscription is given its own id.
+	const messageBuffer = 256
+	subID := uuid.NewString()
+	sub, err := h.Evts.Subscribe(subID, messageBuffer)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusServiceUnavailable)
+	}
+	defer h.Evts.Unsubscribe(subID)
+
+	h.Log.Infow("sse subscribe", "traceid", v.TraceID, "subid", subID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell the client how long to wait before reconnecting.
+	fmt.Fprint(w, "retry: 1000\n\n")
+	if err := rc.Flush(); err != nil {
+		return nil
+	}
+
+	st := stream{
+		state: h.State,
+		send:  func(n notification) error { return writeEvent(rc, w, n) },
+	}
+
+	for _, kind := range sq.kinds {
+		p := subParams{
+			Kind: kind,
+		}
+		if kind != kindNewHeads {
+			p.Account = sq.account
+		}
+
+		if err := st.subscribe(p, func(string) error { return nil }); err != nil {
+			return nil
+		}
+	}
+
+	// Replay the historical blocks for all the subscriptions together so
+	// the events are sent in block order.
+	if sq.fromBlock != 0 {
+		feeds := st.blockFeeds()
+
+		var to uint64
+		for _, f := range feeds {
+			to = max(to, f.last)
+		}
+
+		if sq.fromBlock <= to {
+			if err := st.replay(feeds, sq.fromBlock, to); err != nil {
+				return nil
+			}
+		}
+	}
+
+	// Send a comment on a regular basis to keep proxies from closing
+	// an idle connection.
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	// Block waiting for events from the blockchain, the client to go away
+	// or the ticker.
+	for {
+		select {
+		case msg, wd := <-sub.C():
+
+			// If the channel is closed, the node is shutting down.
+			if !wd {
+				return nil
+			}
+
+			if err := st.dispatch(msg); err != nil {
+				return nil
+			}
+
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			if err := rc.Flush(); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// writeEvent writes the notification as a server-sent event.
+func writeEvent(rc *http.ResponseController, w http.ResponseWriter, n notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	if n.block != 0 {
+		fmt.Fprintf(w, "id: %d\n", n.block)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", n.Type, data)
+
+	return rc.Flush()
+}
+
 // SubmitWalletTransaction adds new transactions to the mempool.
 func (h Handlers) SubmitWalletTransaction(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	v, err := web.GetValues(ctx)
@@ -83,7 +333,11 @@ func (h Handlers) SubmitWalletTransaction(ctx context.Context, w http.ResponseWr
 	// Decode the JSON in the post call into a Signed transaction.
 	var signedTx database.SignedTx
 	if err := web.Decode(r, &signedTx); err != nil {
-		return fmt.Errorf("unable to decode payload: %w", err)
+		return fmt.Errorf("unable to decode payload: %w", validate.DecodeError(err))
+	}
+
+	if err := validate.Check(signedTx); err != nil {
+		return fmt.Errorf("validating payload: %w", err)
 	}
 
 	h.Log.Infow("add tran", "traceid", v.TraceID, "sig:nonce", signedTx, "from", signedTx.FromID, "to", signedTx.ToID, "value", signedTx.Value, "tip", signedTx.Tip)
@@ -92,13 +346,11 @@ func (h Handlers) SubmitWalletTransaction(ctx context.Context, w http.ResponseWr
 	// checks are the transaction signature and the recipient account format.
 	// It's up to the wallet to make sure the account has a proper balance and
 	// nonce. Fees will be taken if this transaction is mined into a block.
-	if err := h.State.UpsertWalletTransaction(signedTx); err != nil {
+	if err := h.State.UpsertWalletTransaction(ctx, signedTx); err != nil {
 		return errs.NewTrusted(err, http.StatusBadRequest)
 	}
 
-	resp := struct {
-		Status string `json:"status"`
-	}{
+	resp := status{
 		Status: "transactions added to mempool",
 	}
 
@@ -111,6 +363,57 @@ func (h Handlers) Genesis(ctx context.Context, w http.ResponseWriter, r *http.Re
 	return web.Respond(ctx, w, gen, http.StatusOK)
 }
 
+// BlocksByNumber returns the blocks based on the specified to/from values, up
+// to peer.MaxBlocksPerRequest blocks. This gives clients like the viewer
+// access to blocks without going through the private node to node API.
+func (h Handlers) BlocksByNumber(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	fromStr := web.Param(r, "from")
+	if fromStr == "latest" || fromStr == "" {
+		fromStr = fmt.Sprintf("%d", state.QueryLastest)
+	}
+
+	toStr := web.Param(r, "to")
+	if toStr == "latest" || toStr == "" {
+		toStr = fmt.Sprintf("%d", state.QueryLastest)
+	}
+
+	from, err := strconv.ParseUint(fromStr, 10, 64)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+	to, err := strconv.ParseUint(toStr, 10, 64)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+
+	if from > to {
+		return errs.NewTrusted(errors.New("from greater than to"), http.StatusBadRequest)
+	}
+
+	// Limit the range so a single request can't read the whole chain. A
+	// client that wants more blocks asks for the next set.
+	latest := h.State.LatestBlock().Header.Number
+	if from == state.QueryLastest {
+		from = latest
+	}
+	to = min(to, latest)
+	if from <= to && to-from >= peer.MaxBlocksPerRequest {
+		to = from + peer.MaxBlocksPerRequest - 1
+	}
+
+	blocks := h.State.QueryBlocksByNumber(from, to)
+	if len(blocks) == 0 {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+
+	blockData := make([]database.BlockData, len(blocks))
+	for i, block := range blocks {
+		blockData[i] = database.NewBlockData(block)
+	}
+
+	return web.Respond(ctx, w, blockData, http.StatusOK)
+}
+
 // Mempool returns the set of uncommitted transactions.
 func (h Handlers) Mempool(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	acct := web.Param(r, "account")
@@ -184,7 +487,11 @@ func (h Handlers) Accounts(ctx context.Context, w http.ResponseWriter, r *http.R
 	return web.Respond(ctx, w, ai, http.StatusOK)
 }
 
-// BlocksByAccount returns all the blocks and their details.
+// BlocksByAccount returns a page of blocks and their details. The query
+// string can filter the blocks by number and time, set the order, and
+// leave out the transactions or their proofs. When there are more blocks,
+// the cursor for the next page is returned in the X-Next-Cursor header and
+// the Link header.
 func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	var accountID database.AccountID
 	accountStr := web.Param(r, "account")
@@ -192,50 +499,77 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 		var err error
 		accountID, err = database.ToAccountID(web.Param(r, "account"))
 		if err != nil {
-			return err
+			return errs.NewTrusted(err, http.StatusBadRequest)
 		}
 	}
 
-	dbBlocks, err := h.State.QueryBlocksByAccount(accountID)
+	bq, err := parseBlockQuery(r)
+	if err != nil {
+		return errs.NewTrusted(err, http.StatusBadRequest)
+	}
+	bq.query.AccountID = accountID
+
+	dbBlocks, next, err := h.State.QueryBlocks(bq.query)
 	if err != nil {
+		if errors.Is(err, state.ErrScanLimit) {
+			return errs.NewTrusted(err, http.StatusBadRequest)
+		}
 		return err
 	}
 
-	if len(dbBlocks) == 0 {
+	if len(dbBlocks) == 0 && next == 0 {
 		return web.Respond(ctx, w, nil, http.StatusNoContent)
 	}
 
+	// A page can be empty when the scan limit was reached before a matching
+	// block was found, the client continues with the cursor.
+	if next != 0 {
+		cursor := strconv.FormatUint(next, 10)
+		w.Header().Set("X-Next-Cursor", cursor)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextPageURL(r, cursor)))
+	}
+
 	blocks := make([]block, len(dbBlocks))
 	for j, blk := range dbBlocks {
-		values := blk.MerkleTree.Values()
-
-		trans := make([]tx, len(values))
-		for i, tran := range values {
-			rawProof, order, err := blk.MerkleTree.Proof(tran)
-			if err != nil {
-				return err
-			}
-			proof := make([]string, len(rawProof))
-			for i, rp := range rawProof {
-				proof[i] = hexutil.Encode(rp)
-			}
-
-			trans[i] = tx{
-				FromAccount: tran.FromID,
-				FromName:    h.NS.Lookup(tran.FromID),
-				To:          tran.ToID,
-				ToName:      h.NS.Lookup(tran.ToID),
-				ChainID:     tran.ChainID,
-				Nonce:       tran.Nonce,
-				Value:       tran.Value,
-				Tip:         tran.Tip,
-				Data:        tran.Data,
-				TimeStamp:   tran.TimeStamp,
-				GasPrice:    tran.GasPrice,
-				GasUnits:    tran.GasUnits,
-				Sig:         tran.SignatureString(),
-				Proof:       proof,
-				ProofOrder:  order,
+		var trans []tx
+		if bq.txs {
+			values := blk.MerkleTree.Values()
+
+			trans = make([]tx, len(values))
+			for i, tran := range values {
+				trans[i] = tx{
+					FromAccount: tran.FromID,
+					FromName:    h.NS.Lookup(tran.FromID),
+					To:          tran.ToID,
+					ToName:      h.NS.Lookup(tran.ToID),
+					ChainID:     tran.ChainID,
+					Nonce:       tran.Nonce,
+					Value:       tran.Value,
+					Tip:         tran.Tip,
+					Data:        tran.Data,
+					TimeStamp:   tran.TimeStamp,
+					GasPrice:    tran.GasPrice,
+					GasUnits:    tran.GasUnits,
+					Sig:         tran.SignatureString(),
+				}
+
+				// Calculating the proof is the expensive part, so it's only
+				// done when the client wants it.
+				if !bq.proofs {
+					continue
+				}
+
+				rawProof, order, err := blk.MerkleTree.Proof(tran)
+				if err != nil {
+					return err
+				}
+				proof := make([]string, len(rawProof))
+				for i, rp := range rawProof {
+					proof[i] = hexutil.Encode(rp)
+				}
+
+				trans[i].Proof = proof
+				trans[i].ProofOrder = order
 			}
 		}
 
@@ -0,0 +1,215 @@
+package public
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// Limits on the number of blocks returned in a page.
+const (
+	defaultBlockLimit = 100
+	maxBlockLimit     = 1000
+)
+
+// blockQuery holds the options for listing blocks provided in the query
+// string.
+type blockQuery struct {
+	query  state.BlockQuery
+	txs    bool
+	proofs bool
+}
+
+// parseBlockQuery reads the options for listing blocks from the query string.
+//
+//	limit   number of blocks to return, default 100 and at most 1000
+//	cursor  value of X-Next-Cursor from the previous page
+//	offset  number of matching blocks to skip
+//	from    lowest block number to include
+//	to      highest block number to include
+//	since   earliest block time to include, unix milliseconds or RFC3339
+//	until   latest block time to include, unix milliseconds or RFC3339
+//	order   asc (default) or desc
+//	txs     include the transactions, default true
+//	proofs  include the Merkle proof for each transaction, default true
+func parseBlockQuery(r *http.Request) (blockQuery, error) {
+	qs := r.URL.Query()
+
+	bq := blockQuery{
+		query: state.BlockQuery{
+			Limit: defaultBlockLimit,
+		},
+		txs:    true,
+		proofs: true,
+	}
+
+	var err error
+
+	if v := qs.Get("limit"); v != "" {
+		if bq.query.Limit, err = strconv.Atoi(v); err != nil || bq.query.Limit < 1 || bq.query.Limit > maxBlockLimit {
+			return blockQuery{}, fmt.Errorf("limit must be between 1 and %d", maxBlockLimit)
+		}
+	}
+
+	if v := qs.Get("cursor"); v != "" {
+		if bq.query.After, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return blockQuery{}, errors.New("invalid cursor")
+		}
+	}
+
+	if v := qs.Get("offset"); v != "" {
+		if bq.query.Offset, err = strconv.Atoi(v); err != nil || bq.query.Offset < 0 {
+			return blockQuery{}, errors.New("offset must be a positive number")
+		}
+	}
+
+	if v := qs.Get("from"); v != "" {
+		if bq.query.From, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return blockQuery{}, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+
+	if v := qs.Get("to"); v != "" {
+		if bq.query.To, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return blockQuery{}, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+
+	if bq.query.To != 0 && bq.query.From > bq.query.To {
+		return blockQuery{}, errors.New("from greater than to")
+	}
+
+	if bq.query.Since, err = parseTime(qs.Get("since")); err != nil {
+		return blockQuery{}, fmt.Errorf("invalid since: %w", err)
+	}
+
+	if bq.query.Until, err = parseTime(qs.Get("until")); err != nil {
+		return blockQuery{}, fmt.Errorf("invalid until: %w", err)
+	}
+
+	switch qs.Get("order") {
+	case "", "asc":
+	case "desc":
+		bq.query.Descending = true
+	default:
+		return blockQuery{}, errors.New("order must be asc or desc")
+	}
+
+	if v := qs.Get("txs"); v != "" {
+		if bq.txs, err = strconv.ParseBool(v); err != nil {
+			return blockQuery{}, fmt.Errorf("invalid txs: %w", err)
+		}
+	}
+
+	if v := qs.Get("proofs"); v != "" {
+		if bq.proofs, err = strconv.ParseBool(v); err != nil {
+			return blockQuery{}, fmt.Errorf("invalid proofs: %w", err)
+		}
+	}
+
+	return bq, nil
+}
+
+// parseTime converts a time in unix milliseconds or RFC3339 format to the
+// unix milliseconds used for block timestamps.
+func parseTime(v string) (uint64, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	if ms, err := strconv.ParseUint(v, 10, 64); err == nil {
+		return ms, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, errors.New("expecting unix milliseconds or RFC3339")
+	}
+
+	return uint64(t.UnixMilli()), nil
+}
+
+// nextPageURL returns the URL of the request with the cursor for the next
+// page.
+func nextPageURL(r *http.Request, cursor string) string {
+	qs := r.URL.Query()
+	qs.Set("cursor", cursor)
+	qs.Del("offset")
+
+	u := url.URL{
+		Path:     r.URL.Path,
+		RawQuery: qs.Encode(),
+	}
+
+	return u.String()
+}
+
+// streamQuery holds the options for an event stream provided in the query
+// string.
+type streamQuery struct {
+	kinds     []string
+	account   database.AccountID
+	fromBlock uint64
+}
+
+// parseStreamQuery reads the options for an event stream from the query
+// string and the Last-Event-ID header.
+//
+//	kinds      newHeads, transactions or mempool, default newHeads,transactions
+//	account    only send transactions from or to this account
+//	fromBlock  replay the blocks starting with this block number
+//
+// The Last-Event-ID header is sent by clients that reconnect and holds the
+// number of the last block received. It takes precedence over fromBlock.
+func parseStreamQuery(r *http.Request) (streamQuery, error) {
+	qs := r.URL.Query()
+
+	sq := streamQuery{
+		kinds: []string{kindNewHeads, kindTransactions},
+	}
+
+	if v := qs.Get("kinds"); v != "" {
+		sq.kinds = nil
+		for _, kind := range strings.Split(v, ",") {
+			switch kind {
+			case kindNewHeads, kindTransactions, kindMempool:
+				sq.kinds = append(sq.kinds, kind)
+			default:
+				return streamQuery{}, fmt.Errorf("invalid kind %q", kind)
+			}
+		}
+	}
+
+	if v := qs.Get("account"); v != "" {
+		account, err := database.ToAccountID(v)
+		if err != nil {
+			return streamQuery{}, err
+		}
+		sq.account = account
+	}
+
+	var err error
+
+	if v := qs.Get("fromBlock"); v != "" {
+		if sq.fromBlock, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return streamQuery{}, fmt.Errorf("invalid fromBlock: %w", err)
+		}
+	}
+
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		last, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return streamQuery{}, fmt.Errorf("invalid Last-Event-ID: %w", err)
+		}
+		sq.fromBlock = last + 1
+	}
+
+	return sq, nil
+}
@@ -3,6 +3,8 @@ package public
 import (
 	"net/http"
 
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/mid"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/events"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
@@ -31,14 +33,21 @@ func Routes(app *web.App, cfg Config) {
 
 	const version = "v1"
 
-	app.Handle(http.MethodGet, version, "/events", pbl.Events)
-	app.Handle(http.MethodGet, version, "/genesis/list", pbl.Genesis)
-	app.Handle(http.MethodGet, version, "/accounts/list", pbl.Accounts)
-	app.Handle(http.MethodGet, version, "/accounts/list/:account", pbl.Accounts)
-	app.Handle(http.MethodGet, version, "/blocks/list", pbl.BlocksByAccount)
-	app.Handle(http.MethodGet, version, "/blocks/list/:account", pbl.BlocksByAccount)
-	app.Handle(http.MethodGet, version, "/tx/uncommitted/list", pbl.Mempool)
-	app.Handle(http.MethodGet, version, "/tx/uncommitted/list/:account", pbl.Mempool)
-	app.Handle(http.MethodPost, version, "/tx/submit", pbl.SubmitWalletTransaction)
-	app.Handle(http.MethodPost, version, "/tx/proof/:block/", pbl.SubmitWalletTransaction)
+	// Every route requires a scope. Anonymous clients are granted the
+	// scopes configured for them.
+	read := mid.Scope(auth.ScopeRead)
+	submit := mid.Scope(auth.ScopeSubmit)
+
+	app.Handle(http.MethodGet, version, "/events", pbl.Events, read)
+	app.Handle(http.MethodGet, version, "/events/stream", pbl.Stream, read)
+	app.Handle(http.MethodGet, version, "/genesis/list", pbl.Genesis, read)
+	app.Handle(http.MethodGet, version, "/accounts/list", pbl.Accounts, read)
+	app.Handle(http.MethodGet, version, "/accounts/list/:account", pbl.Accounts, read)
+	app.Handle(http.MethodGet, version, "/blocks/list", pbl.BlocksByAccount, read)
+	app.Handle(http.MethodGet, version, "/blocks/list/:account", pbl.BlocksByAccount, read)
+	app.Handle(http.MethodGet, version, "/blocks/range/:from/:to", pbl.BlocksByNumber, read)
+	app.Handle(http.MethodGet, version, "/tx/uncommitted/list", pbl.Mempool, read)
+	app.Handle(http.MethodGet, version, "/tx/uncommitted/list/:account", pbl.Mempool, read)
+	app.Handle(http.MethodPost, version, "/tx/submit", pbl.SubmitWalletTransaction, submit)
+	app.Handle(http.MethodPost, version, "/tx/proof/:block/", pbl.SubmitWalletTransaction, submit)
 }
@@ -0,0 +1,381 @@
+package public
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/events"
+)
+
+// The set of subscriptions a client can request.
+const (
+	kindNewHeads     = "newHeads"
+	kindTransactions = "transactions"
+	kindMempool      = "mempool"
+	kindEvents       = "events"
+)
+
+// Limits on the subscriptions a single client can hold.
+const (
+	maxSubscriptions = 16
+	maxReplayBlocks  = 10_000
+	replayPageSize   = 100
+)
+
+// subRequest represents a request sent by a client over the websocket.
+type subRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params subParams       `json:"params"`
+	err    error
+}
+
+// subParams represents the parameters for subscribing and unsubscribing.
+type subParams struct {
+	Kind         string             `json:"kind"`
+	Account      database.AccountID `json:"account"`
+	FromBlock    uint64             `json:"fromBlock"`
+	Topics       []events.Topic     `json:"topics"`
+	Subscription string             `json:"subscription"`
+}
+
+// subResponse represents the response to a client request.
+type subResponse struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Result any             `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// notification represents a message sent to a client for a subscription.
+// The sequence number increases by one for every notification sent on the
+// connection, including the ones replayed from storage.
+type notification struct {
+	Seq          uint64 `json:"seq"`
+	Subscription string `json:"subscription"`
+	Type         string `json:"type"`
+	Replay       bool   `json:"replay,omitempty"`
+	Data         any    `json:"data"`
+
+	// block is the number of the block the notification was produced
+	// from. It's zero for notifications that don't come from a block.
+	block uint64
+}
+
+// blockHead represents the data sent for a newHeads subscription.
+type blockHead struct {
+	Hash   string               `json:"hash"`
+	Header database.BlockHeader `json:"block"`
+}
+
+// blockTx represents the data sent for a transactions subscription.
+type blockTx struct {
+	BlockNumber uint64           `json:"block_number"`
+	BlockHash   string           `json:"block_hash"`
+	Tx          database.BlockTx `json:"tx"`
+}
+
+// =============================================================================
+
+// feed represents a single subscription held by a client.
+type feed struct {
+	id      string
+	kind    string
+	account database.AccountID
+	topics  map[events.Topic]bool
+
+	// last is the number of the last block processed for the block
+	// based subscriptions. It's used to skip blocks already replayed and
+	// to replay blocks that were missed.
+	last uint64
+}
+
+// blockBased identifies if the subscription is fed from blocks.
+func (f *feed) blockBased() bool {
+	return f.kind == kindNewHeads || f.kind == kindTransactions
+}
+
+// involves identifies if the transaction is from or to the account being
+// followed. With no account, every transaction is of interest.
+func (f *feed) involves(tx database.BlockTx) bool {
+	return f.account == "" || tx.FromID == f.account || tx.ToID == f.account
+}
+
+// =============================================================================
+
+// stream manages the subscriptions for a single client connection. Events
+// from the events bus are matched against the subscriptions and blocks are
+// replayed from storage when needed.
+type stream struct {
+	state *state.State
+	send  func(notification) error
+	feeds []*feed
+	seq   uint64
+	next  int
+}
+
+// subscribe validates the parameters and adds a new subscription. The
+// subscription id is returned before any historical blocks are replayed
+// so the client can identify the replayed notifications.
+func (st *stream) subscribe(p subParams, ack func(id string) error) error {
+	if len(st.feeds) >= maxSubscriptions {
+		return fmt.Errorf("too many subscriptions, max %d", maxSubscriptions)
+	}
+
+	f := feed{
+		kind:    p.Kind,
+		account: p.Account,
+		topics:  make(map[events.Topic]bool),
+	}
+
+	switch p.Kind {
+	case kindNewHeads:
+		if p.Account != "" {
+			return errors.New("newHeads doesn't support an account filter")
+		}
+
+	case kindTransactions, kindMempool:
+		if p.Account != "" && !p.Account.IsAccountID() {
+			return fmt.Errorf("invalid account %q", p.Account)
+		}
+
+	case kindEvents:
+		topics, err := parseTopics(p.Topics)
+		if err != nil {
+			return err
+		}
+		for _, topic := range topics {
+			f.topics[topic] = true
+		}
+
+	default:
+		return fmt.Errorf("unknown subscription kind %q", p.Kind)
+	}
+
+	if p.FromBlock != 0 && !f.blockBased() {
+		return fmt.Errorf("%s doesn't support fromBlock", p.Kind)
+	}
+
+	latest := st.state.LatestBlock().Header.Number
+	if p.FromBlock != 0 && latest >= p.FromBlock && latest-p.FromBlock >= maxReplayBlocks {
+		return fmt.Errorf("fromBlock is more than %d blocks behind the latest block %d", maxReplayBlocks, latest)
+	}
+
+	st.next++
+	f.id = strconv.Itoa(st.next)
+
+	if err := ack(f.id); err != nil {
+		return err
+	}
+
+	st.feeds = append(st.feeds, &f)
+
+	// Replay the historical blocks before any live events are processed.
+	// Without a starting block, only the blocks after the latest are sent.
+	f.last = latest
+	if p.FromBlock != 0 && p.FromBlock <= latest {
+		return st.replay([]*feed{&f}, p.FromBlock, latest)
+	}
+
+	return nil
+}
+
+// unsubscribe removes the subscription with the specified id.
+func (st *stream) unsubscribe(id string) error {
+	for i, f := range st.feeds {
+		if f.id == id {
+			st.feeds = append(st.feeds[:i], st.feeds[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("subscription %q does not exist", id)
+}
+
+// dispatch sends the notifications for the event to every subscription
+// that is interested in it.
+func (st *stream) dispatch(msg events.Message) error {
+	for _, f := range st.feeds {
+		if err := st.dispatchFeed(f, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dispatchFeed sends the notifications for the event to the subscription.
+func (st *stream) dispatchFeed(f *feed, msg events.Message) error {
+	switch f.kind {
+	case kindEvents:
+		if !f.topics[msg.Topic] {
+			return nil
+		}
+		return st.deliver(f, notification{Type: msg.Type, Data: msg.Data})
+
+	case kindMempool:
+		switch ev := msg.Data.(type) {
+		case state.TxAccepted:
+			if f.involves(ev.Tx) {
+				return st.deliver(f, notification{Type: msg.Type, Data: ev})
+			}
+		case state.TxEvicted:
+			if f.involves(ev.Tx) {
+				return st.deliver(f, notification{Type: msg.Type, Data: ev})
+			}
+		}
+		return nil
+	}
+
+	switch ev := msg.Data.(type) {
+	case state.ReorgStarted:
+
+		// The blockchain is being synced again from peers so the blocks
+		// that follow will reuse the numbers already sent.
+		f.last = 0
+		return st.deliver(f, notification{Type: msg.Type, Data: ev})
+
+	case state.BlockAdded:
+		number := ev.Block.Header.Number
+		if number <= f.last {
+			return nil
+		}
+
+		// If events were dropped, replay the blocks that were missed.
+		if number > f.last+1 {
+			if err := st.replay([]*feed{f}, f.last+1, number-1); err != nil {
+				return err
+			}
+		}
+
+		f.last = number
+		return st.block(f, ev.Block, false)
+	}
+
+	return nil
+}
+
+// replay reads the blocks in the specified range from storage and sends the
+// notifications for them to the block based subscriptions. The notifications
+// are sent in block order across the subscriptions.
+func (st *stream) replay(feeds []*feed, from uint64, to uint64) error {
+	q := state.BlockQuery{
+		From:  from,
+		To:    to,
+		Limit: replayPageSize,
+	}
+	if len(feeds) == 1 && feeds[0].kind == kindTransactions {
+		q.AccountID = feeds[0].account
+	}
+
+	for {
+		blocks, next, err := st.state.QueryBlocks(q)
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			bd := database.NewBlockData(block)
+			for _, f := range feeds {
+				if err := st.block(f, bd, true); err != nil {
+					return err
+				}
+			}
+		}
+
+		if next == 0 {
+			break
+		}
+		q.After = next
+	}
+
+	for _, f := range feeds {
+		f.last = max(f.last, to)
+	}
+
+	return nil
+}
+
+// blockFeeds returns the block based subscriptions.
+func (st *stream) blockFeeds() []*feed {
+	var feeds []*feed
+	for _, f := range st.feeds {
+		if f.blockBased() {
+			feeds = append(feeds, f)
+		}
+	}
+
+	return feeds
+}
+
+// block sends the notifications for a block to a block based subscription.
+func (st *stream) block(f *feed, bd database.BlockData, replay bool) error {
+	if f.kind == kindNewHeads {
+		n := notification{
+			Type:   "NewHead",
+			Replay: replay,
+			Data:   blockHead{Hash: bd.Hash, Header: bd.Header},
+			block:  bd.Header.Number,
+		}
+		return st.deliver(f, n)
+	}
+
+	for _, tx := range bd.Trans {
+		if !f.involves(tx) {
+			continue
+		}
+
+		n := notification{
+			Type:   "Transaction",
+			Replay: replay,
+			Data: blockTx{
+				BlockNumber: bd.Header.Number,
+				BlockHash:   bd.Hash,
+				Tx:          tx,
+			},
+			block: bd.Header.Number,
+		}
+		if err := st.deliver(f, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver sends the notification for the subscription with the next
+// sequence number.
+func (st *stream) deliver(f *feed, n notification) error {
+	st.seq++
+
+	n.Seq = st.seq
+	n.Subscription = f.id
+
+	return st.send(n)
+}
+
+// =============================================================================
+
+// parseTopics validates the topics for an events subscription. If no topics
+// are specified, all the blockchain topics are returned.
+func parseTopics(topics []events.Topic) ([]events.Topic, error) {
+	if len(topics) == 0 {
+		return state.Topics(), nil
+	}
+
+	valid := make(map[events.Topic]bool)
+	for _, topic := range append(state.Topics(), events.TopicLog) {
+		valid[topic] = true
+	}
+
+	for _, topic := range topics {
+		if !valid[topic] {
+			return nil, fmt.Errorf("invalid topic %q", topic)
+		}
+	}
+
+	return topics, nil
+}
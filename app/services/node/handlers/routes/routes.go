@@ -5,17 +5,28 @@ package routes
 import (
 	"context"
 	"expvar"
+	"maps"
 	"net/http"
 	"net/http/pprof"
 	"os"
 
+	"github.com/ardanlabs/blockchain/app/services/node/handlers/admingrp"
 	"github.com/ardanlabs/blockchain/app/services/node/handlers/debug/checkgrp"
+	"github.com/ardanlabs/blockchain/app/services/node/handlers/graphqlgrp"
 	"github.com/ardanlabs/blockchain/app/services/node/handlers/private"
 	"github.com/ardanlabs/blockchain/app/services/node/handlers/public"
+	"github.com/ardanlabs/blockchain/app/services/node/handlers/rpcgrp"
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/errs"
 	"github.com/ardanlabs/blockchain/business/web/mid"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/metrics"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
 	"github.com/ardanlabs/blockchain/foundation/events"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+	"github.com/ardanlabs/blockchain/foundation/ratelimit"
+	"github.com/ardanlabs/blockchain/foundation/trace"
 	"github.com/ardanlabs/blockchain/foundation/web"
 	"go.uber.org/zap"
 )
@@ -27,6 +38,55 @@ type MuxConfig struct {
 	State    *state.State
 	NS       *nameservice.NameService
 	Evts     *events.Events
+	Webhooks *webhook.Dispatcher
+	Tracer   *trace.Tracer
+
+	// Auth identifies the clients of the public API so routes can require
+	// scopes. The rate limiter limits the requests of each client.
+	Auth        *auth.Auth
+	RateLimiter *ratelimit.Limiter
+	RateLimits  mid.RateLimits
+
+	// CORSOrigins are the origins allowed to call the public API from a
+	// browser. An origin of "*" allows every origin.
+	CORSOrigins []string
+
+	// AdminToken is the bearer token required by the admin routes. The
+	// admin routes are not available if no token is configured.
+	AdminToken string
+
+	// BindPeerCerts requires peers connecting to the private API over TLS
+	// to present a certificate for the identity key that signs their requests.
+	BindPeerCerts bool
+
+	// OpenAPI is the document the routes of the mux are described in. The
+	// server is where clients reach the routes.
+	OpenAPI       *openapi.Document
+	OpenAPIServer openapi.Server
+}
+
+// NewOpenAPI constructs the document that describes the public and private
+// routes. The public mux serves the document once both muxes add their routes.
+func NewOpenAPI(build string, servers ...openapi.Server) *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:       "Ardan Blockchain Node",
+		Description: "Public and private APIs of a node. Errors are reported with the default response.",
+		Version:     build,
+	}, servers...)
+
+	doc.DefaultResponse("Error", errs.Response{})
+
+	for _, schemes := range []map[string]openapi.SecurityScheme{
+		auth.SecuritySchemes(),
+		private.SecuritySchemes(),
+		admingrp.SecuritySchemes(),
+	} {
+		for name, scheme := range schemes {
+			doc.SecurityScheme(name, scheme)
+		}
+	}
+
+	return doc
 }
 
 // PublicMux constructs a http.Handler with all application routes defined.
@@ -35,11 +95,15 @@ func PublicMux(cfg MuxConfig) http.Handler {
 	// Construct the web.App which holds all routes as well as common Middleware.
 	app := web.NewApp(
 		cfg.Shutdown,
+		cfg.Tracer,
 		mid.Logger(cfg.Log),
 		mid.Errors(cfg.Log),
 		mid.Metrics(),
-		mid.Cors("*"),
+		mid.Cors(cfg.CORSOrigins...),
 		mid.Panics(),
+		mid.AuthLimit(cfg.RateLimiter, cfg.RateLimits),
+		mid.APIAuth(cfg.Auth),
+		mid.RateLimit(cfg.RateLimiter, cfg.RateLimits),
 	)
 
 	// Accept CORS 'OPTIONS' preflight requests if config has been provided.
@@ -48,7 +112,7 @@ func PublicMux(cfg MuxConfig) http.Handler {
 	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
-	app.Handle(http.MethodOptions, "", "/*", h, mid.Cors("*"))
+	app.Handle(http.MethodOptions, "", "/*", h, mid.Cors(cfg.CORSOrigins...))
 
 	// Load the routes.
 	public.Routes(app, public.Config{
@@ -58,6 +122,36 @@ func PublicMux(cfg MuxConfig) http.Handler {
 		Evts:  cfg.Evts,
 	})
 
+	// Load the GraphQL routes.
+	graphqlgrp.Routes(app, graphqlgrp.Config{
+		Log:   cfg.Log,
+		State: cfg.State,
+		NS:    cfg.NS,
+	})
+
+	// Load the Ethereum compatible JSON-RPC route.
+	rpcgrp.Routes(app, rpcgrp.Config{
+		Log:   cfg.Log,
+		State: cfg.State,
+	})
+
+	// Serve the document that describes the public and private routes.
+	if cfg.OpenAPI != nil {
+		app.Handle(http.MethodGet, "v1", "/openapi.json", serveOpenAPI(cfg.OpenAPI))
+	}
+
+	describe(cfg.OpenAPI, app, cfg.OpenAPIServer,
+		public.Operations(),
+		graphqlgrp.Operations(),
+		rpcgrp.Operations(),
+		map[string]openapi.Operation{
+			"GET /v1/openapi.json": {
+				Tags:    []string{"public"},
+				Summary: "Get the OpenAPI document for the public and private routes",
+			},
+		},
+	)
+
 	return app
 }
 
@@ -67,6 +161,7 @@ func PrivateMux(cfg MuxConfig) http.Handler {
 	// Construct the web.App which holds all routes as well as common Middleware.
 	app := web.NewApp(
 		cfg.Shutdown,
+		cfg.Tracer,
 		mid.Logger(cfg.Log),
 		mid.Errors(cfg.Log),
 		mid.Metrics(),
@@ -84,14 +179,69 @@ func PrivateMux(cfg MuxConfig) http.Handler {
 
 	// Load the routes.
 	private.Routes(app, private.Config{
-		Log:   cfg.Log,
-		State: cfg.State,
-		NS:    cfg.NS,
+		Log:           cfg.Log,
+		State:         cfg.State,
+		NS:            cfg.NS,
+		BindPeerCerts: cfg.BindPeerCerts,
 	})
 
+	// Load the admin routes for operating the node.
+	if cfg.AdminToken != "" {
+		admingrp.Routes(app, admingrp.Config{
+			Log:      cfg.Log,
+			State:    cfg.State,
+			Evts:     cfg.Evts,
+			Webhooks: cfg.Webhooks,
+			Auth:     cfg.Auth,
+			Token:    cfg.AdminToken,
+		})
+	}
+
+	describe(cfg.OpenAPI, app, cfg.OpenAPIServer,
+		private.Operations(),
+		admingrp.Operations(),
+	)
+
 	return app
 }
 
+// describe adds the routes of the app to the OpenAPI document. Routes without
+// an operation are added as well so the document covers every route.
+func describe(doc *openapi.Document, app *web.App, server openapi.Server, ops ...map[string]openapi.Operation) {
+	if doc == nil {
+		return
+	}
+
+	all := make(map[string]openapi.Operation)
+	for _, m := range ops {
+		maps.Copy(all, m)
+	}
+
+	for _, rt := range app.Routes() {
+
+		// The preflight requests are handled for every path.
+		if rt.Method == http.MethodOptions {
+			continue
+		}
+
+		op := all[rt.Method+" "+rt.Path]
+		if server.URL != "" {
+			op.Servers = []openapi.Server{server}
+		}
+
+		doc.Add(rt.Method, rt.Path, op)
+	}
+}
+
+// serveOpenAPI returns a handler that responds with the document.
+func serveOpenAPI(doc *openapi.Document) web.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		web.SetStatusCode(ctx, http.StatusOK)
+		doc.ServeHTTP(w, r)
+		return nil
+	}
+}
+
 // DebugStandardLibraryMux registers all the debug routes from the standard library
 // into a new mux bypassing the use of the DefaultServerMux. Using the
 // DefaultServerMux would be a security risk since a dependency could inject a
@@ -110,20 +260,46 @@ func DebugStandardLibraryMux() *http.ServeMux {
 	return mux
 }
 
+// DebugConfig contains all the mandatory systems required by the debug
+// handlers.
+type DebugConfig struct {
+	Build   string
+	Log     *zap.SugaredLogger
+	State   *state.State
+	Metrics *metrics.Metrics
+	Traces  *trace.Recorder
+
+	// MaxSyncLag is the number of blocks the node can be behind its best
+	// peer and still be ready.
+	MaxSyncLag uint64
+
+	// MinPeers is the number of reachable peers required to be ready.
+	MinPeers int
+}
+
 // DebugMux registers all the debug standard library routes and then custom
 // debug application routes for the service. This bypassing the use of the
 // DefaultServerMux. Using the DefaultServerMux would be a security risk since
 // a dependency could inject a handler into our service without us knowing it.
-func DebugMux(build string, log *zap.SugaredLogger) http.Handler {
+func DebugMux(cfg DebugConfig) http.Handler {
 	mux := DebugStandardLibraryMux()
 
 	// Register debug check endpoints.
 	cgh := checkgrp.Handlers{
-		Build: build,
-		Log:   log,
+		Build:      cfg.Build,
+		Log:        cfg.Log,
+		State:      cfg.State,
+		MaxSyncLag: cfg.MaxSyncLag,
+		MinPeers:   cfg.MinPeers,
 	}
 	mux.HandleFunc("/debug/readiness", cgh.Readiness)
 	mux.HandleFunc("/debug/liveness", cgh.Liveness)
 
+	// Register the chain metrics in the Prometheus text format.
+	mux.Handle("/metrics", cfg.Metrics)
+
+	// Register the recent spans recorded by the node.
+	mux.Handle("/debug/traces", cfg.Traces)
+
 	return mux
 }
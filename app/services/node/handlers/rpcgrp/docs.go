@@ -0,0 +1,23 @@
+package rpcgrp
+
+import (
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+)
+
+// Operations describes the JSON-RPC route for the OpenAPI document, keyed by
+// the method and path of the route.
+func Operations() map[string]openapi.Operation {
+	op := auth.Describe(auth.ScopeRead, openapi.Operation{
+		Tags:    []string{"rpc"},
+		Summary: "Call an Ethereum compatible JSON-RPC method",
+		Description: "The body can also be a batch, which is an array of requests answered with an array of responses. " +
+			"Errors are reported in the JSON-RPC response. eth_sendRawTransaction also requires the submit scope.",
+		Request:  request{},
+		Response: response{},
+	})
+
+	return map[string]openapi.Operation{
+		"POST /rpc": op,
+	}
+}
@@ -0,0 +1,151 @@
+package rpcgrp
+
+import (
+	"encoding/json"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// version is the only version of the JSON-RPC protocol supported.
+const version = "2.0"
+
+// Set of error codes defined by the JSON-RPC 2.0 specification. Codes from
+// -32000 to -32099 are reserved for the server.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeServerError    = -32000
+	codeUnauthorized   = -32001
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// isNotification identifies a request the client doesn't want a response for.
+func (r request) isNotification() bool {
+	return r.ID == nil
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      json.RawMessage  `json:"id"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// =============================================================================
+
+type rpcBlock struct {
+	Number           hexutil.Uint64     `json:"number"`
+	Hash             string             `json:"hash"`
+	ParentHash       string             `json:"parentHash"`
+	Nonce            hexutil.Uint64     `json:"nonce"`
+	Miner            database.AccountID `json:"miner"`
+	Difficulty       hexutil.Uint64     `json:"difficulty"`
+	StateRoot        string             `json:"stateRoot"`
+	TransactionsRoot string             `json:"transactionsRoot"`
+	Timestamp        hexutil.Uint64     `json:"timestamp"`
+	GasLimit         hexutil.Uint64     `json:"gasLimit"`
+	GasUsed          hexutil.Uint64     `json:"gasUsed"`
+	Transactions     []any              `json:"transactions"`
+}
+
+type rpcTx struct {
+	Hash             string             `json:"hash"`
+	Nonce            hexutil.Uint64     `json:"nonce"`
+	BlockHash        *string            `json:"blockHash"`
+	BlockNumber      *hexutil.Uint64    `json:"blockNumber"`
+	TransactionIndex *hexutil.Uint64    `json:"transactionIndex"`
+	From             database.AccountID `json:"from"`
+	To               database.AccountID `json:"to"`
+	Value            hexutil.Uint64     `json:"value"`
+	GasPrice         hexutil.Uint64     `json:"gasPrice"`
+	Gas              hexutil.Uint64     `json:"gas"`
+	Input            hexutil.Bytes      `json:"input"`
+	ChainID          hexutil.Uint64     `json:"chainId"`
+	V                *hexutil.Big       `json:"v"`
+	R                *hexutil.Big       `json:"r"`
+	S                *hexutil.Big       `json:"s"`
+}
+
+// toRPCBlock converts a block into the format used by Ethereum. With full
+// set, the transactions are included instead of their hashes.
+func toRPCBlock(block database.Block, full bool) rpcBlock {
+	values := block.MerkleTree.Values()
+
+	var gasUsed uint64
+	trans := make([]any, len(values))
+	for i, tx := range values {
+		gasUsed += tx.GasUnits
+		switch full {
+		case true:
+			trans[i] = toRPCTx(tx, block, i)
+		default:
+			trans[i] = tx.HashHex()
+		}
+	}
+
+	return rpcBlock{
+		Number:           hexutil.Uint64(block.Header.Number),
+		Hash:             block.Hash(),
+		ParentHash:       block.Header.PrevBlockHash,
+		Nonce:            hexutil.Uint64(block.Header.Nonce),
+		Miner:            block.Header.BeneficiaryID,
+		Difficulty:       hexutil.Uint64(block.Header.Difficulty),
+		StateRoot:        block.Header.StateRoot,
+		TransactionsRoot: block.Header.TransRoot,
+		Timestamp:        hexutil.Uint64(block.Header.TimeStamp / 1000),
+		GasUsed:          hexutil.Uint64(gasUsed),
+		Transactions:     trans,
+	}
+}
+
+// toRPCTx converts a transaction into the format used by Ethereum. The block
+// information is left empty for a transaction that is still in the mempool.
+func toRPCTx(tx database.BlockTx, block database.Block, index int) rpcTx {
+	rtx := rpcTx{
+		Hash:     tx.HashHex(),
+		Nonce:    hexutil.Uint64(tx.Nonce),
+		From:     tx.FromID,
+		To:       tx.ToID,
+		Value:    hexutil.Uint64(tx.Value),
+		GasPrice: hexutil.Uint64(tx.GasPrice),
+		Gas:      hexutil.Uint64(tx.GasUnits),
+		Input:    tx.Data,
+		ChainID:  hexutil.Uint64(tx.ChainID),
+		V:        (*hexutil.Big)(tx.V),
+		R:        (*hexutil.Big)(tx.R),
+		S:        (*hexutil.Big)(tx.S),
+	}
+
+	if block.Header.Number > 0 {
+		hash := block.Hash()
+		number := hexutil.Uint64(block.Header.Number)
+		idx := hexutil.Uint64(index)
+
+		rtx.BlockHash = &hash
+		rtx.BlockNumber = &number
+		rtx.TransactionIndex = &idx
+	}
+
+	return rtx
+}
@@ -0,0 +1,28 @@
+package rpcgrp
+
+import (
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/mid"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"go.uber.org/zap"
+)
+
+// Config contains all the mandatory systems required by handlers.
+type Config struct {
+	Log   *zap.SugaredLogger
+	State *state.State
+}
+
+// Routes binds the JSON-RPC route.
+func Routes(app *web.App, cfg Config) {
+	rpc := Handlers{
+		Log:   cfg.Log,
+		State: cfg.State,
+	}
+
+	// Methods that submit transactions check for the submit scope.
+	app.Handle(http.MethodPost, "", "/rpc", rpc.Handle, mid.Scope(auth.ScopeRead))
+}
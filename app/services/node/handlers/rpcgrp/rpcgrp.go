@@ -0,0 +1,404 @@
+// Package rpcgrp maintains the group of handlers for the Ethereum compatible
+// JSON-RPC API.
+package rpcgrp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/sys/validate"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"go.uber.org/zap"
+)
+
+// Limits on what a client can send in a single call.
+const (
+	maxBodySize  = 1 << 20
+	maxBatchSize = 100
+)
+
+// Handlers manages the set of JSON-RPC methods.
+type Handlers struct {
+	Log   *zap.SugaredLogger
+	State *state.State
+}
+
+// Handle processes a JSON-RPC 2.0 call. The body can hold a single request
+// or a batch of requests. Errors are reported in the JSON-RPC response so
+// the HTTP status is always OK unless there is nothing to respond with.
+func (h Handlers) Handle(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("unable to read payload: %w", err)
+	}
+
+	body = bytes.TrimSpace(body)
+
+	// A batch is a JSON array of requests.
+	if len(body) > 0 && body[0] == '[' {
+		return h.batch(ctx, w, body)
+	}
+
+	resp := h.call(ctx, body)
+	if resp == nil {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// batch processes each request in the batch and responds with the set of
+// responses. Notifications don't get a response.
+func (h Handlers) batch(ctx context.Context, w http.ResponseWriter, body []byte) error {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(body, &raws); err != nil {
+		return web.Respond(ctx, w, errorResponse(nil, codeParseError, "parse error"), http.StatusOK)
+	}
+
+	switch {
+	case len(raws) == 0:
+		return web.Respond(ctx, w, errorResponse(nil, codeInvalidRequest, "empty batch"), http.StatusOK)
+
+	case len(raws) > maxBatchSize:
+		return web.Respond(ctx, w, errorResponse(nil, codeInvalidRequest, fmt.Sprintf("batch larger than %d requests", maxBatchSize)), http.StatusOK)
+	}
+
+	resps := make([]*response, 0, len(raws))
+	for _, raw := range raws {
+		if resp := h.call(ctx, raw); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+
+	if len(resps) == 0 {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+
+	return web.Respond(ctx, w, resps, http.StatusOK)
+}
+
+// call processes a single request. Nothing is returned for a notification.
+func (h Handlers) call(ctx context.Context, raw []byte) *response {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(nil, codeParseError, "parse error")
+		}
+		return errorResponse(nil, codeInvalidRequest, "invalid request")
+	}
+
+	if req.JSONRPC != version || req.Method == "" {
+		return errorResponse(req.ID, codeInvalidRequest, "invalid request")
+	}
+
+	result, err := h.dispatch(ctx, req.Method, req.Params)
+
+	if req.isNotification() {
+		return nil
+	}
+
+	if err != nil {
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			return &response{
+				JSONRPC: version,
+				ID:      req.ID,
+				Error:   rpcErr,
+			}
+		}
+
+		h.Log.Errorw("rpc", "method", req.Method, "ERROR", err)
+		return errorResponse(req.ID, codeInternalError, "internal error")
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, codeInternalError, "internal error")
+	}
+	msg := json.RawMessage(data)
+
+	return &response{
+		JSONRPC: version,
+		ID:      req.ID,
+		Result:  &msg,
+	}
+}
+
+// dispatch maps the method onto the state package.
+func (h Handlers) dispatch(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "eth_chainId":
+		return hexutil.Uint64(h.State.Genesis().ChainID), nil
+
+	case "eth_blockNumber":
+		return hexutil.Uint64(h.State.LatestBlock().Header.Number), nil
+
+	case "eth_getBalance":
+		return h.getBalance(params)
+
+	case "eth_getTransactionCount":
+		return h.getTransactionCount(params)
+
+	case "eth_getBlockByNumber":
+		return h.getBlockByNumber(params)
+
+	case "eth_getBlockByHash":
+		return h.getBlockByHash(params)
+
+	case "eth_getTransactionByHash":
+		return h.getTransactionByHash(params)
+
+	case "eth_sendRawTransaction":
+		return h.sendRawTransaction(ctx, params)
+	}
+
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not found", method)}
+}
+
+// =============================================================================
+
+// getBalance returns the balance of the account. Only the latest state of
+// the accounts is kept so a block number can't be used.
+func (h Handlers) getBalance(params json.RawMessage) (any, error) {
+	var accountID database.AccountID
+	tag := "latest"
+	if err := decodeParams(params, 1, &accountID, &tag); err != nil {
+		return nil, err
+	}
+
+	if err := latestOnly(tag); err != nil {
+		return nil, err
+	}
+
+	account, err := h.State.QueryAccount(accountID)
+	if err != nil {
+		return hexutil.Uint64(0), nil
+	}
+
+	return hexutil.Uint64(account.Balance), nil
+}
+
+// getTransactionCount returns the number of transactions sent from the
+// account. Nonces start at 1 so the nonce for the next transaction is the
+// count plus one. The pending count includes transactions in the mempool.
+func (h Handlers) getTransactionCount(params json.RawMessage) (any, error) {
+	var accountID database.AccountID
+	tag := "latest"
+	if err := decodeParams(params, 1, &accountID, &tag); err != nil {
+		return nil, err
+	}
+
+	if err := latestOnly(tag); err != nil {
+		return nil, err
+	}
+
+	var count uint64
+	if account, err := h.State.QueryAccount(accountID); err == nil {
+		count = account.Nonce
+	}
+
+	if tag == "pending" {
+		for _, tx := range h.State.Mempool() {
+			if tx.FromID == accountID {
+				count++
+			}
+		}
+	}
+
+	return hexutil.Uint64(count), nil
+}
+
+// getBlockByNumber returns the block with the specified number or null if
+// the block doesn't exist.
+func (h Handlers) getBlockByNumber(params json.RawMessage) (any, error) {
+	var tag string
+	var full bool
+	if err := decodeParams(params, 1, &tag, &full); err != nil {
+		return nil, err
+	}
+
+	number, err := h.blockNumber(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := h.State.QueryBlocksByNumber(number, number)
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	return toRPCBlock(blocks[0], full), nil
+}
+
+// getBlockByHash returns the block with the specified hash or null if the
+// block doesn't exist.
+func (h Handlers) getBlockByHash(params json.RawMessage) (any, error) {
+	var hash string
+	var full bool
+	if err := decodeParams(params, 1, &hash, &full); err != nil {
+		return nil, err
+	}
+
+	block, err := h.State.QueryBlockByHash(hash)
+	if err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return toRPCBlock(block, full), nil
+}
+
+// getTransactionByHash returns the transaction with the specified hash or
+// null if the transaction doesn't exist.
+func (h Handlers) getTransactionByHash(params json.RawMessage) (any, error) {
+	var hash string
+	if err := decodeParams(params, 1, &hash); err != nil {
+		return nil, err
+	}
+
+	tx, block, err := h.State.QueryTransaction(hash)
+	if err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	index := -1
+	for i, btx := range block.MerkleTree.Values() {
+		if btx.HashHex() == hash {
+			index = i
+			break
+		}
+	}
+
+	return toRPCTx(tx, block, index), nil
+}
+
+// sendRawTransaction adds a signed transaction to the mempool and returns
+// its hash.
+func (h Handlers) sendRawTransaction(ctx context.Context, params json.RawMessage) (any, error) {
+
+	// CORE NOTE: Ethereum transactions are RLP encoded and signed over a
+	// different hash than the Ardan blockchain uses, so an Ethereum wallet
+	// can't produce a transaction this node accepts. The raw transaction is
+	// the hex encoded JSON of a signed transaction, the same document the
+	// wallet posts to the tx/submit endpoint.
+
+	if !auth.HasScope(ctx, auth.ScopeSubmit) {
+		return nil, &rpcError{Code: codeUnauthorized, Message: "client not granted scope submit"}
+	}
+
+	var raw hexutil.Bytes
+	if err := decodeParams(params, 1, &raw); err != nil {
+		return nil, err
+	}
+
+	var signedTx database.SignedTx
+	if err := json.Unmarshal(raw, &signedTx); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unable to decode transaction: %s", err)}
+	}
+
+	// The fields that failed validation are reported in the same form as
+	// the rest of the API.
+	if err := validate.Check(signedTx); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid transaction", Data: validate.GetFieldErrors(err).Fields()}
+	}
+
+	if v, err := web.GetValues(ctx); err == nil {
+		h.Log.Infow("add tran", "traceid", v.TraceID, "sig:nonce", signedTx, "from", signedTx.FromID, "to", signedTx.ToID, "value", signedTx.Value, "tip", signedTx.Tip)
+	}
+
+	if err := h.State.UpsertWalletTransaction(ctx, signedTx); err != nil {
+		return nil, &rpcError{Code: codeServerError, Message: err.Error()}
+	}
+
+	// The hash includes the time the transaction was received, so look up
+	// the transaction the node just added.
+	sig := signedTx.SignatureString()
+	for _, tx := range h.State.Mempool() {
+		if tx.FromID == signedTx.FromID && tx.Nonce == signedTx.Nonce && tx.SignatureString() == sig {
+			return tx.HashHex(), nil
+		}
+	}
+
+	return nil, errors.New("transaction not found in mempool after submit")
+}
+
+// =============================================================================
+
+// blockNumber converts a block tag or hex encoded number to a block number.
+func (h Handlers) blockNumber(tag string) (uint64, error) {
+	switch tag {
+	case "latest", "pending", "safe", "finalized":
+		return h.State.LatestBlock().Header.Number, nil
+
+	case "earliest":
+		return 1, nil
+	}
+
+	number, err := hexutil.DecodeUint64(tag)
+	if err != nil {
+		return 0, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid block number %q", tag)}
+	}
+
+	return number, nil
+}
+
+// latestOnly validates the block tag refers to the latest state.
+func latestOnly(tag string) error {
+	switch tag {
+	case "latest", "pending":
+		return nil
+	}
+
+	return &rpcError{Code: codeInvalidParams, Message: "only the latest state is available"}
+}
+
+// decodeParams decodes the positional parameters into the specified values.
+// The first required values must be provided and the rest are optional.
+func decodeParams(params json.RawMessage, required int, values ...any) error {
+	var raws []json.RawMessage
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &raws); err != nil {
+			return &rpcError{Code: codeInvalidParams, Message: "params must be an array"}
+		}
+	}
+
+	if len(raws) < required || len(raws) > len(values) {
+		return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("expected between %d and %d params, got %d", required, len(values), len(raws))}
+	}
+
+	for i, raw := range raws {
+		if err := json.Unmarshal(raw, values[i]); err != nil {
+			return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("invalid param %d: %s", i, err)}
+		}
+	}
+
+	return nil
+}
+
+// errorResponse constructs a response for the error.
+func errorResponse(id json.RawMessage, code int, message string) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return &response{
+		JSONRPC: version,
+		ID:      id,
+		Error:   &rpcError{Code: code, Message: message},
+	}
+}
@@ -2,25 +2,37 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
+	"github.com/ardanlabs/blockchain/app/services/node/handlers/p2pgrp"
 	"github.com/ardanlabs/blockchain/app/services/node/handlers/routes"
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/mid"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/metrics"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/p2p"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/worker"
 	"github.com/ardanlabs/blockchain/foundation/events"
 	"github.com/ardanlabs/blockchain/foundation/logger"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+	"github.com/ardanlabs/blockchain/foundation/ratelimit"
+	"github.com/ardanlabs/blockchain/foundation/trace"
 	"github.com/ardanlabs/conf/v3"
 	"github.com/ethereum/go-ethereum/crypto"
 	"go.uber.org/zap"
@@ -65,17 +77,49 @@ func run(log *zap.SugaredLogger) error {
 			DebugHost       string        `conf:"default:0.0.0.0:7080"`
 			PublicHost      string        `conf:"default:0.0.0.0:8080"`
 			PrivateHost     string        `conf:"default:0.0.0.0:9080"`
+			P2PHost         string        `conf:"default:0.0.0.0:9090,flag:web-p2p-host,env:WEB_P2P_HOST"` // Leave empty to only use the private API
+			AdminToken      string        `conf:"mask"`                                                    // Leave empty to disable the admin API
+			CORSOrigins     []string      `conf:"default:*"`                                               // Origins allowed to call the public API from a browser
+		}
+		Auth struct {
+			KeysFile        string   `conf:"default:zblock/apikeys.json"` // API keys for the public API
+			JWTSecret       string   `conf:"mask"`                        // Leave empty to not accept tokens
+			AnonymousScopes []string `conf:"default:read;submit"`         // Scopes for clients without credentials
+		}
+		RateLimit struct {
+			IPRate   float64 `conf:"default:10"`  // Requests per second for each anonymous IP address
+			IPBurst  int     `conf:"default:50"`  //
+			KeyRate  float64 `conf:"default:100"` // Requests per second for each API key or token
+			KeyBurst int     `conf:"default:200"` //
 		}
 		State struct {
-			Beneficiary    string   `conf:"default:miner1"`
-			DBPath         string   `conf:"default:zblock/miner1/"`
-			SelectStrategy string   `conf:"default:Tip"`
-			OriginPeers    []string `conf:"default:0.0.0.0:9080"` //
-			Consensus      string   `conf:"default:POW"`          // Change to POA to run Proof of Authority
+			Beneficiary     string        `conf:"default:miner1"`
+			DBPath          string        `conf:"default:zblock/miner1/"`
+			IdentityFolder  string        `conf:"default:zblock/identity/"`
+			PeersFolder     string        `conf:"default:zblock/peers/"`
+			PeersStaleAge   time.Duration `conf:"default:168h"`
+			SelectStrategy  string        `conf:"default:Tip"`
+			OriginPeers     []string      `conf:"default:0.0.0.0:9080"` //
+			Consensus       string        `conf:"default:POW"`          // Change to POA to run Proof of Authority
+			ReadyMaxSyncLag uint64        `conf:"default:10"`           // Blocks the node can be behind its best peer and be ready
+			ReadyMinPeers   int           `conf:"default:1"`            // Set to 0 to run a single node
 		}
 		NameService struct {
 			Folder string `conf:"default:zblock/accounts/"`
 		}
+		Webhooks struct {
+			Folder string `conf:"default:zblock/webhooks/"`
+		}
+		Trace struct {
+			MaxSpans int  `conf:"default:10000"` // Number of recent spans kept for /debug/traces
+			Stdout   bool `conf:"default:false"` // Write every completed span to stdout as JSON
+		}
+		PeerTLS struct {
+			Enabled  bool `conf:"default:false"`
+			CertFile string
+			KeyFile  string
+			CAFile   string
+		}
 	}{
 		Version: conf.Version{
 			Build: build,
@@ -141,27 +185,95 @@ func run(log *zap.SugaredLogger) error {
 		return fmt.Errorf("unable to load private key for node: %w", err)
 	}
 
+	// The identity key identifies this node to its peers and is separate from
+	// the beneficiary key. A new key is generated the first time a node runs.
+	identityPath := fmt.Sprintf("%s%s.pem", cfg.State.IdentityFolder, cfg.State.Beneficiary)
+	identityKey, err := identity.LoadOrGenerate(identityPath)
+	if err != nil {
+		return fmt.Errorf("unable to load identity key for node: %w", err)
+	}
+
+	// The peer store is the address book of peers this node has talked to.
+	// Peers not seen within the stale age are dropped from the address book.
+	peersPath := fmt.Sprintf("%s%s.json", cfg.State.PeersFolder, cfg.State.Beneficiary)
+	peerStore := peer.NewStore(peersPath, cfg.State.PeersStaleAge)
+	records, err := peerStore.Load()
+	if err != nil {
+		return fmt.Errorf("unable to load peer store for node: %w", err)
+	}
+
+	// The private API can be secured with mutual TLS. Without a configured
+	// certificate, a self-signed certificate is generated from the identity
+	// key and peers pin it using the public key from the handshake.
+	var serverTLS, clientTLS *tls.Config
+	if cfg.PeerTLS.Enabled {
+		var cert tls.Certificate
+		var pool *x509.CertPool
+
+		switch cfg.PeerTLS.CertFile {
+		case "":
+			cert, err = identity.Certificate(identityKey)
+		default:
+			cert, pool, err = identity.LoadCertificate(cfg.PeerTLS.CertFile, cfg.PeerTLS.KeyFile, cfg.PeerTLS.CAFile)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to load peer tls certificate: %w", err)
+		}
+
+		serverTLS = identity.ServerTLS(cert, pool)
+		clientTLS = identity.ClientTLS(cert, pool)
+	}
+
 	// A peer set is a collection of known nodes in the network so transactions
-	// and blocks can be shared.
+	// and blocks can be shared. The origin peers are only used when the
+	// address book is empty.
 	peerSet := peer.NewPeerSet()
-	for _, host := range cfg.State.OriginPeers {
-		peerSet.Add(peer.New(host))
+	peerSet.Restore(records)
+	if len(records) == 0 {
+		for _, host := range cfg.State.OriginPeers {
+			peerSet.Add(peer.New(host))
+		}
 	}
 	peerSet.Add(peer.New(cfg.Web.PrivateHost))
+	log.Infow("startup", "status", "peer store", "path", peersPath, "peers", len(records))
 
-	// The blockchain packages accept a function of this signature to allow the
-	// application to log. For now, these raw messages are sent to any websocket
-	// client that is connected into the system through the events package.
+	// The blockchain packages publish typed events on the events bus. The raw
+	// messages passed to the event handler are published as log events and
+	// logging is just one of the subscribers. Websocket clients subscribe to
+	// the topics they want to receive.
 	evts := events.New()
 	ev := func(v string, args ...any) {
-		const websocketPrefix = "viewer:"
+		evts.Publish(events.Log{Message: fmt.Sprintf(v, args...)})
+	}
+
+	logEvents := func(msg events.Message) {
+		traceID := msg.TraceID
+		if traceID == "" {
+			traceID = "00000000-0000-0000-0000-000000000000"
+		}
 
-		s := fmt.Sprintf(v, args...)
-		log.Infow(s, "traceid", "00000000-0000-0000-0000-000000000000")
-		if strings.HasPrefix(s, websocketPrefix) {
-			evts.Send(s)
+		switch ev := msg.Data.(type) {
+		case events.Log:
+			log.Infow(ev.Message, "traceid", traceID)
+		case state.AdminAction:
+			log.Infow("audit", "traceid", ev.TraceID, "seq", msg.Seq, "action", ev.Action, "target", ev.Target, "remote", ev.Remote, "error", ev.Error)
+		default:
+			log.Infow("event", "traceid", traceID, "seq", msg.Seq, "topic", msg.Topic, "type", msg.Type)
 		}
 	}
+	if _, err := evts.Handle("logger", logEvents); err != nil {
+		return fmt.Errorf("registering event logger: %w", err)
+	}
+
+	// The tracer follows requests, mining and transactions through this node
+	// and to its peers. The most recent spans are kept in memory and can be
+	// written to stdout for collection by another system.
+	traces := trace.NewRecorder(cfg.Trace.MaxSpans)
+	exporters := []trace.Exporter{traces}
+	if cfg.Trace.Stdout {
+		exporters = append(exporters, trace.NewWriterExporter(os.Stdout))
+	}
+	tracer := trace.New(cfg.State.Beneficiary, exporters...)
 
 	// Construct the use of disk storage.
 	storage, err := disk.New(cfg.State.DBPath)
@@ -175,6 +287,16 @@ func run(log *zap.SugaredLogger) error {
 		return err
 	}
 
+	// Peers are reached over the streaming protocol when they support it. The
+	// private HTTP API is used on first contact and as a fallback.
+	var transport state.Transport = state.NewHTTPTransport(identityKey, clientTLS)
+	if cfg.Web.P2PHost != "" {
+		p2pClient := p2p.NewClient(identityKey, clientTLS)
+		defer p2pClient.Close()
+
+		transport = state.NewFallbackTransport(p2pClient, transport)
+	}
+
 	// The state value represents the blockchain node and manages the blockchain
 	// database and provides an API for application support.
 	state, err := state.New(state.Config{
@@ -184,19 +306,54 @@ func run(log *zap.SugaredLogger) error {
 		Genesis:        genesis,
 		SelectStrategy: cfg.State.SelectStrategy,
 		KnownPeers:     peerSet,
+		PeerStore:      peerStore,
 		Consensus:      cfg.State.Consensus,
+		NodeVersion:    build,
+		IdentityKey:    identityKey,
+		Transport:      transport,
+		P2PHost:        cfg.Web.P2PHost,
 		EvHandler:      ev,
+		Events:         evts,
+		Tracer:         tracer,
 	})
 	if err != nil {
 		return err
 	}
 	defer state.Shutdown()
 
+	// The chain metrics are collected from the events published by the
+	// blockchain so they need to be in place before the worker starts.
+	chainMetrics, err := metrics.New(metrics.Config{
+		Chain:  state,
+		Events: evts,
+	})
+	if err != nil {
+		return fmt.Errorf("starting metrics: %w", err)
+	}
+	defer chainMetrics.Shutdown()
+
 	// The worker package implements the different workflows such as mining,
 	// transaction peer sharing, and peer updates. The worker will register
 	// itself with the state.
 	worker.Run(state, ev)
 
+	// The webhook dispatcher delivers blockchain events to the endpoints
+	// registered by the operator. Hooks can be configured in the hooks.json
+	// file inside the folder or through the admin API.
+	webhookPath := fmt.Sprintf("%s%s/", cfg.Webhooks.Folder, cfg.State.Beneficiary)
+	webhooks, err := webhook.New(webhook.Config{
+		Dir:       webhookPath,
+		Events:    evts,
+		Clock:     state.Clock(),
+		EvHandler: ev,
+	})
+	if err != nil {
+		return fmt.Errorf("starting webhooks: %w", err)
+	}
+	defer webhooks.Shutdown()
+
+	log.Infow("startup", "status", "webhooks", "path", webhookPath, "hooks", len(webhooks.Hooks()))
+
 	// =========================================================================
 	// Start Debug Service
 
@@ -206,7 +363,15 @@ func run(log *zap.SugaredLogger) error {
 	// related endpoints. This includes the standard library endpoints.
 
 	// Construct the mux for the debug calls.
-	debugMux := routes.DebugMux(build, log)
+	debugMux := routes.DebugMux(routes.DebugConfig{
+		Build:      build,
+		Log:        log,
+		State:      state,
+		Metrics:    chainMetrics,
+		Traces:     traces,
+		MaxSyncLag: cfg.State.ReadyMaxSyncLag,
+		MinPeers:   cfg.State.ReadyMinPeers,
+	})
 
 	// Start the service listening for debug requests.
 	// Not concerned with shutting this down with load shedding.
@@ -233,13 +398,50 @@ func run(log *zap.SugaredLogger) error {
 
 	log.Infow("startup", "status", "initializing V1 public API support")
 
+	// Clients of the public API are identified by an API key or a token and
+	// are limited in the number of requests they can make.
+	apiKeys, err := auth.LoadKeys(cfg.Auth.KeysFile)
+	if err != nil {
+		return fmt.Errorf("unable to load api keys: %w", err)
+	}
+
+	apiAuth, err := auth.New(auth.Config{
+		Keys:            apiKeys,
+		JWTSecret:       cfg.Auth.JWTSecret,
+		AnonymousScopes: cfg.Auth.AnonymousScopes,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to configure api auth: %w", err)
+	}
+
+	log.Infow("startup", "status", "api auth", "keys", len(apiKeys), "tokens", cfg.Auth.JWTSecret != "", "anonymous", cfg.Auth.AnonymousScopes)
+
+	// The public and private routes are described in a single document that
+	// is served by the public API.
+	publicServer := openapi.Server{URL: hostURL("http", cfg.Web.PublicHost), Description: "Public API"}
+	privateServer := openapi.Server{URL: hostURL("http", cfg.Web.PrivateHost), Description: "Private API"}
+	if serverTLS != nil {
+		privateServer.URL = hostURL("https", cfg.Web.PrivateHost)
+	}
+	spec := routes.NewOpenAPI(build, publicServer)
+
 	// Construct the mux for the public API calls.
 	publicMux := routes.PublicMux(routes.MuxConfig{
-		Shutdown: shutdown,
-		Log:      log,
-		State:    state,
-		NS:       ns,
-		Evts:     evts,
+		Shutdown:    shutdown,
+		Log:         log,
+		State:       state,
+		NS:          ns,
+		Evts:        evts,
+		Tracer:      tracer,
+		Auth:        apiAuth,
+		RateLimiter: ratelimit.New(nil),
+		RateLimits: mid.RateLimits{
+			IP:  ratelimit.Limit{Rate: cfg.RateLimit.IPRate, Burst: cfg.RateLimit.IPBurst},
+			Key: ratelimit.Limit{Rate: cfg.RateLimit.KeyRate, Burst: cfg.RateLimit.KeyBurst},
+		},
+		CORSOrigins:   cfg.Web.CORSOrigins,
+		OpenAPI:       spec,
+		OpenAPIServer: publicServer,
 	})
 
 	// Construct a server to service the requests against the mux.
@@ -265,15 +467,24 @@ func run(log *zap.SugaredLogger) error {
 
 	// Construct the mux for the private API calls.
 	privateMux := routes.PrivateMux(routes.MuxConfig{
-		Shutdown: shutdown,
-		Log:      log,
-		State:    state,
+		Shutdown:      shutdown,
+		Log:           log,
+		State:         state,
+		Evts:          evts,
+		Webhooks:      webhooks,
+		Tracer:        tracer,
+		Auth:          apiAuth,
+		AdminToken:    cfg.Web.AdminToken,
+		BindPeerCerts: cfg.PeerTLS.Enabled && cfg.PeerTLS.CertFile == "",
+		OpenAPI:       spec,
+		OpenAPIServer: privateServer,
 	})
 
 	// Construct a server to service the requests against the mux.
 	private := http.Server{
 		Addr:         cfg.Web.PrivateHost,
 		Handler:      privateMux,
+		TLSConfig:    serverTLS,
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 		IdleTimeout:  cfg.Web.IdleTimeout,
@@ -282,10 +493,35 @@ func run(log *zap.SugaredLogger) error {
 
 	// Start the service listening for api requests.
 	go func() {
-		log.Infow("startup", "status", "private api router started", "host", private.Addr)
+		log.Infow("startup", "status", "private api router started", "host", private.Addr, "tls", serverTLS != nil)
+		if serverTLS != nil {
+			serverErrors <- private.ListenAndServeTLS("", "")
+			return
+		}
 		serverErrors <- private.ListenAndServe()
 	}()
 
+	// =========================================================================
+	// Start P2P Service
+
+	// The streaming protocol uses long-lived connections between peers.
+	var p2pServer *p2p.Server
+	if cfg.Web.P2PHost != "" {
+		p2pgh := p2pgrp.Handlers{
+			Log:    log,
+			State:  state,
+			Tracer: tracer,
+		}
+		p2pServer = p2p.NewServer(identityKey, serverTLS, p2pgh.Handle, ev)
+
+		go func() {
+			log.Infow("startup", "status", "p2p router started", "host", cfg.Web.P2PHost, "tls", serverTLS != nil)
+			if err := p2pServer.ListenAndServe(cfg.Web.P2PHost); !errors.Is(err, p2p.ErrServerClosed) {
+				serverErrors <- err
+			}
+		}()
+	}
+
 	// =========================================================================
 	// Shutdown
 
@@ -306,6 +542,14 @@ func run(log *zap.SugaredLogger) error {
 		ctx, cancelPub := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancelPub()
 
+		// Close the peer connections and wait for requests in progress.
+		if p2pServer != nil {
+			log.Infow("shutdown", "status", "shutdown p2p started")
+			if err := p2pServer.Shutdown(ctx); err != nil {
+				return fmt.Errorf("could not stop p2p service gracefully: %w", err)
+			}
+		}
+
 		// Asking listener to shut down and shed load.
 		log.Infow("shutdown", "status", "shutdown private API started")
 		if err := private.Shutdown(ctx); err != nil {
@@ -327,3 +571,19 @@ func run(log *zap.SugaredLogger) error {
 
 	return nil
 }
+
+// hostURL returns the url clients use to reach a server listening on the
+// host. A server listening on every interface is reached on localhost.
+func hostURL(scheme string, hostport string) string {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return scheme + "://" + hostport
+	}
+
+	switch host {
+	case "", "0.0.0.0", "::":
+		host = "localhost"
+	}
+
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
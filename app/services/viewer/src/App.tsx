@@ -70,6 +70,11 @@ class App extends Component<{}, State> {
     const ws = new WebSocket(wsUrl)
     ws.onopen = () => {
       this.changeNodeState('Connection open', nodeID)
+      ws.send(JSON.stringify({
+        id: 1,
+        method: 'subscribe',
+        params: { kind: 'events', topics: ['blocks', 'mining'] },
+      }))
       try{
         axios.get(httpUrl)
         .then(res => {
@@ -82,28 +87,31 @@ class App extends Component<{}, State> {
     }
     ws.onmessage = (evt: MessageEvent) => {
       if (evt.data) {
-        let text = evt.data        
-        if (text.startsWith("viewer: block:")) {
-            const blockMsgStart = 'viewer: block:'
-            text = text.substring(blockMsgStart.length);
-            let block = JSON.parse(text);
-            this.handleNewBlock(block, nodeID, accountID);
-            return;
+        const msg = JSON.parse(evt.data)
+        if (msg.error) {
+          console.error('Subscription failed: ', msg.error)
+          return;
         }
-        if (text.includes("MINING: completed")) {
+        switch (msg.type) {
+          case "BlockAdded":
+            this.handleNewBlock(msg.data.block, nodeID, accountID);
+            return;
+          case "MiningCompleted":
+          case "MiningCancelled": {
             this.changeNodeState('Connected', nodeID)
             let activlyMiningModified = this.state.activlyMining
             activlyMiningModified[nodeID - 1] = false
             this.setState({activlyMining : activlyMiningModified })
             return;
-        }
-        if (text.includes("MINING: running")) {
-          console.info(text.replace('viewer: ', ''))
-          this.changeNodeState('Mining...', nodeID)
-          let activlyMiningModified = this.state.activlyMining
-          activlyMiningModified[nodeID - 1] = true
-          this.setState({activlyMining : activlyMiningModified })
-          return;
+          }
+          case "MiningStarted": {
+            console.info(`mining block ${msg.data.number} with ${msg.data.txs} transactions`)
+            this.changeNodeState('Mining...', nodeID)
+            let activlyMiningModified = this.state.activlyMining
+            activlyMiningModified[nodeID - 1] = true
+            this.setState({activlyMining : activlyMiningModified })
+            return;
+          }
         }
       }
       return;
@@ -27,29 +27,38 @@ export default function connect(wsUrl, httpUrl, nodeID, accountID) {
   let socket = new WebSocket(wsUrl)
   socket.onopen = function () {
     nodes[nodeID].state = 'Connection open'
+    socket.send(
+      JSON.stringify({
+        id: 1,
+        method: 'subscribe',
+        params: { kind: 'events', topics: ['blocks', 'mining'] },
+      }),
+    )
     var oReq = new XMLHttpRequest()
     oReq.addEventListener('load', reqListener.bind(oReq, nodeID), false)
     oReq.open('GET', httpUrl)
     oReq.send()
   }
   socket.onmessage = function (event) {
-    let text = event.data
-    if (text.startsWith('viewer: block:')) {
-      const blockMsgStart = 'viewer: block:'
-      text = text.substring(blockMsgStart.length)
-      let block = JSON.parse(text)
-      handleNewBlock(block)
-      return
-    }
-    if (text.includes('MINING: completed')) {
-      nodes[nodeID].state = 'Connected'
+    const msg = JSON.parse(event.data)
+    if (msg.error) {
+      console.error('Subscription failed: ', msg.error)
       return
     }
-    if (text.includes('MINING: running')) {
-      nodes[nodeID].state = 'Mining...'
-      return
+    switch (msg.type) {
+      case 'BlockAdded':
+        handleNewBlock(msg.data.block)
+        return
+      case 'MiningStarted':
+        nodes[nodeID].state = 'Mining...'
+        return
+      case 'MiningCompleted':
+      case 'MiningCancelled':
+        nodes[nodeID].state = 'Connected'
+        return
+      default:
+        return
     }
-    return
   }
   socket.onclose = function (event) {
     console.log(
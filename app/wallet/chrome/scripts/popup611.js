@@ -65,6 +65,11 @@ function connect() {
         const conn = document.getElementById('connected');
         conn.className = 'connected';
         conn.innerHTML = 'CONNECTED';
+        socket.send(JSON.stringify({
+            id: 1,
+            method: 'subscribe',
+            params: { kind: 'events', topics: ['mining'] },
+        }));
         load();
     });
 
@@ -76,15 +81,16 @@ function connect() {
 
     socket.addEventListener('message', function (event) {
         const conn = document.getElementById('connected');
+        const msg = JSON.parse(event.data);
 
-        if (event.data.includes('MINING: completed')) {
+        if (msg.type == 'MiningCompleted' || msg.type == 'MiningCancelled') {
             conn.className = 'connected';
             conn.innerHTML = 'CONNECTED';
             load();
             return;
         }
 
-        if (event.data.includes('MINING: running')) {
+        if (msg.type == 'MiningStarted') {
             conn.className = 'mining';
             conn.innerHTML = 'MINING...';
             return;
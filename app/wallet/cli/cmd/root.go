@@ -2,6 +2,8 @@
 package cmd
 
 import (
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,6 +14,7 @@ import (
 var (
 	accountName string
 	accountPath string
+	apiKey      string
 )
 
 const (
@@ -22,6 +25,7 @@ func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().StringVarP(&accountName, "account", "a", "private.ecdsa", "The account to use.")
 	rootCmd.PersistentFlags().StringVarP(&accountPath, "account-path", "p", "zblock/accounts/", "Path to the directory with private keys.")
+	rootCmd.PersistentFlags().StringVarP(&apiKey, "api-key", "k", "", "API key to send to the node.")
 }
 
 var rootCmd = &cobra.Command{
@@ -43,3 +47,21 @@ func getPrivateKeyPath() string {
 
 	return filepath.Join(accountPath, accountName)
 }
+
+// doRequest sends a request to the node with the API key when one is set.
+func doRequest(method string, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	return http.DefaultClient.Do(req)
+}
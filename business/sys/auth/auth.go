@@ -0,0 +1,212 @@
+// Package auth provides support for authenticating clients of the public API
+// with API keys or JWTs and authorizing them by scope.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// The set of scopes a client can be granted.
+const (
+	ScopeRead   = "read"
+	ScopeSubmit = "submit"
+)
+
+// HeaderAPIKey is the header a client uses to provide its API key.
+const HeaderAPIKey = "X-API-Key"
+
+// ErrInvalidCredentials is returned when a client provides an API key or
+// token that can't be verified.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// scopes is the set of known scopes.
+var scopes = []string{ScopeRead, ScopeSubmit}
+
+// =============================================================================
+
+// Key represents an API key issued to a client. The rate and burst override
+// the default rate limit for keys when set.
+type Key struct {
+	ID     string   `json:"id"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+	Rate   float64  `json:"rate,omitempty"`
+	Burst  int      `json:"burst,omitempty"`
+}
+
+// LoadKeys reads the API keys from the JSON file at the specified path. A
+// missing file means there are no keys.
+func LoadKeys(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("decoding keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// Client represents the caller of a request. A client that provided no
+// credentials is anonymous and has the anonymous scopes.
+type Client struct {
+	ID        string
+	Scopes    []string
+	Anonymous bool
+	Rate      float64
+	Burst     int
+}
+
+// HasScope checks if the client was granted the scope.
+func (c Client) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// =============================================================================
+
+// Config represents the information required to authenticate clients.
+type Config struct {
+	Keys            []Key
+	JWTSecret       string
+	AnonymousScopes []string
+}
+
+// Auth authenticates the clients of the public API.
+type Auth struct {
+	keys      map[[sha256.Size]byte]Key
+	secret    []byte
+	anonymous []string
+}
+
+// New constructs an Auth for the configured keys and JWT secret.
+func New(cfg Config) (*Auth, error) {
+	if err := checkScopes(cfg.AnonymousScopes); err != nil {
+		return nil, fmt.Errorf("anonymous: %w", err)
+	}
+
+	// CORE NOTE: The keys are indexed by their hash so a lookup doesn't
+	// compare the provided key to the real keys one byte at a time, which
+	// would leak how much of a key was guessed through timing.
+
+	keys := make(map[[sha256.Size]byte]Key, len(cfg.Keys))
+	ids := make(map[string]bool, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		switch {
+		case key.ID == "":
+			return nil, errors.New("key id is required")
+		case key.Key == "":
+			return nil, fmt.Errorf("key %s: key is required", key.ID)
+		case ids[key.ID]:
+			return nil, fmt.Errorf("key %s: duplicate id", key.ID)
+		}
+
+		if err := checkScopes(key.Scopes); err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.ID, err)
+		}
+
+		ids[key.ID] = true
+		keys[sha256.Sum256([]byte(key.Key))] = key
+	}
+
+	a := Auth{
+		keys:      keys,
+		secret:    []byte(cfg.JWTSecret),
+		anonymous: cfg.AnonymousScopes,
+	}
+
+	return &a, nil
+}
+
+// Authenticate identifies the client that made the request using the API
+// key header or a bearer token. A request without credentials is from an
+// anonymous client. Credentials that can't be verified are an error.
+func (a *Auth) Authenticate(r *http.Request) (Client, error) {
+	if apiKey := r.Header.Get(HeaderAPIKey); apiKey != "" {
+		key, exists := a.keys[sha256.Sum256([]byte(apiKey))]
+		if !exists {
+			return Client{}, ErrInvalidCredentials
+		}
+
+		client := Client{
+			ID:     key.ID,
+			Scopes: key.Scopes,
+			Rate:   key.Rate,
+			Burst:  key.Burst,
+		}
+		return client, nil
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if len(a.secret) == 0 {
+			return Client{}, ErrInvalidCredentials
+		}
+
+		claims, err := verifyToken(a.secret, token)
+		if err != nil {
+			return Client{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+		}
+
+		client := Client{
+			ID:     claims.Subject,
+			Scopes: strings.Fields(claims.Scope),
+		}
+		return client, nil
+	}
+
+	client := Client{
+		Scopes:    a.anonymous,
+		Anonymous: true,
+	}
+
+	return client, nil
+}
+
+// checkScopes validates the scopes are known.
+func checkScopes(list []string) error {
+	for _, scope := range list {
+		if !slices.Contains(scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// ctxKey represents the type of value for the context key.
+type ctxKey int
+
+// clientKey is how the client is stored/retrieved.
+const clientKey ctxKey = 1
+
+// SetClient stores the client in the context.
+func SetClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey, client)
+}
+
+// GetClient returns the client from the context.
+func GetClient(ctx context.Context) (Client, bool) {
+	client, ok := ctx.Value(clientKey).(Client)
+	return client, ok
+}
+
+// HasScope checks if the client in the context was granted the scope.
+func HasScope(ctx context.Context, scope string) bool {
+	client, ok := GetClient(ctx)
+	return ok && client.HasScope(scope)
+}
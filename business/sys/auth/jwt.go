@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// CORE NOTE: Tokens are JWTs signed with HMAC-SHA256 using a secret shared
+// by the node and whoever issues the tokens. The scopes are provided in the
+// scope claim as a space separated list like OAuth 2.0 does. Tokens must
+// expire so a leaked token can't be used forever.
+
+// jwtHeader is the only header accepted and produced.
+const jwtHeader = `{"alg":"HS256","typ":"JWT"}`
+
+// Claims represents the claims in a token.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Scope     string `json:"scope"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// GenerateToken produces a token for the subject with the scopes that
+// expires after the specified duration.
+func (a *Auth) GenerateToken(subject string, scopes []string, ttl time.Duration) (string, error) {
+	if len(a.secret) == 0 {
+		return "", errors.New("no jwt secret configured")
+	}
+
+	if subject == "" {
+		return "", errors.New("subject is required")
+	}
+
+	if err := checkScopes(scopes); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Subject:   subject,
+		Scope:     strings.Join(scopes, " "),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(jwtHeader)) + "." + enc.EncodeToString(payload)
+
+	return unsigned + "." + enc.EncodeToString(sign(a.secret, unsigned)), nil
+}
+
+// verifyToken checks the signature and times of the token and returns
+// its claims.
+func verifyToken(secret []byte, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, errors.New("malformed token")
+	}
+
+	enc := base64.RawURLEncoding
+
+	rawHeader, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return Claims{}, errors.New("malformed token header")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return Claims{}, errors.New("malformed token header")
+	}
+
+	// Only accept the algorithm the node signs with. Trusting the header
+	// would allow a token with no signature at all.
+	if header.Alg != "HS256" {
+		return Claims{}, errors.New("unsupported token algorithm")
+	}
+
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, sign(secret, parts[0]+"."+parts[1])) {
+		return Claims{}, errors.New("invalid token signature")
+	}
+
+	rawClaims, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, errors.New("malformed token claims")
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return Claims{}, errors.New("malformed token claims")
+	}
+
+	now := time.Now().Unix()
+	switch {
+	case claims.Subject == "":
+		return Claims{}, errors.New("token has no subject")
+	case claims.ExpiresAt == 0:
+		return Claims{}, errors.New("token has no expiration")
+	case now >= claims.ExpiresAt:
+		return Claims{}, errors.New("token has expired")
+	case claims.NotBefore != 0 && now < claims.NotBefore:
+		return Claims{}, errors.New("token is not valid yet")
+	}
+
+	return claims, nil
+}
+
+// sign produces the HMAC-SHA256 signature for the data.
+func sign(secret []byte, data string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
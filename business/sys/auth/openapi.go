@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+)
+
+// Names of the security schemes in the OpenAPI document.
+const (
+	SchemeAPIKey = "apiKey"
+	SchemeBearer = "bearerToken"
+)
+
+// SecuritySchemes returns the ways a client of the public API provides
+// credentials, keyed by the name of the security scheme.
+func SecuritySchemes() map[string]openapi.SecurityScheme {
+	return map[string]openapi.SecurityScheme{
+		SchemeAPIKey: {
+			Type:        "apiKey",
+			Description: "API key issued by the operator of the node.",
+			Name:        HeaderAPIKey,
+			In:          openapi.InHeader,
+		},
+		SchemeBearer: {
+			Type:         "http",
+			Description:  "Token issued by the admin API of the node.",
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+		},
+	}
+}
+
+// Describe adds the credentials and the scope a route requires to the
+// operation. The operation can be called without credentials when the node
+// grants the scope to anonymous clients.
+func Describe(scope string, op openapi.Operation) openapi.Operation {
+	op.Security = []openapi.SecurityRequirement{
+		{SchemeAPIKey: {}},
+		{SchemeBearer: {}},
+		{},
+	}
+
+	note := fmt.Sprintf("Requires the %s scope.", scope)
+	if op.Description != "" {
+		note = op.Description + " " + note
+	}
+	op.Description = note
+
+	return op
+}
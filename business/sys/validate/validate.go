@@ -2,7 +2,9 @@
 package validate
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 
@@ -66,6 +68,51 @@ func Check(val any) error {
 	return nil
 }
 
+// DecodeError converts an error from decoding a JSON document into field
+// errors when the error is about a specific field, so the client learns which
+// field is wrong. Any other error is returned as is.
+func DecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return FieldErrors{{
+			Field: typeErr.Field,
+			Error: fmt.Sprintf("%s must be a %s", typeErr.Field, jsonType(typeErr.Type)),
+		}}
+	}
+
+	// The json package doesn't provide a type for unknown fields.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return FieldErrors{{
+			Field: field,
+			Error: fmt.Sprintf("%s is not a known field", field),
+		}}
+	}
+
+	return err
+}
+
+// jsonType returns the name of the JSON type a Go type is decoded from.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+
+	case reflect.String:
+		return "string"
+
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+
+	return "object"
+}
+
 // GenerateID generate a unique id for entities.
 func GenerateID() string {
 	return uuid.NewString()
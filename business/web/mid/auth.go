@@ -0,0 +1,149 @@
+package mid
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/errs"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// Authenticate validates that the request was signed by a node identity key.
+// Requests that are unsigned, have an invalid signature, are too old or have
+// already been seen are rejected.
+func Authenticate(v *identity.Verifier) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			publicKey, err := v.VerifyRequest(r)
+			if err != nil {
+				if errors.Is(err, identity.ErrBodyTooLarge) {
+					return errs.NewTrusted(err, http.StatusRequestEntityTooLarge)
+				}
+				return errs.NewTrusted(err, http.StatusUnauthorized)
+			}
+
+			// Add the verified public key to the context for the handlers.
+			ctx = identity.SetPublicKey(ctx, publicKey)
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// Authorize validates that the identity key that signed the request belongs
+// to a known peer. This middleware must run after Authenticate.
+func Authorize(isKnown func(publicKey string) bool) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if !isKnown(identity.GetPublicKey(ctx)) {
+				return errs.NewTrusted(identity.ErrUnknownIdentity, http.StatusForbidden)
+			}
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// AdminAuth validates that the request carries the operator's admin token
+// as a bearer token in the Authorization header.
+func AdminAuth(token string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+				return errs.NewTrusted(errors.New("invalid admin token"), http.StatusUnauthorized)
+			}
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// APIAuth identifies the client of the public API from its API key or bearer
+// token. Requests without credentials are handled as an anonymous client.
+// Credentials that can't be verified are rejected.
+func APIAuth(a *auth.Auth) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			client, err := a.Authenticate(r)
+			if err != nil {
+				return errs.NewTrusted(err, http.StatusUnauthorized)
+			}
+
+			// Add the client to the context for the handlers.
+			ctx = auth.SetClient(ctx, client)
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// Scope validates that the client was granted the scope required by the
+// route. This middleware must run after APIAuth.
+func Scope(scope string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			client, ok := auth.GetClient(ctx)
+			switch {
+			case !ok || (client.Anonymous && !client.HasScope(scope)):
+				return errs.NewTrusted(fmt.Errorf("authentication required for scope %s", scope), http.StatusUnauthorized)
+
+			case !client.HasScope(scope):
+				return errs.NewTrusted(fmt.Errorf("client %s not granted scope %s", client.ID, scope), http.StatusForbidden)
+			}
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -3,12 +3,16 @@ package mid
 import (
 	"context"
 	"net/http"
+	"slices"
 
 	"github.com/ardanlabs/blockchain/foundation/web"
 )
 
-// Cors sets the response headers needed for Cross-Origin Resource Sharing
-func Cors(origin string) web.Middleware {
+// Cors sets the response headers needed for Cross-Origin Resource Sharing.
+// The origin of the request is allowed if it's in the list of origins. An
+// origin of "*" allows every origin.
+func Cors(origins ...string) web.Middleware {
+	wildcard := slices.Contains(origins, "*")
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
@@ -17,9 +21,16 @@ func Cors(origin string) web.Middleware {
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
 			// Set the CORS headers to the response.
-			w.Header().Set("Access-Control-Allow-Origin", origin)
+			switch origin := r.Header.Get("Origin"); {
+			case wildcard:
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			case slices.Contains(origins, origin):
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Origin, Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, traceparent")
+			w.Header().Set("Access-Control-Expose-Headers", "Link, X-Next-Cursor, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
 
 			// Call the next handler.
 			return handler(ctx, w, r)
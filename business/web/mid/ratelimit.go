@@ -0,0 +1,124 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/errs"
+	"github.com/ardanlabs/blockchain/foundation/ratelimit"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// RateLimits represents the limits applied to the clients of an API.
+// Anonymous clients are limited by IP address and authenticated clients by
+// their id. A key can be given its own limit.
+type RateLimits struct {
+	IP  ratelimit.Limit
+	Key ratelimit.Limit
+}
+
+// RateLimit limits the rate of requests a client can make using a token
+// bucket. Every response reports the state of the bucket in the rate limit
+// headers. This middleware must run after APIAuth.
+func RateLimit(lim *ratelimit.Limiter, limits RateLimits) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			key, limit := rateKey(ctx, r, limits)
+
+			res := lim.Allow(key, limit)
+			if res.Limit > 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				w.Header().Set("X-RateLimit-Reset", ceilSeconds(res.Reset))
+			}
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				return errs.NewTrusted(errors.New("rate limit exceeded"), http.StatusTooManyRequests)
+			}
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// AuthLimit limits the rate of failed authentications from an IP address so
+// credentials can't be guessed without limit. Every failed attempt takes a
+// token from a bucket for the address that is kept apart from the bucket for
+// anonymous requests, and requests are refused before they are authenticated
+// once it's empty. This middleware must run before APIAuth.
+func AuthLimit(lim *ratelimit.Limiter, limits RateLimits) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			key := "auth:" + remoteIP(r)
+
+			if res := lim.Peek(key, limits.IP); !res.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				return errs.NewTrusted(errors.New("rate limit exceeded"), http.StatusTooManyRequests)
+			}
+
+			// Call the next handler.
+			err := handler(ctx, w, r)
+
+			if re := errs.GetTrusted(err); re != nil && errors.Is(re.Err, auth.ErrInvalidCredentials) {
+				lim.Allow(key, limits.IP)
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// rateKey identifies the bucket and limit for the client of the request.
+func rateKey(ctx context.Context, r *http.Request, limits RateLimits) (string, ratelimit.Limit) {
+	client, ok := auth.GetClient(ctx)
+	if ok && !client.Anonymous {
+		limit := limits.Key
+		if client.Rate > 0 {
+			limit = ratelimit.Limit{Rate: client.Rate, Burst: client.Burst}
+		}
+		return "client:" + client.ID, limit
+	}
+
+	return "ip:" + remoteIP(r), limits.IP
+}
+
+// remoteIP returns the IP address of the request. The address of the
+// connection is used since forwarding headers can be set to anything by the
+// client.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return host
+}
+
+// ceilSeconds formats the duration as a whole number of seconds rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
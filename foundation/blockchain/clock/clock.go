@@ -0,0 +1,161 @@
+// Package clock provides a source of time that can be replaced so the
+// blockchain can run against a controlled clock in tests and simulations.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock represents the behavior required to tell the time and to produce
+// tickers.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker represents the behavior of a time.Ticker created by a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// =============================================================================
+
+// System is the clock that uses the system's wall-clock time.
+type System struct{}
+
+// New constructs a clock that uses the system's wall-clock time.
+func New() System {
+	return System{}
+}
+
+// Now returns the current local time.
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker returns a ticker backed by a time.Ticker.
+func (System) NewTicker(d time.Duration) Ticker {
+	return systemTicker{ticker: time.NewTicker(d)}
+}
+
+// systemTicker adapts a time.Ticker to the Ticker interface.
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (st systemTicker) C() <-chan time.Time {
+	return st.ticker.C
+}
+
+func (st systemTicker) Reset(d time.Duration) {
+	st.ticker.Reset(d)
+}
+
+func (st systemTicker) Stop() {
+	st.ticker.Stop()
+}
+
+// =============================================================================
+
+// Manual is a clock that only moves when it's advanced. Tickers created
+// from this clock fire as time is advanced past their next tick.
+type Manual struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers map[*manualTicker]struct{}
+}
+
+// NewManual constructs a clock that starts at the specified time.
+func NewManual(start time.Time) *Manual {
+	return &Manual{
+		now:     start,
+		tickers: make(map[*manualTicker]struct{}),
+	}
+}
+
+// Now returns the current time of the clock.
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.now
+}
+
+// NewTicker returns a ticker that fires when the clock is advanced.
+func (m *Manual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mt := manualTicker{
+		clock:  m,
+		c:      make(chan time.Time, 1),
+		period: d,
+		next:   m.now.Add(d),
+	}
+	m.tickers[&mt] = struct{}{}
+
+	return &mt
+}
+
+// Advance moves the clock forward by the specified duration and fires the
+// tickers that are due. Like a time.Ticker, a ticker that is due more than
+// once only delivers one tick if the previous tick hasn't been received.
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = m.now.Add(d)
+
+	for mt := range m.tickers {
+		if mt.next.After(m.now) {
+			continue
+		}
+
+		select {
+		case mt.c <- mt.next:
+		default:
+		}
+
+		missed := m.now.Sub(mt.next) / mt.period
+		mt.next = mt.next.Add((missed + 1) * mt.period)
+	}
+}
+
+// manualTicker is a ticker driven by a Manual clock.
+type manualTicker struct {
+	clock  *Manual
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (mt *manualTicker) C() <-chan time.Time {
+	return mt.c
+}
+
+func (mt *manualTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Reset")
+	}
+
+	mt.clock.mu.Lock()
+	defer mt.clock.mu.Unlock()
+
+	mt.period = d
+	mt.next = mt.clock.now.Add(d)
+	mt.clock.tickers[mt] = struct{}{}
+}
+
+func (mt *manualTicker) Stop() {
+	mt.clock.mu.Lock()
+	defer mt.clock.mu.Unlock()
+
+	delete(mt.clock.tickers, mt)
+}
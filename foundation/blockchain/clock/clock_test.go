@@ -0,0 +1,54 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+)
+
+func Test_Manual(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewManual(start)
+
+	ticker := clk.NewTicker(12 * time.Second)
+	defer ticker.Stop()
+
+	clk.Advance(11 * time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatalf("Should not tick before the interval has passed.")
+	default:
+	}
+
+	clk.Advance(time.Second)
+	select {
+	case tick := <-ticker.C():
+		if exp := start.Add(12 * time.Second); !tick.Equal(exp) {
+			t.Fatalf("Should tick at %s, got %s.", exp, tick)
+		}
+	default:
+		t.Fatalf("Should tick once the interval has passed.")
+	}
+
+	// Missed ticks are dropped like a time.Ticker does.
+	clk.Advance(time.Minute)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Fatalf("Should only deliver one tick when ticks are missed.")
+	default:
+	}
+
+	ticker.Reset(time.Second)
+	clk.Advance(time.Second)
+	select {
+	case <-ticker.C():
+	default:
+		t.Fatalf("Should tick on the new interval after a reset.")
+	}
+
+	if exp := start.Add(73 * time.Second); !clk.Now().Equal(exp) {
+		t.Fatalf("Should report the advanced time %s, got %s.", exp, clk.Now())
+	}
+}
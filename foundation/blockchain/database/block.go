@@ -5,10 +5,12 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/merkle"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 )
@@ -17,13 +19,63 @@ import (
 // is two or more blocks ahead of ours.
 var ErrChainForked = errors.New("blockchain forked, start resync")
 
+// ErrInvalidBlock is returned from ValidateBlock when the block breaks the
+// consensus rules regardless of the state of this node's chain. A peer that
+// provides a block like this is misbehaving.
+var ErrInvalidBlock = errors.New("invalid block")
+
+// The set of reasons a block fails validation.
+const (
+	ReasonForked     = "forked"
+	ReasonDifficulty = "difficulty"
+	ReasonHash       = "hash"
+	ReasonNumber     = "number"
+	ReasonParent     = "parent"
+	ReasonTimestamp  = "timestamp"
+	ReasonStateRoot  = "state_root"
+	ReasonMerkleRoot = "merkle_root"
+)
+
+// ValidationError is returned from ValidateBlock and identifies the check
+// the block failed.
+type ValidationError struct {
+	Reason string
+	err    error
+}
+
+// Error implements the error interface.
+func (ve *ValidationError) Error() string {
+	return ve.err.Error()
+}
+
+// Unwrap provides support for errors.Is and errors.As.
+func (ve *ValidationError) Unwrap() error {
+	return ve.err
+}
+
+// ValidationReason returns the reason the block failed validation. If the
+// error isn't a validation error, an empty string is returned.
+func ValidationReason(err error) string {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return ve.Reason
+	}
+
+	return ""
+}
+
+// invalid constructs a validation error for the specified reason.
+func invalid(reason string, err error) error {
+	return &ValidationError{Reason: reason, err: err}
+}
+
 // =============================================================================
 
 // BlockData represents what can be serialized to disk and over the network.
 type BlockData struct {
-	Hash   string      `json:"hash"`
+	Hash   string      `json:"hash" validate:"required"`
 	Header BlockHeader `json:"block"`
-	Trans  []BlockTx   `json:"trans"`
+	Trans  []BlockTx   `json:"trans" validate:"dive"`
 }
 
 // NewBlockData constructs block data from a block.
@@ -54,17 +106,57 @@ func ToBlock(blockData BlockData) (Block, error) {
 
 // =============================================================================
 
+// CompactBlockData represents a block where the transactions are replaced by
+// short transaction ids. The receiver is expected to already have most of the
+// transactions in its mempool. Any transactions the sender believes the
+// receiver is missing are included in full as prefilled transactions.
+type CompactBlockData struct {
+	Hash      string        `json:"hash" validate:"required"`
+	Header    BlockHeader   `json:"block"`
+	ShortIDs  []string      `json:"short_ids" validate:"dive,required"`
+	Prefilled []PrefilledTx `json:"prefilled" validate:"dive"`
+}
+
+// PrefilledTx represents a full transaction and its position in the block.
+type PrefilledTx struct {
+	Index int     `json:"index" validate:"gte=0"`
+	Tx    BlockTx `json:"tx"`
+}
+
+// NewCompactBlockData constructs compact block data from a block. The prefill
+// function identifies the transactions that need to be sent in full.
+func NewCompactBlockData(block Block, prefill func(tx BlockTx) bool) CompactBlockData {
+	values := block.MerkleTree.Values()
+
+	cbd := CompactBlockData{
+		Hash:     block.Hash(),
+		Header:   block.Header,
+		ShortIDs: make([]string, len(values)),
+	}
+
+	for i, tx := range values {
+		cbd.ShortIDs[i] = tx.ShortID()
+		if prefill(tx) {
+			cbd.Prefilled = append(cbd.Prefilled, PrefilledTx{Index: i, Tx: tx})
+		}
+	}
+
+	return cbd
+}
+
+// =============================================================================
+
 // BlockHeader represents common information required for each block.
 type BlockHeader struct {
-	Number        uint64    `json:"number"`          // Ethereum: Block number in the chain.
-	PrevBlockHash string    `json:"prev_block_hash"` // Bitcoin: Hash of the previous block in the chain.
-	TimeStamp     uint64    `json:"timestamp"`       // Bitcoin: Time the block was mined.
-	BeneficiaryID AccountID `json:"beneficiary"`     // Ethereum: The account who is receiving fees and tips.
-	Difficulty    uint16    `json:"difficulty"`      // Ethereum: Number of 0's needed to solve the hash solution.
-	MiningReward  uint64    `json:"mining_reward"`   // Ethereum: The reward for mining this block.
-	StateRoot     string    `json:"state_root"`      // Ethereum: Represents a hash of the accounts and their balances.
-	TransRoot     string    `json:"trans_root"`      // Both: Represents the merkle tree root hash for the transactions in this block.
-	Nonce         uint64    `json:"nonce"`           // Both: Value identified to solve the hash solution.
+	Number        uint64    `json:"number" validate:"required"`                                       // Ethereum: Block number in the chain.
+	PrevBlockHash string    `json:"prev_block_hash" validate:"required"`                              // Bitcoin: Hash of the previous block in the chain.
+	TimeStamp     uint64    `json:"timestamp" validate:"required"`                                    // Bitcoin: Time the block was mined.
+	BeneficiaryID AccountID `json:"beneficiary" validate:"required,len=42,startswith=0x,hexadecimal"` // Ethereum: The account who is receiving fees and tips.
+	Difficulty    uint16    `json:"difficulty" validate:"required"`                                   // Ethereum: Number of 0's needed to solve the hash solution.
+	MiningReward  uint64    `json:"mining_reward"`                                                    // Ethereum: The reward for mining this block.
+	StateRoot     string    `json:"state_root" validate:"required"`                                   // Ethereum: Represents a hash of the accounts and their balances.
+	TransRoot     string    `json:"trans_root" validate:"required"`                                   // Both: Represents the merkle tree root hash for the transactions in this block.
+	Nonce         uint64    `json:"nonce"`                                                            // Both: Value identified to solve the hash solution.
 }
 
 // Block represents a group of transactions batched together.
@@ -81,12 +173,21 @@ type POWArgs struct {
 	PrevBlock     Block
 	StateRoot     string
 	Trans         []BlockTx
+	Clock         clock.Clock // Source of the block timestamp. Defaults to the system clock.
+	Rand          io.Reader   // Source of the starting nonce. Defaults to crypto/rand.
 	EvHandler     func(v string, args ...any)
 }
 
 // POW constructs a new Block and performs the work to find a nonce that
-// solves the cryptographic POW puzzel.
-func POW(ctx context.Context, args POWArgs) (Block, error) {
+// solves the cryptographic POW puzzel. It returns the number of hashes that
+// were calculated to find the solution.
+func POW(ctx context.Context, args POWArgs) (Block, uint64, error) {
+	if args.Clock == nil {
+		args.Clock = clock.New()
+	}
+	if args.Rand == nil {
+		args.Rand = rand.Reader
+	}
 
 	// When mining the first block, the previous block's hash will be zero.
 	prevBlockHash := signature.ZeroHash
@@ -98,7 +199,7 @@ func POW(ctx context.Context, args POWArgs) (Block, error) {
 	// of this tree will be part of the block to be mined.
 	tree, err := merkle.NewTree(args.Trans)
 	if err != nil {
-		return Block{}, err
+		return Block{}, 0, err
 	}
 
 	// Construct the block to be mined.
@@ -106,7 +207,7 @@ func POW(ctx context.Context, args POWArgs) (Block, error) {
 		Header: BlockHeader{
 			Number:        args.PrevBlock.Header.Number + 1,
 			PrevBlockHash: prevBlockHash,
-			TimeStamp:     uint64(time.Now().UTC().UnixMilli()),
+			TimeStamp:     uint64(args.Clock.Now().UTC().UnixMilli()),
 			BeneficiaryID: args.BeneficiaryID,
 			Difficulty:    args.Difficulty,
 			MiningReward:  args.MiningReward,
@@ -118,16 +219,17 @@ func POW(ctx context.Context, args POWArgs) (Block, error) {
 	}
 
 	// Peform the proof of work mining operation.
-	if err := block.performPOW(ctx, args.EvHandler); err != nil {
-		return Block{}, err
+	attempts, err := block.performPOW(ctx, args.Rand, args.EvHandler)
+	if err != nil {
+		return Block{}, attempts, err
 	}
 
-	return block, nil
+	return block, attempts, nil
 }
 
 // performPOW does the work of mining to find a valid hash for a specified
 // block. Pointer semantics are being used since a nonce is being discovered.
-func (b *Block) performPOW(ctx context.Context, ev func(v string, args ...any)) error {
+func (b *Block) performPOW(ctx context.Context, random io.Reader, ev func(v string, args ...any)) (uint64, error) {
 	ev("database: PerformPOW: MINING: started")
 	defer ev("database: PerformPOW: MINING: completed")
 
@@ -138,26 +240,26 @@ func (b *Block) performPOW(ctx context.Context, ev func(v string, args ...any))
 
 	// Choose a random starting point for the nonce. After this, the nonce
 	// will be incremented by 1 until a solution is found by us or another node.
-	nBig, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+	nBig, err := rand.Int(random, big.NewInt(math.MaxInt64))
 	if err != nil {
-		return ctx.Err()
+		return 0, ctx.Err()
 	}
 	b.Header.Nonce = nBig.Uint64()
 
-	ev("viewer: PerformPOW: MINING: running")
+	ev("database: PerformPOW: MINING: running")
 
 	// Loop until we or another node finds a solution for the next block.
 	var attempts uint64
 	for {
 		attempts++
 		if attempts%1_000_000 == 0 {
-			ev("viewer: PerformPOW: MINING: running: attempts[%d]", attempts)
+			ev("database: PerformPOW: MINING: running: attempts[%d]", attempts)
 		}
 
 		// Did we timeout trying to solve the problem.
 		if ctx.Err() != nil {
 			ev("database: PerformPOW: MINING: CANCELLED")
-			return ctx.Err()
+			return attempts, ctx.Err()
 		}
 
 		// Hash the block and check if we have solved the puzzle.
@@ -170,7 +272,7 @@ func (b *Block) performPOW(ctx context.Context, ev func(v string, args ...any))
 		ev("database: PerformPOW: MINING: SOLVED: prevBlk[%s]: newBlk[%s]", b.Header.PrevBlockHash, hash)
 		ev("database: PerformPOW: MINING: attempts[%d]", attempts)
 
-		return nil
+		return attempts, nil
 	}
 }
 
@@ -202,32 +304,32 @@ func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler fu
 	// of ours. This means there has been a fork and we are on the wrong side.
 	nextNumber := previousBlock.Header.Number + 1
 	if b.Header.Number >= (nextNumber + 2) {
-		return ErrChainForked
+		return invalid(ReasonForked, ErrChainForked)
 	}
 
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: block difficulty is the same or greater than parent block difficulty", b.Header.Number)
 
 	if b.Header.Difficulty < previousBlock.Header.Difficulty {
-		return fmt.Errorf("block difficulty is less than previous block difficulty, parent %d, block %d", previousBlock.Header.Difficulty, b.Header.Difficulty)
+		return invalid(ReasonDifficulty, fmt.Errorf("%w: block difficulty is less than previous block difficulty, parent %d, block %d", ErrInvalidBlock, previousBlock.Header.Difficulty, b.Header.Difficulty))
 	}
 
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: block hash has been solved", b.Header.Number)
 
 	hash := b.Hash()
 	if !isHashSolved(b.Header.Difficulty, hash) {
-		return fmt.Errorf("%s invalid block hash", hash)
+		return invalid(ReasonHash, fmt.Errorf("%w: %s invalid block hash", ErrInvalidBlock, hash))
 	}
 
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: block number is the next number", b.Header.Number)
 
 	if b.Header.Number != nextNumber {
-		return fmt.Errorf("this block is not the next number, got %d, exp %d", b.Header.Number, nextNumber)
+		return invalid(ReasonNumber, fmt.Errorf("this block is not the next number, got %d, exp %d", b.Header.Number, nextNumber))
 	}
 
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: parent hash does match parent block", b.Header.Number)
 
 	if b.Header.PrevBlockHash != previousBlock.Hash() {
-		return fmt.Errorf("parent block hash doesn't match our known parent, got %s, exp %s", b.Header.PrevBlockHash, previousBlock.Hash())
+		return invalid(ReasonParent, fmt.Errorf("parent block hash doesn't match our known parent, got %s, exp %s", b.Header.PrevBlockHash, previousBlock.Hash()))
 	}
 
 	if previousBlock.Header.TimeStamp > 0 {
@@ -236,7 +338,7 @@ func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler fu
 		parentTime := time.Unix(int64(previousBlock.Header.TimeStamp), 0)
 		blockTime := time.Unix(int64(b.Header.TimeStamp), 0)
 		if blockTime.Before(parentTime) {
-			return fmt.Errorf("block timestamp is before parent block, parent %s, block %s", parentTime, blockTime)
+			return invalid(ReasonTimestamp, fmt.Errorf("%w: block timestamp is before parent block, parent %s, block %s", ErrInvalidBlock, parentTime, blockTime))
 		}
 
 		// This is a check that Ethereum does but we can't because we don't run all the time.
@@ -252,13 +354,13 @@ func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler fu
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: state root hash does match current database", b.Header.Number)
 
 	if b.Header.StateRoot != stateRoot {
-		return fmt.Errorf("state of the accounts are wrong, current %s, expected %s", stateRoot, b.Header.StateRoot)
+		return invalid(ReasonStateRoot, fmt.Errorf("state of the accounts are wrong, current %s, expected %s", stateRoot, b.Header.StateRoot))
 	}
 
 	evHandler("database: ValidateBlock: validate: blk[%d]: check: merkle root does match transactions", b.Header.Number)
 
 	if b.Header.TransRoot != b.MerkleTree.RootHex() {
-		return fmt.Errorf("merkle root does not match transactions, got %s, exp %s", b.MerkleTree.RootHex(), b.Header.TransRoot)
+		return invalid(ReasonMerkleRoot, fmt.Errorf("%w: merkle root does not match transactions, got %s, exp %s", ErrInvalidBlock, b.MerkleTree.RootHex(), b.Header.TransRoot))
 	}
 
 	return nil
@@ -22,6 +22,12 @@ type Storage interface {
 	Reset() error
 }
 
+// Checker interface represents the behavior a storage package can implement
+// to report if it's able to write blocks.
+type Checker interface {
+	Check() error
+}
+
 // Iterator interface represents the behavior required to be implemented by any
 // package providing support to iterate over the blocks.
 type Iterator interface {
@@ -88,6 +94,16 @@ func (db *Database) Close() {
 	db.storage.Close()
 }
 
+// CheckStorage reports if the storage is able to write blocks. Storage that
+// doesn't implement the Checker interface is assumed to be healthy.
+func (db *Database) CheckStorage() error {
+	if c, ok := db.storage.(Checker); ok {
+		return c.Check()
+	}
+
+	return nil
+}
+
 // Reset re-initializes the database back to the genesis state.
 func (db *Database) Reset() error {
 	db.mu.Lock()
@@ -1,9 +1,14 @@
 package database_test
 
 import (
+	"context"
+	"crypto/ecdsa"
 	"errors"
+	"math/rand/v2"
 	"testing"
+	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -157,8 +162,68 @@ func TestNonceValidation(t *testing.T) {
 	}
 }
 
+func Test_POWReproducible(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+	}
+
+	signedTx, err := tx.Sign(privateKey(t))
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	mine := func(seed uint64) database.Block {
+		var chaSeed [32]byte
+		chaSeed[0] = byte(seed)
+
+		block, _, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+			Difficulty:    1,
+			MiningReward:  700,
+			Trans:         []database.BlockTx{database.NewBlockTxAt(signedTx, 15, 1, start)},
+			Clock:         clock.NewManual(start),
+			Rand:          rand.NewChaCha8(chaSeed),
+			EvHandler:     func(v string, args ...any) {},
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine a block: %v", err)
+		}
+
+		return block
+	}
+
+	block1 := mine(1)
+	block2 := mine(1)
+
+	if block1.Hash() != block2.Hash() {
+		t.Fatalf("Should mine the same block with the same clock and seed, got %s and %s.", block1.Hash(), block2.Hash())
+	}
+
+	if block1.Header.TimeStamp != uint64(start.UnixMilli()) {
+		t.Fatalf("Should stamp the block with the clock's time, got %d.", block1.Header.TimeStamp)
+	}
+
+	if block3 := mine(2); block3.Header.Nonce == block1.Header.Nonce {
+		t.Fatalf("Should start from a different nonce with a different seed.")
+	}
+}
+
 // =============================================================================
 
+func privateKey(t *testing.T) *ecdsa.PrivateKey {
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		t.Fatalf("Should be able to construct the private key: %v", err)
+	}
+
+	return pk
+}
+
 func sign(tx database.Tx, gas uint64) (database.BlockTx, error) {
 	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
 	if err != nil {
@@ -16,13 +16,13 @@ import (
 
 // Tx is the transactional information between two parties.
 type Tx struct {
-	ChainID uint16    `json:"chain_id"` // Ethereum: The chain id that is listed in the genesis file.
-	Nonce   uint64    `json:"nonce"`    // Ethereum: Unique id for the transaction supplied by the user.
-	FromID  AccountID `json:"from"`     // Ethereum: Account sending the transaction. Will be checked against signature.
-	ToID    AccountID `json:"to"`       // Ethereum: Account receiving the benefit of the transaction.
-	Value   uint64    `json:"value"`    // Ethereum: Monetary value received from this transaction.
-	Tip     uint64    `json:"tip"`      // Ethereum: Tip offered by the sender as an incentive to mine this transaction.
-	Data    []byte    `json:"data"`     // Ethereum: Extra data related to the transaction.
+	ChainID uint16    `json:"chain_id" validate:"required"`                              // Ethereum: The chain id that is listed in the genesis file.
+	Nonce   uint64    `json:"nonce" validate:"required"`                                 // Ethereum: Unique id for the transaction supplied by the user.
+	FromID  AccountID `json:"from" validate:"required,len=42,startswith=0x,hexadecimal"` // Ethereum: Account sending the transaction. Will be checked against signature.
+	ToID    AccountID `json:"to" validate:"required,len=42,startswith=0x,hexadecimal"`   // Ethereum: Account receiving the benefit of the transaction.
+	Value   uint64    `json:"value"`                                                     // Ethereum: Monetary value received from this transaction.
+	Tip     uint64    `json:"tip"`                                                       // Ethereum: Tip offered by the sender as an incentive to mine this transaction.
+	Data    []byte    `json:"data"`                                                      // Ethereum: Extra data related to the transaction.
 }
 
 // NewTx constructs a new transaction.
@@ -74,9 +74,9 @@ func (tx Tx) Sign(privateKey *ecdsa.PrivateKey) (SignedTx, error) {
 // a wallet provide transactions for inclusion into the blockchain.
 type SignedTx struct {
 	Tx
-	V *big.Int `json:"v"` // Ethereum: Recovery identifier, either 29 or 30 with ardanID.
-	R *big.Int `json:"r"` // Ethereum: First coordinate of the ECDSA signature.
-	S *big.Int `json:"s"` // Ethereum: Second coordinate of the ECDSA signature.
+	V *big.Int `json:"v" validate:"required"` // Ethereum: Recovery identifier, either 29 or 30 with ardanID.
+	R *big.Int `json:"r" validate:"required"` // Ethereum: First coordinate of the ECDSA signature.
+	S *big.Int `json:"s" validate:"required"` // Ethereum: Second coordinate of the ECDSA signature.
 }
 
 // Validate verifies the transaction has a proper signature that conforms to our
@@ -136,11 +136,17 @@ type BlockTx struct {
 	GasUnits  uint64 `json:"gas_units"` // Ethereum: The number of units of gas used for this transaction.
 }
 
-// NewBlockTx constructs a new block transaction.
+// NewBlockTx constructs a new block transaction stamped with the current time.
 func NewBlockTx(signedTx SignedTx, gasPrice uint64, unitsOfGas uint64) BlockTx {
+	return NewBlockTxAt(signedTx, gasPrice, unitsOfGas, time.Now())
+}
+
+// NewBlockTxAt constructs a new block transaction stamped with the specified
+// time.
+func NewBlockTxAt(signedTx SignedTx, gasPrice uint64, unitsOfGas uint64, received time.Time) BlockTx {
 	return BlockTx{
 		SignedTx:  signedTx,
-		TimeStamp: uint64(time.Now().UTC().UnixMilli()),
+		TimeStamp: uint64(received.UTC().UnixMilli()),
 		GasPrice:  gasPrice,
 		GasUnits:  unitsOfGas,
 	}
@@ -155,6 +161,20 @@ func (tx BlockTx) Hash() ([]byte, error) {
 	return hex.DecodeString(str[2:])
 }
 
+// HashHex returns the hex-encoded hash of the block transaction. This is the
+// value used to identify a transaction when it's announced to peers.
+func (tx BlockTx) HashHex() string {
+	return signature.Hash(tx)
+}
+
+// ShortID returns a shortened version of the transaction hash. This is used
+// to reference the transaction in a compact block.
+func (tx BlockTx) ShortID() string {
+	const shortIDLength = 2 + 16
+
+	return tx.HashHex()[:shortIDLength]
+}
+
 // Equals implements the merkle Hashable interface for providing an equality
 // check between two block transactions. If the nonce and signatures are the
 // same, the two blocks are the same.
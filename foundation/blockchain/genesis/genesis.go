@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"os"
 	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 )
 
 // Genesis represents the genesis file.
@@ -36,3 +38,9 @@ func Load() (Genesis, error) {
 
 	return genesis, nil
 }
+
+// Hash returns a unique hash for the genesis information. Nodes use this to
+// verify they are running the same chain.
+func (g Genesis) Hash() string {
+	return signature.Hash(g)
+}
@@ -0,0 +1,153 @@
+// Package identity manages the key that identifies a node on the network.
+// This key is separate from the beneficiary key that receives mining rewards
+// and is only used for node to node communication.
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// pemType is the PEM block type used to store the identity key.
+const pemType = "EC PRIVATE KEY"
+
+// =============================================================================
+
+// LoadOrGenerate reads the identity key from the specified file. If the file
+// doesn't exist, a new key is generated and saved to that file.
+func LoadOrGenerate(path string) (*ecdsa.PrivateKey, error) {
+	privateKey, err := Load(path)
+	switch {
+	case err == nil:
+		return privateKey, nil
+
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	privateKey, err = Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Save(path, privateKey); err != nil {
+		return nil, err
+	}
+
+	return privateKey, nil
+}
+
+// Generate constructs a new identity key.
+func Generate() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// Load reads the identity key from the specified file.
+func Load(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("%s: invalid identity key file", path)
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// Save writes the identity key to the specified file.
+func Save(path string, privateKey *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+	return os.WriteFile(path, data, 0600)
+}
+
+// =============================================================================
+
+// Sign signs the data with the identity key and returns the hex-encoded
+// signature.
+func Sign(privateKey *ecdsa.PrivateKey, data []byte) (string, error) {
+	digest := sha256.Sum256(data)
+
+	sig, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sig), nil
+}
+
+// Verify checks the hex-encoded signature of the data was produced by the
+// identity key for the specified public key.
+func Verify(publicKeyHex string, data []byte, sigHex string) error {
+	publicKey, err := ParsePublicKeyHex(publicKeyHex)
+	if err != nil {
+		return err
+	}
+
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return ErrInvalidSig
+	}
+
+	digest := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(publicKey, digest[:], sig) {
+		return ErrInvalidSig
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// PublicKeyHex returns the hex-encoded form of the public key that is
+// shared with peers.
+func PublicKeyHex(publicKey *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(der), nil
+}
+
+// ParsePublicKeyHex converts the hex-encoded form of a public key back
+// into a public key.
+func ParsePublicKeyHex(publicKeyHex string) (*ecdsa.PublicKey, error) {
+	der, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an ECDSA key")
+	}
+
+	return publicKey, nil
+}
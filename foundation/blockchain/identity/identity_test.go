@@ -0,0 +1,40 @@
+package identity_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+)
+
+func Test_LoadOrGenerate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity", "node.pem")
+
+	key1, err := identity.LoadOrGenerate(path)
+	if err != nil {
+		t.Fatalf("Should be able to generate an identity key: %s", err)
+	}
+
+	key2, err := identity.LoadOrGenerate(path)
+	if err != nil {
+		t.Fatalf("Should be able to load the identity key: %s", err)
+	}
+
+	if !key1.Equal(key2) {
+		t.Fatalf("Should load the same identity key that was generated.")
+	}
+
+	publicKey, err := identity.PublicKeyHex(&key1.PublicKey)
+	if err != nil {
+		t.Fatalf("Should be able to encode the public key: %s", err)
+	}
+
+	pk, err := identity.ParsePublicKeyHex(publicKey)
+	if err != nil {
+		t.Fatalf("Should be able to parse the public key: %s", err)
+	}
+
+	if !pk.Equal(&key1.PublicKey) {
+		t.Fatalf("Should parse back the same public key.")
+	}
+}
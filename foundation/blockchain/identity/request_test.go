@@ -0,0 +1,143 @@
+package identity_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+)
+
+func Test_VerifyRequest(t *testing.T) {
+	key, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("Should be able to generate an identity key: %s", err)
+	}
+
+	body := []byte(`{"host":"0.0.0.0:9080"}`)
+
+	signed := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/v1/node/peers", bytes.NewReader(body))
+		if err := identity.SignRequest(r, key, body); err != nil {
+			t.Fatalf("Should be able to sign the request: %s", err)
+		}
+		return r
+	}
+
+	v := identity.NewVerifier(time.Minute, false)
+
+	r := signed()
+	publicKey, err := v.VerifyRequest(r)
+	if err != nil {
+		t.Fatalf("Should be able to verify a signed request: %s", err)
+	}
+
+	expKey, _ := identity.PublicKeyHex(&key.PublicKey)
+	if publicKey != expKey {
+		t.Fatalf("Should get back the public key that signed the request.")
+	}
+
+	got, _ := io.ReadAll(r.Body)
+	if !bytes.Equal(got, body) {
+		t.Fatalf("Should be able to read the body again after verification.")
+	}
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		err  error
+	}{
+		{
+			name: "unsigned",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/v1/node/peers", bytes.NewReader(body))
+			},
+			err: identity.ErrUnsigned,
+		},
+		{
+			name: "replayed",
+			req: func() *http.Request {
+				r := signed()
+				v.VerifyRequest(r.Clone(r.Context()))
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				return r
+			},
+			err: identity.ErrReplayed,
+		},
+		{
+			name: "tampered body",
+			req: func() *http.Request {
+				r := signed()
+				r.Body = io.NopCloser(bytes.NewReader([]byte(`{"host":"evil"}`)))
+				return r
+			},
+			err: identity.ErrInvalidSig,
+		},
+		{
+			name: "tampered path",
+			req: func() *http.Request {
+				r := signed()
+				r.URL.Path = "/v1/node/block/propose"
+				return r
+			},
+			err: identity.ErrInvalidSig,
+		},
+		{
+			name: "too large",
+			req: func() *http.Request {
+				large := bytes.Repeat([]byte("a"), identity.MaxBodySize+1)
+				r := httptest.NewRequest(http.MethodPost, "/v1/node/peers", bytes.NewReader(large))
+				if err := identity.SignRequest(r, key, large); err != nil {
+					t.Fatalf("Should be able to sign the request: %s", err)
+				}
+				return r
+			},
+			err: identity.ErrBodyTooLarge,
+		},
+		{
+			name: "bad key",
+			req: func() *http.Request {
+				r := signed()
+				r.Header.Set(identity.HeaderPublicKey, "zz")
+				r.Body = errReader{}
+				return r
+			},
+			err: identity.ErrInvalidSig,
+		},
+		{
+			name: "expired",
+			req: func() *http.Request {
+				r := signed()
+				old := time.Now().Add(-time.Hour).UnixNano()
+				r.Header.Set(identity.HeaderTimestamp, strconv.FormatInt(old, 10))
+				return r
+			},
+			err: identity.ErrExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.VerifyRequest(tt.req())
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Test %s:\tShould get error %q, got %v.", tt.name, tt.err, err)
+			}
+		})
+	}
+}
+
+// errReader fails the test if the body is read.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("body should not be read")
+}
+
+func (errReader) Close() error {
+	return nil
+}
@@ -0,0 +1,171 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// certValidity represents how long a self-signed certificate is valid.
+const certValidity = 10 * 365 * 24 * time.Hour
+
+// ErrCertMismatch is returned when a peer presents a certificate that doesn't
+// belong to the identity it claims.
+var ErrCertMismatch = errors.New("certificate doesn't match the peer identity")
+
+// =============================================================================
+
+// Certificate generates a self-signed certificate for the identity key. Peers
+// pin this certificate by the public key they received during the handshake.
+func Certificate(privateKey *ecdsa.PrivateKey) (tls.Certificate, error) {
+	publicKey, err := PublicKeyHex(&privateKey.PublicKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "node-" + publicKey[len(publicKey)-16:]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert := tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  privateKey,
+		Leaf:        leaf,
+	}
+
+	return cert, nil
+}
+
+// LoadCertificate reads a certificate and key pair from disk along with the
+// certificate authority used to verify peers.
+func LoadCertificate(certFile string, keyFile string, caFile string) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("loading key pair: %w", err)
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("loading ca: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return tls.Certificate{}, nil, fmt.Errorf("%s: no certificates found", caFile)
+	}
+
+	return cert, pool, nil
+}
+
+// =============================================================================
+
+// ServerTLS constructs the TLS configuration for the private API. Peers must
+// present a certificate. When a certificate authority is provided the peer
+// certificate must be issued by it. Otherwise any self-signed certificate is
+// accepted and the request signature binds it to the peer identity.
+func ServerTLS(cert tls.Certificate, clientCAs *x509.CertPool) *tls.Config {
+	cfg := tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}
+
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &cfg
+}
+
+// ClientTLS constructs the TLS configuration for calls to peers. When a
+// certificate authority is provided the peer certificate must be issued by
+// it. Otherwise peer certificates are pinned with PinPublicKey.
+func ClientTLS(cert tls.Certificate, rootCAs *x509.CertPool) *tls.Config {
+	cfg := tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+	}
+
+	// The standard verification is replaced by pinning the public key.
+	if rootCAs == nil {
+		cfg.InsecureSkipVerify = true
+	}
+
+	return &cfg
+}
+
+// PinPublicKey returns a copy of the client configuration that only accepts
+// a certificate for the specified identity public key. If the configuration
+// uses a certificate authority or the public key is not known yet, like on
+// first contact, the configuration is returned unchanged.
+func PinPublicKey(cfg *tls.Config, publicKey string) *tls.Config {
+	if cfg.RootCAs != nil || publicKey == "" {
+		return cfg
+	}
+
+	pinned := cfg.Clone()
+	pinned.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrCertMismatch
+		}
+
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		certKey, err := CertPublicKeyHex(cert)
+		if err != nil {
+			return err
+		}
+
+		if certKey != publicKey {
+			return ErrCertMismatch
+		}
+
+		return nil
+	}
+
+	return pinned
+}
+
+// CertPublicKeyHex returns the hex-encoded form of the certificate's public
+// key so it can be compared with a peer identity.
+func CertPublicKeyHex(cert *x509.Certificate) (string, error) {
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return "", errors.New("certificate key is not an ECDSA key")
+	}
+
+	return PublicKeyHex(publicKey)
+}
@@ -0,0 +1,129 @@
+package identity_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+)
+
+func Test_MutualTLS(t *testing.T) {
+	serverKey, _ := identity.Generate()
+	clientKey, _ := identity.Generate()
+	otherKey, _ := identity.Generate()
+
+	serverCert := mustCertificate(t, serverKey)
+	clientCert := mustCertificate(t, clientKey)
+
+	serverPublicKey, _ := identity.PublicKeyHex(&serverKey.PublicKey)
+	otherPublicKey, _ := identity.PublicKeyHex(&otherKey.PublicKey)
+
+	v := identity.NewVerifier(time.Minute, true)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := v.VerifyRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(h))
+	srv.TLS = identity.ServerTLS(serverCert, nil)
+	srv.StartTLS()
+	defer srv.Close()
+
+	clientTLS := identity.ClientTLS(clientCert, nil)
+
+	tests := []struct {
+		name    string
+		tls     *tls.Config
+		signKey *ecdsa.PrivateKey
+		status  int
+		err     error
+	}{
+		{
+			name:    "pinned",
+			tls:     identity.PinPublicKey(clientTLS, serverPublicKey),
+			signKey: clientKey,
+			status:  http.StatusOK,
+		},
+		{
+			name:    "first contact",
+			tls:     identity.PinPublicKey(clientTLS, ""),
+			signKey: clientKey,
+			status:  http.StatusOK,
+		},
+		{
+			name:    "wrong pin",
+			tls:     identity.PinPublicKey(clientTLS, otherPublicKey),
+			signKey: clientKey,
+			err:     identity.ErrCertMismatch,
+		},
+		{
+			name:    "signed by another identity",
+			tls:     identity.PinPublicKey(clientTLS, serverPublicKey),
+			signKey: otherKey,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "no client certificate",
+			tls:     &tls.Config{InsecureSkipVerify: true},
+			signKey: clientKey,
+			err:     errAny,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := http.Client{
+				Transport: &http.Transport{TLSClientConfig: tt.tls},
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/node/status", nil)
+			if err := identity.SignRequest(req, tt.signKey, nil); err != nil {
+				t.Fatalf("Test %s:\tShould be able to sign the request: %s", tt.name, err)
+			}
+
+			resp, err := client.Do(req)
+			switch {
+			case tt.err == errAny:
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("Test %s:\tShould fail the TLS handshake.", tt.name)
+				}
+				return
+
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Test %s:\tShould get error %q, got %v.", tt.name, tt.err, err)
+				}
+				return
+
+			case err != nil:
+				t.Fatalf("Test %s:\tShould be able to make the call: %s", tt.name, err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Test %s:\tShould get status %d, got %d.", tt.name, tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// errAny is used when a test expects an error but the exact error depends
+// on the TLS stack.
+var errAny = errors.New("any error")
+
+func mustCertificate(t *testing.T, key *ecdsa.PrivateKey) tls.Certificate {
+	cert, err := identity.Certificate(key)
+	if err != nil {
+		t.Fatalf("Should be able to generate a certificate: %s", err)
+	}
+	return cert
+}
@@ -16,6 +16,7 @@ import (
 type Mempool struct {
 	mu       sync.RWMutex
 	pool     map[string]database.BlockTx
+	hashes   map[string]string
 	selectFn selector.Func
 }
 
@@ -33,6 +34,7 @@ func NewWithStrategy(strategy string) (*Mempool, error) {
 
 	mp := Mempool{
 		pool:     make(map[string]database.BlockTx),
+		hashes:   make(map[string]string),
 		selectFn: selectFn,
 	}
 
@@ -71,9 +73,11 @@ func (mp *Mempool) Upsert(tx database.BlockTx) error {
 		if tx.Tip < uint64(math.Round(float64(etx.Tip)*1.10)) {
 			return errors.New("replacing a transaction requires a 10% bump in the tip")
 		}
+		delete(mp.hashes, etx.HashHex())
 	}
 
 	mp.pool[key] = tx
+	mp.hashes[tx.HashHex()] = key
 
 	return nil
 }
@@ -88,6 +92,9 @@ func (mp *Mempool) Delete(tx database.BlockTx) error {
 		return err
 	}
 
+	if etx, exists := mp.pool[key]; exists {
+		delete(mp.hashes, etx.HashHex())
+	}
 	delete(mp.pool, key)
 
 	return nil
@@ -99,6 +106,47 @@ func (mp *Mempool) Truncate() {
 	defer mp.mu.Unlock()
 
 	mp.pool = make(map[string]database.BlockTx)
+	mp.hashes = make(map[string]string)
+}
+
+// Contains checks if a transaction with the specified hash is in the pool.
+func (mp *Mempool) Contains(hash string) bool {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	_, exists := mp.hashes[hash]
+	return exists
+}
+
+// Lookup returns the transaction in the pool from the same account and with
+// the same nonce as the specified transaction.
+func (mp *Mempool) Lookup(tx database.BlockTx) (database.BlockTx, bool) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	key, err := mapKey(tx)
+	if err != nil {
+		return database.BlockTx{}, false
+	}
+
+	etx, exists := mp.pool[key]
+	return etx, exists
+}
+
+// LookupHashes returns the transactions in the pool that match the specified
+// hashes. Hashes that are not found are ignored.
+func (mp *Mempool) LookupHashes(hashes []string) []database.BlockTx {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	var trans []database.BlockTx
+	for _, hash := range hashes {
+		if key, exists := mp.hashes[hash]; exists {
+			trans = append(trans, mp.pool[key])
+		}
+	}
+
+	return trans
 }
 
 // PickBest uses the configured sort strategy to return a set of transactions.
@@ -103,6 +103,54 @@ func Test_CRUD(t *testing.T) {
 	}
 }
 
+func Test_LookupHashes(t *testing.T) {
+	mp, err := mempool.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	tx1, err := sign("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93", database.Tx{Nonce: 1, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", ToID: "0x0000000000000000000000000000000000000000", Tip: 100})
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %s", err)
+	}
+	tx2, err := sign("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93", database.Tx{Nonce: 1, FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", ToID: "0x0000000000000000000000000000000000000000", Tip: 200})
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %s", err)
+	}
+
+	if err := mp.Upsert(tx1); err != nil {
+		t.Fatalf("Should be able to upsert transaction: %s", err)
+	}
+
+	if !mp.Contains(tx1.HashHex()) {
+		t.Fatalf("Should find the transaction by hash.")
+	}
+
+	txs := mp.LookupHashes([]string{tx1.HashHex(), tx2.HashHex()})
+	if len(txs) != 1 {
+		t.Logf("got: %d", len(txs))
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should only get back the transactions in the pool.")
+	}
+
+	// Replacing the transaction should replace the hash as well.
+	if err := mp.Upsert(tx2); err != nil {
+		t.Fatalf("Should be able to replace transaction: %s", err)
+	}
+
+	if mp.Contains(tx1.HashHex()) {
+		t.Fatalf("Should not find the replaced transaction by hash.")
+	}
+	if !mp.Contains(tx2.HashHex()) {
+		t.Fatalf("Should find the new transaction by hash.")
+	}
+
+	mp.Delete(tx2)
+	if mp.Contains(tx2.HashHex()) {
+		t.Fatalf("Should not find the deleted transaction by hash.")
+	}
+}
+
 // =============================================================================
 
 func sign(hexKey string, tx database.Tx) (database.BlockTx, error) {
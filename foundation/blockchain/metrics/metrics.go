@@ -0,0 +1,184 @@
+// Package metrics collects metrics about the blockchain, the mempool, mining
+// and peers and serves them in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/events"
+)
+
+// subscriberID is the id the metrics are registered with on the events bus.
+const subscriberID = "metrics"
+
+// Chain provides the state of the node that is read every time the metrics
+// are collected.
+type Chain interface {
+	LatestBlock() database.Block
+	MempoolLength() int
+	KnownExternalPeers() []peer.Peer
+	BestPeerHeight() uint64
+}
+
+// Config represents the configuration required to collect metrics.
+type Config struct {
+	Chain  Chain
+	Events *events.Events
+}
+
+// Metrics collects the metrics from the events published by the blockchain.
+type Metrics struct {
+	chain Chain
+	evts  *events.Events
+
+	mu              sync.Mutex
+	lastNumber      uint64
+	lastTimeStamp   uint64
+	blocksAdded     uint64
+	blockInterval   *histogram
+	miningDuration  *histogram
+	hashrate        float64
+	miningCancelled uint64
+	evictions       map[string]uint64
+	peerFailures    map[string]uint64
+	peerBans        uint64
+	reorgs          uint64
+	reorgDepth      *histogram
+	validation      map[string]uint64
+}
+
+// New constructs the metrics and starts collecting the events published by
+// the blockchain.
+func New(cfg Config) (*Metrics, error) {
+	latest := cfg.Chain.LatestBlock()
+
+	m := Metrics{
+		chain:          cfg.Chain,
+		evts:           cfg.Events,
+		lastNumber:     latest.Header.Number,
+		lastTimeStamp:  latest.Header.TimeStamp,
+		blockInterval:  newHistogram(1, 2, 5, 10, 15, 30, 60, 120, 300, 600),
+		miningDuration: newHistogram(0.1, 0.5, 1, 2, 5, 10, 15, 30, 60, 120),
+		reorgDepth:     newHistogram(1, 2, 3, 5, 10, 20, 50, 100, 500, 1000),
+		evictions:      make(map[string]uint64),
+		peerFailures:   make(map[string]uint64),
+		validation:     make(map[string]uint64),
+	}
+
+	if _, err := cfg.Events.Handle(subscriberID, m.handle, state.Topics()...); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Shutdown stops collecting events.
+func (m *Metrics) Shutdown() {
+	m.evts.Unsubscribe(subscriberID)
+}
+
+// ServeHTTP implements the http.Handler interface so the metrics can be
+// scraped by Prometheus.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// Write writes the metrics in the Prometheus text format.
+func (m *Metrics) Write(w io.Writer) error {
+	height := m.chain.LatestBlock().Header.Number
+	mempool := m.chain.MempoolLength()
+	peers := len(m.chain.KnownExternalPeers())
+
+	var lag uint64
+	if best := m.chain.BestPeerHeight(); best > height {
+		lag = best - height
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pw := writer{w: w}
+
+	pw.gauge("blockchain_block_height", "Number of the latest block in the blockchain.", float64(height))
+	pw.counter("blockchain_blocks_added_total", "Blocks added to the blockchain.", m.blocksAdded)
+	pw.histogram("blockchain_block_interval_seconds", "Time between consecutive blocks based on the block timestamps.", m.blockInterval)
+
+	pw.histogram("blockchain_mining_duration_seconds", "Time taken to mine a block.", m.miningDuration)
+	pw.gauge("blockchain_mining_hashrate", "Hashes per second calculated mining the last block.", m.hashrate)
+	pw.counter("blockchain_mining_cancelled_total", "Mining runs cancelled before a block was added.", m.miningCancelled)
+
+	pw.gauge("blockchain_mempool_size", "Transactions in the mempool.", float64(mempool))
+	pw.counterVec("blockchain_mempool_evictions_total", "Transactions removed from the mempool without being mined.", "reason", m.evictions)
+
+	pw.gauge("blockchain_peers", "Known peers not including this node.", float64(peers))
+	pw.counterVec("blockchain_peer_failures_total", "Network calls to peers that failed.", "operation", m.peerFailures)
+	pw.counter("blockchain_peer_bans_total", "Peers banned.", m.peerBans)
+
+	pw.gauge("blockchain_sync_lag_blocks", "Blocks this node is behind the best peer.", float64(lag))
+	pw.counter("blockchain_reorgs_total", "Times the blockchain was reset and resynced.", m.reorgs)
+	pw.histogram("blockchain_reorg_depth_blocks", "Blocks that were no longer part of the blockchain after a resync.", m.reorgDepth)
+
+	pw.counterVec("blockchain_validation_failures_total", "Blocks that failed validation.", "reason", m.validation)
+
+	return pw.err
+}
+
+// handle updates the metrics for an event published by the blockchain.
+func (m *Metrics) handle(msg events.Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch ev := msg.Data.(type) {
+	case state.BlockAdded:
+		m.blocksAdded++
+
+		header := ev.Block.Header
+		if header.Number == m.lastNumber+1 && m.lastTimeStamp != 0 && header.TimeStamp >= m.lastTimeStamp {
+			m.blockInterval.observe(float64(header.TimeStamp-m.lastTimeStamp) / 1000)
+		}
+		m.lastNumber = header.Number
+		m.lastTimeStamp = header.TimeStamp
+
+	case state.BlockRejected:
+		m.validation[ev.Reason]++
+
+	case state.TxEvicted:
+		m.evictions[ev.Reason]++
+
+	case state.MiningCompleted:
+		m.miningDuration.observe(ev.Duration.Seconds())
+		if ev.Duration > 0 {
+			m.hashrate = float64(ev.Attempts) / ev.Duration.Seconds()
+		}
+
+	case state.MiningCancelled:
+		m.miningCancelled++
+
+	case state.PeerFailed:
+		m.peerFailures[ev.Operation]++
+
+	case state.PeerBanned:
+		m.peerBans++
+
+	case state.ReorgStarted:
+		m.reorgs++
+		m.lastNumber = 0
+		m.lastTimeStamp = 0
+
+	case state.ReorgCompleted:
+		m.reorgDepth.observe(float64(ev.Depth))
+	}
+}
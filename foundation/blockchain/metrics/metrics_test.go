@@ -0,0 +1,99 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/metrics"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/events"
+)
+
+func Test_Metrics(t *testing.T) {
+	evts := events.New()
+	defer evts.Shutdown()
+
+	chain := chain{
+		latest: database.Block{Header: database.BlockHeader{Number: 1, TimeStamp: 1_000}},
+		best:   5,
+		peers:  []peer.Peer{peer.New("host1"), peer.New("host2")},
+		txs:    3,
+	}
+
+	m, err := metrics.New(metrics.Config{
+		Chain:  &chain,
+		Events: evts,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the metrics: %v", err)
+	}
+	defer m.Shutdown()
+
+	evts.Publish(state.BlockAdded{Block: database.BlockData{Header: database.BlockHeader{Number: 2, TimeStamp: 13_000}}})
+	evts.Publish(state.MiningCompleted{Number: 2, Duration: 2 * time.Second, Attempts: 1000})
+	evts.Publish(state.MiningCancelled{Number: 3})
+	evts.Publish(state.TxEvicted{Reason: state.EvictReplaced})
+	evts.Publish(state.TxEvicted{Reason: state.EvictReplaced})
+	evts.Publish(state.TxEvicted{Reason: state.EvictConflict})
+	evts.Publish(state.PeerFailed{Host: "host1", Operation: "status"})
+	evts.Publish(state.PeerBanned{Host: "host1"})
+	evts.Publish(state.BlockRejected{Number: 3, Reason: database.ReasonHash})
+	evts.Publish(state.ReorgStarted{Number: 2})
+	evts.Publish(state.ReorgCompleted{Number: 4, Depth: 2})
+
+	chain.latest.Header.Number = 2
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Should serve the Prometheus text format, got %q.", ct)
+	}
+
+	exp := []string{
+		"blockchain_block_height 2",
+		"blockchain_blocks_added_total 1",
+		`blockchain_block_interval_seconds_bucket{le="10"} 0`,
+		`blockchain_block_interval_seconds_bucket{le="15"} 1`,
+		"blockchain_block_interval_seconds_sum 12",
+		"blockchain_mining_duration_seconds_count 1",
+		"blockchain_mining_hashrate 500",
+		"blockchain_mining_cancelled_total 1",
+		"blockchain_mempool_size 3",
+		`blockchain_mempool_evictions_total{reason="conflict"} 1`,
+		`blockchain_mempool_evictions_total{reason="replaced"} 2`,
+		"blockchain_peers 2",
+		`blockchain_peer_failures_total{operation="status"} 1`,
+		"blockchain_peer_bans_total 1",
+		"blockchain_sync_lag_blocks 3",
+		"blockchain_reorgs_total 1",
+		"blockchain_reorg_depth_blocks_sum 2",
+		`blockchain_validation_failures_total{reason="hash"} 1`,
+		"# TYPE blockchain_reorg_depth_blocks histogram",
+	}
+
+	body := rec.Body.String()
+	for _, line := range exp {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("Should contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
+// =============================================================================
+
+type chain struct {
+	latest database.Block
+	best   uint64
+	peers  []peer.Peer
+	txs    int
+}
+
+func (c *chain) LatestBlock() database.Block     { return c.latest }
+func (c *chain) MempoolLength() int              { return c.txs }
+func (c *chain) KnownExternalPeers() []peer.Peer { return c.peers }
+func (c *chain) BestPeerHeight() uint64          { return c.best }
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CORE NOTE: The Prometheus text format is simple enough that a client library
+// isn't needed. Every metric is written as a HELP and TYPE line followed by
+// one line per sample. A histogram is written as cumulative buckets with a
+// sum and a count.
+
+// histogram tracks the distribution of observed values in buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// newHistogram constructs a histogram with the specified bucket upper bounds.
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
+
+// observe adds the value to the histogram.
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// =============================================================================
+
+// writer writes metrics in the Prometheus text format. The first error is
+// kept and every write after that is skipped.
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (pw *writer) printf(format string, args ...any) {
+	if pw.err != nil {
+		return
+	}
+	_, pw.err = fmt.Fprintf(pw.w, format, args...)
+}
+
+func (pw *writer) header(name string, typ string, help string) {
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (pw *writer) gauge(name string, help string, v float64) {
+	pw.header(name, "gauge", help)
+	pw.printf("%s %s\n", name, formatFloat(v))
+}
+
+func (pw *writer) counter(name string, help string, v uint64) {
+	pw.header(name, "counter", help)
+	pw.printf("%s %d\n", name, v)
+}
+
+// counterVec writes a counter with one sample for every value of the label.
+// The samples are ordered by label value.
+func (pw *writer) counterVec(name string, help string, label string, values map[string]uint64) {
+	pw.header(name, "counter", help)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pw.printf("%s{%s=\"%s\"} %d\n", name, label, escape(k), values[k])
+	}
+}
+
+func (pw *writer) histogram(name string, help string, h *histogram) {
+	pw.header(name, "histogram", help)
+
+	for i, bound := range h.bounds {
+		pw.printf("%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), h.counts[i])
+	}
+	pw.printf("%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	pw.printf("%s_sum %s\n", name, formatFloat(h.sum))
+	pw.printf("%s_count %d\n", name, h.count)
+}
+
+// formatFloat formats the value the way Prometheus expects.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape escapes a label value.
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,242 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// Set of deadlines for the requests made to peers.
+const (
+	dialTimeout    = 5 * time.Second
+	requestTimeout = 10 * time.Second
+	syncTimeout    = 30 * time.Second
+)
+
+// Client maintains the long-lived connections to peers and provides the
+// requests this node makes over them. The Client can be used as a transport
+// for the state package.
+type Client struct {
+	identityKey *ecdsa.PrivateKey
+	tls         *tls.Config
+
+	mu    sync.Mutex
+	conns map[string]*Conn
+}
+
+// NewClient constructs a client that authenticates with the identity key.
+// If a TLS configuration is provided, connections are encrypted.
+func NewClient(identityKey *ecdsa.PrivateKey, tlsConfig *tls.Config) *Client {
+	return &Client{
+		identityKey: identityKey,
+		tls:         tlsConfig,
+		conns:       make(map[string]*Conn),
+	}
+}
+
+// Close closes all the connections to peers.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for host, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, host)
+	}
+}
+
+// =============================================================================
+
+// Handshake exchanges handshake information with the peer.
+func (c *Client) Handshake(ctx context.Context, pr peer.Peer, hs peer.Peer) (peer.Peer, error) {
+	var resp peer.Peer
+	err := c.request(ctx, pr, MsgHandshake, requestTimeout, hs, &resp)
+	return resp, err
+}
+
+// Ping checks the connection to the peer is alive.
+func (c *Client) Ping(ctx context.Context, pr peer.Peer) error {
+	return c.request(ctx, pr, MsgPing, requestTimeout, nil, nil)
+}
+
+// Status requests the current status of the peer.
+func (c *Client) Status(ctx context.Context, pr peer.Peer) (peer.PeerStatus, error) {
+	var resp peer.PeerStatus
+	err := c.request(ctx, pr, MsgStatus, requestTimeout, nil, &resp)
+	return resp, err
+}
+
+// Mempool requests the transactions in the peer's mempool.
+func (c *Client) Mempool(ctx context.Context, pr peer.Peer) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := c.request(ctx, pr, MsgMempool, syncTimeout, nil, &resp)
+	return resp, err
+}
+
+// AnnounceTxs announces new transaction hashes to the peer.
+func (c *Client) AnnounceTxs(ctx context.Context, pr peer.Peer, ann peer.TxAnnounce) error {
+	return c.request(ctx, pr, MsgTxAnnounce, requestTimeout, ann, nil)
+}
+
+// RequestTxs requests the transactions that match the hashes.
+func (c *Client) RequestTxs(ctx context.Context, pr peer.Peer, req peer.TxRequest) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := c.request(ctx, pr, MsgTxRequest, requestTimeout, req, &resp)
+	return resp, err
+}
+
+// AnnounceBlock sends a new block in the compact format to the peer.
+func (c *Client) AnnounceBlock(ctx context.Context, pr peer.Peer, cb peer.CompactBlock) error {
+	return c.request(ctx, pr, MsgBlockAnnounce, syncTimeout, cb, nil)
+}
+
+// RequestBlocks requests the blocks starting at the specified block number.
+// The headers are requested first so they can be checked to form a chain
+// before the bodies of those blocks are requested.
+func (c *Client) RequestBlocks(ctx context.Context, pr peer.Peer, req peer.BlocksRequest) ([]database.BlockData, error) {
+	var headers []peer.BlockHeader
+	if err := c.request(ctx, pr, MsgHeaders, requestTimeout, req, &headers); err != nil {
+		return nil, err
+	}
+
+	if len(headers) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]peer.BlockID, len(headers))
+	for i, hdr := range headers {
+		if i > 0 && hdr.Header.PrevBlockHash != headers[i-1].Hash {
+			return nil, fmt.Errorf("header for block %d doesn't link to the previous header", hdr.Header.Number)
+		}
+		ids[i] = peer.BlockID{Number: hdr.Header.Number, Hash: hdr.Hash}
+	}
+
+	var bodies [][]database.BlockTx
+	if err := c.request(ctx, pr, MsgBodies, syncTimeout, peer.BodiesRequest{Blocks: ids}, &bodies); err != nil {
+		return nil, err
+	}
+
+	if len(bodies) != len(headers) {
+		return nil, fmt.Errorf("peer returned the wrong number of bodies, got %d, exp %d", len(bodies), len(headers))
+	}
+
+	blocks := make([]database.BlockData, len(headers))
+	for i, hdr := range headers {
+		blocks[i] = database.BlockData{
+			Hash:   hdr.Hash,
+			Header: hdr.Header,
+			Trans:  bodies[i],
+		}
+	}
+
+	return blocks, nil
+}
+
+// RequestBlockTxs requests the transactions of a block at the specified
+// positions. This is used to fill in a compact block.
+func (c *Client) RequestBlockTxs(ctx context.Context, pr peer.Peer, req peer.BlockTxRequest) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := c.request(ctx, pr, MsgBlockTxs, requestTimeout, req, &resp)
+	return resp, err
+}
+
+// =============================================================================
+
+// Request sends a request of the specified type to the peer. The deadline
+// of the context is sent to the peer with the request.
+func (c *Client) Request(ctx context.Context, pr peer.Peer, typ MsgType, dataSend any, dataRecv any) error {
+	conn, err := c.conn(ctx, pr)
+	if err != nil {
+		return err
+	}
+
+	return conn.Request(ctx, typ, dataSend, dataRecv)
+}
+
+// request sends a request to the peer with the specified timeout. A shorter
+// deadline on the context is respected.
+func (c *Client) request(ctx context.Context, pr peer.Peer, typ MsgType, timeout time.Duration, dataSend any, dataRecv any) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return c.Request(ctx, pr, typ, dataSend, dataRecv)
+}
+
+// conn returns the open connection to the peer or establishes a new one.
+func (c *Client) conn(ctx context.Context, pr peer.Peer) (*Conn, error) {
+	if pr.P2PHost == "" {
+		return nil, ErrNoStream
+	}
+
+	c.mu.Lock()
+	conn, exists := c.conns[pr.P2PHost]
+	c.mu.Unlock()
+
+	if exists && !conn.Closed() && (pr.PublicKey == "" || conn.PublicKey() == pr.PublicKey) {
+		return conn, nil
+	}
+
+	conn, err := c.dial(ctx, pr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another request may have connected at the same time.
+	if existing, exists := c.conns[pr.P2PHost]; exists && !existing.Closed() && existing.PublicKey() == conn.PublicKey() {
+		conn.Close()
+		return existing, nil
+	}
+
+	if existing, exists := c.conns[pr.P2PHost]; exists {
+		existing.Close()
+	}
+	c.conns[pr.P2PHost] = conn
+
+	return conn, nil
+}
+
+// dial establishes and authenticates a new connection to the peer.
+func (c *Client) dial(ctx context.Context, pr peer.Peer) (*Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+
+	nc, err := dialer.DialContext(ctx, "tcp", pr.P2PHost)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.tls != nil {
+		tc := tls.Client(nc, identity.PinPublicKey(c.tls, pr.PublicKey))
+		if err := tc.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		nc = tc
+	}
+
+	publicKey, err := authenticate(nc, c.identityKey)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	if pr.PublicKey != "" && publicKey != pr.PublicKey {
+		nc.Close()
+		return nil, ErrIdentityMismatch
+	}
+
+	conn := newConn(nc, publicKey)
+	go conn.readResponses()
+
+	return conn, nil
+}
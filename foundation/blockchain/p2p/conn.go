@@ -0,0 +1,315 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+// authTimeout represents how long the two nodes have to authenticate
+// each other after the connection is established.
+const authTimeout = 5 * time.Second
+
+// writeTimeout represents how long a single frame write can take.
+const writeTimeout = 10 * time.Second
+
+// hello is the first message each node sends on a new connection.
+type hello struct {
+	PublicKey string `json:"public_key"`
+	Nonce     string `json:"nonce"`
+}
+
+// auth proves the node holds the identity key it announced in hello by
+// signing the nonce provided by the other node.
+type auth struct {
+	Signature string `json:"signature"`
+}
+
+// errorPayload is the payload of a MsgError frame.
+type errorPayload struct {
+	Error string `json:"error"`
+}
+
+// =============================================================================
+
+// Conn represents an authenticated connection to a peer. Requests are
+// multiplexed over the connection by request id.
+type Conn struct {
+	nc        net.Conn
+	publicKey string
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan frame
+	done    chan struct{}
+	err     error
+}
+
+// newConn constructs a connection for an authenticated network connection.
+func newConn(nc net.Conn, publicKey string) *Conn {
+	return &Conn{
+		nc:        nc,
+		publicKey: publicKey,
+		pending:   make(map[uint64]chan frame),
+		done:      make(chan struct{}),
+	}
+}
+
+// PublicKey returns the identity public key of the peer.
+func (c *Conn) PublicKey() string {
+	return c.publicKey
+}
+
+// Close closes the connection and fails any pending requests.
+func (c *Conn) Close() error {
+	c.closeWithError(ErrClosed)
+	return nil
+}
+
+// Closed identifies if the connection has been closed.
+func (c *Conn) Closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Request sends a request to the peer and waits for the response. The
+// deadline of the context is sent with the request so the peer knows when
+// the request is no longer wanted. The span in the context is sent as well
+// so the peer continues the trace.
+func (c *Conn) Request(ctx context.Context, typ MsgType, dataSend any, dataRecv any) error {
+	var payload []byte
+	if dataSend != nil {
+		var err error
+		if payload, err = json.Marshal(dataSend); err != nil {
+			return err
+		}
+	}
+
+	var deadline int64
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d.UnixNano()
+	}
+
+	ch := make(chan frame, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(frame{typ: typ, id: id, deadline: deadline, sc: trace.SpanContextFromContext(ctx), payload: payload}); err != nil {
+		c.closeWithError(err)
+		return err
+	}
+
+	select {
+	case f := <-ch:
+		return decodeResponse(f, dataRecv)
+
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-c.done:
+		return c.closeErr()
+	}
+}
+
+// readResponses reads the response frames from the peer and hands them to
+// the pending requests. This runs until the connection is closed.
+func (c *Conn) readResponses() {
+	for {
+		f, err := readFrame(c.nc, maxFrameSize)
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+
+		c.mu.Lock()
+		ch, exists := c.pending[f.id]
+		c.mu.Unlock()
+
+		// The request may have already timed out.
+		if exists {
+			select {
+			case ch <- f:
+			default:
+			}
+		}
+	}
+}
+
+// write sends a frame to the peer.
+func (c *Conn) write(f frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return writeFrame(c.nc, f)
+}
+
+// respond sends the result of a request back to the peer.
+func (c *Conn) respond(id uint64, data any, err error) error {
+	if err != nil {
+		payload, _ := json.Marshal(errorPayload{Error: err.Error()})
+		return c.write(frame{typ: MsgError, id: id, payload: payload})
+	}
+
+	var payload []byte
+	if data != nil {
+		if payload, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+
+	return c.write(frame{typ: MsgResponse, id: id, payload: payload})
+}
+
+// closeWithError closes the connection and records the reason.
+func (c *Conn) closeWithError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	close(c.done)
+	c.nc.Close()
+}
+
+// closeErr returns the reason the connection was closed.
+func (c *Conn) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if errors.Is(c.err, ErrClosed) {
+		return c.err
+	}
+
+	return fmt.Errorf("%w: %w", ErrClosed, c.err)
+}
+
+// decodeResponse converts a response frame into the result of a request.
+func decodeResponse(f frame, dataRecv any) error {
+	switch f.typ {
+	case MsgError:
+		var ep errorPayload
+		if err := json.Unmarshal(f.payload, &ep); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", peer.ErrRejected, ep.Error)
+
+	case MsgResponse:
+		if dataRecv == nil || len(f.payload) == 0 {
+			return nil
+		}
+		return json.Unmarshal(f.payload, dataRecv)
+	}
+
+	return fmt.Errorf("unexpected response type %s", f.typ)
+}
+
+// =============================================================================
+
+// authenticate proves the identity of each node to the other. Each node sends
+// its public key with a random nonce and then signs the nonce it received.
+// The public key of the peer is returned.
+func authenticate(nc net.Conn, identityKey *ecdsa.PrivateKey) (string, error) {
+	nc.SetDeadline(time.Now().Add(authTimeout))
+	defer nc.SetDeadline(time.Time{})
+
+	publicKey, err := identity.PublicKeyHex(&identityKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	local := hello{
+		PublicKey: publicKey,
+		Nonce:     hex.EncodeToString(nonce),
+	}
+
+	var remote hello
+	if err := exchange(nc, MsgHello, local, &remote); err != nil {
+		return "", err
+	}
+
+	sig, err := identity.Sign(identityKey, authData(remote.Nonce, publicKey))
+	if err != nil {
+		return "", err
+	}
+
+	var remoteAuth auth
+	if err := exchange(nc, MsgAuth, auth{Signature: sig}, &remoteAuth); err != nil {
+		return "", err
+	}
+
+	if err := identity.Verify(remote.PublicKey, authData(local.Nonce, remote.PublicKey), remoteAuth.Signature); err != nil {
+		return "", fmt.Errorf("authenticating peer: %w", err)
+	}
+
+	return remote.PublicKey, nil
+}
+
+// exchange writes a message to the peer and reads the same type of
+// message back.
+func exchange(nc net.Conn, typ MsgType, dataSend any, dataRecv any) error {
+	payload, err := json.Marshal(dataSend)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFrame(nc, frame{typ: typ, payload: payload}); err != nil {
+		return err
+	}
+
+	f, err := readFrame(nc, maxAuthFrameSize)
+	if err != nil {
+		return err
+	}
+
+	if f.typ != typ {
+		return errors.New("unexpected message during authentication: " + f.typ.String())
+	}
+
+	return json.Unmarshal(f.payload, dataRecv)
+}
+
+// authData produces the data that is signed to prove the identity key.
+func authData(nonce string, publicKey string) []byte {
+	return []byte("ardan-p2p-auth\n" + nonce + "\n" + publicKey)
+}
@@ -0,0 +1,90 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+// CORE NOTE: Every frame starts with a 4 byte length followed by a fixed
+// header and the payload. The header holds the message type, the request id,
+// the deadline for the request and the W3C trace context of the caller. The
+// trace context is all zeros when the request is not traced. The payload is
+// JSON so the same data types used by the HTTP API can be reused.
+//
+//	| length (4) | type (1) | request id (8) | deadline (8) | trace id (16) | span id (8) | payload |
+
+// headerSize represents the size of the fixed header that follows the length.
+const headerSize = 1 + 8 + 8 + 16 + 8
+
+// maxFrameSize represents the largest frame a node will read. This protects
+// the node from a peer announcing a huge frame.
+const maxFrameSize = 32 << 20
+
+// maxAuthFrameSize represents the largest frame a node will read before the
+// peer is authenticated. The hello and auth messages are small, so a peer
+// that hasn't proven its identity can't make the node allocate large frames.
+const maxAuthFrameSize = 4 << 10
+
+// frame represents a single message on the wire.
+type frame struct {
+	typ      MsgType
+	id       uint64
+	deadline int64
+	sc       trace.SpanContext
+	payload  []byte
+}
+
+// writeFrame writes the frame to the writer as a single write.
+func writeFrame(w io.Writer, f frame) error {
+	size := headerSize + len(f.payload)
+	if size > maxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	buf := make([]byte, 4+size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(size))
+	buf[4] = byte(f.typ)
+	binary.BigEndian.PutUint64(buf[5:13], f.id)
+	binary.BigEndian.PutUint64(buf[13:21], uint64(f.deadline))
+	copy(buf[21:37], f.sc.TraceID[:])
+	copy(buf[37:45], f.sc.SpanID[:])
+	copy(buf[45:], f.payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// readFrame reads the next frame from the reader. Frames larger than the
+// limit are refused.
+func readFrame(r io.Reader, limit uint32) (frame, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	switch {
+	case size < headerSize:
+		return frame{}, ErrInvalidFrame
+	case size > limit:
+		return frame{}, ErrFrameTooLarge
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{
+		typ:      MsgType(buf[0]),
+		id:       binary.BigEndian.Uint64(buf[1:9]),
+		deadline: int64(binary.BigEndian.Uint64(buf[9:17])),
+		payload:  buf[headerSize:],
+	}
+	copy(f.sc.TraceID[:], buf[17:33])
+	copy(f.sc.SpanID[:], buf[33:41])
+
+	return f, nil
+}
@@ -0,0 +1,78 @@
+// Package p2p implements the binary streaming protocol used between nodes.
+// Peers keep long-lived TCP connections that carry length-prefixed frames.
+// Every request frame has an id so many requests can be in flight on the same
+// connection, and a deadline so the receiving node can stop working on a
+// request the sender has already given up on.
+package p2p
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Set of error variables for the streaming protocol.
+var (
+	ErrNoStream         = errors.New("peer doesn't support the streaming protocol")
+	ErrClosed           = errors.New("connection closed")
+	ErrFrameTooLarge    = errors.New("frame too large")
+	ErrInvalidFrame     = errors.New("invalid frame")
+	ErrIdentityMismatch = errors.New("peer identity doesn't match the handshake")
+	ErrServerClosed     = errors.New("p2p: server closed")
+)
+
+// MsgType represents the type of message carried by a frame.
+type MsgType uint8
+
+// Set of message types supported by the protocol.
+const (
+	MsgHello MsgType = iota + 1
+	MsgAuth
+	MsgResponse
+	MsgError
+	MsgPing
+	MsgHandshake
+	MsgStatus
+	MsgMempool
+	MsgTxAnnounce
+	MsgTxRequest
+	MsgBlockAnnounce
+	MsgHeaders
+	MsgBodies
+	MsgBlockTxs
+)
+
+// String implements the Stringer interface for logging.
+func (m MsgType) String() string {
+	switch m {
+	case MsgHello:
+		return "hello"
+	case MsgAuth:
+		return "auth"
+	case MsgResponse:
+		return "response"
+	case MsgError:
+		return "error"
+	case MsgPing:
+		return "ping"
+	case MsgHandshake:
+		return "handshake"
+	case MsgStatus:
+		return "status"
+	case MsgMempool:
+		return "mempool"
+	case MsgTxAnnounce:
+		return "tx-announce"
+	case MsgTxRequest:
+		return "tx-request"
+	case MsgBlockAnnounce:
+		return "block-announce"
+	case MsgHeaders:
+		return "headers"
+	case MsgBodies:
+		return "bodies"
+	case MsgBlockTxs:
+		return "block-txs"
+	}
+
+	return fmt.Sprintf("unknown(%d)", uint8(m))
+}
@@ -0,0 +1,254 @@
+package p2p_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/p2p"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+func Test_Request(t *testing.T) {
+	serverKey, _ := identity.Generate()
+	clientKey, _ := identity.Generate()
+	otherKey, _ := identity.Generate()
+
+	serverPublicKey, _ := identity.PublicKeyHex(&serverKey.PublicKey)
+	clientPublicKey, _ := identity.PublicKeyHex(&clientKey.PublicKey)
+	otherPublicKey, _ := identity.PublicKeyHex(&otherKey.PublicKey)
+
+	var connections atomic.Int32
+	deadlines := make(chan bool, 1)
+
+	h := func(ctx context.Context, publicKey string, typ p2p.MsgType, payload []byte) (any, error) {
+		if publicKey != clientPublicKey {
+			return nil, errors.New("unexpected identity")
+		}
+
+		switch typ {
+		case p2p.MsgStatus:
+			return peer.PeerStatus{LatestBlockNumber: 10}, nil
+
+		case p2p.MsgTxRequest:
+			return nil, errors.New("not allowed")
+
+		case p2p.MsgTxAnnounce:
+			return trace.SpanContextFromContext(ctx).Traceparent(), nil
+
+		case p2p.MsgHeaders:
+			return []peer.BlockHeader{
+				{Hash: "0x01", Header: database.BlockHeader{Number: 1}},
+				{Hash: "0x02", Header: database.BlockHeader{Number: 2, PrevBlockHash: "0x01"}},
+			}, nil
+
+		case p2p.MsgBodies:
+			var req peer.BodiesRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return nil, err
+			}
+			bodies := make([][]database.BlockTx, len(req.Blocks))
+			for i, id := range req.Blocks {
+				bodies[i] = []database.BlockTx{{SignedTx: database.SignedTx{Tx: database.Tx{Nonce: id.Number}}}}
+			}
+			return bodies, nil
+
+		case p2p.MsgMempool:
+			<-ctx.Done()
+			_, ok := ctx.Deadline()
+			deadlines <- ok
+			return nil, ctx.Err()
+		}
+
+		return nil, nil
+	}
+
+	ev := func(v string, args ...any) {
+		if v == "p2p: serveConn: %s: connected" {
+			connections.Add(1)
+		}
+	}
+
+	srv, host := startServer(t, serverKey, h, ev)
+	defer srv.Shutdown(context.Background())
+
+	client := p2p.NewClient(clientKey, nil)
+	defer client.Close()
+
+	pr := peer.Peer{Host: "0.0.0.0:9080", P2PHost: host, PublicKey: serverPublicKey}
+
+	t.Run("response", func(t *testing.T) {
+		status, err := client.Status(context.Background(), pr)
+		if err != nil {
+			t.Fatalf("Should be able to get the status: %s", err)
+		}
+		if status.LatestBlockNumber != 10 {
+			t.Fatalf("Should get block number 10, got %d.", status.LatestBlockNumber)
+		}
+	})
+
+	t.Run("multiplexed", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Go(func() {
+				if err := client.Ping(context.Background(), pr); err != nil {
+					t.Errorf("Should be able to ping the peer: %s", err)
+				}
+			})
+		}
+		wg.Wait()
+
+		if n := connections.Load(); n != 1 {
+			t.Fatalf("Should use a single connection, got %d.", n)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := client.RequestTxs(context.Background(), pr, peer.TxRequest{})
+		if !errors.Is(err, peer.ErrRejected) {
+			t.Fatalf("Should get a rejected error, got %v.", err)
+		}
+	})
+
+	t.Run("trace", func(t *testing.T) {
+		tracer := trace.New("client", trace.NewRecorder(10))
+		ctx, span := tracer.Start(context.Background(), "announce")
+		defer span.End()
+
+		var traceparent string
+		if err := client.Request(ctx, pr, p2p.MsgTxAnnounce, peer.TxAnnounce{}, &traceparent); err != nil {
+			t.Fatalf("Should be able to announce: %s", err)
+		}
+
+		if traceparent != span.SpanContext().Traceparent() {
+			t.Fatalf("Should send the trace context to the peer, got %s.", traceparent)
+		}
+	})
+
+	t.Run("headers first", func(t *testing.T) {
+		blocks, err := client.RequestBlocks(context.Background(), pr, peer.BlocksRequest{From: 1})
+		if err != nil {
+			t.Fatalf("Should be able to request the blocks: %s", err)
+		}
+		if len(blocks) != 2 {
+			t.Fatalf("Should get 2 blocks, got %d.", len(blocks))
+		}
+		for i, blk := range blocks {
+			if blk.Header.Number != uint64(i+1) || len(blk.Trans) != 1 || blk.Trans[0].Nonce != blk.Header.Number {
+				t.Fatalf("Should match each body to its header, got %+v.", blk)
+			}
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := client.Request(ctx, pr, p2p.MsgMempool, nil, nil)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Should get a deadline error, got %v.", err)
+		}
+
+		select {
+		case ok := <-deadlines:
+			if !ok {
+				t.Fatalf("Should send the deadline to the peer.")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Should cancel the request on the peer.")
+		}
+	})
+
+	t.Run("identity mismatch", func(t *testing.T) {
+		impostor := peer.Peer{Host: "0.0.0.0:9081", P2PHost: host, PublicKey: otherPublicKey}
+
+		if err := client.Ping(context.Background(), impostor); !errors.Is(err, p2p.ErrIdentityMismatch) {
+			t.Fatalf("Should get an identity mismatch error, got %v.", err)
+		}
+	})
+
+	t.Run("no stream", func(t *testing.T) {
+		if err := client.Ping(context.Background(), peer.New("0.0.0.0:9080")); !errors.Is(err, p2p.ErrNoStream) {
+			t.Fatalf("Should get a no stream error, got %v.", err)
+		}
+	})
+}
+
+func Test_Shutdown(t *testing.T) {
+	serverKey, _ := identity.Generate()
+	clientKey, _ := identity.Generate()
+
+	h := func(ctx context.Context, publicKey string, typ p2p.MsgType, payload []byte) (any, error) {
+		return nil, nil
+	}
+
+	srv, host := startServer(t, serverKey, h, nil)
+
+	client := p2p.NewClient(clientKey, nil)
+	defer client.Close()
+
+	pr := peer.Peer{Host: "0.0.0.0:9080", P2PHost: host}
+	if err := client.Ping(context.Background(), pr); err != nil {
+		t.Fatalf("Should be able to ping the peer: %s", err)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Should be able to shutdown the server: %s", err)
+	}
+
+	if err := client.Ping(context.Background(), pr); err == nil {
+		t.Fatalf("Should not be able to ping a peer that is shutdown.")
+	}
+}
+
+func Test_AuthFrameLimit(t *testing.T) {
+	serverKey, _ := identity.Generate()
+
+	h := func(ctx context.Context, publicKey string, typ p2p.MsgType, payload []byte) (any, error) {
+		return nil, nil
+	}
+
+	_, host := startServer(t, serverKey, h, nil)
+
+	nc, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatalf("Should be able to connect: %s", err)
+	}
+	defer nc.Close()
+
+	// Announce a 1 MiB frame in place of the hello message.
+	if _, err := nc.Write([]byte{0x00, 0x10, 0x00, 0x00}); err != nil {
+		t.Fatalf("Should be able to write: %s", err)
+	}
+
+	nc.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var ne net.Error
+	if _, err := io.ReadAll(nc); errors.As(err, &ne) && ne.Timeout() {
+		t.Fatalf("Should close a connection that sends a large frame before authenticating.")
+	}
+}
+
+// =============================================================================
+
+func startServer(t *testing.T, key *ecdsa.PrivateKey, h p2p.Handler, ev p2p.EventHandler) (*p2p.Server, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Should be able to listen: %s", err)
+	}
+
+	srv := p2p.NewServer(key, nil, h, ev)
+	go srv.Serve(ln)
+
+	return srv, ln.Addr().String()
+}
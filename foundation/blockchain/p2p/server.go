@@ -0,0 +1,279 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+// maxConcurrentRequests represents the number of requests from a single
+// connection that are processed at the same time.
+const maxConcurrentRequests = 32
+
+// maxConns represents the number of connections, authenticated or not, the
+// server keeps open at the same time. Connections past the limit are closed
+// as soon as they are accepted.
+const maxConns = 256
+
+// Handler processes a request received from a peer. The public key is the
+// authenticated identity of the peer that sent the request. The returned
+// value is sent back to the peer as the response.
+type Handler func(ctx context.Context, publicKey string, typ MsgType, payload []byte) (any, error)
+
+// EventHandler defines a function that is called when events
+// occur in the processing of connections.
+type EventHandler func(v string, args ...any)
+
+// =============================================================================
+
+// Server accepts connections from peers and processes their requests.
+type Server struct {
+	identityKey *ecdsa.PrivateKey
+	tls         *tls.Config
+	handler     Handler
+	evHandler   EventHandler
+
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*Conn]struct{}
+	open     int
+	shut     bool
+}
+
+// NewServer constructs a server that authenticates peers with the identity
+// key. If a TLS configuration is provided, connections are encrypted.
+func NewServer(identityKey *ecdsa.PrivateKey, tlsConfig *tls.Config, handler Handler, evHandler EventHandler) *Server {
+	ev := func(v string, args ...any) {
+		if evHandler != nil {
+			evHandler(v, args...)
+		}
+	}
+
+	return &Server{
+		identityKey: identityKey,
+		tls:         tlsConfig,
+		handler:     handler,
+		evHandler:   ev,
+		conns:       make(map[*Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the specified address and serves peers until
+// the server is shut down.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on the listener until the server is shut down.
+func (s *Server) Serve(ln net.Listener) error {
+	if s.tls != nil {
+		ln = tls.NewListener(ln, s.tls)
+	}
+
+	s.mu.Lock()
+	if s.shut {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			if s.isShutdown() {
+				return ErrServerClosed
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		if !s.acquire() {
+			s.evHandler("p2p: serve: %s: too many connections", nc.RemoteAddr())
+			nc.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer func() {
+				s.release()
+				s.wg.Done()
+			}()
+			s.serveConn(nc)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections, closes the open connections and
+// waits for the requests in progress to finish.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shut = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// =============================================================================
+
+// serveConn authenticates the peer and then processes its requests until
+// the connection is closed.
+func (s *Server) serveConn(nc net.Conn) {
+	publicKey, err := authenticate(nc, s.identityKey)
+	if err != nil {
+		s.evHandler("p2p: serveConn: %s: authenticate: ERROR: %s", nc.RemoteAddr(), err)
+		nc.Close()
+		return
+	}
+
+	c := newConn(nc, publicKey)
+	if !s.track(c) {
+		c.Close()
+		return
+	}
+	defer s.untrack(c)
+
+	s.evHandler("p2p: serveConn: %s: connected", nc.RemoteAddr())
+	defer s.evHandler("p2p: serveConn: %s: disconnected", nc.RemoteAddr())
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sem := make(chan struct{}, maxConcurrentRequests)
+
+	for {
+		f, err := readFrame(nc, maxFrameSize)
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s.serveRequest(c, f)
+		}()
+	}
+}
+
+// serveRequest processes a single request and responds to the peer.
+func (s *Server) serveRequest(c *Conn, f frame) {
+	ctx := context.Background()
+	if f.deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, f.deadline))
+		defer cancel()
+	}
+
+	// Continue the trace of the peer that made the request.
+	ctx = trace.ContextWithSpanContext(ctx, f.sc)
+
+	var resp any
+	var err error
+
+	switch f.typ {
+	case MsgPing:
+
+	default:
+		resp, err = s.handler(ctx, c.PublicKey(), f.typ, f.payload)
+	}
+
+	// The peer has already given up on this request.
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err := c.respond(f.id, resp, err); err != nil {
+		c.closeWithError(err)
+	}
+}
+
+// acquire reserves a slot for a new connection. It returns false when the
+// server already has the max number of connections open.
+func (s *Server) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.open >= maxConns {
+		return false
+	}
+
+	s.open++
+	return true
+}
+
+// release frees the slot held by a connection that is closed.
+func (s *Server) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.open--
+}
+
+// track adds the connection to the set of open connections.
+func (s *Server) track(c *Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shut {
+		return false
+	}
+
+	s.conns[c] = struct{}{}
+	return true
+}
+
+// untrack removes the connection from the set of open connections.
+func (s *Server) untrack(c *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, c)
+}
+
+// isShutdown identifies if the server is shutting down.
+func (s *Server) isShutdown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.shut
+}
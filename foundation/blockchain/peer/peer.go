@@ -3,12 +3,44 @@
 package peer
 
 import (
+	"errors"
+	"fmt"
 	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 )
 
-// Peer represents information about a Node in the network.
+// ProtocolVersion represents the version of the node to node protocol
+// implemented by this software. Nodes must run the same protocol version.
+const ProtocolVersion = 3
+
+// ErrRejected is returned by a transport when the peer was reached but didn't
+// accept the request. This is different from failing to reach the peer.
+var ErrRejected = errors.New("request rejected by peer")
+
+// ErrKeyMismatch is returned when a handshake for a known host carries a
+// different identity public key than the one the host is bound to. The
+// binding can only be changed by unpinning the host.
+var ErrKeyMismatch = errors.New("host is bound to a different identity public key")
+
+// ErrCircuitOpen is returned when a peer has been failing network calls and
+// no calls are allowed until its backoff expires.
+var ErrCircuitOpen = errors.New("peer circuit open")
+
+// =============================================================================
+
+// Peer represents information about a Node in the network. Outside of the
+// host, the information is provided by the node during the handshake.
 type Peer struct {
-	Host string
+	Host            string `json:"host" validate:"required"`
+	ChainID         uint16 `json:"chain_id,omitempty"`
+	GenesisHash     string `json:"genesis_hash,omitempty"`
+	NodeVersion     string `json:"node_version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+	Consensus       string `json:"consensus,omitempty"`
+	PublicKey       string `json:"public_key,omitempty"`
+	P2PHost         string `json:"p2p_host,omitempty"`
 }
 
 // New contructs a new info value.
@@ -23,43 +55,205 @@ func (p Peer) Match(host string) bool {
 	return p.Host == host
 }
 
+// String implements the Stringer interface for logging.
+func (p Peer) String() string {
+	return p.Host
+}
+
+// HasHandshake identifies if the handshake information for this
+// peer is known.
+func (p Peer) HasHandshake() bool {
+	return p.GenesisHash != ""
+}
+
+// Compatible checks the handshake information of the other peer is
+// compatible with this peer so they can participate in the same network.
+func (p Peer) Compatible(other Peer) error {
+	if other.ChainID != p.ChainID {
+		return fmt.Errorf("chain id mismatch, got %d, exp %d", other.ChainID, p.ChainID)
+	}
+
+	if other.GenesisHash != p.GenesisHash {
+		return fmt.Errorf("genesis hash mismatch, got %s, exp %s", other.GenesisHash, p.GenesisHash)
+	}
+
+	if other.ProtocolVersion != p.ProtocolVersion {
+		return fmt.Errorf("protocol version mismatch, got %d, exp %d", other.ProtocolVersion, p.ProtocolVersion)
+	}
+
+	if other.Consensus != p.Consensus {
+		return fmt.Errorf("consensus mismatch, got %s, exp %s", other.Consensus, p.Consensus)
+	}
+
+	if other.PublicKey == "" {
+		return fmt.Errorf("missing identity public key")
+	}
+
+	return nil
+}
+
 // =============================================================================
 
 // PeerStatus represents information about the status
 // of any given peer.
 type PeerStatus struct {
-	LatestBlockHash   string `json:"latest_block_hash"`
-	LatestBlockNumber uint64 `json:"latest_block_number"`
-	KnownPeers        []Peer `json:"known_peers"`
+	LatestBlockHash   string  `json:"latest_block_hash"`
+	LatestBlockNumber uint64  `json:"latest_block_number"`
+	KnownPeers        []Peer  `json:"known_peers"`
+	Scores            []Score `json:"scores,omitempty"`
 }
 
 // =============================================================================
 
-// PeerSet represents the data representation to maintain a set of known peers.
+// TxAnnounce represents a batch of transaction hashes a node is announcing to
+// its peers. A peer will request the transactions it doesn't already have
+// from the node identified by the request, not by anything in the payload.
+// Traces holds the W3C traceparent for the transactions that are being
+// traced, keyed by hash, so each one can be followed across nodes.
+type TxAnnounce struct {
+	Hashes []string          `json:"hashes" validate:"required"`
+	Traces map[string]string `json:"traces,omitempty"`
+}
+
+// TxRequest represents a request for the full transactions that match
+// the specified hashes.
+type TxRequest struct {
+	Hashes []string `json:"hashes" validate:"required"`
+}
+
+// CompactBlock represents a new block being relayed by a node to its peers
+// in the compact format. Missing transactions are requested from the node
+// identified by the request, not by anything in the payload.
+type CompactBlock struct {
+	Block database.CompactBlockData `json:"block"`
+}
+
+// BlockTxRequest represents a request for the transactions at the specified
+// positions in a block. This is used to fill in a compact block.
+type BlockTxRequest struct {
+	Number  uint64 `json:"number" validate:"required"`
+	Hash    string `json:"hash" validate:"required"`
+	Indexes []int  `json:"indexes" validate:"required"`
+}
+
+// MaxBlocksPerRequest is the most blocks a node returns for a single
+// request. A node that is further behind keeps asking for the next set
+// until it's caught up.
+const MaxBlocksPerRequest = 100
+
+// BlocksRequest represents a request for the blocks starting at the
+// specified block number up to the peer's latest block, limited to
+// MaxBlocksPerRequest blocks.
+type BlocksRequest struct {
+	From uint64 `json:"from"`
+}
+
+// BlockHeader represents the header of a block along with its hash. A node
+// that is catching up over the streaming protocol receives the headers first
+// and then requests the bodies of those blocks.
+type BlockHeader struct {
+	Hash   string               `json:"hash"`
+	Header database.BlockHeader `json:"block"`
+}
+
+// BlockID identifies a block by its number and hash.
+type BlockID struct {
+	Number uint64 `json:"number" validate:"required"`
+	Hash   string `json:"hash" validate:"required"`
+}
+
+// BodiesRequest represents a request for the transactions of the specified
+// blocks, limited to MaxBlocksPerRequest blocks. The bodies are returned in
+// the order the blocks are requested.
+type BodiesRequest struct {
+	Blocks []BlockID `json:"blocks" validate:"required,dive"`
+}
+
+// =============================================================================
+
+// PeerSet represents the data representation to maintain a set of known peers
+// and the scores that track their behavior.
 type PeerSet struct {
-	mu  sync.RWMutex
-	set map[Peer]struct{}
+	mu     sync.RWMutex
+	clock  clock.Clock
+	set    map[string]Peer
+	scores map[string]*Score
 }
 
 // NewPeerSet constructs a new info set to manage node peer information.
 func NewPeerSet() *PeerSet {
 	return &PeerSet{
-		set: make(map[Peer]struct{}),
+		clock:  clock.New(),
+		set:    make(map[string]Peer),
+		scores: make(map[string]*Score),
 	}
 }
 
-// Add adds a new node to the set.
+// SetClock replaces the clock used to time backoffs and bans.
+func (ps *PeerSet) SetClock(clk clock.Clock) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.clock = clk
+}
+
+// Add adds a new node to the set. If the node already exists and the peer
+// carries handshake information, the information is updated. It returns
+// true if the node is new to the set. Banned nodes are not added and a
+// handshake that doesn't match the identity the host is bound to is ignored.
 func (ps *PeerSet) Add(peer Peer) bool {
+	added, _ := ps.AddHandshake(peer)
+	return added
+}
+
+// AddHandshake adds the node to the set like Add does, but returns
+// ErrKeyMismatch when the host is bound to a different identity public key.
+// The check and the update happen under the same lock so two handshakes for
+// the same host can't both bind it.
+func (ps *PeerSet) AddHandshake(peer Peer) (bool, error) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	_, exists := ps.set[peer]
+	if s, exists := ps.scores[peer.Host]; exists && s.banned(ps.clock.Now()) {
+		return false, nil
+	}
+
+	existing, exists := ps.set[peer.Host]
 	if !exists {
-		ps.set[peer] = struct{}{}
-		return true
+		ps.set[peer.Host] = peer
+		return true, nil
+	}
+
+	if !peer.HasHandshake() {
+		return false, nil
+	}
+
+	// CORE NOTE: The first handshake binds the host to the identity key that
+	// signed it. Letting a later handshake replace the key would let anyone
+	// with a new key pair claim a known host and lock the real node out.
+	if existing.PublicKey != "" && existing.PublicKey != peer.PublicKey {
+		return false, ErrKeyMismatch
+	}
+
+	ps.set[peer.Host] = peer
+
+	return false, nil
+}
+
+// Unpin clears the handshake information for the host so the next handshake
+// binds it to a new identity public key. It returns false if the host isn't
+// in the set.
+func (ps *PeerSet) Unpin(host string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, exists := ps.set[host]; !exists {
+		return false
 	}
 
-	return false
+	ps.set[host] = New(host)
+
+	return true
 }
 
 // Remove removes a node from the set.
@@ -67,7 +261,43 @@ func (ps *PeerSet) Remove(peer Peer) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	delete(ps.set, peer)
+	delete(ps.set, peer.Host)
+}
+
+// Get returns the node information for the specified host.
+func (ps *PeerSet) Get(host string) (Peer, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	peer, exists := ps.set[host]
+	return peer, exists
+}
+
+// ByPublicKey returns the peer that completed a handshake with the specified
+// identity public key. This is how a request is tied to the peer that sent
+// it, since the host in a payload can't be trusted.
+func (ps *PeerSet) ByPublicKey(publicKey string) (Peer, bool) {
+	if publicKey == "" {
+		return Peer{}, false
+	}
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	for _, peer := range ps.set {
+		if peer.PublicKey == publicKey {
+			return peer, true
+		}
+	}
+
+	return Peer{}, false
+}
+
+// HasPublicKey identifies if a peer in the set completed a handshake
+// with the specified identity public key.
+func (ps *PeerSet) HasPublicKey(publicKey string) bool {
+	_, exists := ps.ByPublicKey(publicKey)
+	return exists
 }
 
 // Copy returns a list of the known peers.
@@ -76,7 +306,7 @@ func (ps *PeerSet) Copy(host string) []Peer {
 	defer ps.mu.RUnlock()
 
 	var peers []Peer
-	for peer := range ps.set {
+	for _, peer := range ps.set {
 		if !peer.Match(host) {
 			peers = append(peers, peer)
 		}
@@ -1,6 +1,7 @@
 package peer_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
@@ -45,3 +46,117 @@ func Test_CRUD(t *testing.T) {
 		t.Run(tst.name, f)
 	}
 }
+
+func Test_Compatible(t *testing.T) {
+	self := peer.Peer{
+		Host:            "host1",
+		ChainID:         1,
+		GenesisHash:     "0x01",
+		ProtocolVersion: peer.ProtocolVersion,
+		Consensus:       "POW",
+		PublicKey:       "3059",
+	}
+
+	type table struct {
+		name    string
+		other   func(p peer.Peer) peer.Peer
+		success bool
+	}
+
+	tt := []table{
+		{name: "match", other: func(p peer.Peer) peer.Peer { return p }, success: true},
+		{name: "chain", other: func(p peer.Peer) peer.Peer { p.ChainID = 2; return p }},
+		{name: "genesis", other: func(p peer.Peer) peer.Peer { p.GenesisHash = "0x02"; return p }},
+		{name: "protocol", other: func(p peer.Peer) peer.Peer { p.ProtocolVersion++; return p }},
+		{name: "consensus", other: func(p peer.Peer) peer.Peer { p.Consensus = "POA"; return p }},
+		{name: "publickey", other: func(p peer.Peer) peer.Peer { p.PublicKey = ""; return p }},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			other := tst.other(self)
+			other.Host = "host2"
+
+			err := self.Compatible(other)
+			if tst.success && err != nil {
+				t.Fatalf("Test %s:\tShould be compatible: %s", tst.name, err)
+			}
+			if !tst.success && err == nil {
+				t.Fatalf("Test %s:\tShould not be compatible.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_AddHandshake(t *testing.T) {
+	ps := peer.NewPeerSet()
+
+	if !ps.Add(peer.New("host1")) {
+		t.Fatalf("Should be able to add a new peer.")
+	}
+
+	hs := peer.Peer{Host: "host1", GenesisHash: "0x01"}
+	if ps.Add(hs) {
+		t.Fatalf("Should not report an existing peer as new.")
+	}
+
+	pr, exists := ps.Get("host1")
+	if !exists {
+		t.Fatalf("Should be able to get the peer.")
+	}
+	if !pr.HasHandshake() {
+		t.Fatalf("Should have updated the peer with the handshake information.")
+	}
+
+	ps.Add(peer.New("host1"))
+	if pr, _ := ps.Get("host1"); !pr.HasHandshake() {
+		t.Fatalf("Should not lose the handshake information.")
+	}
+}
+
+func Test_KeyBinding(t *testing.T) {
+	ps := peer.NewPeerSet()
+
+	owner := peer.Peer{Host: "host1", GenesisHash: "0x01", PublicKey: "key1"}
+	if added, err := ps.AddHandshake(owner); err != nil || !added {
+		t.Fatalf("Should be able to add the peer with its handshake: %v", err)
+	}
+
+	owner.NodeVersion = "1.1"
+	if _, err := ps.AddHandshake(owner); err != nil {
+		t.Fatalf("Should accept a new handshake with the same key: %s", err)
+	}
+
+	attacker := peer.Peer{Host: "host1", GenesisHash: "0x01", PublicKey: "key2"}
+	if _, err := ps.AddHandshake(attacker); !errors.Is(err, peer.ErrKeyMismatch) {
+		t.Fatalf("Should reject a second key claiming the host, got %v.", err)
+	}
+
+	ps.Add(attacker)
+	if ps.HasPublicKey("key2") {
+		t.Fatalf("Should not authorize the second key.")
+	}
+	if pr, _ := ps.Get("host1"); pr.PublicKey != "key1" || pr.NodeVersion != "1.1" {
+		t.Fatalf("Should keep the peer bound to the first key, got %+v.", pr)
+	}
+
+	if !ps.Unpin("host1") {
+		t.Fatalf("Should be able to unpin a known peer.")
+	}
+	if ps.HasPublicKey("key1") {
+		t.Fatalf("Should clear the key when the peer is unpinned.")
+	}
+
+	if _, err := ps.AddHandshake(attacker); err != nil {
+		t.Fatalf("Should bind a new key after the peer is unpinned: %s", err)
+	}
+	if !ps.HasPublicKey("key2") {
+		t.Fatalf("Should authorize the new key.")
+	}
+
+	if ps.Unpin("host2") {
+		t.Fatalf("Should not unpin an unknown peer.")
+	}
+}
@@ -0,0 +1,415 @@
+package peer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Settings for scoring the behavior of a peer. Every peer starts with the
+// initial score. Failures and invalid data reduce the score and once the
+// score drops to the ban threshold, the peer is banned for a period of time.
+const (
+	initialScore       = 100
+	failurePenalty     = 10
+	invalidTxPenalty   = 10
+	invalidBlkPenalty  = 50
+	maxLatencyPenalty  = 20
+	latencyPenaltyUnit = 100 * time.Millisecond
+	banThreshold       = 0
+	banDuration        = time.Hour
+)
+
+// Settings for backing off from a peer that is failing network calls. The
+// wait time doubles with every consecutive failure up to the max. A peer
+// that reaches the max number of consecutive failures should be dropped.
+const (
+	baseBackoff            = 5 * time.Second
+	maxBackoff             = 10 * time.Minute
+	MaxConsecutiveFailures = 5
+)
+
+// CORE NOTE: Each peer has a circuit breaker. A failed call opens the circuit
+// and calls are refused until the backoff expires. The first call after that
+// is a trial with the circuit half open. Other calls are refused while the
+// trial is running. A successful trial closes the circuit and a failed trial
+// opens it again with a longer backoff.
+
+// Set of states for the circuit breaker of a peer.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// trialTimeout represents how long a trial call is given before another
+// trial is allowed. This covers a trial whose result is never recorded.
+const trialTimeout = time.Minute
+
+// latencyWeight is the weight given to a new latency sample when
+// calculating the moving average.
+const latencyWeight = 0.2
+
+// reachableWindow represents how recently a peer must have answered a call
+// to be counted as reachable.
+const reachableWindow = time.Minute
+
+// =============================================================================
+
+// Score represents the reputation of a peer based on its behavior.
+type Score struct {
+	Host                string        `json:"host"`
+	Score               int           `json:"score"`
+	Latency             time.Duration `json:"latency"`
+	Successes           uint64        `json:"successes"`
+	Failures            uint64        `json:"failures"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	InvalidBlocks       uint64        `json:"invalid_blocks"`
+	InvalidTxs          uint64        `json:"invalid_txs"`
+	LatestBlock         uint64        `json:"latest_block"`
+	LastSeen            time.Time     `json:"last_seen,omitzero"`
+	Circuit             string        `json:"circuit"`
+	NextAttempt         time.Time     `json:"next_attempt,omitzero"`
+	BannedUntil         time.Time     `json:"banned_until,omitzero"`
+
+	// answered is set once the peer answers a call made by this node. The
+	// last seen time of a peer restored from the address book is from a
+	// previous run and doesn't show the peer is reachable now.
+	answered bool
+}
+
+// calculate updates the score value based on the recorded behavior.
+func (s *Score) calculate() {
+	latencyPenalty := int(s.Latency / latencyPenaltyUnit)
+	if latencyPenalty > maxLatencyPenalty {
+		latencyPenalty = maxLatencyPenalty
+	}
+
+	s.Score = initialScore -
+		latencyPenalty -
+		s.ConsecutiveFailures*failurePenalty -
+		int(s.InvalidTxs)*invalidTxPenalty -
+		int(s.InvalidBlocks)*invalidBlkPenalty
+}
+
+// banned identifies if the peer is banned at the specified time.
+func (s *Score) banned(now time.Time) bool {
+	return now.Before(s.BannedUntil)
+}
+
+// =============================================================================
+
+// RecordSuccess records a successful network call to the peer.
+func (ps *PeerSet) RecordSuccess(host string, latency time.Duration) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	s := ps.score(host)
+
+	switch s.Latency {
+	case 0:
+		s.Latency = latency
+	default:
+		s.Latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(s.Latency))
+	}
+
+	s.Successes++
+	s.ConsecutiveFailures = 0
+	s.LastSeen = ps.clock.Now()
+	s.answered = true
+	s.Circuit = CircuitClosed
+	s.NextAttempt = time.Time{}
+	s.calculate()
+}
+
+// RecordFailure records a failed network call to the peer. The peer is put
+// into an exponential backoff. It returns true when the peer has failed too
+// many times in a row and should be removed from the set.
+func (ps *PeerSet) RecordFailure(host string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	s := ps.score(host)
+
+	s.Failures++
+	s.ConsecutiveFailures++
+
+	backoff := baseBackoff << (s.ConsecutiveFailures - 1)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	s.Circuit = CircuitOpen
+	s.NextAttempt = ps.clock.Now().Add(backoff)
+	s.calculate()
+
+	return s.ConsecutiveFailures >= MaxConsecutiveFailures
+}
+
+// RecordInvalidBlock records the peer provided an invalid block. It returns
+// true if the peer has been banned because of this.
+func (ps *PeerSet) RecordInvalidBlock(host string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	s := ps.score(host)
+	s.InvalidBlocks++
+	s.calculate()
+
+	return ps.banIfNeeded(s)
+}
+
+// RecordInvalidTx records the peer provided an invalid transaction. It returns
+// true if the peer has been banned because of this.
+func (ps *PeerSet) RecordInvalidTx(host string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	s := ps.score(host)
+	s.InvalidTxs++
+	s.calculate()
+
+	return ps.banIfNeeded(s)
+}
+
+// Ban bans the peer for the specified duration and removes it from the set.
+func (ps *PeerSet) Ban(host string, duration time.Duration) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	s := ps.score(host)
+	s.BannedUntil = ps.clock.Now().Add(duration)
+
+	delete(ps.set, host)
+}
+
+// Unban lifts a ban on the peer and resets its score.
+func (ps *PeerSet) Unban(host string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.scores, host)
+}
+
+// IsBanned identifies if the peer is currently banned.
+func (ps *PeerSet) IsBanned(host string) bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	s, exists := ps.scores[host]
+	return exists && s.banned(ps.clock.Now())
+}
+
+// CanAttempt identifies if a network call to the peer can be attempted. A
+// peer that is banned or in backoff can't be contacted.
+func (ps *PeerSet) CanAttempt(host string) bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	s, exists := ps.scores[host]
+	if !exists {
+		return true
+	}
+
+	now := ps.clock.Now()
+	return !s.banned(now) && !now.Before(s.NextAttempt)
+}
+
+// Acquire asks the circuit breaker if a network call to the peer can be
+// made. A peer that is banned or has an open circuit is refused. When the
+// backoff expires, the call is let through as the trial for the peer.
+func (ps *PeerSet) Acquire(host string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	s, exists := ps.scores[host]
+	if !exists {
+		return nil
+	}
+
+	now := ps.clock.Now()
+	if s.banned(now) {
+		return fmt.Errorf("%w: peer is banned", ErrCircuitOpen)
+	}
+
+	if s.Circuit == CircuitClosed {
+		return nil
+	}
+
+	if now.Before(s.NextAttempt) {
+		return ErrCircuitOpen
+	}
+
+	s.Circuit = CircuitHalfOpen
+	s.NextAttempt = now.Add(trialTimeout)
+
+	return nil
+}
+
+// RecordHeight records the number of the latest block the peer reported.
+func (ps *PeerSet) RecordHeight(host string, number uint64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.score(host).LatestBlock = number
+}
+
+// CapHeight lowers the latest block number recorded for the peer to the
+// specified number. It is used after syncing from a peer so the peer is only
+// credited with the blocks it provided, and a peer reporting blocks it can't
+// provide doesn't make this node look like it's behind.
+func (ps *PeerSet) CapHeight(host string, number uint64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if s, exists := ps.scores[host]; exists {
+		s.LatestBlock = min(s.LatestBlock, number)
+	}
+}
+
+// BestHeight returns the highest latest block number reported by a peer in
+// the set. Banned peers are not considered.
+func (ps *PeerSet) BestHeight() uint64 {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	now := ps.clock.Now()
+
+	var best uint64
+	for host := range ps.set {
+		if s, exists := ps.scores[host]; exists && !s.banned(now) {
+			best = max(best, s.LatestBlock)
+		}
+	}
+
+	return best
+}
+
+// Reachable returns the number of peers in the set, other than the specified
+// host, that answered a call within the last minute and don't have an open
+// circuit. Peers restored from the address book are not counted until they
+// answer.
+func (ps *PeerSet) Reachable(host string) int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	now := ps.clock.Now()
+	cutoff := now.Add(-reachableWindow)
+
+	var count int
+	for h, peer := range ps.set {
+		if peer.Match(host) {
+			continue
+		}
+
+		s, exists := ps.scores[h]
+		if !exists || !s.answered || s.banned(now) || s.Circuit == CircuitOpen {
+			continue
+		}
+
+		if s.LastSeen.After(cutoff) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// PruneScores removes the scores for the hosts that are no longer in the set
+// so the scores don't grow with every host this node has heard about. The
+// scores for hosts that are banned or in backoff are kept so they can't come
+// back early.
+func (ps *PeerSet) PruneScores() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	now := ps.clock.Now()
+
+	for host, s := range ps.scores {
+		if _, exists := ps.set[host]; exists {
+			continue
+		}
+
+		if s.banned(now) || now.Before(s.NextAttempt) {
+			continue
+		}
+
+		delete(ps.scores, host)
+	}
+}
+
+// Scores returns a copy of the scores for all the peers that have been
+// contacted, ordered from the best to the worst score.
+func (ps *PeerSet) Scores() []Score {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	scores := make([]Score, 0, len(ps.scores))
+	for _, s := range ps.scores {
+		scores = append(scores, *s)
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score == scores[j].Score {
+			return scores[i].Host < scores[j].Host
+		}
+		return scores[i].Score > scores[j].Score
+	})
+
+	return scores
+}
+
+// SortByScore orders the list of peers from the best to the worst score.
+// Peers that have not been scored yet are given the initial score.
+func (ps *PeerSet) SortByScore(peers []Peer) []Peer {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	score := func(host string) int {
+		if s, exists := ps.scores[host]; exists {
+			return s.Score
+		}
+		return initialScore
+	}
+
+	sort.SliceStable(peers, func(i, j int) bool {
+		return score(peers[i].Host) > score(peers[j].Host)
+	})
+
+	return peers
+}
+
+// =============================================================================
+
+// score returns the score for the host, creating it if needed. The caller
+// must hold the write lock.
+func (ps *PeerSet) score(host string) *Score {
+	s, exists := ps.scores[host]
+	if !exists {
+		s = &Score{Host: host, Score: initialScore, Circuit: CircuitClosed}
+		ps.scores[host] = s
+	}
+
+	// A peer whose ban has expired starts over, otherwise the invalid data
+	// that got it banned would ban it again on its next mistake.
+	if !s.BannedUntil.IsZero() && !s.banned(ps.clock.Now()) {
+		s.InvalidBlocks = 0
+		s.InvalidTxs = 0
+		s.BannedUntil = time.Time{}
+		s.calculate()
+	}
+
+	return s
+}
+
+// banIfNeeded bans the peer if the score has dropped to the ban threshold.
+// The caller must hold the write lock.
+func (ps *PeerSet) banIfNeeded(s *Score) bool {
+	if s.Score > banThreshold {
+		return false
+	}
+
+	s.BannedUntil = ps.clock.Now().Add(banDuration)
+	delete(ps.set, s.Host)
+
+	return true
+}
@@ -0,0 +1,228 @@
+package peer_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+func Test_Backoff(t *testing.T) {
+	ps := peer.NewPeerSet()
+	ps.Add(peer.New("host1"))
+
+	if !ps.CanAttempt("host1") {
+		t.Fatalf("Should be able to contact a new peer.")
+	}
+
+	for i := 1; i < peer.MaxConsecutiveFailures; i++ {
+		if ps.RecordFailure("host1") {
+			t.Fatalf("Should not drop the peer after %d failures.", i)
+		}
+	}
+
+	if ps.CanAttempt("host1") {
+		t.Fatalf("Should not be able to contact a peer in backoff.")
+	}
+
+	if !ps.RecordFailure("host1") {
+		t.Fatalf("Should drop the peer after %d failures.", peer.MaxConsecutiveFailures)
+	}
+
+	ps.RecordSuccess("host1", time.Millisecond)
+	if !ps.CanAttempt("host1") {
+		t.Fatalf("Should be able to contact the peer after a success.")
+	}
+}
+
+func Test_Ban(t *testing.T) {
+	ps := peer.NewPeerSet()
+	ps.Add(peer.New("host1"))
+	ps.Add(peer.New("host2"))
+
+	ps.RecordSuccess("host2", time.Millisecond)
+
+	if ps.RecordInvalidBlock("host1") {
+		t.Fatalf("Should not ban the peer after one invalid block.")
+	}
+
+	scores := ps.Scores()
+	if scores[0].Host != "host2" {
+		t.Fatalf("Should order the scores from best to worst, got %s first.", scores[0].Host)
+	}
+
+	peers := ps.SortByScore(ps.Copy(""))
+	if peers[0].Host != "host2" {
+		t.Fatalf("Should order the peers from best to worst, got %s first.", peers[0].Host)
+	}
+
+	if !ps.RecordInvalidBlock("host1") {
+		t.Fatalf("Should ban the peer after two invalid blocks.")
+	}
+
+	if !ps.IsBanned("host1") {
+		t.Fatalf("Should report the peer as banned.")
+	}
+
+	if _, exists := ps.Get("host1"); exists {
+		t.Fatalf("Should remove the banned peer from the set.")
+	}
+
+	if ps.Add(peer.New("host1")) {
+		t.Fatalf("Should not be able to add a banned peer.")
+	}
+
+	ps.Unban("host1")
+	if !ps.Add(peer.New("host1")) {
+		t.Fatalf("Should be able to add the peer after the ban is lifted.")
+	}
+}
+
+func Test_BanExpires(t *testing.T) {
+	clk := clock.NewManual(time.Now())
+
+	ps := peer.NewPeerSet()
+	ps.SetClock(clk)
+	ps.Add(peer.New("host1"))
+
+	ps.RecordInvalidBlock("host1")
+	if !ps.RecordInvalidBlock("host1") {
+		t.Fatalf("Should ban the peer after two invalid blocks.")
+	}
+
+	clk.Advance(2 * time.Hour)
+
+	if !ps.Add(peer.New("host1")) {
+		t.Fatalf("Should be able to add the peer after the ban expires.")
+	}
+
+	if ps.RecordInvalidBlock("host1") {
+		t.Fatalf("Should start over after the ban expires, not ban the peer on its next invalid block.")
+	}
+}
+
+func Test_PruneScores(t *testing.T) {
+	clk := clock.NewManual(time.Now())
+
+	ps := peer.NewPeerSet()
+	ps.SetClock(clk)
+	ps.Add(peer.New("host1"))
+
+	ps.RecordSuccess("host1", time.Millisecond)
+	ps.RecordSuccess("host2", time.Millisecond)
+	ps.RecordFailure("host3")
+	ps.Ban("host4", time.Hour)
+
+	ps.PruneScores()
+
+	var hosts []string
+	for _, s := range ps.Scores() {
+		hosts = append(hosts, s.Host)
+	}
+
+	if fmt.Sprint(hosts) != "[host1 host4 host3]" {
+		t.Fatalf("Should keep the scores for peers in the set, banned or in backoff, got %v.", hosts)
+	}
+
+	clk.Advance(2 * time.Hour)
+	ps.PruneScores()
+
+	if n := len(ps.Scores()); n != 1 {
+		t.Fatalf("Should remove the scores once the ban and backoff expire, got %d.", n)
+	}
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	clk := clock.NewManual(time.Now())
+
+	ps := peer.NewPeerSet()
+	ps.SetClock(clk)
+	ps.Add(peer.New("host1"))
+
+	if err := ps.Acquire("host1"); err != nil {
+		t.Fatalf("Should be able to call a new peer: %s", err)
+	}
+
+	ps.RecordFailure("host1")
+	if err := ps.Acquire("host1"); !errors.Is(err, peer.ErrCircuitOpen) {
+		t.Fatalf("Should refuse calls while the circuit is open, got %v.", err)
+	}
+
+	clk.Advance(time.Minute)
+	if err := ps.Acquire("host1"); err != nil {
+		t.Fatalf("Should allow a trial call after the backoff: %s", err)
+	}
+
+	if err := ps.Acquire("host1"); !errors.Is(err, peer.ErrCircuitOpen) {
+		t.Fatalf("Should refuse other calls while the trial is running, got %v.", err)
+	}
+
+	if circuit := ps.Scores()[0].Circuit; circuit != peer.CircuitHalfOpen {
+		t.Fatalf("Should report the circuit as half open, got %s.", circuit)
+	}
+
+	ps.RecordSuccess("host1", time.Millisecond)
+	if err := ps.Acquire("host1"); err != nil {
+		t.Fatalf("Should close the circuit after a successful trial: %s", err)
+	}
+
+	ps.Ban("host1", time.Hour)
+	if err := ps.Acquire("host1"); !errors.Is(err, peer.ErrCircuitOpen) {
+		t.Fatalf("Should refuse calls to a banned peer, got %v.", err)
+	}
+}
+
+func Test_BestHeight(t *testing.T) {
+	ps := peer.NewPeerSet()
+	ps.Add(peer.New("host1"))
+	ps.Add(peer.New("host2"))
+
+	ps.RecordHeight("host1", 10)
+	ps.RecordHeight("host2", 20)
+	ps.RecordHeight("host3", 30)
+
+	if best := ps.BestHeight(); best != 20 {
+		t.Fatalf("Should return the best height of the peers in the set, got %d.", best)
+	}
+
+	ps.Ban("host2", time.Hour)
+
+	if best := ps.BestHeight(); best != 10 {
+		t.Fatalf("Should not consider banned peers, got %d.", best)
+	}
+
+	ps.CapHeight("host1", 5)
+
+	if best := ps.BestHeight(); best != 5 {
+		t.Fatalf("Should only credit the peer with the blocks it provided, got %d.", best)
+	}
+}
+
+func Test_Reachable(t *testing.T) {
+	clk := clock.NewManual(time.Now())
+
+	ps := peer.NewPeerSet()
+	ps.SetClock(clk)
+	ps.Add(peer.New("host0"))
+	ps.Add(peer.New("host1"))
+	ps.Add(peer.New("host2"))
+	ps.Restore([]peer.Record{{Peer: peer.New("host3"), LastSeen: clk.Now(), Successes: 10}})
+
+	ps.RecordSuccess("host0", time.Millisecond)
+	ps.RecordSuccess("host1", time.Millisecond)
+	ps.RecordSuccess("host2", time.Millisecond)
+	ps.RecordFailure("host2")
+
+	if n := ps.Reachable("host0"); n != 1 {
+		t.Fatalf("Should only count peers that answered and don't have an open circuit, got %d.", n)
+	}
+
+	clk.Advance(2 * time.Minute)
+
+	if n := ps.Reachable("host0"); n != 0 {
+		t.Fatalf("Should not count peers that haven't answered recently, got %d.", n)
+	}
+}
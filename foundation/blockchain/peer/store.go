@@ -0,0 +1,152 @@
+package peer
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+)
+
+// Record represents the information saved for a known peer so the node can
+// reconnect to the network after a restart.
+type Record struct {
+	Peer      Peer      `json:"peer"`
+	LastSeen  time.Time `json:"last_seen"`
+	Successes uint64    `json:"successes"`
+}
+
+// =============================================================================
+
+// Store maintains the address book of known peers on disk.
+type Store struct {
+	mu         sync.Mutex
+	clock      clock.Clock
+	path       string
+	staleAfter time.Duration
+}
+
+// NewStore constructs a store that reads and writes the address book at the
+// specified path. Peers that have not been seen within the stale duration are
+// pruned from the address book.
+func NewStore(path string, staleAfter time.Duration) *Store {
+	return &Store{
+		clock:      clock.New(),
+		path:       path,
+		staleAfter: staleAfter,
+	}
+}
+
+// SetClock replaces the clock used to prune stale peers. It should be the
+// same clock the peer set uses to stamp when peers were last seen.
+func (st *Store) SetClock(clk clock.Clock) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.clock = clk
+}
+
+// Load reads the address book from disk. If the address book doesn't exist
+// yet, an empty list is returned.
+func (st *Store) Load() ([]Record, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	data, err := os.ReadFile(st.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	return st.prune(records), nil
+}
+
+// Save writes the address book to disk. The file is replaced atomically so
+// a crash during the write doesn't corrupt the address book.
+func (st *Store) Save(records []Record) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	data, err := json.MarshalIndent(st.prune(records), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(st.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, st.path)
+}
+
+// prune removes the records that have not been seen recently.
+func (st *Store) prune(records []Record) []Record {
+	cutoff := st.clock.Now().Add(-st.staleAfter)
+
+	fresh := make([]Record, 0, len(records))
+	for _, rec := range records {
+		if rec.LastSeen.After(cutoff) {
+			fresh = append(fresh, rec)
+		}
+	}
+
+	return fresh
+}
+
+// =============================================================================
+
+// Records returns the information to save for the peers in the set that have
+// completed a handshake. The peer matching the specified host is excluded.
+func (ps *PeerSet) Records(host string) []Record {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	var records []Record
+	for _, peer := range ps.set {
+		if peer.Match(host) || !peer.HasHandshake() {
+			continue
+		}
+
+		rec := Record{
+			Peer: peer,
+		}
+		if s, exists := ps.scores[peer.Host]; exists {
+			rec.LastSeen = s.LastSeen
+			rec.Successes = s.Successes
+		}
+
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+// Restore adds the peers from the saved records to the set.
+func (ps *PeerSet) Restore(records []Record) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for _, rec := range records {
+		ps.set[rec.Peer.Host] = rec.Peer
+
+		s := ps.score(rec.Peer.Host)
+		s.LastSeen = rec.LastSeen
+		s.Successes = rec.Successes
+	}
+}
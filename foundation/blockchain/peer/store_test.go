@@ -0,0 +1,119 @@
+package peer_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+func Test_Store(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers", "node.json")
+	store := peer.NewStore(path, time.Hour)
+
+	records, err := store.Load()
+	if err != nil {
+		t.Fatalf("Should be able to load a missing address book: %s", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("Should get an empty address book, got %d records.", len(records))
+	}
+
+	handshake := func(host string) peer.Peer {
+		return peer.Peer{
+			Host:            host,
+			ChainID:         1,
+			GenesisHash:     "0xgenesis",
+			ProtocolVersion: peer.ProtocolVersion,
+			Consensus:       "POW",
+			PublicKey:       "key",
+		}
+	}
+
+	ps := peer.NewPeerSet()
+	ps.Add(handshake("self"))
+	ps.Add(handshake("host1"))
+	ps.Add(handshake("host2"))
+	ps.Add(peer.New("host3"))
+	ps.RecordSuccess("host1", time.Millisecond)
+	ps.RecordSuccess("host1", time.Millisecond)
+	ps.RecordSuccess("host3", time.Millisecond)
+
+	if err := store.Save(ps.Records("self")); err != nil {
+		t.Fatalf("Should be able to save the address book: %s", err)
+	}
+
+	records, err = store.Load()
+	if err != nil {
+		t.Fatalf("Should be able to load the address book: %s", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Should only keep recently seen peers with a handshake, got %d records.", len(records))
+	}
+	if records[0].Peer.Host != "host1" || records[0].Successes != 2 {
+		t.Fatalf("Should get host1 with 2 successes, got %s with %d.", records[0].Peer.Host, records[0].Successes)
+	}
+
+	restored := peer.NewPeerSet()
+	restored.Restore(records)
+
+	pr, exists := restored.Get("host1")
+	if !exists {
+		t.Fatalf("Should restore host1 into the peer set.")
+	}
+	if !pr.HasHandshake() {
+		t.Fatalf("Should restore the handshake for host1.")
+	}
+
+	stale := peer.NewStore(path, 0)
+	records, err = stale.Load()
+	if err != nil {
+		t.Fatalf("Should be able to load the address book: %s", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("Should prune stale peers, got %d records.", len(records))
+	}
+}
+
+func Test_StoreClock(t *testing.T) {
+	clk := clock.NewManual(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ps := peer.NewPeerSet()
+	ps.SetClock(clk)
+	ps.Add(peer.Peer{
+		Host:            "host1",
+		ChainID:         1,
+		GenesisHash:     "0xgenesis",
+		ProtocolVersion: peer.ProtocolVersion,
+		Consensus:       "POW",
+		PublicKey:       "key",
+	})
+	ps.RecordSuccess("host1", time.Millisecond)
+
+	store := peer.NewStore(filepath.Join(t.TempDir(), "node.json"), time.Hour)
+	store.SetClock(clk)
+
+	if err := store.Save(ps.Records("")); err != nil {
+		t.Fatalf("Should be able to save the address book: %s", err)
+	}
+
+	records, err := store.Load()
+	if err != nil {
+		t.Fatalf("Should be able to load the address book: %s", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Should keep a peer seen within the stale age of the clock, got %d records.", len(records))
+	}
+
+	clk.Advance(2 * time.Hour)
+
+	records, err = store.Load()
+	if err != nil {
+		t.Fatalf("Should be able to load the address book: %s", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("Should prune a peer once the clock passes the stale age, got %d records.", len(records))
+	}
+}
@@ -0,0 +1,236 @@
+// Package simnet provides an in-memory network for running many nodes in a
+// single process. Latency, message drops and partitions can be simulated so
+// multi-node behavior can be tested without opening real ports.
+package simnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// Set of error variables for delivering messages.
+var (
+	ErrUnknownHost = errors.New("unknown host")
+	ErrPartitioned = errors.New("host is on the other side of a partition")
+	ErrDropped     = errors.New("message dropped")
+)
+
+// Config represents the behavior of the simulated network.
+type Config struct {
+	Latency  time.Duration
+	Jitter   time.Duration
+	DropRate float64
+	Seed     uint64
+}
+
+// Stats represents the number of messages handled by the network.
+type Stats struct {
+	Delivered int
+	Dropped   int
+}
+
+// =============================================================================
+
+// Network represents a set of nodes that can talk to each other in memory.
+type Network struct {
+	mu       sync.Mutex
+	nodes    map[string]*state.State
+	groups   map[string]int
+	latency  time.Duration
+	jitter   time.Duration
+	dropRate float64
+	rand     *rand.Rand
+	stats    Stats
+}
+
+// New constructs a simulated network. The seed makes the message drops and
+// latency jitter repeatable between runs.
+func New(cfg Config) *Network {
+	return &Network{
+		nodes:    make(map[string]*state.State),
+		groups:   make(map[string]int),
+		latency:  cfg.Latency,
+		jitter:   cfg.Jitter,
+		dropRate: cfg.DropRate,
+		rand:     rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)),
+	}
+}
+
+// Register adds the node to the network under the specified host. Peers
+// reach the node using this host.
+func (n *Network) Register(host string, st *state.State) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.nodes[host] = st
+}
+
+// Unregister removes the node from the network as if it went offline.
+func (n *Network) Unregister(host string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.nodes, host)
+}
+
+// Transport returns the transport used by the node with the specified host
+// to talk to its peers.
+func (n *Network) Transport(host string) state.Transport {
+	return &transport{
+		net:  n,
+		from: host,
+	}
+}
+
+// Partition splits the network into the specified groups of hosts. Nodes
+// can only reach other nodes in the same group. Hosts that are not listed
+// form a group of their own.
+func (n *Network) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, host := range group {
+			n.groups[host] = i + 1
+		}
+	}
+}
+
+// Heal removes all partitions from the network.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.groups = make(map[string]int)
+}
+
+// SetDropRate changes the fraction of messages that are dropped.
+func (n *Network) SetDropRate(rate float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.dropRate = rate
+}
+
+// SetLatency changes the latency and jitter of message delivery.
+func (n *Network) SetLatency(latency time.Duration, jitter time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.latency = latency
+	n.jitter = jitter
+}
+
+// Stats returns the number of messages delivered and dropped.
+func (n *Network) Stats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.stats
+}
+
+// =============================================================================
+
+// handler processes a request on the destination node. The source node is
+// provided so the destination can check who sent the request.
+type handler func(ctx context.Context, dst *state.State, src *state.State, payload []byte) (any, error)
+
+// send delivers a request from one node to another and delivers the response
+// back. Data is encoded as JSON so nodes never share memory, like on a real
+// network. The context is honored while the message is in flight.
+func (n *Network) send(ctx context.Context, from string, to string, dataSend any, dataRecv any, h handler) error {
+	src, dst, delay, err := n.route(from, to)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(dataSend)
+	if err != nil {
+		return err
+	}
+
+	if err := wait(ctx, delay); err != nil {
+		return err
+	}
+
+	resp, err := h(ctx, dst, src, payload)
+	if err != nil {
+		return fmt.Errorf("%w: %w", peer.ErrRejected, err)
+	}
+
+	if err := wait(ctx, delay); err != nil {
+		return err
+	}
+
+	if dataRecv == nil || resp == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, dataRecv)
+}
+
+// route decides if a message can be delivered and how long it takes.
+func (n *Network) route(from string, to string) (*state.State, *state.State, time.Duration, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	src, exists := n.nodes[from]
+	if !exists {
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrUnknownHost, from)
+	}
+
+	dst, exists := n.nodes[to]
+	if !exists {
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrUnknownHost, to)
+	}
+
+	if n.groups[from] != n.groups[to] {
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrPartitioned, to)
+	}
+
+	if n.dropRate > 0 && n.rand.Float64() < n.dropRate {
+		n.stats.Dropped++
+		return nil, nil, 0, fmt.Errorf("%w: %s -> %s", ErrDropped, from, to)
+	}
+
+	delay := n.latency
+	if n.jitter > 0 {
+		delay += time.Duration(n.rand.Int64N(int64(n.jitter)))
+	}
+
+	n.stats.Delivered++
+
+	return src, dst, delay, nil
+}
+
+// wait simulates the time a message spends on the network. It returns the
+// context's error if the context is done first.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
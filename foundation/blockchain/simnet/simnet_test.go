@@ -0,0 +1,667 @@
+package simnet_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/simnet"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/worker"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	kennedyPrivateKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+	pavelPrivateKey   = "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"
+
+	edAccountID = database.AccountID("0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0")
+
+	chainID = 1
+
+	// poaCycle matches the interval the PoA worker selects a node to mine.
+	poaCycle = 12 * time.Second
+)
+
+func Test_Convergence(t *testing.T) {
+	net := simnet.New(simnet.Config{
+		Latency: time.Millisecond,
+		Jitter:  time.Millisecond,
+		Seed:    1,
+	})
+
+	nodes := newNetwork(net, 5, t)
+
+	blk := mine(nodes[0], kennedyPrivateKey, 1, t)
+	if err := nodes[0].state.NetSendBlockToPeers(context.Background(), blk); err != nil {
+		t.Fatalf("Should be able to send the block to peers: %s", err)
+	}
+
+	waitConverged(nodes, 1, t)
+}
+
+func Test_Partition(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	nodes := newNetwork(net, 4, t)
+
+	net.Partition([]string{nodes[0].host, nodes[1].host}, []string{nodes[2].host, nodes[3].host})
+
+	blk := mine(nodes[0], kennedyPrivateKey, 1, t)
+	nodes[0].state.NetSendBlockToPeers(context.Background(), blk)
+	waitConverged(nodes[:2], 1, t)
+
+	for _, nd := range nodes[2:] {
+		if num := nd.state.LatestBlock().Header.Number; num != 0 {
+			t.Fatalf("Should not receive blocks across the partition, got block %d on %s.", num, nd.host)
+		}
+	}
+
+	if _, err := nodes[2].state.NetRequestPeerStatus(context.Background(), peer.New(nodes[0].host)); !errors.Is(err, simnet.ErrPartitioned) {
+		t.Fatalf("Should not be able to reach a node across the partition, got %v.", err)
+	}
+
+	net.Heal()
+
+	for _, nd := range nodes[2:] {
+		nd.state.Worker.Sync()
+	}
+
+	waitConverged(nodes, 1, t)
+}
+
+func Test_Drops(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	nodes := newNetwork(net, 2, t)
+
+	net.SetDropRate(1)
+
+	if _, err := nodes[1].state.NetRequestPeerStatus(context.Background(), peer.New(nodes[0].host)); !errors.Is(err, simnet.ErrDropped) {
+		t.Fatalf("Should drop every message, got %v.", err)
+	}
+
+	if net.Stats().Dropped < 2 {
+		t.Fatalf("Should retry a dropped message, got %d attempts.", net.Stats().Dropped)
+	}
+
+	if _, err := nodes[1].state.NetRequestPeerStatus(context.Background(), peer.New(nodes[0].host)); !errors.Is(err, peer.ErrCircuitOpen) {
+		t.Fatalf("Should open the circuit for a peer that can't be reached, got %v.", err)
+	}
+
+	net.SetDropRate(0)
+
+	blk := mine(nodes[0], kennedyPrivateKey, 1, t)
+	if err := nodes[0].state.NetSendBlockToPeers(context.Background(), blk); err != nil {
+		t.Fatalf("Should be able to send the block once messages are delivered: %s", err)
+	}
+
+	waitConverged(nodes, 1, t)
+}
+
+func Test_Timeout(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	nodes := newNetwork(net, 2, t)
+
+	net.SetLatency(time.Hour, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := nodes[0].state.NetRequestPeerStatus(ctx, peer.New(nodes[1].host)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Should give up when the context is done, got %v.", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatalf("Should not wait on a stalled peer past the deadline.")
+	}
+
+	net.SetLatency(0, 0)
+
+	// Giving up on a call says nothing about the peer.
+	if _, err := nodes[0].state.NetRequestPeerStatus(context.Background(), peer.New(nodes[1].host)); err != nil {
+		t.Fatalf("Should be able to call the peer after a cancelled call: %s", err)
+	}
+}
+
+func Test_Reorganize(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	nodes := newNetwork(net, 2, t)
+
+	net.Partition([]string{nodes[0].host}, []string{nodes[1].host})
+
+	// Each side of the partition builds its own chain. The first node's
+	// chain is far enough ahead that the second node has to reorganize.
+	var blk database.Block
+	for nonce := uint64(1); nonce <= 4; nonce++ {
+		blk = mine(nodes[0], kennedyPrivateKey, nonce, t)
+	}
+	mine(nodes[1], pavelPrivateKey, 1, t)
+
+	net.Heal()
+
+	if err := nodes[0].state.NetSendBlockToPeers(context.Background(), blk); err == nil {
+		t.Fatalf("Should have the forked node reject the block.")
+	}
+
+	waitConverged(nodes, 4, t)
+}
+
+func Test_SyncPaging(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	nodes := newNetwork(net, 2, t)
+
+	net.Partition([]string{nodes[0].host}, []string{nodes[1].host})
+
+	// Build a chain longer than a peer returns in a single request.
+	number := uint64(peer.MaxBlocksPerRequest + 5)
+	for nonce := uint64(1); nonce <= number; nonce++ {
+		mine(nodes[0], kennedyPrivateKey, nonce, t)
+	}
+
+	net.Heal()
+
+	pr, _ := nodes[1].state.KnownPeer(nodes[0].host)
+	if err := nodes[1].state.NetRequestPeerBlocks(context.Background(), pr); err != nil {
+		t.Fatalf("Should be able to sync from the peer: %s", err)
+	}
+
+	if latest := nodes[1].state.LatestBlock().Header.Number; latest != number {
+		t.Fatalf("Should sync every block across requests, got %d, exp %d.", latest, number)
+	}
+}
+
+func Test_TxAnnounce(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	nodes := newNetwork(net, 2, t)
+
+	privateKey, err := crypto.HexToECDSA(kennedyPrivateKey)
+	if err != nil {
+		t.Fatalf("Error constructing private key: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  database.PublicKeyToAccountID(privateKey.PublicKey),
+		ToID:    edAccountID,
+		Value:   1,
+	}
+	signedTx, err := tx.Sign(privateKey)
+	if err != nil {
+		t.Fatalf("Error signing transaction: %v", err)
+	}
+	if err := nodes[0].state.UpsertWalletTransaction(context.Background(), signedTx); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	var hashes []string
+	for _, tx := range nodes[0].state.Mempool() {
+		hashes = append(hashes, tx.HashHex())
+	}
+
+	// A node that never completed a handshake can't have the transactions
+	// requested from anybody.
+	stranger := newState(nodes[0].state.Genesis(), "stranger", net.Transport("stranger"), state.ConsensusPOW, nil, t)
+	net.Register("stranger", stranger)
+	t.Cleanup(func() { stranger.Shutdown() })
+	stranger.AddKnownPeer(peer.New(nodes[1].host))
+
+	if err := stranger.NetSendTxAnnounceToPeers(context.Background(), hashes); !errors.Is(err, identity.ErrUnknownIdentity) {
+		t.Fatalf("Should reject an announcement from an unknown identity, got %v.", err)
+	}
+
+	// The transactions are requested from the node that announced them.
+	if err := nodes[0].state.NetSendTxAnnounceToPeers(context.Background(), hashes); err != nil {
+		t.Fatalf("Should be able to announce the transactions: %s", err)
+	}
+
+	if n := nodes[1].state.MempoolLength(); n != 1 {
+		t.Fatalf("Should request the transaction from the announcing node, got %d in the mempool.", n)
+	}
+}
+
+func Test_HostTakeover(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	nodes := newNetwork(net, 2, t)
+
+	// The impostor has its own identity key but claims the host of the
+	// second node in its handshake.
+	impostor := newState(nodes[0].state.Genesis(), nodes[1].host, net.Transport("impostor"), state.ConsensusPOW, nil, t)
+	net.Register("impostor", impostor)
+	t.Cleanup(func() { impostor.Shutdown() })
+
+	if _, err := impostor.NetHandshake(context.Background(), peer.New(nodes[0].host)); !errors.Is(err, peer.ErrKeyMismatch) {
+		t.Fatalf("Should reject a handshake that claims a bound host, got %v.", err)
+	}
+
+	if nodes[0].state.IsPeerKey(impostor.Handshake().PublicKey) {
+		t.Fatalf("Should not authorize the impostor's identity.")
+	}
+
+	pr, _ := nodes[0].state.KnownPeer(nodes[1].host)
+	if pr.PublicKey != nodes[1].state.Handshake().PublicKey {
+		t.Fatalf("Should keep the host bound to the second node's identity.")
+	}
+
+	if _, err := nodes[1].state.NetRequestPeerStatus(context.Background(), peer.New(nodes[0].host)); err != nil {
+		t.Fatalf("Should still accept requests from the bound identity: %s", err)
+	}
+}
+
+func Test_PoARotation(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	clk := clock.NewManual(time.Now().Truncate(time.Minute))
+	nodes := newPoANetwork(net, 3, clk, t)
+
+	beneficiaries := make(map[database.AccountID]string)
+	for _, nd := range nodes {
+		beneficiaries[nd.state.Beneficiary()] = nd.host
+	}
+
+	// Every cycle, the node selected from the latest block mines the
+	// transaction in the mempool. Keep going until more than one node has
+	// been the leader.
+	leaders := make(map[string]bool)
+	for number := uint64(1); len(leaders) < 2; number++ {
+		if number > 20 {
+			t.Fatalf("Should rotate the leader between the nodes, got %v.", leaders)
+		}
+
+		leader := selected(nodes[0])
+
+		submitTx(nodes, kennedyPrivateKey, number, t)
+		advanceConverged(clk, nodes, number, t)
+
+		miner := beneficiaries[nodes[0].state.LatestBlock().Header.BeneficiaryID]
+		if miner != leader {
+			t.Fatalf("Should have block %d mined by the selected node %s, got %s.", number, leader, miner)
+		}
+
+		leaders[miner] = true
+	}
+}
+
+func Test_PoAReorganize(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	clk := clock.NewManual(time.Now().Truncate(time.Minute))
+	nodes := newPoANetwork(net, 3, clk, t)
+
+	majority, isolated := nodes[:2], nodes[2]
+
+	// The isolated node drops off the network. Each side removes the nodes
+	// it can't reach, the way the worker does after too many failures, so
+	// each side selects leaders among the nodes it can reach.
+	net.Partition([]string{nodes[0].host, nodes[1].host}, []string{isolated.host})
+	for _, nd := range majority {
+		nd.state.RemoveKnownPeer(peer.New(isolated.host))
+		isolated.state.RemoveKnownPeer(peer.New(nd.host))
+	}
+
+	// The isolated node mines a block on its own and the majority builds a
+	// chain far enough ahead that the isolated node has to reorganize.
+	submitTx([]node{isolated}, pavelPrivateKey, 1, t)
+
+	const number = 4
+	for nonce := uint64(1); nonce <= number; nonce++ {
+		submitTx(majority, kennedyPrivateKey, nonce, t)
+		advanceConverged(clk, majority, nonce, t)
+	}
+
+	waitConverged([]node{isolated}, 1, t)
+	if isolated.state.LatestBlock().Hash() == nodes[0].state.LatestBlock().Hash() {
+		t.Fatalf("Should have the isolated node on a fork.")
+	}
+
+	// Once the network heals, the isolated node learns about the longer
+	// chain and replaces its fork.
+	net.Heal()
+
+	if _, err := nodes[0].state.NetHandshake(context.Background(), peer.New(isolated.host)); err != nil {
+		t.Fatalf("Should be able to handshake with the isolated node: %s", err)
+	}
+
+	if err := nodes[0].state.NetSendBlockToPeers(context.Background(), nodes[0].state.LatestBlock()); err == nil {
+		t.Fatalf("Should have the forked node reject the block.")
+	}
+
+	waitConverged(nodes, number, t)
+}
+
+func Test_SyncUnreachable(t *testing.T) {
+	net := simnet.New(simnet.Config{Seed: 1})
+	clk := clock.NewManual(time.Now().Truncate(time.Minute))
+	nodes := newPoANetwork(net, 2, clk, t)
+
+	// A peer that can't be reached during a sync is left to its backoff
+	// instead of being dropped from the address book.
+	net.Partition([]string{nodes[0].host}, []string{nodes[1].host})
+	nodes[0].state.Worker.Sync()
+
+	if _, exists := nodes[0].state.KnownPeer(nodes[1].host); !exists {
+		t.Fatalf("Should keep a peer that couldn't be reached.")
+	}
+}
+
+// =============================================================================
+
+type node struct {
+	host  string
+	state *state.State
+}
+
+// newNetwork constructs the specified number of nodes on the network and
+// has every node handshake with every other node.
+func newNetwork(net *simnet.Network, n int, t *testing.T) []node {
+	nodes := newNodes(net, n, state.ConsensusPOW, nil, t)
+
+	// Let any relays still moving between nodes finish before the nodes
+	// are shut down.
+	t.Cleanup(func() {
+		for _, nd := range nodes {
+			nd.state.Worker.Shutdown()
+		}
+		for _, nd := range nodes {
+			nd.state.Shutdown()
+		}
+	})
+
+	return nodes
+}
+
+// newPoANetwork constructs the specified number of PoA nodes on the network
+// that share the manual clock. Each node runs the real worker, so a node
+// only mines when it's selected and the clock is advanced a cycle.
+func newPoANetwork(net *simnet.Network, n int, clk *clock.Manual, t *testing.T) []node {
+	nodes := newNodes(net, n, state.ConsensusPOA, clk, t)
+
+	for _, nd := range nodes {
+		worker.Run(nd.state, func(v string, args ...any) {})
+	}
+
+	// Shutting down the state shuts down its worker.
+	t.Cleanup(func() {
+		for _, nd := range nodes {
+			nd.state.Shutdown()
+		}
+	})
+
+	return nodes
+}
+
+// newNodes constructs the nodes and has every node handshake with every
+// other node.
+func newNodes(net *simnet.Network, n int, consensus string, clk clock.Clock, t *testing.T) []node {
+	gen := newGenesis()
+
+	nodes := make([]node, n)
+	for i := range nodes {
+		host := fmt.Sprintf("node%d", i)
+		nodes[i] = node{
+			host:  host,
+			state: newState(gen, host, net.Transport(host), consensus, clk, t),
+		}
+		net.Register(host, nodes[i].state)
+	}
+
+	for _, nd := range nodes {
+		for _, other := range nodes {
+			if nd.host == other.host {
+				continue
+			}
+			if _, err := nd.state.NetHandshake(context.Background(), peer.New(other.host)); err != nil {
+				t.Fatalf("Error performing handshake: %s", err)
+			}
+		}
+	}
+
+	return nodes
+}
+
+// mine adds a transaction to the node's mempool and mines a block.
+func mine(nd node, hexKey string, nonce uint64, t *testing.T) database.Block {
+	privateKey, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		t.Fatalf("Error constructing private key: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   nonce,
+		FromID:  database.PublicKeyToAccountID(privateKey.PublicKey),
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	signedTx, err := tx.Sign(privateKey)
+	if err != nil {
+		t.Fatalf("Error signing transaction: %v", err)
+	}
+
+	if err := nd.state.UpsertWalletTransaction(context.Background(), signedTx); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	blk, err := nd.state.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	return blk
+}
+
+// waitConverged waits for all the nodes to agree on the same latest block.
+func waitConverged(nodes []node, number uint64, t *testing.T) {
+	if !converged(nodes, number, 5*time.Second) {
+		logLatest(nodes, t)
+		t.Fatalf("Should converge on block %d.", number)
+	}
+}
+
+// advanceConverged advances the clock a PoA cycle at a time until all the
+// nodes agree on the same latest block. The workers create their tickers
+// after they start, so the first block can take more than one cycle.
+func advanceConverged(clk *clock.Manual, nodes []node, number uint64, t *testing.T) {
+	for range 50 {
+		clk.Advance(poaCycle)
+		if converged(nodes, number, 200*time.Millisecond) {
+			return
+		}
+	}
+
+	logLatest(nodes, t)
+	t.Fatalf("Should converge on block %d as the clock advances.", number)
+}
+
+// converged reports whether all the nodes agree on the same latest block
+// before the timeout.
+func converged(nodes []node, number uint64, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		same := true
+		hash := nodes[0].state.LatestBlock().Hash()
+		for _, nd := range nodes {
+			latest := nd.state.LatestBlock()
+			if latest.Header.Number != number || latest.Hash() != hash {
+				same = false
+				break
+			}
+		}
+
+		if same {
+			return true
+		}
+
+		if time.Now().After(deadline) {
+			return false
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// logLatest logs the latest block of every node.
+func logLatest(nodes []node, t *testing.T) {
+	for _, nd := range nodes {
+		latest := nd.state.LatestBlock()
+		t.Logf("%s: blk[%d]: %s", nd.host, latest.Header.Number, latest.Hash())
+	}
+}
+
+// selected returns the host of the node the PoA worker selects to mine the
+// next block. It follows the selection of the worker: the known hosts are
+// sorted and indexed by a hash of the latest block.
+func selected(nd node) string {
+	var hosts []string
+	for _, pr := range nd.state.KnownPeers() {
+		hosts = append(hosts, pr.Host)
+	}
+	sort.Strings(hosts)
+
+	h := fnv.New32a()
+	h.Write([]byte(nd.state.LatestBlock().Hash()))
+
+	return hosts[h.Sum32()%uint32(len(hosts))]
+}
+
+// submitTx adds the same signed transaction to the mempool of every node.
+func submitTx(nodes []node, hexKey string, nonce uint64, t *testing.T) {
+	privateKey, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		t.Fatalf("Error constructing private key: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   nonce,
+		FromID:  database.PublicKeyToAccountID(privateKey.PublicKey),
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	signedTx, err := tx.Sign(privateKey)
+	if err != nil {
+		t.Fatalf("Error signing transaction: %v", err)
+	}
+
+	for _, nd := range nodes {
+		if err := nd.state.UpsertWalletTransaction(context.Background(), signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+	}
+}
+
+// newGenesis will create a new Genesis.
+func newGenesis() genesis.Genesis {
+	return genesis.Genesis{
+		Date:          time.Now().Add(time.Hour * 24 * -365),
+		ChainID:       chainID,
+		TransPerBlock: 10,
+		Difficulty:    1,
+		MiningReward:  700,
+		GasPrice:      15,
+		Balances: map[string]uint64{
+			"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32": 1000000,
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000000,
+		},
+	}
+}
+
+// newState constructs a node that talks to its peers over the simulated
+// network.
+func newState(gen genesis.Genesis, host string, transport state.Transport, consensus string, clk clock.Clock, t *testing.T) *state.State {
+	identityKey, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("Error generating identity key: %v", err)
+	}
+
+	minerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Error generating miner key: %v", err)
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Error setting up memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID:  database.PublicKeyToAccountID(minerKey.PublicKey),
+		Host:           host,
+		Genesis:        gen,
+		Storage:        storage,
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewPeerSet(),
+		Consensus:      consensus,
+		IdentityKey:    identityKey,
+		Transport:      transport,
+		Clock:          clk,
+		EvHandler:      func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Error constructing node state: %v", err)
+	}
+
+	// Like a running node, the node is in its own peer list so it takes
+	// part in the PoA selection.
+	st.AddKnownPeer(peer.New(host))
+
+	st.Worker = &syncWorker{state: st}
+	return st
+}
+
+// =============================================================================
+
+// syncWorker implements the parts of the Worker interface needed to move
+// blocks around the network. Blocks are relayed in the background like the
+// real worker does.
+type syncWorker struct {
+	state *state.State
+	wg    sync.WaitGroup
+}
+
+func (w *syncWorker) Shutdown() {
+	w.wg.Wait()
+}
+
+func (w *syncWorker) Sync() {
+	for _, pr := range w.state.SyncPeers() {
+		if _, err := w.state.NetHandshake(context.Background(), pr); err != nil {
+			continue
+		}
+
+		ps, err := w.state.NetRequestPeerStatus(context.Background(), pr)
+		if err != nil {
+			continue
+		}
+
+		if ps.LatestBlockNumber > w.state.LatestBlock().Header.Number {
+			w.state.NetRequestPeerBlocks(context.Background(), pr)
+		}
+	}
+}
+
+func (w *syncWorker) SignalStartMining() {}
+
+func (w *syncWorker) SignalCancelMining() {}
+
+func (w *syncWorker) SignalShareTx(blockTx database.BlockTx) {}
+
+func (w *syncWorker) SignalShareBlock(block database.Block) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.state.NetSendBlockToPeers(context.Background(), block)
+	}()
+}
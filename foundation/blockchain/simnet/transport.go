@@ -0,0 +1,202 @@
+package simnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// transport implements the state.Transport interface for a node on the
+// simulated network.
+type transport struct {
+	net  *Network
+	from string
+}
+
+// Handshake exchanges handshake information with the peer.
+func (t *transport) Handshake(ctx context.Context, pr peer.Peer, hs peer.Peer) (peer.Peer, error) {
+	var resp peer.Peer
+	err := t.net.send(ctx, t.from, pr.Host, hs, &resp, handshake)
+	return resp, err
+}
+
+// Ping checks the peer is responding.
+func (t *transport) Ping(ctx context.Context, pr peer.Peer) error {
+	return t.net.send(ctx, t.from, pr.Host, nil, nil, known(func(ctx context.Context, dst *state.State, payload []byte) (any, error) {
+		return nil, nil
+	}))
+}
+
+// Status requests the current status of the peer.
+func (t *transport) Status(ctx context.Context, pr peer.Peer) (peer.PeerStatus, error) {
+	var resp peer.PeerStatus
+	err := t.net.send(ctx, t.from, pr.Host, nil, &resp, known(status))
+	return resp, err
+}
+
+// Mempool requests the transactions in the peer's mempool.
+func (t *transport) Mempool(ctx context.Context, pr peer.Peer) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := t.net.send(ctx, t.from, pr.Host, nil, &resp, known(func(ctx context.Context, dst *state.State, payload []byte) (any, error) {
+		return dst.Mempool(), nil
+	}))
+	return resp, err
+}
+
+// AnnounceTxs announces a batch of new transaction hashes to the peer.
+func (t *transport) AnnounceTxs(ctx context.Context, pr peer.Peer, ann peer.TxAnnounce) error {
+	return t.net.send(ctx, t.from, pr.Host, ann, nil, txAnnounce)
+}
+
+// RequestTxs requests the transactions that match the specified hashes.
+func (t *transport) RequestTxs(ctx context.Context, pr peer.Peer, req peer.TxRequest) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := t.net.send(ctx, t.from, pr.Host, req, &resp, known(txRequest))
+	return resp, err
+}
+
+// AnnounceBlock sends a new block to the peer in compact form.
+func (t *transport) AnnounceBlock(ctx context.Context, pr peer.Peer, cb peer.CompactBlock) error {
+	return t.net.send(ctx, t.from, pr.Host, cb, nil, blockAnnounce)
+}
+
+// RequestBlocks requests the blocks starting at the specified number.
+func (t *transport) RequestBlocks(ctx context.Context, pr peer.Peer, req peer.BlocksRequest) ([]database.BlockData, error) {
+	var resp []database.BlockData
+	err := t.net.send(ctx, t.from, pr.Host, req, &resp, known(blocks))
+	return resp, err
+}
+
+// RequestBlockTxs requests the transactions at the specified positions in a
+// block.
+func (t *transport) RequestBlockTxs(ctx context.Context, pr peer.Peer, req peer.BlockTxRequest) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := t.net.send(ctx, t.from, pr.Host, req, &resp, known(blockTxs))
+	return resp, err
+}
+
+// =============================================================================
+
+// These handlers mirror what the node does for the same messages over the
+// real network protocols.
+
+// known only passes the request to the handler if the sender's identity is
+// already known by the destination node.
+func known(h func(ctx context.Context, dst *state.State, payload []byte) (any, error)) handler {
+	return func(ctx context.Context, dst *state.State, src *state.State, payload []byte) (any, error) {
+		if !dst.IsPeerKey(src.Handshake().PublicKey) {
+			return nil, identity.ErrUnknownIdentity
+		}
+
+		return h(ctx, dst, payload)
+	}
+}
+
+// handshake adds the sender to the destination's known peer list.
+func handshake(ctx context.Context, dst *state.State, src *state.State, payload []byte) (any, error) {
+	var pr peer.Peer
+	if err := json.Unmarshal(payload, &pr); err != nil {
+		return nil, err
+	}
+
+	if pr.PublicKey != src.Handshake().PublicKey {
+		return nil, errors.New("handshake public key doesn't match the sender identity")
+	}
+
+	if err := dst.AcceptPeerHandshake(pr); err != nil {
+		return nil, err
+	}
+
+	return dst.Handshake(), nil
+}
+
+// status returns the current status of the destination node.
+func status(ctx context.Context, dst *state.State, payload []byte) (any, error) {
+	latestBlock := dst.LatestBlock()
+
+	ps := peer.PeerStatus{
+		LatestBlockHash:   latestBlock.Hash(),
+		LatestBlockNumber: latestBlock.Header.Number,
+		KnownPeers:        dst.KnownExternalPeers(),
+		Scores:            dst.PeerScores(),
+	}
+
+	return ps, nil
+}
+
+// txAnnounce has the destination request the transactions it's missing from
+// the sender. The destination identifies the sender by its identity key.
+func txAnnounce(ctx context.Context, dst *state.State, src *state.State, payload []byte) (any, error) {
+	var ann peer.TxAnnounce
+	if err := json.Unmarshal(payload, &ann); err != nil {
+		return nil, err
+	}
+
+	return nil, dst.ProcessTxAnnounce(ctx, src.Handshake().PublicKey, ann)
+}
+
+// txRequest returns the requested transactions from the mempool.
+func txRequest(ctx context.Context, dst *state.State, payload []byte) (any, error) {
+	var req peer.TxRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+
+	return dst.MempoolByHashes(req.Hashes), nil
+}
+
+// blockAnnounce has the destination rebuild and validate a compact block,
+// requesting any missing transactions from the sender. The destination
+// identifies the sender by its identity key.
+func blockAnnounce(ctx context.Context, dst *state.State, src *state.State, payload []byte) (any, error) {
+	var cb peer.CompactBlock
+	if err := json.Unmarshal(payload, &cb); err != nil {
+		return nil, err
+	}
+
+	if err := dst.ProcessCompactBlock(ctx, src.Handshake().PublicKey, cb); err != nil {
+		switch {
+		case errors.Is(err, state.ErrBlockSeen):
+			return nil, nil
+
+		case errors.Is(err, database.ErrChainForked):
+			dst.Reorganize()
+		}
+
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// blocks returns the blocks starting at the requested block number.
+func blocks(ctx context.Context, dst *state.State, payload []byte) (any, error) {
+	var req peer.BlocksRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+
+	blocks := dst.QueryBlocksForPeer(req.From)
+
+	blockData := make([]database.BlockData, len(blocks))
+	for i, block := range blocks {
+		blockData[i] = database.NewBlockData(block)
+	}
+
+	return blockData, nil
+}
+
+// blockTxs returns the transactions at the requested positions in a block.
+func blockTxs(ctx context.Context, dst *state.State, payload []byte) (any, error) {
+	var req peer.BlockTxRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+
+	return dst.QueryBlockTxs(req.Number, req.Hash, req.Indexes)
+}
@@ -0,0 +1,123 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// PauseMining stops this node from mining blocks until mining is resumed.
+// A block being mined when mining is paused is cancelled. Pausing mining is
+// independent of a reorganization, so a resync completing doesn't resume
+// mining paused by an operator.
+func (s *State) PauseMining(paused bool) {
+	s.mu.Lock()
+	s.miningPaused = paused
+	s.mu.Unlock()
+
+	s.evHandler("state: PauseMining: paused[%v]", paused)
+
+	if s.Worker == nil {
+		return
+	}
+
+	if paused {
+		s.Worker.SignalCancelMining()
+		return
+	}
+
+	s.Worker.SignalStartMining()
+}
+
+// IsMiningPaused identifies if an operator paused mining.
+func (s *State) IsMiningPaused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.miningPaused
+}
+
+// SetBeneficiary changes the account that receives the rewards for the
+// blocks mined from now on.
+func (s *State) SetBeneficiary(beneficiaryID database.AccountID) error {
+	if !beneficiaryID.IsAccountID() {
+		return fmt.Errorf("invalid beneficiary account %q", beneficiaryID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evHandler("state: SetBeneficiary: from[%s] to[%s]", s.beneficiaryID, beneficiaryID)
+
+	s.beneficiaryID = beneficiaryID
+
+	return nil
+}
+
+// EvictTx removes the transaction with the specified hash from the mempool.
+func (s *State) EvictTx(hash string) (database.BlockTx, error) {
+	trans := s.mempool.LookupHashes([]string{hash})
+	if len(trans) == 0 {
+		return database.BlockTx{}, ErrNotFound
+	}
+
+	tx := trans[0]
+	if err := s.mempool.Delete(tx); err != nil {
+		return database.BlockTx{}, err
+	}
+
+	s.evHandler("state: EvictTx: tx[%s]", hash)
+	s.publish(TxEvicted{Tx: tx, Reason: EvictAdmin})
+
+	return tx, nil
+}
+
+// FlushMempool removes every transaction from the mempool and returns the
+// number of transactions removed.
+func (s *State) FlushMempool() int {
+	trans := s.mempool.PickBest()
+	for _, tx := range trans {
+		s.mempool.Delete(tx)
+		s.publish(TxEvicted{Tx: tx, Reason: EvictAdmin})
+	}
+
+	s.evHandler("state: FlushMempool: removed[%d]", len(trans))
+
+	return len(trans)
+}
+
+// BanPeer bans the peer for the specified duration. The peer is removed
+// from the known peer list and handshakes from it are rejected until the
+// ban expires.
+func (s *State) BanPeer(host string, duration time.Duration) {
+	s.knownPeers.Ban(host, duration)
+
+	s.evHandler("state: BanPeer: peer[%s]: duration[%s]", host, duration)
+	s.publish(PeerBanned{Host: host, Reason: "banned by operator"})
+}
+
+// UnbanPeer lifts the ban on the peer and resets its score.
+func (s *State) UnbanPeer(host string) {
+	s.knownPeers.Unban(host)
+
+	s.evHandler("state: UnbanPeer: peer[%s]", host)
+}
+
+// UnpinPeer clears the identity public key the peer is bound to so the next
+// handshake from the host can bind a new key. It returns false if the peer
+// isn't known.
+func (s *State) UnpinPeer(host string) bool {
+	if !s.knownPeers.Unpin(host) {
+		return false
+	}
+
+	s.evHandler("state: UnpinPeer: peer[%s]", host)
+
+	return true
+}
+
+// IsPeerBanned identifies if the peer is currently banned.
+func (s *State) IsPeerBanned(host string) bool {
+	return s.knownPeers.IsBanned(host)
+}
@@ -2,23 +2,33 @@ package state
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/trace"
 )
 
+// compactPrefillWindow represents how recent a transaction needs to be for
+// it to be sent in full inside a compact block. Transactions younger than
+// this have likely not propagated through the network yet.
+const compactPrefillWindow = 2 * time.Second
+
 // ErrNoTransactions is returned when a block is requested to be created
 // and there are not enough transactions.
 var ErrNoTransactions = errors.New("no transactions in mempool")
 
+// ErrBlockSeen is returned when a proposed block has already been accepted.
+var ErrBlockSeen = errors.New("block already seen")
+
 // =============================================================================
 
 // MineNewBlock attempts to create a new block with a proper hash that can become
 // the next block in the chain.
-func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
-	defer s.evHandler("viewer: MineNewBlock: MINING: completed")
+func (s *State) MineNewBlock(ctx context.Context) (_ database.Block, err error) {
+	defer s.evHandler("state: MineNewBlock: MINING: completed")
 
 	s.evHandler("state: MineNewBlock: MINING: check mempool count")
 
@@ -27,6 +37,12 @@ func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
 		return database.Block{}, ErrNoTransactions
 	}
 
+	ctx, span := s.tracer.Start(ctx, "state.MineNewBlock")
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	// Pick the best transactions from the mempool.
 	trans := s.mempool.PickBest(s.genesis.TransPerBlock)
 
@@ -37,43 +53,217 @@ func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
 		difficulty = 1
 	}
 
-	// Attempt to create a new block by solving the POW puzzle. This can be cancelled.
-	block, err := database.POW(ctx, database.POWArgs{
-		BeneficiaryID: s.beneficiaryID,
+	prevBlock := s.db.LatestBlock()
+	number := prevBlock.Header.Number + 1
+	start := s.clock.Now()
+
+	// Link the block to the traces of the transactions being mined.
+	span.SetAttributes(trace.Attr("block.number", number), trace.Attr("block.txs", len(trans)))
+	for _, tx := range trans {
+		if sc, exists := s.txTraces.get(tx.HashHex()); exists {
+			span.AddLink(sc)
+		}
+	}
+
+	s.publishContext(ctx, MiningStarted{Number: number, Txs: len(trans)})
+
+	block, attempts, err := s.mineBlock(ctx, database.POWArgs{
+		BeneficiaryID: s.Beneficiary(),
 		Difficulty:    difficulty,
 		MiningReward:  s.genesis.MiningReward,
-		PrevBlock:     s.db.LatestBlock(),
+		PrevBlock:     prevBlock,
 		StateRoot:     s.db.HashState(),
 		Trans:         trans,
+		Clock:         s.clock,
+		Rand:          s.random,
 		EvHandler:     s.evHandler,
 	})
+	span.SetAttributes(trace.Attr("mining.attempts", attempts))
 	if err != nil {
+		s.publishContext(ctx, MiningCancelled{Number: number, Reason: err.Error()})
 		return database.Block{}, err
 	}
 
+	span.SetAttributes(trace.Attr("block.hash", block.Hash()))
+	s.publishContext(ctx, MiningCompleted{Number: number, Hash: block.Hash(), Duration: s.clock.Now().Sub(start), Attempts: attempts})
+
+	return block, nil
+}
+
+// mineBlock solves the POW puzzle for a new block and adds the block to the
+// local blockchain. It returns the number of hashes calculated.
+func (s *State) mineBlock(ctx context.Context, args database.POWArgs) (database.Block, uint64, error) {
+
+	// Attempt to create a new block by solving the POW puzzle. This can be cancelled.
+	block, attempts, err := database.POW(ctx, args)
+	if err != nil {
+		return database.Block{}, attempts, err
+	}
+
 	// Just check one more time we were not cancelled.
 	if ctx.Err() != nil {
-		return database.Block{}, ctx.Err()
+		return database.Block{}, attempts, ctx.Err()
 	}
 
 	s.evHandler("state: MineNewBlock: MINING: validate and update database")
 
 	// Validate the block and then update the blockchain database.
-	if err := s.validateUpdateDatabase(block); err != nil {
-		return database.Block{}, err
+	if err := s.validateUpdateDatabase(ctx, block); err != nil {
+		return database.Block{}, attempts, err
 	}
 
-	return block, nil
+	return block, attempts, nil
 }
 
 // ProcessProposedBlock takes a block received from a peer, validates it and
-// if that passes, adds the block to the local blockchain.
-func (s *State) ProcessProposedBlock(block database.Block) error {
-	s.evHandler("state: ValidateProposedBlock: started: prevBlk[%s]: newBlk[%s]: numTrans[%d]", block.Header.PrevBlockHash, block.Hash(), len(block.MerkleTree.Values()))
-	defer s.evHandler("state: ValidateProposedBlock: completed: newBlk[%s]", block.Hash())
+// if that passes, adds the block to the local blockchain. The accepted block
+// is relayed to a subset of the known peers.
+func (s *State) ProcessProposedBlock(ctx context.Context, block database.Block) error {
+	if err := s.processProposedBlock(ctx, block); err != nil {
+		return err
+	}
+
+	// Relay the block so it propagates through the network.
+	s.Worker.SignalShareBlock(block)
+
+	return nil
+}
+
+// ProcessCompactBlock takes a compact block received from the peer with the
+// specified identity public key and rebuilds the full block using the
+// transactions in the mempool. Any transactions that are missing are requested
+// from the peer before the block is processed.
+func (s *State) ProcessCompactBlock(ctx context.Context, publicKey string, cb peer.CompactBlock) error {
+
+	// The peer is identified by the key that authenticated the request so a
+	// peer can't have another host asked for the transactions or blamed for
+	// a bad block.
+	pr, err := s.peerByKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	s.evHandler("state: ProcessCompactBlock: started: peer[%s]: newBlk[%s]: numTrans[%d]: prefilled[%d]", pr, cb.Block.Hash, len(cb.Block.ShortIDs), len(cb.Block.Prefilled))
+	defer s.evHandler("state: ProcessCompactBlock: completed: newBlk[%s]", cb.Block.Hash)
+
+	// If this block has already been accepted, there is nothing to do.
+	if s.blockSeen.contains(cb.Block.Hash) {
+		return ErrBlockSeen
+	}
+
+	// Rebuild the block using the mempool and the prefilled transactions.
+	trans, missing, err := s.reconstructTrans(cb.Block)
+	if err != nil {
+		return err
+	}
+
+	// Request any of the transactions we could not find.
+	if len(missing) > 0 {
+		s.evHandler("state: ProcessCompactBlock: requesting missing: peer[%s]: trans[%d]", pr, len(missing))
+
+		req := peer.BlockTxRequest{
+			Number:  cb.Block.Header.Number,
+			Hash:    cb.Block.Hash,
+			Indexes: missing,
+		}
+
+		blockTxs, err := s.NetRequestPeerBlockTxs(ctx, pr, req)
+		if err != nil {
+			return fmt.Errorf("requesting missing transactions: %w", err)
+		}
+
+		if len(blockTxs) != len(missing) {
+			return fmt.Errorf("peer returned the wrong number of transactions, got %d, exp %d", len(blockTxs), len(missing))
+		}
+
+		for i, idx := range missing {
+			if blockTxs[i].ShortID() != cb.Block.ShortIDs[idx] {
+				return fmt.Errorf("peer returned the wrong transaction for index %d", idx)
+			}
+			trans[idx] = blockTxs[i]
+		}
+	}
+
+	block, err := database.ToBlock(database.BlockData{
+		Hash:   cb.Block.Hash,
+		Header: cb.Block.Header,
+		Trans:  trans,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.ProcessProposedBlock(ctx, block); err != nil {
+		s.recordInvalidBlock(pr.Host, err)
+		return err
+	}
+
+	return nil
+}
+
+// reconstructTrans rebuilds the list of transactions for a compact block. The
+// indexes of the transactions that could not be located are returned.
+func (s *State) reconstructTrans(cbd database.CompactBlockData) ([]database.BlockTx, []int, error) {
+	trans := make([]database.BlockTx, len(cbd.ShortIDs))
+	filled := make([]bool, len(cbd.ShortIDs))
+
+	for _, pf := range cbd.Prefilled {
+		if pf.Index < 0 || pf.Index >= len(trans) {
+			return nil, nil, fmt.Errorf("prefilled transaction index %d out of range", pf.Index)
+		}
+		if pf.Tx.ShortID() != cbd.ShortIDs[pf.Index] {
+			return nil, nil, fmt.Errorf("prefilled transaction index %d doesn't match short id", pf.Index)
+		}
+		trans[pf.Index] = pf.Tx
+		filled[pf.Index] = true
+	}
+
+	// Index the mempool by short id. If two transactions share the same
+	// short id, neither can be trusted and the transaction is requested.
+	pool := make(map[string]database.BlockTx)
+	collisions := make(map[string]bool)
+	for _, tx := range s.mempool.PickBest() {
+		id := tx.ShortID()
+		if _, exists := pool[id]; exists {
+			collisions[id] = true
+			continue
+		}
+		pool[id] = tx
+	}
+
+	var missing []int
+	for i, id := range cbd.ShortIDs {
+		if filled[i] {
+			continue
+		}
+
+		tx, exists := pool[id]
+		if !exists || collisions[id] {
+			missing = append(missing, i)
+			continue
+		}
+		trans[i] = tx
+	}
+
+	return trans, missing, nil
+}
+
+// processProposedBlock validates the block and adds it to the local
+// blockchain without relaying it. Blocks retrieved during a sync are
+// processed this way since they are not new to the network.
+func (s *State) processProposedBlock(ctx context.Context, block database.Block) error {
+	hash := block.Hash()
+
+	s.evHandler("state: ValidateProposedBlock: started: prevBlk[%s]: newBlk[%s]: numTrans[%d]", block.Header.PrevBlockHash, hash, len(block.MerkleTree.Values()))
+	defer s.evHandler("state: ValidateProposedBlock: completed: newBlk[%s]", hash)
+
+	// If this block has already been accepted, there is nothing to do.
+	if s.blockSeen.contains(hash) {
+		return ErrBlockSeen
+	}
 
 	// Validate the block and then update the blockchain database.
-	if err := s.validateUpdateDatabase(block); err != nil {
+	if err := s.validateUpdateDatabase(ctx, block); err != nil {
 		return err
 	}
 
@@ -89,10 +279,24 @@ func (s *State) ProcessProposedBlock(block database.Block) error {
 // validateUpdateDatabase takes the block and validates the block against the
 // consensus rules. If the block passes, then the state of the node is updated
 // including adding the block to disk.
-func (s *State) validateUpdateDatabase(block database.Block) error {
+func (s *State) validateUpdateDatabase(ctx context.Context, block database.Block) (err error) {
+	ctx, span := s.tracer.Start(ctx, "state.validateUpdateDatabase", trace.Attr("block.number", block.Header.Number), trace.Attr("block.hash", block.Hash()))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// The seen cache is checked again under the lock, where the block is
+	// also marked as seen, so the same block arriving from two peers at the
+	// same time is only validated and written once. The earlier checks only
+	// save the work of rebuilding a block that is already known.
+	if s.blockSeen.contains(block.Hash()) {
+		return ErrBlockSeen
+	}
+
 	s.evHandler("state: validateUpdateDatabase: validate block")
 
 	// CORE NOTE: I could add logic to determine if this block was mined by this
@@ -100,17 +304,19 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 	// me to this function for the same block number, I could replace the peer
 	// block with my own and attempt to have other peers accept my block instead.
 
-	if err := block.ValidateBlock(s.db.LatestBlock(), s.db.HashState(), s.evHandler); err != nil {
+	if err := s.validateBlock(ctx, block); err != nil {
+		s.publishContext(ctx, BlockRejected{Number: block.Header.Number, Hash: block.Hash(), Reason: database.ValidationReason(err), Error: err.Error()})
 		return err
 	}
 
 	s.evHandler("state: validateUpdateDatabase: write to disk")
 
 	// Write the new block to the chain on disk.
-	if err := s.db.Write(block); err != nil {
+	if err := s.writeBlock(ctx, block); err != nil {
 		return err
 	}
 	s.db.UpdateLatestBlock(block)
+	s.recentHashes.add(block.Header.Number, block.Hash())
 
 	s.evHandler("state: validateUpdateDatabase: update accounts and remove from mempool")
 
@@ -118,9 +324,16 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 	for _, tx := range block.MerkleTree.Values() {
 		s.evHandler("state: validateUpdateDatabase: tx[%s] update and remove", tx)
 
-		// Remove this transaction from the mempool.
+		// Remove this transaction from the mempool. A different transaction
+		// from the same account with the same nonce can't be mined anymore.
+		if etx, exists := s.mempool.Lookup(tx); exists && etx.HashHex() != tx.HashHex() {
+			s.publishContext(ctx, TxEvicted{Tx: etx, Reason: EvictConflict})
+		}
 		s.mempool.Delete(tx)
 
+		// Complete the trace for this transaction on this node.
+		s.traceTxIncluded(ctx, block, tx)
+
 		// Apply the balance changes based on this transaction.
 		if err := s.db.ApplyTransaction(block, tx); err != nil {
 			s.evHandler("state: validateUpdateDatabase: WARNING : %s", err)
@@ -133,19 +346,73 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 	// Apply the mining reward for this block.
 	s.db.ApplyMiningReward(block)
 
+	// Remember this block so it isn't processed again if a peer
+	// relays it back to us.
+	s.blockSeen.add(block.Hash())
+
 	// Send an event about this new block.
-	s.blockEvent(block)
+	s.publishContext(ctx, BlockAdded{Block: database.NewBlockData(block)})
 
 	return nil
 }
 
-// blockEvent provides a specific event about a new block in the chain for
-// application specific support.
-func (s *State) blockEvent(block database.Block) {
-	data, err := json.Marshal(database.NewBlockData(block))
+// validateBlock validates the block against the consensus rules and the
+// current state of the chain.
+func (s *State) validateBlock(ctx context.Context, block database.Block) error {
+	_, span := s.tracer.Start(ctx, "database.ValidateBlock")
+	defer span.End()
+
+	err := block.ValidateBlock(s.db.LatestBlock(), s.db.HashState(), s.evHandler)
 	if err != nil {
-		data = []byte(fmt.Sprintf("{error: %q}", err.Error()))
+		span.SetAttributes(trace.Attr("validation.reason", database.ValidationReason(err)))
+		span.RecordError(err)
+	}
+
+	return err
+}
+
+// writeBlock writes the block to storage.
+func (s *State) writeBlock(ctx context.Context, block database.Block) error {
+	_, span := s.tracer.Start(ctx, "database.Write")
+	defer span.End()
+
+	err := s.db.Write(block)
+	span.RecordError(err)
+
+	return err
+}
+
+// traceTxIncluded records the inclusion of the transaction in the block as
+// part of the trace for the transaction. The span is linked to the trace of
+// the block so one can be found from the other.
+func (s *State) traceTxIncluded(ctx context.Context, block database.Block, tx database.BlockTx) {
+	hash := tx.HashHex()
+
+	sc, exists := s.txTraces.get(hash)
+	if !exists {
+		return
+	}
+	s.txTraces.remove(hash)
+
+	_, span := s.tracer.Start(trace.ContextWithSpanContext(context.Background(), sc), "state.txIncluded",
+		trace.Attr("tx.hash", hash),
+		trace.Attr("block.number", block.Header.Number),
+		trace.Attr("block.hash", block.Hash()),
+	)
+	span.AddLink(trace.SpanContextFromContext(ctx))
+	span.End()
+}
+
+// prefillTx identifies the transactions that should be sent in full when
+// relaying a compact block. The time this node first received the transaction
+// is used, since the timestamp in the transaction comes from the clock of the
+// node the wallet submitted it to. A transaction this node didn't receive
+// before the block has most likely not reached the peers either.
+func (s *State) prefillTx(tx database.BlockTx) bool {
+	received, exists := s.txSeen.addedAt(tx.HashHex())
+	if !exists {
+		return true
 	}
 
-	s.evHandler("viewer: block: %s", string(data))
+	return s.clock.Now().Sub(received) < compactPrefillWindow
 }
@@ -0,0 +1,197 @@
+package state
+
+import (
+	"context"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/events"
+)
+
+// The set of topics the blockchain publishes events on.
+const (
+	TopicBlocks events.Topic = "blocks"
+	TopicTxs    events.Topic = "txs"
+	TopicMining events.Topic = "mining"
+	TopicPeers  events.Topic = "peers"
+	TopicSync   events.Topic = "sync"
+)
+
+// Topics returns the set of topics the blockchain publishes events on.
+func Topics() []events.Topic {
+	return []events.Topic{TopicBlocks, TopicTxs, TopicMining, TopicPeers, TopicSync}
+}
+
+// The set of reasons a transaction is evicted from the mempool.
+const (
+	EvictReplaced = "replaced"
+	EvictConflict = "conflict"
+	EvictAdmin    = "admin"
+)
+
+// TopicAdmin is the topic the audit events for the actions taken by an
+// operator are published on. It's not part of the blockchain topics so
+// the audit trail isn't exposed to the public API.
+const TopicAdmin events.Topic = "admin"
+
+// =============================================================================
+
+// BlockAdded is published when a block is written to the blockchain.
+type BlockAdded struct {
+	Block database.BlockData `json:"block"`
+}
+
+// Topic implements the events.Event interface.
+func (BlockAdded) Topic() events.Topic { return TopicBlocks }
+
+// BlockRejected is published when a block fails validation. The reason
+// identifies the check the block failed.
+type BlockRejected struct {
+	Number uint64 `json:"number"`
+	Hash   string `json:"hash"`
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+}
+
+// Topic implements the events.Event interface.
+func (BlockRejected) Topic() events.Topic { return TopicBlocks }
+
+// TxAccepted is published when a transaction is added to the mempool.
+type TxAccepted struct {
+	Tx database.BlockTx `json:"tx"`
+}
+
+// Topic implements the events.Event interface.
+func (TxAccepted) Topic() events.Topic { return TopicTxs }
+
+// TxEvicted is published when a transaction is removed from the mempool
+// without being mined. A transaction is replaced when a new transaction
+// with the same nonce and a bigger tip is accepted. A transaction is in
+// conflict when a block is mined with a different transaction for the
+// same nonce. An operator can also evict transactions.
+type TxEvicted struct {
+	Tx     database.BlockTx `json:"tx"`
+	Reason string           `json:"reason"`
+}
+
+// Topic implements the events.Event interface.
+func (TxEvicted) Topic() events.Topic { return TopicTxs }
+
+// MiningStarted is published when this node starts to mine a block.
+type MiningStarted struct {
+	Number uint64 `json:"number"`
+	Txs    int    `json:"txs"`
+}
+
+// Topic implements the events.Event interface.
+func (MiningStarted) Topic() events.Topic { return TopicMining }
+
+// MiningCompleted is published when this node mines a block. Attempts is
+// the number of hashes calculated to solve the POW puzzle.
+type MiningCompleted struct {
+	Number   uint64        `json:"number"`
+	Hash     string        `json:"hash"`
+	Duration time.Duration `json:"duration"`
+	Attempts uint64        `json:"attempts"`
+}
+
+// Topic implements the events.Event interface.
+func (MiningCompleted) Topic() events.Topic { return TopicMining }
+
+// MiningCancelled is published when this node stops mining a block without
+// adding it to the blockchain.
+type MiningCancelled struct {
+	Number uint64 `json:"number"`
+	Reason string `json:"reason"`
+}
+
+// Topic implements the events.Event interface.
+func (MiningCancelled) Topic() events.Topic { return TopicMining }
+
+// PeerAdded is published when a peer is added to the known peer list.
+type PeerAdded struct {
+	Peer peer.Peer `json:"peer"`
+}
+
+// Topic implements the events.Event interface.
+func (PeerAdded) Topic() events.Topic { return TopicPeers }
+
+// PeerRemoved is published when a peer is removed from the known peer list.
+type PeerRemoved struct {
+	Peer peer.Peer `json:"peer"`
+}
+
+// Topic implements the events.Event interface.
+func (PeerRemoved) Topic() events.Topic { return TopicPeers }
+
+// PeerBanned is published when a peer is banned for misbehaving or by an
+// operator.
+type PeerBanned struct {
+	Host   string `json:"host"`
+	Reason string `json:"reason"`
+}
+
+// Topic implements the events.Event interface.
+func (PeerBanned) Topic() events.Topic { return TopicPeers }
+
+// PeerFailed is published when a network call to a peer fails after all
+// its attempts.
+type PeerFailed struct {
+	Host      string `json:"host"`
+	Operation string `json:"operation"`
+	Error     string `json:"error"`
+}
+
+// Topic implements the events.Event interface.
+func (PeerFailed) Topic() events.Topic { return TopicPeers }
+
+// ReorgStarted is published when the blockchain is reset so it can be
+// synced again from peers.
+type ReorgStarted struct {
+	Number uint64 `json:"number"`
+}
+
+// Topic implements the events.Event interface.
+func (ReorgStarted) Topic() events.Topic { return TopicSync }
+
+// ReorgCompleted is published when the blockchain has been synced again
+// after a reset. Depth is the number of blocks the node had before the
+// reset that are no longer part of the blockchain.
+type ReorgCompleted struct {
+	Number uint64 `json:"number"`
+	Depth  uint64 `json:"depth"`
+}
+
+// Topic implements the events.Event interface.
+func (ReorgCompleted) Topic() events.Topic { return TopicSync }
+
+// AdminAction is published for every action an operator takes against the
+// running node, whether it succeeds or not.
+type AdminAction struct {
+	Action  string `json:"action"`
+	Target  string `json:"target,omitempty"`
+	Remote  string `json:"remote"`
+	TraceID string `json:"trace_id"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Topic implements the events.Event interface.
+func (AdminAction) Topic() events.Topic { return TopicAdmin }
+
+// =============================================================================
+
+// publish sends the event to the events bus if one is configured.
+func (s *State) publish(ev events.Event) {
+	if s.events != nil {
+		s.events.Publish(ev)
+	}
+}
+
+// publishContext sends the event to the events bus, if one is configured,
+// with the trace id of the operation in the context.
+func (s *State) publishContext(ctx context.Context, ev events.Event) {
+	if s.events != nil {
+		s.events.PublishContext(ctx, ev)
+	}
+}
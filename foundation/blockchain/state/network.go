@@ -1,44 +1,96 @@
 package state
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"sync"
+	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/trace"
 )
 
-const baseURL = "http://%s/v1/node"
+// blockGossipFanout represents the number of peers a new block is
+// sent to by any given node.
+const blockGossipFanout = 4
 
-// NetSendBlockToPeers takes the new mined block and sends it to all know peers.
-func (s *State) NetSendBlockToPeers(block database.Block) error {
+// Set of timeouts for a single attempt of each kind of network call. Calls
+// that move a lot of data are given more time.
+const (
+	handshakeTimeout = 5 * time.Second
+	requestTimeout   = 10 * time.Second
+	syncTimeout      = 30 * time.Second
+)
+
+// Settings for retrying a network call that failed to reach the peer. The
+// wait between attempts doubles with every attempt up to the max and half
+// of the wait is random so peers are not retried in lockstep.
+const (
+	maxAttempts = 3
+	retryBase   = 100 * time.Millisecond
+	retryMax    = 2 * time.Second
+)
+
+// operation describes how a network call to a peer is made.
+type operation struct {
+	name     string
+	timeout  time.Duration
+	attempts int
+}
+
+// Set of network calls made to peers.
+var (
+	opHandshake       = operation{name: "handshake", timeout: handshakeTimeout, attempts: maxAttempts}
+	opStatus          = operation{name: "status", timeout: requestTimeout, attempts: maxAttempts}
+	opMempool         = operation{name: "mempool", timeout: syncTimeout, attempts: maxAttempts}
+	opAnnounceTxs     = operation{name: "announceTxs", timeout: requestTimeout, attempts: maxAttempts}
+	opRequestTxs      = operation{name: "requestTxs", timeout: requestTimeout, attempts: maxAttempts}
+	opAnnounceBlock   = operation{name: "announceBlock", timeout: syncTimeout, attempts: maxAttempts}
+	opRequestBlocks   = operation{name: "requestBlocks", timeout: syncTimeout, attempts: maxAttempts}
+	opRequestBlockTxs = operation{name: "requestBlockTxs", timeout: requestTimeout, attempts: maxAttempts}
+)
+
+// =============================================================================
+
+// NetSendBlockToPeers takes a new block and sends it to a random subset of
+// the known peers. Peers that accept the block will relay it to their own
+// random subset of peers.
+func (s *State) NetSendBlockToPeers(ctx context.Context, block database.Block) error {
 	s.evHandler("state: NetSendBlockToPeers: started")
 	defer s.evHandler("state: NetSendBlockToPeers: completed")
 
-	for _, peer := range s.KnownExternalPeers() {
-		s.evHandler("state: NetSendBlockToPeers: send: block[%s] to peer[%s]", block.Hash(), peer)
+	// CORE NOTE: Sending every block to every peer doesn't scale beyond a
+	// small network. Like Ethereum, the block is gossiped to a small number
+	// of peers and each peer that accepts the block forwards it again. The
+	// seen cache on each node stops the block from echoing back.
 
-		url := fmt.Sprintf("%s/block/propose", fmt.Sprintf(baseURL, peer.Host))
+	// CORE NOTE: Peers will usually have most of the transactions for the
+	// block in their mempool already. Like Bitcoin, the block is sent in a
+	// compact form with short transaction ids. Transactions that were
+	// received very recently are sent in full since they have most likely
+	// not reached the peer yet.
 
-		var status struct {
-			Status string `json:"status"`
-		}
-		if err := send(http.MethodPost, url, database.NewBlockData(block), &status); err != nil {
-			return fmt.Errorf("%s: %s", peer.Host, err)
-		}
+	cb := peer.CompactBlock{
+		Block: database.NewCompactBlockData(block, s.prefillTx),
 	}
 
-	return nil
+	peers := s.gossipPeers(blockGossipFanout)
+	for _, pr := range peers {
+		s.evHandler("state: NetSendBlockToPeers: send: block[%s] to peer[%s]: prefilled[%d]", block.Hash(), pr, len(cb.Block.Prefilled))
+	}
+
+	return s.callPeers(ctx, peers, opAnnounceBlock, func(ctx context.Context, pr peer.Peer) error {
+		return s.transport.AnnounceBlock(ctx, pr, cb)
+	})
 }
 
-// NetSendTxToPeers shares a new block transaction with the known peers.
-func (s *State) NetSendTxToPeers(tx database.BlockTx) {
-	s.evHandler("state: NetSendTxToPeers: started")
-	defer s.evHandler("state: NetSendTxToPeers: completed")
+// NetSendTxAnnounceToPeers announces a batch of new transaction hashes to
+// the known peers.
+func (s *State) NetSendTxAnnounceToPeers(ctx context.Context, hashes []string) error {
+	s.evHandler("state: NetSendTxAnnounceToPeers: started: hashes[%d]", len(hashes))
+	defer s.evHandler("state: NetSendTxAnnounceToPeers: completed")
 
 	// CORE NOTE: Bitcoin does not send the full transaction immediately to save
 	// on bandwidth. A node will send the transaction's mempool key first so the
@@ -46,64 +98,162 @@ func (s *State) NetSendTxToPeers(tx database.BlockTx) {
 	// the receiving node doesn't have it, then it will request the transaction
 	// based on the mempool key it received.
 
-	// For now, the Ardan blockchain just sends the full transaction.
-	for _, peer := range s.KnownExternalPeers() {
-		s.evHandler("state: NetSendTxToPeers: send: tx[%s] to peer[%s]", tx, peer)
+	// The Ardan blockchain does the same thing using the transaction hash. The
+	// hashes are batched up and announced periodically. Each peer will call
+	// back to request the transactions it's missing.
+	ann := peer.TxAnnounce{
+		Hashes: hashes,
+	}
 
-		url := fmt.Sprintf("%s/tx/submit", fmt.Sprintf(baseURL, peer.Host))
+	// The announcement continues the trace of the first traced transaction
+	// and is linked to the traces of the others. Every traced transaction
+	// is announced with its own span so each trace continues on the peers.
+	var span *trace.Span
+	for _, hash := range hashes {
+		sc, exists := s.txTraces.get(hash)
+		if !exists {
+			continue
+		}
 
-		if err := send(http.MethodPost, url, tx, nil); err != nil {
-			s.evHandler("state: NetSendTxToPeers: WARNING: %s", err)
+		if span == nil {
+			ctx, span = s.tracer.Start(trace.ContextWithSpanContext(ctx, sc), "state.NetSendTxAnnounceToPeers", trace.Attr("tx.hashes", len(hashes)))
+			defer span.End()
 		}
+		span.AddLink(sc)
+
+		if ann.Traces == nil {
+			ann.Traces = make(map[string]string)
+		}
+		ann.Traces[hash] = sc.Traceparent()
 	}
+
+	return s.callPeers(ctx, s.KnownExternalPeers(), opAnnounceTxs, func(ctx context.Context, pr peer.Peer) error {
+		s.evHandler("state: NetSendTxAnnounceToPeers: send: hashes[%d] to peer[%s]", len(hashes), pr)
+		return s.transport.AnnounceTxs(ctx, pr, ann)
+	})
+}
+
+// NetRequestPeerTxs asks the peer for the transactions that match the
+// specified hashes.
+func (s *State) NetRequestPeerTxs(ctx context.Context, pr peer.Peer, hashes []string) ([]database.BlockTx, error) {
+	s.evHandler("state: NetRequestPeerTxs: started: %s: hashes[%d]", pr, len(hashes))
+	defer s.evHandler("state: NetRequestPeerTxs: completed: %s", pr)
+
+	var trans []database.BlockTx
+	err := s.callPeer(ctx, pr, opRequestTxs, func(ctx context.Context, pr peer.Peer) error {
+		var err error
+		trans, err = s.transport.RequestTxs(ctx, pr, peer.TxRequest{Hashes: hashes})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.evHandler("state: NetRequestPeerTxs: received: %s: trans[%d]", pr, len(trans))
+
+	return trans, nil
 }
 
 // NetSendNodeAvailableToPeers shares this node is available to
 // participate in the network with the known peers.
-func (s *State) NetSendNodeAvailableToPeers() {
+func (s *State) NetSendNodeAvailableToPeers(ctx context.Context) error {
 	s.evHandler("state: NetSendNodeAvailableToPeers: started")
 	defer s.evHandler("state: NetSendNodeAvailableToPeers: completed")
 
-	host := peer.Peer{Host: s.Host()}
+	peers := s.KnownExternalPeers()
 
-	for _, peer := range s.KnownExternalPeers() {
-		s.evHandler("state: NetSendNodeAvailableToPeers: send: host[%s] to peer[%s]", host, peer)
+	var wg sync.WaitGroup
+	errs := make([]error, len(peers))
 
-		url := fmt.Sprintf("%s/peers", fmt.Sprintf(baseURL, peer.Host))
+	for i, pr := range peers {
+		s.evHandler("state: NetSendNodeAvailableToPeers: send: host[%s] to peer[%s]", s.Host(), pr)
 
-		if err := send(http.MethodPost, url, host, nil); err != nil {
-			s.evHandler("state: NetSendNodeAvailableToPeers: WARNING: %s", err)
-		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = s.NetHandshake(ctx, pr)
+		}()
 	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// NetHandshake exchanges handshake information with the specified peer. If
+// the peer is not compatible with this node, it's removed from the known peer
+// list. Otherwise the peer is added with its handshake information.
+func (s *State) NetHandshake(ctx context.Context, pr peer.Peer) (peer.Peer, error) {
+	s.evHandler("state: NetHandshake: started: %s", pr)
+	defer s.evHandler("state: NetHandshake: completed: %s", pr)
+
+	var hs peer.Peer
+	err := s.callPeer(ctx, pr, opHandshake, func(ctx context.Context, pr peer.Peer) error {
+		var err error
+		hs, err = s.transport.Handshake(ctx, pr, s.Handshake())
+		return err
+	})
+	if err != nil {
+		return peer.Peer{}, fmt.Errorf("%s: %w", pr.Host, err)
+	}
+
+	// The peer is known by the host we used to reach it.
+	hs.Host = pr.Host
+
+	if err := s.handshake.Compatible(hs); err != nil {
+		s.RemoveKnownPeer(pr)
+		return peer.Peer{}, fmt.Errorf("%s: handshake rejected: %w", pr.Host, err)
+	}
+
+	s.evHandler("state: NetHandshake: peer-node[%s]: version[%s]: consensus[%s]", pr, hs.NodeVersion, hs.Consensus)
+
+	added, err := s.knownPeers.AddHandshake(hs)
+	if err != nil {
+		return peer.Peer{}, fmt.Errorf("%s: handshake rejected: %w", pr.Host, err)
+	}
+
+	if added {
+		s.publish(PeerAdded{Peer: hs})
+	}
+
+	return hs, nil
 }
 
 // NetRequestPeerStatus looks for new nodes on the blockchain by asking
 // known nodes for their peer list. New nodes are added to the list.
-func (s *State) NetRequestPeerStatus(pr peer.Peer) (peer.PeerStatus, error) {
+func (s *State) NetRequestPeerStatus(ctx context.Context, pr peer.Peer) (peer.PeerStatus, error) {
 	s.evHandler("state: NetRequestPeerStatus: started: %s", pr)
 	defer s.evHandler("state: NetRequestPeerStatus: completed: %s", pr)
 
-	url := fmt.Sprintf("%s/status", fmt.Sprintf(baseURL, pr.Host))
-
 	var ps peer.PeerStatus
-	if err := send(http.MethodGet, url, nil, &ps); err != nil {
+	err := s.callPeer(ctx, pr, opStatus, func(ctx context.Context, pr peer.Peer) error {
+		var err error
+		ps, err = s.transport.Status(ctx, pr)
+		return err
+	})
+	if err != nil {
 		return peer.PeerStatus{}, err
 	}
 
 	s.evHandler("state: NetRequestPeerStatus: peer-node[%s]: latest-blknum[%d]: peer-list[%s]", pr, ps.LatestBlockNumber, ps.KnownPeers)
 
+	s.knownPeers.RecordHeight(pr.Host, ps.LatestBlockNumber)
+
 	return ps, nil
 }
 
 // NetRequestPeerMempool asks the peer for the transactions in their mempool.
-func (s *State) NetRequestPeerMempool(pr peer.Peer) ([]database.BlockTx, error) {
+func (s *State) NetRequestPeerMempool(ctx context.Context, pr peer.Peer) ([]database.BlockTx, error) {
 	s.evHandler("state: NetRequestPeerMempool: started: %s", pr)
 	defer s.evHandler("state: NetRequestPeerMempool: completed: %s", pr)
 
-	url := fmt.Sprintf("%s/tx/list", fmt.Sprintf(baseURL, pr.Host))
-
 	var mempool []database.BlockTx
-	if err := send(http.MethodGet, url, nil, &mempool); err != nil {
+	err := s.callPeer(ctx, pr, opMempool, func(ctx context.Context, pr peer.Peer) error {
+		var err error
+		mempool, err = s.transport.Mempool(ctx, pr)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -112,12 +262,37 @@ func (s *State) NetRequestPeerMempool(pr peer.Peer) ([]database.BlockTx, error)
 	return mempool, nil
 }
 
+// NetRequestPeerBlockTxs asks the peer for the transactions at the specified
+// positions in a block. This is used to fill in a compact block.
+func (s *State) NetRequestPeerBlockTxs(ctx context.Context, pr peer.Peer, req peer.BlockTxRequest) ([]database.BlockTx, error) {
+	s.evHandler("state: NetRequestPeerBlockTxs: started: %s: blk[%d]: trans[%d]", pr, req.Number, len(req.Indexes))
+	defer s.evHandler("state: NetRequestPeerBlockTxs: completed: %s", pr)
+
+	var trans []database.BlockTx
+	err := s.callPeer(ctx, pr, opRequestBlockTxs, func(ctx context.Context, pr peer.Peer) error {
+		var err error
+		trans, err = s.transport.RequestBlockTxs(ctx, pr, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trans, nil
+}
+
 // NetRequestPeerBlocks queries the specified node asking for blocks this node does
 // not have, then writes them to disk.
-func (s *State) NetRequestPeerBlocks(pr peer.Peer) error {
+func (s *State) NetRequestPeerBlocks(ctx context.Context, pr peer.Peer) error {
 	s.evHandler("state: NetRequestPeerBlocks: started: %s", pr)
 	defer s.evHandler("state: NetRequestPeerBlocks: completed: %s", pr)
 
+	// The height the peer reported is only trusted as far as the peer can
+	// provide the blocks, whether the sync fails or stops early.
+	defer func() {
+		s.knownPeers.CapHeight(pr.Host, s.LatestBlock().Header.Number)
+	}()
+
 	// CORE NOTE: Ideally you want to start by pulling just block headers and
 	// performing the cryptographic audit so you know your're not being attacked.
 	// After that you can start pulling the full block data for each block header
@@ -129,79 +304,221 @@ func (s *State) NetRequestPeerBlocks(pr peer.Peer) error {
 	// transactions to have a complete account database. The cryptographic audit
 	// does take place as each full block is downloaded from peers.
 
-	from := s.LatestBlock().Header.Number + 1
-	url := fmt.Sprintf("%s/block/list/%d/latest", fmt.Sprintf(baseURL, pr.Host), from)
+	// Peers return a limited number of blocks per request, so keep asking
+	// for the next set until a peer returns less than a full set.
+	for {
+		from := s.LatestBlock().Header.Number + 1
 
-	var blocksData []database.BlockData
-	if err := send(http.MethodGet, url, nil, &blocksData); err != nil {
-		return err
-	}
-
-	s.evHandler("state: NetRequestPeerBlocks: found blocks[%d]", len(blocksData))
-
-	for _, blockData := range blocksData {
-		block, err := database.ToBlock(blockData)
+		var blocksData []database.BlockData
+		err := s.callPeer(ctx, pr, opRequestBlocks, func(ctx context.Context, pr peer.Peer) error {
+			var err error
+			blocksData, err = s.transport.RequestBlocks(ctx, pr, peer.BlocksRequest{From: from})
+			return err
+		})
 		if err != nil {
 			return err
 		}
 
-		if err := s.ProcessProposedBlock(block); err != nil {
-			return err
+		s.evHandler("state: NetRequestPeerBlocks: found blocks[%d] from[%d]", len(blocksData), from)
+
+		for _, blockData := range blocksData {
+			block, err := database.ToBlock(blockData)
+			if err != nil {
+				return err
+			}
+
+			if err := s.processProposedBlock(ctx, block); err != nil {
+				if errors.Is(err, ErrBlockSeen) {
+					continue
+				}
+				s.recordInvalidBlock(pr.Host, err)
+				return err
+			}
 		}
-	}
 
-	return nil
+		if len(blocksData) < peer.MaxBlocksPerRequest {
+			return nil
+		}
+
+		// Stop if the peer sent a full set that didn't move the chain
+		// forward, otherwise the same set would be requested forever.
+		if s.LatestBlock().Header.Number < from {
+			return nil
+		}
+	}
 }
 
 // =============================================================================
 
-// send is a helper function to send an HTTP request to a node.
-func send(method string, url string, dataSend any, dataRecv any) error {
-	var req *http.Request
+// callPeers makes the call to each of the peers at the same time so a slow
+// peer doesn't hold up the others. The errors from all the peers are
+// returned together.
+func (s *State) callPeers(ctx context.Context, peers []peer.Peer, op operation, call func(ctx context.Context, pr peer.Peer) error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(peers))
+
+	for i, pr := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.callPeer(ctx, pr, op, call); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", pr.Host, err)
+			}
+		}()
+	}
 
-	switch {
-	case dataSend != nil:
-		data, err := json.Marshal(dataSend)
-		if err != nil {
-			return err
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// callPeer makes a call to the specified peer through the transport and
+// records the outcome against the peer's score. The call receives the known
+// information for the peer, such as the identity from its handshake.
+func (s *State) callPeer(ctx context.Context, pr peer.Peer, op operation, call func(ctx context.Context, pr peer.Peer) error) (err error) {
+	if known, exists := s.knownPeers.Get(pr.Host); exists {
+		pr = known
+	}
+
+	// Every call is traced and the transport propagates the span so the
+	// peer continues the trace.
+	ctx, span := s.tracer.Start(ctx, "state.callPeer", trace.Attr("peer.host", pr.Host), trace.Attr("peer.operation", op.name))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// CORE NOTE: Every attempt is given its own timeout so a stalled peer
+	// can't hold up the node. An attempt that fails to reach the peer is
+	// retried a few times since the network may just have dropped it. A peer
+	// that keeps failing has its circuit opened and isn't called again until
+	// its backoff expires.
+
+	if err := s.knownPeers.Acquire(pr.Host); err != nil {
+		return fmt.Errorf("%s: %w", op.name, err)
+	}
+
+	start := s.clock.Now()
+
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(trace.Attr("peer.attempts", attempt))
+
+		err = s.attempt(ctx, pr, op, call)
+		if err == nil || errors.Is(err, peer.ErrRejected) || ctx.Err() != nil || attempt >= op.attempts {
+			break
 		}
-		req, err = http.NewRequest(method, url, bytes.NewReader(data))
-		if err != nil {
-			return err
+
+		s.evHandler("state: callPeer: peer[%s]: %s: attempt[%d]: retrying: %s", pr, op.name, attempt, err)
+
+		if !sleep(ctx, s.retryDelay(attempt)) {
+			break
 		}
+	}
+
+	switch {
+	case err == nil || errors.Is(err, peer.ErrRejected):
+
+		// A peer that rejects the request was still reached.
+		s.knownPeers.RecordSuccess(pr.Host, s.clock.Now().Sub(start))
+
+	case ctx.Err() != nil:
+
+		// The caller gave up on the call, which says nothing about the peer.
 
 	default:
-		var err error
-		req, err = http.NewRequest(method, url, nil)
-		if err != nil {
-			return err
+
+		// Only failures to reach the peer count against it. A peer that has
+		// failed too many times in a row is dropped from the known peer list.
+		s.publishContext(ctx, PeerFailed{Host: pr.Host, Operation: op.name, Error: err.Error()})
+
+		if s.knownPeers.RecordFailure(pr.Host) {
+			s.evHandler("state: callPeer: peer[%s]: too many failures: removing peer", pr)
+			s.RemoveKnownPeer(pr)
 		}
 	}
 
-	var client http.Client
-	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %w", op.name, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNoContent {
-		return nil
+	return nil
+}
+
+// attempt makes a single attempt of the call within the operation's timeout.
+func (s *State) attempt(ctx context.Context, pr peer.Peer, op operation, call func(ctx context.Context, pr peer.Peer) error) error {
+	ctx, cancel := context.WithTimeout(ctx, op.timeout)
+	defer cancel()
+
+	return call(ctx, pr)
+}
+
+// retryDelay returns how long to wait before the next attempt.
+func (s *State) retryDelay(attempt int) time.Duration {
+	delay := retryBase << (attempt - 1)
+	if delay > retryMax || delay <= 0 {
+		delay = retryMax
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		msg, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		return errors.New(string(msg))
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+
+	return delay/2 + time.Duration(s.rand.Int64N(int64(delay/2)))
+}
+
+// sleep waits for the specified duration. It returns false if the context
+// is done before the duration has passed. This uses the wall clock since
+// there is nothing to move a simulated clock while a call is waiting.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
+}
 
-	if dataRecv != nil {
-		if err := json.NewDecoder(resp.Body).Decode(dataRecv); err != nil {
-			return err
-		}
+// recordInvalidBlock penalizes the peer if the error shows the block it
+// provided breaks the consensus rules.
+func (s *State) recordInvalidBlock(host string, err error) {
+	if !errors.Is(err, database.ErrInvalidBlock) {
+		return
 	}
 
-	return nil
+	s.evHandler("state: recordInvalidBlock: peer[%s]: %s", host, err)
+
+	if s.knownPeers.RecordInvalidBlock(host) {
+		s.evHandler("state: recordInvalidBlock: peer[%s]: BANNED", host)
+		s.publish(PeerBanned{Host: host, Reason: "invalid blocks"})
+	}
+}
+
+// recordInvalidTx penalizes the peer for providing an invalid transaction.
+func (s *State) recordInvalidTx(host string, err error) {
+	s.evHandler("state: recordInvalidTx: peer[%s]: %s", host, err)
+
+	if s.knownPeers.RecordInvalidTx(host) {
+		s.evHandler("state: recordInvalidTx: peer[%s]: BANNED", host)
+		s.publish(PeerBanned{Host: host, Reason: "invalid transactions"})
+	}
+}
+
+// gossipPeers returns a random subset of the known external peers no
+// larger than the specified fanout.
+func (s *State) gossipPeers(fanout int) []peer.Peer {
+	peers := s.KnownExternalPeers()
+
+	s.randMu.Lock()
+	s.rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	s.randMu.Unlock()
+
+	if len(peers) > fanout {
+		peers = peers[:fanout]
+	}
+
+	return peers
 }
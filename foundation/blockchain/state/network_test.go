@@ -0,0 +1,124 @@
+package state_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_NetHandshakeTLS(t *testing.T) {
+	gen := newGenesis()
+	nodeA := newTLSNode(gen, t)
+	nodeB := newTLSNode(gen, t)
+
+	// Serve the handshake endpoint for node B over mutual TLS.
+	v := identity.NewVerifier(time.Minute, true)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		publicKey, err := v.VerifyRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var pr peer.Peer
+		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil || pr.PublicKey != publicKey {
+			http.Error(w, "bad handshake", http.StatusBadRequest)
+			return
+		}
+
+		if err := nodeB.state.AcceptPeerHandshake(pr); err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+
+		json.NewEncoder(w).Encode(nodeB.state.Handshake())
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(h))
+	srv.TLS = identity.ServerTLS(nodeB.cert, nil)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	host := srv.Listener.Addr().String()
+
+	hs, err := nodeA.state.NetHandshake(context.Background(), peer.New(host))
+	if err != nil {
+		t.Fatalf("Should be able to handshake over TLS: %s", err)
+	}
+	if hs.PublicKey != nodeB.state.Handshake().PublicKey {
+		t.Fatalf("Should receive the identity of node B.")
+	}
+
+	// The second handshake pins the certificate to node B's identity.
+	if _, err := nodeA.state.NetHandshake(context.Background(), peer.New(host)); err != nil {
+		t.Fatalf("Should be able to handshake with a pinned certificate: %s", err)
+	}
+
+	// A node that has pinned a different identity for the host must reject
+	// node B's certificate.
+	nodeC := newTLSNode(gen, t)
+	impostor := nodeA.state.Handshake()
+	impostor.Host = host
+	nodeC.state.AcceptPeerHandshake(impostor)
+
+	if _, err := nodeC.state.NetHandshake(context.Background(), peer.New(host)); err == nil {
+		t.Fatalf("Should reject a certificate that doesn't match the pinned identity.")
+	}
+}
+
+// =============================================================================
+
+type tlsNode struct {
+	state *state.State
+	cert  tls.Certificate
+}
+
+func newTLSNode(gen genesis.Genesis, t *testing.T) tlsNode {
+	identityKey, err := identity.Generate()
+	if err != nil {
+		t.Fatalf("Error generating identity key: %v", err)
+	}
+
+	cert, err := identity.Certificate(identityKey)
+	if err != nil {
+		t.Fatalf("Error generating certificate: %v", err)
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Error setting up memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID:  database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"),
+		Host:           "localhost:9080",
+		Genesis:        gen,
+		Storage:        storage,
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewPeerSet(),
+		Consensus:      "POW",
+		IdentityKey:    identityKey,
+		TLS:            identity.ClientTLS(cert, nil),
+		EvHandler:      func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Error constructing node state: %v", err)
+	}
+
+	st.Worker = noopWorker{}
+	return tlsNode{state: st, cert: cert}
+}
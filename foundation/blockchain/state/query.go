@@ -1,12 +1,19 @@
 package state
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
 )
 
 // QueryLastest represents to query the latest block in the chain.
 const QueryLastest = ^uint64(0) >> 1
 
+// ErrNotFound is returned when a block or transaction doesn't exist.
+var ErrNotFound = errors.New("not found")
+
 // =============================================================================
 
 // QueryAccount returns a copy of the account from the database.
@@ -38,25 +45,278 @@ func (s *State) QueryBlocksByNumber(from uint64, to uint64) []database.Block {
 	return out
 }
 
-// QueryBlocksByAccount returns the set of blocks by account. If the account
-// is empty, all blocks are returned. This function reads the blockchain
-// from disk first.
-func (s *State) QueryBlocksByAccount(accountID database.AccountID) ([]database.Block, error) {
-	var out []database.Block
+// QueryBlocksForPeer returns the blocks starting at the specified number that
+// are sent to a peer catching up, limited to peer.MaxBlocksPerRequest blocks.
+func (s *State) QueryBlocksForPeer(from uint64) []database.Block {
+	latest := s.db.LatestBlock().Header.Number
+	if from > latest {
+		return nil
+	}
+
+	return s.QueryBlocksByNumber(from, min(latest, from+peer.MaxBlocksPerRequest-1))
+}
+
+// QueryBlockTxs returns the transactions at the specified positions in the
+// block. The hash is checked to make sure the right block is being used.
+func (s *State) QueryBlockTxs(number uint64, hash string, indexes []int) ([]database.BlockTx, error) {
+	block, err := s.db.GetBlock(number)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Hash() != hash {
+		return nil, fmt.Errorf("block %d hash doesn't match, got %s, exp %s", number, block.Hash(), hash)
+	}
+
+	values := block.MerkleTree.Values()
+
+	trans := make([]database.BlockTx, len(indexes))
+	for i, idx := range indexes {
+		if idx < 0 || idx >= len(values) {
+			return nil, fmt.Errorf("transaction index %d out of range", idx)
+		}
+		trans[i] = values[idx]
+	}
+
+	return trans, nil
+}
+
+// QueryBlockBodies returns the transactions for each of the specified blocks,
+// limited to peer.MaxBlocksPerRequest blocks. The hashes are checked to make
+// sure the right blocks are being used.
+func (s *State) QueryBlockBodies(ids []peer.BlockID) ([][]database.BlockTx, error) {
+	if len(ids) > peer.MaxBlocksPerRequest {
+		return nil, fmt.Errorf("too many blocks requested, got %d, max %d", len(ids), peer.MaxBlocksPerRequest)
+	}
+
+	bodies := make([][]database.BlockTx, len(ids))
+	for i, id := range ids {
+		block, err := s.db.GetBlock(id.Number)
+		if err != nil {
+			return nil, err
+		}
+
+		if block.Hash() != id.Hash {
+			return nil, fmt.Errorf("block %d hash doesn't match, got %s, exp %s", id.Number, block.Hash(), id.Hash)
+		}
+
+		bodies[i] = block.MerkleTree.Values()
+	}
+
+	return bodies, nil
+}
+
+// MaxBlocksScanned is the most blocks QueryBlocks reads from disk in a single
+// call when filtering by account. A query that reaches the limit returns a
+// cursor so the caller can continue where the scan stopped.
+const MaxBlocksScanned = 1000
+
+// ErrScanLimit is returned when the offset of a query can't be applied within
+// the blocks that are scanned for a single call.
+var ErrScanLimit = fmt.Errorf("offset reaches past the %d blocks scanned per query, use the cursor instead", MaxBlocksScanned)
+
+// BlockQuery represents the filters and paging for a query of blocks. Zero
+// values mean no filter is applied.
+type BlockQuery struct {
+	AccountID  database.AccountID
+	From       uint64
+	To         uint64
+	Since      uint64
+	Until      uint64
+	Descending bool
+	After      uint64
+	Offset     int
+	Limit      int
+}
+
+// QueryBlocks returns a page of blocks matching the query in block number
+// order. The blocks are read one at a time from disk so only the blocks in
+// the requested range are read, and at most MaxBlocksScanned blocks are read
+// when filtering by account. When there may be more blocks matching the
+// query, the cursor is returned and they can be read by setting After to it.
+// A page can be empty when no matching blocks were found in the blocks that
+// were scanned, and a zero cursor means the query is complete.
+func (s *State) QueryBlocks(q BlockQuery) (blocks []database.Block, cursor uint64, err error) {
+	latest := s.db.LatestBlock().Header.Number
+
+	from := max(q.From, 1)
+	to := latest
+	if q.To != 0 {
+		to = min(q.To, latest)
+	}
+
+	// Continue after the cursor in the direction of the query.
+	if q.After != 0 {
+		switch {
+		case q.Descending:
+			if q.After <= from {
+				return nil, 0, nil
+			}
+			to = min(to, q.After-1)
+		default:
+			from = max(from, q.After+1)
+		}
+	}
+
+	if from > to {
+		return nil, 0, nil
+	}
+
+	// Block timestamps never go backwards so the time filters are turned into
+	// a range of block numbers instead of checking every block.
+	if q.Since != 0 {
+		if from, err = s.searchBlocks(from, to, func(block database.Block) bool { return block.Header.TimeStamp >= q.Since }); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if q.Until != 0 && from <= to {
+		n, err := s.searchBlocks(from, to, func(block database.Block) bool { return block.Header.TimeStamp > q.Until })
+		if err != nil {
+			return nil, 0, err
+		}
+		to = n - 1
+	}
+
+	if from > to {
+		return nil, 0, nil
+	}
+
+	// Without an account filter every block in the range matches, so the
+	// offset is applied without reading the skipped blocks.
+	skip := q.Offset
+	if q.AccountID == "" && skip > 0 {
+		if uint64(skip) > to-from {
+			return nil, 0, nil
+		}
+
+		switch {
+		case q.Descending:
+			to -= uint64(skip)
+		default:
+			from += uint64(skip)
+		}
+		skip = 0
+	}
+
+	next, step := from, uint64(1)
+	if q.Descending {
+		next, step = to, ^uint64(0)
+	}
+
+	var scanned int
+	for ; next >= from && next <= to; next += step {
+		if scanned == MaxBlocksScanned {
+			if skip > 0 {
+				return nil, 0, ErrScanLimit
+			}
+			return blocks, next - step, nil
+		}
+		scanned++
+
+		block, err := s.db.GetBlock(next)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if !matchAccount(block, q.AccountID) {
+			continue
+		}
+
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		if q.Limit > 0 && len(blocks) == q.Limit {
+			return blocks, blocks[len(blocks)-1].Header.Number, nil
+		}
+
+		blocks = append(blocks, block)
+	}
+
+	return blocks, 0, nil
+}
+
+// searchBlocks performs a binary search for the lowest block number in the
+// range of from to to where fn returns true, and returns to+1 when there is
+// none. Fn must return false for every block before that number and true for
+// every block after.
+func (s *State) searchBlocks(from uint64, to uint64, fn func(database.Block) bool) (uint64, error) {
+	lo, hi := from, to+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		block, err := s.db.GetBlock(mid)
+		if err != nil {
+			return 0, err
+		}
 
+		switch {
+		case fn(block):
+			hi = mid
+		default:
+			lo = mid + 1
+		}
+	}
+
+	return lo, nil
+}
+
+// matchAccount identifies if the block has a transaction from or to the
+// account. Every block matches when no account is specified.
+func matchAccount(block database.Block, accountID database.AccountID) bool {
+	if accountID == "" {
+		return true
+	}
+
+	for _, tx := range block.MerkleTree.Values() {
+		if tx.FromID == accountID || tx.ToID == accountID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// QueryBlockByHash returns the block with the specified hash. This function
+// reads the blockchain from disk.
+func (s *State) QueryBlockByHash(hash string) (database.Block, error) {
 	iter := s.db.ForEach()
 	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
 		if err != nil {
-			return nil, err
+			return database.Block{}, err
+		}
+
+		if block.Hash() == hash {
+			return block, nil
+		}
+	}
+
+	return database.Block{}, ErrNotFound
+}
+
+// QueryTransaction returns the transaction with the specified hash and the
+// block that includes it. A transaction that is still in the mempool is
+// returned with an empty block. This function reads the blockchain from
+// disk when the transaction is not in the mempool.
+func (s *State) QueryTransaction(hash string) (database.BlockTx, database.Block, error) {
+	if txs := s.mempool.LookupHashes([]string{hash}); len(txs) == 1 {
+		return txs[0], database.Block{}, nil
+	}
+
+	iter := s.db.ForEach()
+	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
+		if err != nil {
+			return database.BlockTx{}, database.Block{}, err
 		}
 
 		for _, tx := range block.MerkleTree.Values() {
-			if accountID == "" || tx.FromID == accountID || tx.ToID == accountID {
-				out = append(out, block)
-				break
+			if tx.HashHex() == hash {
+				return tx, block, nil
 			}
 		}
 	}
 
-	return out, nil
+	return database.BlockTx{}, database.Block{}, ErrNotFound
 }
@@ -1,5 +1,11 @@
 package state
 
+import "sync"
+
+// reorgWindow is the number of the latest blocks remembered when the
+// blockchain is reset. They are used to find how deep the reorganization was.
+const reorgWindow = 1000
+
 // Reorganize corrects an identified fork. No mining is allowed to take place
 // while this process is running. New transactions can be placed into the mempool.
 func (s *State) Reorganize() error {
@@ -9,8 +15,19 @@ func (s *State) Reorganize() error {
 	// Don't allow mining to continue.
 	s.allowMining = false
 
+	latest := s.db.LatestBlock().Header.Number
+	s.publish(ReorgStarted{Number: latest})
+
+	// Remember the hashes of the latest blocks before they are gone. They
+	// are kept in memory so no blocks are read from disk under the lock.
+	hashes := s.recentHashes.snapshot()
+
 	// Reset the state of the blockchain node.
 	s.db.Reset()
+	s.recentHashes.reset()
+
+	// The blocks need to be accepted again from peers.
+	s.blockSeen.reset()
 
 	// Resync the state of the blockchain.
 	s.resyncWG.Add(1)
@@ -18,6 +35,7 @@ func (s *State) Reorganize() error {
 		s.evHandler("state: Resync: started: *****************************")
 		defer func() {
 			s.turnMiningOn()
+			s.publish(ReorgCompleted{Number: s.db.LatestBlock().Header.Number, Depth: s.reorgDepth(latest, hashes)})
 			s.evHandler("state: Resync: completed: *****************************")
 			s.resyncWG.Done()
 		}()
@@ -35,3 +53,71 @@ func (s *State) turnMiningOn() {
 
 	s.allowMining = true
 }
+
+// reorgDepth finds the latest block from before the reset that is still
+// part of the blockchain and returns the number of blocks after it. If no
+// block in the window is found, the size of the window is returned.
+func (s *State) reorgDepth(latest uint64, hashes map[uint64]string) uint64 {
+	current := s.recentHashes.snapshot()
+
+	for number := min(latest, s.db.LatestBlock().Header.Number); number > 0 && latest-number < reorgWindow; number-- {
+		if hash, exists := current[number]; exists && hash == hashes[number] {
+			return latest - number
+		}
+	}
+
+	return min(latest, reorgWindow)
+}
+
+// =============================================================================
+
+// hashWindow remembers the hashes of the latest blocks indexed by block
+// number. Blocks are added in order, so the oldest hash is dropped as each
+// new block is added once the window is full.
+type hashWindow struct {
+	mu     sync.Mutex
+	size   uint64
+	hashes map[uint64]string
+}
+
+// newHashWindow constructs a window that remembers the specified number of
+// the latest block hashes.
+func newHashWindow(size uint64) *hashWindow {
+	return &hashWindow{
+		size:   size,
+		hashes: make(map[uint64]string),
+	}
+}
+
+// add remembers the hash of the block and forgets the hash that is no
+// longer in the window.
+func (hw *hashWindow) add(number uint64, hash string) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	hw.hashes[number] = hash
+	if number > hw.size {
+		delete(hw.hashes, number-hw.size)
+	}
+}
+
+// snapshot returns a copy of the hashes in the window.
+func (hw *hashWindow) snapshot() map[uint64]string {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	hashes := make(map[uint64]string, len(hw.hashes))
+	for number, hash := range hw.hashes {
+		hashes[number] = hash
+	}
+
+	return hashes
+}
+
+// reset forgets all the hashes.
+func (hw *hashWindow) reset() {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	hw.hashes = make(map[uint64]string)
+}
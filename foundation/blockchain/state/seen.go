@@ -0,0 +1,181 @@
+package state
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+// seenCache maintains a bounded set of keys, like transaction hashes, that
+// have recently been processed. This is used to suppress duplicate work
+// when the same data is received from multiple peers.
+type seenCache struct {
+	mu    sync.Mutex
+	clock clock.Clock
+	ttl   time.Duration
+	max   int
+	keys  map[string]time.Time
+	order []seenKey
+}
+
+// seenKey records when a key was added for eviction purposes.
+type seenKey struct {
+	key   string
+	added time.Time
+}
+
+// newSeenCache constructs a cache that holds up to max keys for the
+// specified duration.
+func newSeenCache(max int, ttl time.Duration, clk clock.Clock) *seenCache {
+	return &seenCache{
+		clock: clk,
+		ttl:   ttl,
+		max:   max,
+		keys:  make(map[string]time.Time),
+	}
+}
+
+// add marks the key as seen. It returns false if the key has already
+// been seen and hasn't expired.
+func (sc *seenCache) add(key string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := sc.clock.Now()
+
+	if added, exists := sc.keys[key]; exists && now.Sub(added) < sc.ttl {
+		return false
+	}
+
+	// Evict the oldest keys once the cache is full. A key that was removed
+	// or added again since is left alone.
+	for len(sc.order) >= sc.max {
+		oldest := sc.order[0]
+		if added, exists := sc.keys[oldest.key]; exists && added.Equal(oldest.added) {
+			delete(sc.keys, oldest.key)
+		}
+		sc.order = sc.order[1:]
+	}
+
+	sc.keys[key] = now
+	sc.order = append(sc.order, seenKey{key: key, added: now})
+
+	return true
+}
+
+// contains checks if the key has been seen and hasn't expired.
+func (sc *seenCache) contains(key string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	added, exists := sc.keys[key]
+	return exists && sc.clock.Now().Sub(added) < sc.ttl
+}
+
+// addedAt returns when the key was added. The time is returned even after
+// the key has expired, until the key is evicted to make room.
+func (sc *seenCache) addedAt(key string) (time.Time, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	added, exists := sc.keys[key]
+	return added, exists
+}
+
+// remove forgets the key so it can be processed again.
+func (sc *seenCache) remove(key string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	delete(sc.keys, key)
+}
+
+// reset forgets all the keys.
+func (sc *seenCache) reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.keys = make(map[string]time.Time)
+	sc.order = nil
+}
+
+// =============================================================================
+
+// traceCache maintains a bounded set of transaction hashes and the span
+// that last handled each transaction on this node. This is what allows a
+// transaction to be followed from the wallet, through gossip and into a
+// block even though those steps happen in different requests.
+type traceCache struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	ttl    time.Duration
+	max    int
+	traces map[string]tracedTx
+	order  []seenKey
+}
+
+// tracedTx records the span for a transaction and when it was added.
+type tracedTx struct {
+	sc    trace.SpanContext
+	added time.Time
+}
+
+// newTraceCache constructs a cache that holds up to max transactions for
+// the specified duration.
+func newTraceCache(max int, ttl time.Duration, clk clock.Clock) *traceCache {
+	return &traceCache{
+		clock:  clk,
+		ttl:    ttl,
+		max:    max,
+		traces: make(map[string]tracedTx),
+	}
+}
+
+// set records the span for the transaction, replacing any previous span.
+// An invalid span context is ignored.
+func (tc *traceCache) set(hash string, sc trace.SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	now := tc.clock.Now()
+
+	// Evict the oldest transactions once the cache is full. A transaction
+	// that was removed or set again since is left alone.
+	for len(tc.order) >= tc.max {
+		oldest := tc.order[0]
+		if tt, exists := tc.traces[oldest.key]; exists && tt.added.Equal(oldest.added) {
+			delete(tc.traces, oldest.key)
+		}
+		tc.order = tc.order[1:]
+	}
+
+	tc.traces[hash] = tracedTx{sc: sc, added: now}
+	tc.order = append(tc.order, seenKey{key: hash, added: now})
+}
+
+// get returns the span for the transaction if it's known and hasn't expired.
+func (tc *traceCache) get(hash string) (trace.SpanContext, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tt, exists := tc.traces[hash]
+	if !exists || tc.clock.Now().Sub(tt.added) >= tc.ttl {
+		return trace.SpanContext{}, false
+	}
+
+	return tt.sc, true
+}
+
+// remove forgets the transaction.
+func (tc *traceCache) remove(hash string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	delete(tc.traces, hash)
+}
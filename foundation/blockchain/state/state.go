@@ -3,12 +3,26 @@
 package state
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
 	"sync"
+	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/mempool"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/events"
+	"github.com/ardanlabs/blockchain/foundation/trace"
 )
 
 /*
@@ -32,6 +46,20 @@ const (
 	ConsensusPOA = "POA"
 )
 
+// Settings for the cache of transaction hashes this node has already
+// received or requested from peers.
+const (
+	maxSeenTxs = 50_000
+	seenTxsTTL = 10 * time.Minute
+)
+
+// Settings for the cache of block hashes this node has already accepted.
+// This stops blocks from echoing back and forth between peers.
+const (
+	maxSeenBlocks = 1_000
+	seenBlocksTTL = time.Hour
+)
+
 // =============================================================================
 
 // EventHandler defines a function that is called when events
@@ -46,6 +74,7 @@ type Worker interface {
 	SignalStartMining()
 	SignalCancelMining()
 	SignalShareTx(blockTx database.BlockTx)
+	SignalShareBlock(block database.Block)
 }
 
 // =============================================================================
@@ -59,26 +88,52 @@ type Config struct {
 	Genesis        genesis.Genesis
 	SelectStrategy string
 	KnownPeers     *peer.PeerSet
+	PeerStore      *peer.Store
 	EvHandler      EventHandler
+	Events         *events.Events
+	Tracer         *trace.Tracer
 	Consensus      string
+	NodeVersion    string
+	IdentityKey    *ecdsa.PrivateKey
+	TLS            *tls.Config
+	Transport      Transport
+	P2PHost        string
+	Clock          clock.Clock
+	Rand           io.Reader
 }
 
 // State manages the blockchain database.
 type State struct {
-	mu          sync.RWMutex
-	resyncWG    sync.WaitGroup
-	allowMining bool
+	mu           sync.RWMutex
+	resyncWG     sync.WaitGroup
+	allowMining  bool
+	miningPaused bool
 
 	beneficiaryID database.AccountID
 	host          string
 	evHandler     EventHandler
+	events        *events.Events
+	tracer        *trace.Tracer
 	consensus     string
+	handshake     peer.Peer
+	transport     Transport
+	clock         clock.Clock
+	random        io.Reader
+
+	randMu sync.Mutex
+	rand   *mrand.Rand
 
 	knownPeers *peer.PeerSet
+	peerStore  *peer.Store
 	storage    database.Storage
 	genesis    genesis.Genesis
 	mempool    *mempool.Mempool
 	db         *database.Database
+	txSeen     *seenCache
+	blockSeen  *seenCache
+	txTraces   *traceCache
+
+	recentHashes *hashWindow
 
 	Worker Worker
 }
@@ -99,25 +154,103 @@ func New(cfg Config) (*State, error) {
 		return nil, err
 	}
 
+	// Remember the hashes of the latest blocks so the depth of a
+	// reorganization can be found without reading the blocks again.
+	recentHashes := newHashWindow(reorgWindow)
+	latest := db.LatestBlock().Header.Number
+	for number := latest; number > 0 && latest-number < reorgWindow; number-- {
+		block, err := db.GetBlock(number)
+		if err != nil {
+			return nil, err
+		}
+		recentHashes.add(number, block.Hash())
+	}
+
 	// Construct a mempool with the specified sort strategy.
 	mempool, err := mempool.NewWithStrategy(cfg.SelectStrategy)
 	if err != nil {
 		return nil, err
 	}
 
+	// Capture the information this node provides to peers on first contact.
+	handshake := peer.Peer{
+		Host:            cfg.Host,
+		ChainID:         cfg.Genesis.ChainID,
+		GenesisHash:     cfg.Genesis.Hash(),
+		NodeVersion:     cfg.NodeVersion,
+		ProtocolVersion: peer.ProtocolVersion,
+		Consensus:       cfg.Consensus,
+		P2PHost:         cfg.P2PHost,
+	}
+	if cfg.IdentityKey != nil {
+		publicKey, err := identity.PublicKeyHex(&cfg.IdentityKey.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("encoding identity public key: %w", err)
+		}
+		handshake.PublicKey = publicKey
+	}
+
+	// Without a transport, peers are reached through the private HTTP API.
+	transport := cfg.Transport
+	if transport == nil {
+		transport = NewHTTPTransport(cfg.IdentityKey, cfg.TLS)
+	}
+
+	// CORE NOTE: Mining results depend on the time and on random numbers. A
+	// simulation can provide its own clock and source of randomness so runs
+	// can be reproduced exactly. By default the system clock and crypto/rand
+	// are used.
+	clk := cfg.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+	random := cfg.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+
+	// Backoffs and bans for peers are timed using the node's clock. The peer
+	// store prunes with the same clock that stamps when peers were last seen.
+	if cfg.Clock != nil && cfg.KnownPeers != nil {
+		cfg.KnownPeers.SetClock(clk)
+	}
+	if cfg.Clock != nil && cfg.PeerStore != nil {
+		cfg.PeerStore.SetClock(clk)
+	}
+
+	// Seed the random numbers used for gossiping and retries from the source
+	// of randomness.
+	var seed [2]uint64
+	if err := binary.Read(random, binary.LittleEndian, &seed); err != nil {
+		return nil, fmt.Errorf("seeding random source: %w", err)
+	}
+
 	// Create the State to provide support for managing the blockchain.
 	state := State{
 		beneficiaryID: cfg.BeneficiaryID,
 		host:          cfg.Host,
 		storage:       cfg.Storage,
 		evHandler:     ev,
+		events:        cfg.Events,
+		tracer:        cfg.Tracer,
 		consensus:     cfg.Consensus,
+		handshake:     handshake,
+		transport:     transport,
+		clock:         clk,
+		random:        random,
+		rand:          mrand.New(mrand.NewPCG(seed[0], seed[1])),
 		allowMining:   true,
 
 		knownPeers: cfg.KnownPeers,
+		peerStore:  cfg.PeerStore,
 		genesis:    cfg.Genesis,
 		mempool:    mempool,
 		db:         db,
+		txSeen:     newSeenCache(maxSeenTxs, seenTxsTTL, clk),
+		blockSeen:  newSeenCache(maxSeenBlocks, seenBlocksTTL, clk),
+		txTraces:   newTraceCache(maxSeenTxs, seenTxsTTL, clk),
+
+		recentHashes: recentHashes,
 	}
 
 	// The Worker is not set here. The call to worker.Run will assign itself
@@ -142,18 +275,46 @@ func (s *State) Shutdown() error {
 	// Wait for any resync to finish.
 	s.resyncWG.Wait()
 
+	// Save the address book so the node can reconnect on restart.
+	if err := s.SavePeers(); err != nil {
+		s.evHandler("state: shutdown: savePeers: ERROR: %s", err)
+	}
+
 	return nil
 }
 
 // =============================================================================
 
 // IsMiningAllowed identifies if we are allowed to mine blocks. This
-// might be turned off if the blockchain needs to be re-synced.
+// might be turned off if the blockchain needs to be re-synced or if an
+// operator paused mining.
 func (s *State) IsMiningAllowed() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.allowMining
+	return s.allowMining && !s.miningPaused
+}
+
+// IsSyncing identifies if the blockchain is being resynced from peers after
+// a reorganization.
+func (s *State) IsSyncing() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return !s.allowMining
+}
+
+// CheckStorage reports if the storage is able to write blocks.
+func (s *State) CheckStorage() error {
+	return s.db.CheckStorage()
+}
+
+// Beneficiary returns the account that receives the mining rewards.
+func (s *State) Beneficiary() database.AccountID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.beneficiaryID
 }
 
 // Host returns a copy of host information.
@@ -161,11 +322,22 @@ func (s *State) Host() string {
 	return s.host
 }
 
+// Clock returns the clock used by this node.
+func (s *State) Clock() clock.Clock {
+	return s.clock
+}
+
 // Consensus returns a copy of consensus algorithm being used.
 func (s *State) Consensus() string {
 	return s.consensus
 }
 
+// Handshake returns a copy of the information this node provides
+// to peers on first contact.
+func (s *State) Handshake() peer.Peer {
+	return s.handshake
+}
+
 // Genesis returns a copy of the genesis information.
 func (s *State) Genesis() genesis.Genesis {
 	return s.genesis
@@ -188,7 +360,32 @@ func (s *State) Mempool() []database.BlockTx {
 
 // UpsertMempool adds a new transaction to the mempool.
 func (s *State) UpsertMempool(tx database.BlockTx) error {
-	return s.mempool.Upsert(tx)
+	return s.upsertMempool(context.Background(), tx)
+}
+
+// upsertMempool adds a new transaction to the mempool as part of the
+// operation traced in the context.
+func (s *State) upsertMempool(ctx context.Context, tx database.BlockTx) error {
+	etx, replacing := s.mempool.Lookup(tx)
+
+	if err := s.mempool.Upsert(tx); err != nil {
+		return err
+	}
+
+	s.txSeen.add(tx.HashHex())
+
+	if replacing && etx.HashHex() != tx.HashHex() {
+		s.publishContext(ctx, TxEvicted{Tx: etx, Reason: EvictReplaced})
+	}
+	s.publishContext(ctx, TxAccepted{Tx: tx})
+
+	return nil
+}
+
+// MempoolByHashes returns the transactions in the mempool that match
+// the specified hashes.
+func (s *State) MempoolByHashes(hashes []string) []database.BlockTx {
+	return s.mempool.LookupHashes(hashes)
 }
 
 // Accounts returns a copy of the database accounts.
@@ -198,14 +395,88 @@ func (s *State) Accounts() map[database.AccountID]database.Account {
 
 // AddKnownPeer provides the ability to add a new peer to
 // the known peer list.
-func (s *State) AddKnownPeer(peer peer.Peer) bool {
-	return s.knownPeers.Add(peer)
+func (s *State) AddKnownPeer(pr peer.Peer) bool {
+	if !s.knownPeers.Add(pr) {
+		return false
+	}
+
+	s.publish(PeerAdded{Peer: pr})
+
+	return true
+}
+
+// AcceptPeerHandshake validates the handshake information provided by a peer
+// on first contact. If the peer is compatible with this node, it's added to
+// the known peer list.
+func (s *State) AcceptPeerHandshake(pr peer.Peer) error {
+	if s.knownPeers.IsBanned(pr.Host) {
+		return errors.New("handshake rejected: peer is banned")
+	}
+
+	if err := s.handshake.Compatible(pr); err != nil {
+		return fmt.Errorf("handshake rejected: %w", err)
+	}
+
+	added, err := s.knownPeers.AddHandshake(pr)
+	if err != nil {
+		return fmt.Errorf("handshake rejected: %w", err)
+	}
+
+	if added {
+		s.publish(PeerAdded{Peer: pr})
+	}
+
+	return nil
+}
+
+// IsPeerKey identifies if the specified identity public key belongs to
+// a known peer.
+func (s *State) IsPeerKey(publicKey string) bool {
+	return s.knownPeers.HasPublicKey(publicKey)
+}
+
+// peerByKey returns the known peer that completed a handshake with the
+// specified identity public key.
+func (s *State) peerByKey(publicKey string) (peer.Peer, error) {
+	pr, exists := s.knownPeers.ByPublicKey(publicKey)
+	if !exists {
+		return peer.Peer{}, identity.ErrUnknownIdentity
+	}
+
+	return pr, nil
+}
+
+// KnownPeer returns the information for the specified peer if the
+// peer is in the known peer list.
+func (s *State) KnownPeer(host string) (peer.Peer, bool) {
+	return s.knownPeers.Get(host)
+}
+
+// SavePeers writes the known peers that completed a handshake to the peer
+// store. If no peer store is configured, nothing is saved.
+func (s *State) SavePeers() error {
+	if s.peerStore == nil {
+		return nil
+	}
+
+	return s.peerStore.Save(s.knownPeers.Records(s.host))
+}
+
+// PrunePeerScores removes the scores for the peers that are no longer known
+// and are not banned or in backoff.
+func (s *State) PrunePeerScores() {
+	s.knownPeers.PruneScores()
 }
 
 // RemoveKnownPeer provides the ability to remove a peer from
 // the known peer list.
-func (s *State) RemoveKnownPeer(peer peer.Peer) {
-	s.knownPeers.Remove(peer)
+func (s *State) RemoveKnownPeer(pr peer.Peer) {
+	if _, exists := s.knownPeers.Get(pr.Host); !exists {
+		return
+	}
+
+	s.knownPeers.Remove(pr)
+	s.publish(PeerRemoved{Peer: pr})
 }
 
 // KnownExternalPeers retrieves a copy of the known peer list without
@@ -219,3 +490,41 @@ func (s *State) KnownExternalPeers() []peer.Peer {
 func (s *State) KnownPeers() []peer.Peer {
 	return s.knownPeers.Copy("")
 }
+
+// SyncPeers retrieves the known peer list without including this node,
+// ordered from the best to the worst score. Peers that are banned or in
+// backoff are not included.
+func (s *State) SyncPeers() []peer.Peer {
+	var peers []peer.Peer
+	for _, pr := range s.knownPeers.SortByScore(s.KnownExternalPeers()) {
+		if s.knownPeers.CanAttempt(pr.Host) {
+			peers = append(peers, pr)
+		}
+	}
+
+	return peers
+}
+
+// CanContactPeer identifies if the peer can be contacted. A peer that is
+// banned or in backoff after failed network calls can't be contacted.
+func (s *State) CanContactPeer(host string) bool {
+	return s.knownPeers.CanAttempt(host)
+}
+
+// ReachablePeers returns the number of known peers, not including this node,
+// that answered a call within the last minute.
+func (s *State) ReachablePeers() int {
+	return s.knownPeers.Reachable(s.host)
+}
+
+// BestPeerHeight returns the highest latest block number reported by the
+// known peers. A peer's height is lowered to the blocks it provided when this
+// node syncs from it.
+func (s *State) BestPeerHeight() uint64 {
+	return s.knownPeers.BestHeight()
+}
+
+// PeerScores returns a copy of the scores tracking the behavior of peers.
+func (s *State) PeerScores() []peer.Score {
+	return s.knownPeers.Scores()
+}
@@ -3,14 +3,19 @@ package state_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ardanlabs/blockchain/foundation/events"
+	"github.com/ardanlabs/blockchain/foundation/trace"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -56,7 +61,7 @@ func Test_MineAndSyncBlock(t *testing.T) {
 	}
 
 	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
-	if err := node1.UpsertWalletTransaction(signedTx); err != nil {
+	if err := node1.UpsertWalletTransaction(context.Background(), signedTx); err != nil {
 		t.Fatalf("Error upserting wallet transaction: %v", err)
 	}
 
@@ -65,14 +70,562 @@ func Test_MineAndSyncBlock(t *testing.T) {
 		t.Fatalf("Error mining new block: %v", err)
 	}
 
-	err = node2.ProcessProposedBlock(blk)
+	err = node2.ProcessProposedBlock(context.Background(), blk)
 	if err != nil {
 		t.Fatalf("Error proposing new block: %v", err)
 	}
+
+	err = node2.ProcessProposedBlock(context.Background(), blk)
+	if !errors.Is(err, state.ErrBlockSeen) {
+		t.Fatalf("Error proposing the same block again: should have received ErrBlockSeen, got %v", err)
+	}
+}
+
+// Test_QueryTransaction validates blocks and transactions can be found by
+// hash in both the mempool and the blockchain.
+func Test_QueryTransaction(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node.UpsertWalletTransaction(context.Background(), newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+	hash := node.Mempool()[0].HashHex()
+
+	if _, block, err := node.QueryTransaction(hash); err != nil || block.Header.Number != 0 {
+		t.Fatalf("Should find the transaction in the mempool without a block, got block %d: %v", block.Header.Number, err)
+	}
+
+	blk, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	btx, block, err := node.QueryTransaction(hash)
+	if err != nil {
+		t.Fatalf("Should find the transaction in the blockchain: %v", err)
+	}
+	if btx.HashHex() != hash || block.Hash() != blk.Hash() {
+		t.Fatalf("Should return the transaction and the block holding it.")
+	}
+
+	if found, err := node.QueryBlockByHash(blk.Hash()); err != nil || found.Header.Number != blk.Header.Number {
+		t.Fatalf("Should find the block by hash: %v", err)
+	}
+
+	if _, err := node.QueryBlockByHash("0x00"); !errors.Is(err, state.ErrNotFound) {
+		t.Fatalf("Should return ErrNotFound for an unknown block, got %v", err)
+	}
+
+	if _, _, err := node.QueryTransaction("0x00"); !errors.Is(err, state.ErrNotFound) {
+		t.Fatalf("Should return ErrNotFound for an unknown transaction, got %v", err)
+	}
+}
+
+// Test_Events validates the events published when transactions are
+// accepted, replaced and mined into a block.
+func Test_Events(t *testing.T) {
+	evts := events.New()
+	defer evts.Shutdown()
+
+	sub, err := evts.Subscribe("test", 100, state.TopicTxs, state.TopicBlocks, state.TopicMining)
+	if err != nil {
+		t.Fatalf("Error subscribing to events: %v", err)
+	}
+
+	node := newNodeWithEvents(miner1PrivateKey, evts, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+		Tip:     10,
+	}
+	if err := node.UpsertWalletTransaction(context.Background(), newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	tx.Tip = 20
+	if err := node.UpsertWalletTransaction(context.Background(), newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting replacement transaction: %v", err)
+	}
+
+	blk, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	exp := []string{"TxAccepted", "TxEvicted", "TxAccepted", "MiningStarted", "BlockAdded", "MiningCompleted"}
+	for i, typ := range exp {
+		var msg events.Message
+		select {
+		case msg = <-sub.C():
+		default:
+			t.Fatalf("Should receive event %d %q.", i, typ)
+		}
+
+		if msg.Type != typ {
+			t.Fatalf("Should receive event %d as %q, got %q.", i, typ, msg.Type)
+		}
+
+		switch ev := msg.Data.(type) {
+		case state.TxEvicted:
+			if ev.Reason != state.EvictReplaced || ev.Tx.Tip != 10 {
+				t.Fatalf("Should evict the original transaction as replaced, got %s tip %d.", ev.Reason, ev.Tx.Tip)
+			}
+		case state.BlockAdded:
+			if ev.Block.Hash != blk.Hash() {
+				t.Fatalf("Should publish the mined block, got %s.", ev.Block.Hash)
+			}
+		case state.MiningCompleted:
+			if ev.Number != blk.Header.Number || ev.Hash != blk.Hash() {
+				t.Fatalf("Should publish the mined block number and hash, got %d %s.", ev.Number, ev.Hash)
+			}
+		}
+	}
+
+	if sub.Dropped() != 0 {
+		t.Fatalf("Should not drop any events, got %d.", sub.Dropped())
+	}
+}
+
+// Test_Admin validates the actions an operator can take on a running node.
+func Test_Admin(t *testing.T) {
+	evts := events.New()
+	defer evts.Shutdown()
+
+	sub, err := evts.Subscribe("test", 100, state.TopicTxs, state.TopicPeers)
+	if err != nil {
+		t.Fatalf("Error subscribing to events: %v", err)
+	}
+
+	node := newNodeWithEvents(miner1PrivateKey, evts, t)
+
+	node.PauseMining(true)
+	if node.IsMiningAllowed() {
+		t.Fatalf("Should not allow mining while paused.")
+	}
+	node.PauseMining(false)
+	if !node.IsMiningAllowed() {
+		t.Fatalf("Should allow mining once resumed.")
+	}
+
+	if err := node.SetBeneficiary("bill"); err == nil {
+		t.Fatalf("Should reject an invalid beneficiary.")
+	}
+	if err := node.SetBeneficiary(miner2AccountID); err != nil {
+		t.Fatalf("Should be able to change the beneficiary: %v", err)
+	}
+
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   nonce,
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+			Tip:     10,
+		}
+		if err := node.UpsertWalletTransaction(context.Background(), newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+	}
+
+	var hash string
+	for _, tx := range node.Mempool() {
+		if tx.Nonce == 3 {
+			hash = tx.HashHex()
+		}
+	}
+
+	if _, err := node.EvictTx(hash); err != nil {
+		t.Fatalf("Should be able to evict the transaction: %v", err)
+	}
+	if _, err := node.EvictTx(hash); !errors.Is(err, state.ErrNotFound) {
+		t.Fatalf("Should not find an evicted transaction, got %v.", err)
+	}
+	if node.MempoolLength() != 2 {
+		t.Fatalf("Should have 2 transactions in the mempool, got %d.", node.MempoolLength())
+	}
+
+	blk, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+	if blk.Header.BeneficiaryID != miner2AccountID {
+		t.Fatalf("Should reward the new beneficiary, got %s.", blk.Header.BeneficiaryID)
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   3,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+		Tip:     10,
+	}
+	if err := node.UpsertWalletTransaction(context.Background(), newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+	if n := node.FlushMempool(); n != 1 || node.MempoolLength() != 0 {
+		t.Fatalf("Should flush the mempool, removed %d, left %d.", n, node.MempoolLength())
+	}
+
+	const host = "http://localhost:9081"
+	node.AddKnownPeer(peer.New(host))
+	node.BanPeer(host, time.Hour)
+	if _, exists := node.KnownPeer(host); exists {
+		t.Fatalf("Should remove a banned peer.")
+	}
+	if err := node.AcceptPeerHandshake(peer.Peer{Host: host}); err == nil {
+		t.Fatalf("Should reject the handshake of a banned peer.")
+	}
+	node.UnbanPeer(host)
+	if node.IsPeerBanned(host) {
+		t.Fatalf("Should lift the ban.")
+	}
+
+	const pinned = "http://localhost:9082"
+	hs := node.Handshake()
+	hs.Host = pinned
+	hs.PublicKey = "owner"
+	if err := node.AcceptPeerHandshake(hs); err != nil {
+		t.Fatalf("Should accept the first handshake for the host: %s", err)
+	}
+	hs.PublicKey = "intruder"
+	if err := node.AcceptPeerHandshake(hs); !errors.Is(err, peer.ErrKeyMismatch) {
+		t.Fatalf("Should reject a second key claiming the host, got %v.", err)
+	}
+	if node.IsPeerKey("intruder") || !node.IsPeerKey("owner") {
+		t.Fatalf("Should keep the host bound to the first key.")
+	}
+	if !node.UnpinPeer(pinned) {
+		t.Fatalf("Should unpin a known peer.")
+	}
+	if err := node.AcceptPeerHandshake(hs); err != nil || !node.IsPeerKey("intruder") {
+		t.Fatalf("Should bind the new key after the peer is unpinned: %v", err)
+	}
+
+	var evicted, banned int
+	for len(sub.C()) > 0 {
+		msg := <-sub.C()
+		switch ev := msg.Data.(type) {
+		case state.TxEvicted:
+			if ev.Reason != state.EvictAdmin {
+				t.Fatalf("Should evict transactions as admin, got %s.", ev.Reason)
+			}
+			evicted++
+		case state.PeerBanned:
+			banned++
+		}
+	}
+	if evicted != 2 || banned != 1 {
+		t.Fatalf("Should publish 2 evictions and 1 ban, got %d and %d.", evicted, banned)
+	}
+}
+
+// Test_QueryBlocks validates the filters and paging when querying blocks.
+func Test_QueryBlocks(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	txs := []struct {
+		tx  database.Tx
+		key string
+	}{
+		{database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100}, kennedyPrivateKey},
+		{database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: babaAccountID, Value: 1}, kennedyPrivateKey},
+		{database.Tx{ChainID: chainID, Nonce: 1, FromID: edAccountID, ToID: ceasarAccountID, Value: 1}, edPrivateKey},
+	}
+
+	for _, tx := range txs {
+		if err := node.UpsertWalletTransaction(context.Background(), newSignedTx(tx.tx, tx.key, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+	}
+
+	type table struct {
+		name  string
+		query state.BlockQuery
+		exp   []uint64
+		next  uint64
+	}
+
+	tt := []table{
+		{name: "all", query: state.BlockQuery{}, exp: []uint64{1, 2, 3}},
+		{name: "limit", query: state.BlockQuery{Limit: 2}, exp: []uint64{1, 2}, next: 2},
+		{name: "after", query: state.BlockQuery{Limit: 2, After: 2}, exp: []uint64{3}},
+		{name: "desc", query: state.BlockQuery{Limit: 2, Descending: true}, exp: []uint64{3, 2}, next: 2},
+		{name: "descAfter", query: state.BlockQuery{Limit: 2, Descending: true, After: 2}, exp: []uint64{1}},
+		{name: "offset", query: state.BlockQuery{Offset: 1}, exp: []uint64{2, 3}},
+		{name: "range", query: state.BlockQuery{From: 2, To: 2}, exp: []uint64{2}},
+		{name: "account", query: state.BlockQuery{AccountID: kennedyAccountID}, exp: []uint64{1, 2}},
+		{name: "accountLimit", query: state.BlockQuery{AccountID: edAccountID, Limit: 1, After: 1}, exp: []uint64{3}},
+		{name: "until", query: state.BlockQuery{Until: 1}, exp: nil},
+		{name: "since", query: state.BlockQuery{Since: 1}, exp: []uint64{1, 2, 3}},
+		{name: "descOffset", query: state.BlockQuery{Descending: true, Offset: 2}, exp: []uint64{1}},
+		{name: "offsetPast", query: state.BlockQuery{Offset: 3}, exp: nil},
+		{name: "accountOffset", query: state.BlockQuery{AccountID: edAccountID, Offset: 1}, exp: []uint64{3}},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			blocks, next, err := node.QueryBlocks(tst.query)
+			if err != nil {
+				t.Fatalf("Should be able to query blocks: %v", err)
+			}
+
+			var got []uint64
+			for _, block := range blocks {
+				got = append(got, block.Header.Number)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tst.exp) || next != tst.next {
+				t.Fatalf("Should get blocks %v next %d, got %v next %d.", tst.exp, tst.next, got, next)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+// Test_CompactBlock validates a compact block can be rebuilt by a peer using
+// its mempool and the prefilled transactions.
+func Test_CompactBlock(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNode(miner2PrivateKey, t)
+
+	for i := 1; i <= 2; i++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   uint64(i),
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+			Tip:     0,
+			Data:    nil,
+		}
+
+		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+		if err := node1.UpsertWalletTransaction(context.Background(), signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+	}
+
+	// Node2 only knows about the first transaction.
+	trans := node1.Mempool()
+	for _, tx := range trans {
+		if tx.Nonce == 1 {
+			if err := node2.UpsertNodeTransaction(context.Background(), tx); err != nil {
+				t.Fatalf("Error upserting node transaction: %v", err)
+			}
+		}
+	}
+
+	blk, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	// Prefill the transaction node2 doesn't have so no request is needed.
+	prefill := func(tx database.BlockTx) bool {
+		return tx.Nonce == 2
+	}
+
+	cb := peer.CompactBlock{
+		Block: database.NewCompactBlockData(blk, prefill),
+	}
+
+	if len(cb.Block.Prefilled) != 1 {
+		t.Fatalf("Error building compact block: got %d prefilled, exp 1", len(cb.Block.Prefilled))
+	}
+
+	// The sender is identified by its identity key, which node2 only knows
+	// once node1 has completed a handshake.
+	const node1Key = "node1"
+	if err := node2.ProcessCompactBlock(context.Background(), node1Key, cb); !errors.Is(err, identity.ErrUnknownIdentity) {
+		t.Fatalf("Should reject a compact block from an unknown identity, got %v.", err)
+	}
+
+	hs := node2.Handshake()
+	hs.Host = "http://localhost:9081"
+	hs.PublicKey = node1Key
+	if err := node2.AcceptPeerHandshake(hs); err != nil {
+		t.Fatalf("Error accepting handshake: %v", err)
+	}
+
+	if err := node2.ProcessCompactBlock(context.Background(), node1Key, cb); err != nil {
+		t.Fatalf("Error processing compact block: %v", err)
+	}
+
+	if node2.LatestBlock().Hash() != blk.Hash() {
+		t.Fatalf("Error processing compact block: latest block doesn't match")
+	}
 }
 
 // =============================================================================
 
+// Test_TraceTransaction validates a transaction can be followed from the
+// wallet to its inclusion in a block on the node that mined it and on a peer.
+func Test_TraceTransaction(t *testing.T) {
+	rec1 := trace.NewRecorder(100)
+	rec2 := trace.NewRecorder(100)
+	node1 := newTracedNode(miner1PrivateKey, trace.New("node1", rec1), t)
+	node2 := newTracedNode(miner2PrivateKey, trace.New("node2", rec2), t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	wallet := trace.New("wallet", trace.NewRecorder(10))
+	ctx, span := wallet.Start(context.Background(), "submit")
+	span.End()
+	traceID := span.SpanContext().TraceID.String()
+
+	if err := node1.UpsertWalletTransaction(ctx, newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	// Node2 receives the transaction as part of the same trace.
+	spans := rec1.Trace(traceID)
+	if len(spans) != 1 {
+		t.Fatalf("Should record the wallet transaction in the trace, got %d spans.", len(spans))
+	}
+	ctx = trace.ContextWithSpanContext(context.Background(), span.SpanContext())
+	if err := node2.UpsertNodeTransaction(ctx, node1.Mempool()[0]); err != nil {
+		t.Fatalf("Error upserting node transaction: %v", err)
+	}
+
+	blk, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if err := node2.ProcessProposedBlock(context.Background(), blk); err != nil {
+		t.Fatalf("Error processing proposed block: %v", err)
+	}
+
+	for i, rec := range []*trace.Recorder{rec1, rec2} {
+		var included bool
+		for _, sd := range rec.Trace(traceID) {
+			if sd.TraceID == traceID && sd.Name == "state.txIncluded" && sd.Attributes["block.hash"] == blk.Hash() {
+				included = true
+			}
+		}
+		if !included {
+			t.Fatalf("Should record the inclusion of the transaction in the trace on node%d.", i+1)
+		}
+	}
+
+	var mined bool
+	for _, sd := range rec1.Trace(traceID) {
+		if sd.Name == "state.MineNewBlock" {
+			mined = true
+		}
+	}
+	if !mined {
+		t.Fatalf("Should link the mined block to the trace of the transaction.")
+	}
+}
+
+// Test_ProposeBlockConcurrent validates the same block received from many
+// peers at the same time is only accepted once.
+func Test_ProposeBlockConcurrent(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+	if err := node1.UpsertWalletTransaction(context.Background(), newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	blk, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	evts := events.New()
+	defer evts.Shutdown()
+
+	sub, err := evts.Subscribe("test", 100, state.TopicBlocks)
+	if err != nil {
+		t.Fatalf("Error subscribing to events: %v", err)
+	}
+
+	// Hold the first block being written until every peer's copy has made
+	// it past the seen check done before the lock is taken.
+	const peers = 10
+	var checked sync.WaitGroup
+	checked.Add(peers)
+	var once sync.Once
+	ev := func(v string, args ...any) {
+		switch v {
+		case "state: ValidateProposedBlock: started: prevBlk[%s]: newBlk[%s]: numTrans[%d]":
+			checked.Done()
+		case "state: validateUpdateDatabase: write to disk":
+			once.Do(func() {
+				checked.Wait()
+				time.Sleep(10 * time.Millisecond)
+			})
+		}
+	}
+	node2 := newTestNode(miner2PrivateKey, evts, nil, ev, t)
+
+	errs := make(chan error, peers)
+
+	var wg sync.WaitGroup
+	for range peers {
+		wg.Go(func() {
+			errs <- node2.ProcessProposedBlock(context.Background(), blk)
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	var accepted int
+	for err := range errs {
+		switch {
+		case err == nil:
+			accepted++
+		case !errors.Is(err, state.ErrBlockSeen):
+			t.Fatalf("Should report the duplicates as seen, got %v.", err)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("Should accept the block once, got %d.", accepted)
+	}
+
+	var added int
+	for len(sub.C()) > 0 {
+		if _, ok := (<-sub.C()).Data.(state.BlockAdded); ok {
+			added++
+		}
+	}
+	if added != 1 {
+		t.Fatalf("Should publish the block once, got %d.", added)
+	}
+}
+
 // Test_ProposeBlockValidation is an umbrella, holding different
 // scenarios to validate proper handling of issues regarding block proposals.
 func Test_ProposeBlockValidation(t *testing.T) {
@@ -92,7 +645,7 @@ func Test_ProposeBlockValidation(t *testing.T) {
 		}
 
 		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
-		if err := node1.UpsertWalletTransaction(signedTx); err != nil {
+		if err := node1.UpsertWalletTransaction(context.Background(), signedTx); err != nil {
 			t.Fatalf("Error upserting wallet transaction: %v", err)
 		}
 
@@ -119,7 +672,7 @@ func proposeBlockErrChainRaised(blocks []database.Block) func(t *testing.T) {
 		for i, blk := range blocks[:blocksToHave-2] {
 			switch {
 			case i < 10:
-				if err := node2.ProcessProposedBlock(blk); err != nil {
+				if err := node2.ProcessProposedBlock(context.Background(), blk); err != nil {
 					t.Fatalf("Error proposing new block %d: %v", i, err)
 				}
 
@@ -127,10 +680,13 @@ func proposeBlockErrChainRaised(blocks []database.Block) func(t *testing.T) {
 				continue
 
 			case i == 12:
-				err := node2.ProcessProposedBlock(blk)
+				err := node2.ProcessProposedBlock(context.Background(), blk)
 				if !errors.Is(err, database.ErrChainForked) {
 					t.Fatal("Error handling missing blocks: should have received ErrChainForked")
 				}
+				if reason := database.ValidationReason(err); reason != database.ReasonForked {
+					t.Fatalf("Error handling missing blocks: should have received the forked reason, got %q", reason)
+				}
 			}
 		}
 	}
@@ -148,7 +704,7 @@ func proposeBlockOneMissingBlock(blocks []database.Block) func(t *testing.T) {
 		for i, blk := range blocks[:blocksToHave-2] {
 			switch {
 			case i < 10:
-				if err := node2.ProcessProposedBlock(blk); err != nil {
+				if err := node2.ProcessProposedBlock(context.Background(), blk); err != nil {
 					t.Fatalf("Error proposing new block %d: %v", i, err)
 				}
 
@@ -156,7 +712,7 @@ func proposeBlockOneMissingBlock(blocks []database.Block) func(t *testing.T) {
 				continue
 
 			case i == 11:
-				err := node2.ProcessProposedBlock(blk)
+				err := node2.ProcessProposedBlock(context.Background(), blk)
 				if err == nil {
 					t.Fatal("Error handling missing block: should have received error about block number")
 				}
@@ -182,6 +738,8 @@ func (n noopWorker) SignalCancelMining() {}
 
 func (n noopWorker) SignalShareTx(blockTx database.BlockTx) {}
 
+func (n noopWorker) SignalShareBlock(block database.Block) {}
+
 // =============================================================================
 
 // newGenesis will create a new Genesis.
@@ -219,10 +777,27 @@ func newSignedTx(tx database.Tx, hexKey string, t *testing.T) database.SignedTx
 
 // newNode will create an in memory miner.
 func newNode(hexKey string, t *testing.T) *state.State {
+	return newNodeWithEvents(hexKey, nil, t)
+}
+
+func newNodeWithEvents(hexKey string, evts *events.Events, t *testing.T) *state.State {
+	return newTestNode(hexKey, evts, nil, nil, t)
+}
+
+// newTracedNode will create an in memory miner that records its spans.
+func newTracedNode(hexKey string, tracer *trace.Tracer, t *testing.T) *state.State {
+	return newTestNode(hexKey, nil, tracer, nil, t)
+}
+
+func newTestNode(hexKey string, evts *events.Events, tracer *trace.Tracer, ev state.EventHandler, t *testing.T) *state.State {
 	if hexKey == "" {
 		t.Fatalf("Error with hexKey being empty.")
 	}
 
+	if ev == nil {
+		ev = func(v string, args ...any) {}
+	}
+
 	privateKey, err := crypto.HexToECDSA(hexKey)
 	if err != nil {
 		t.Fatalf("Error constructing private key: %v", err)
@@ -240,7 +815,9 @@ func newNode(hexKey string, t *testing.T) *state.State {
 		Storage:        storage,
 		SelectStrategy: "Tip",
 		KnownPeers:     peer.NewPeerSet(),
-		EvHandler:      func(v string, args ...any) {},
+		EvHandler:      ev,
+		Events:         evts,
+		Tracer:         tracer,
 	})
 	if err != nil {
 		t.Fatalf("Error constructing node state: %v", err)
@@ -1,11 +1,26 @@
 package state
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/trace"
 )
 
+// maxTxRequestBatch represents the max number of transactions that are
+// requested from a peer in a single call.
+const maxTxRequestBatch = 100
+
 // UpsertWalletTransaction accepts a transaction from a wallet for inclusion.
-func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
+// The transaction is traced from here until it's included in a block.
+func (s *State) UpsertWalletTransaction(ctx context.Context, signedTx database.SignedTx) (err error) {
+	ctx, span := s.tracer.Start(ctx, "state.UpsertWalletTransaction", trace.Attr("tx.from", string(signedTx.FromID)), trace.Attr("tx.nonce", signedTx.Nonce))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
 	// CORE NOTE: It's up to the wallet to make sure the account has a proper
 	// balance and this transaction has a proper nonce. Fees will be taken if
@@ -19,10 +34,13 @@ func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
 	}
 
 	const oneUnitOfGas = 1
-	tx := database.NewBlockTx(signedTx, s.genesis.GasPrice, oneUnitOfGas)
-	if err := s.mempool.Upsert(tx); err != nil {
+	tx := database.NewBlockTxAt(signedTx, s.genesis.GasPrice, oneUnitOfGas, s.clock.Now())
+	span.SetAttributes(trace.Attr("tx.hash", tx.HashHex()))
+
+	if err := s.upsertMempool(ctx, tx); err != nil {
 		return err
 	}
+	s.txTraces.set(tx.HashHex(), span.SpanContext())
 
 	s.Worker.SignalShareTx(tx)
 	s.Worker.SignalStartMining()
@@ -31,7 +49,12 @@ func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
 }
 
 // UpsertNodeTransaction accepts a transaction from a node for inclusion.
-func (s *State) UpsertNodeTransaction(tx database.BlockTx) error {
+func (s *State) UpsertNodeTransaction(ctx context.Context, tx database.BlockTx) (err error) {
+	ctx, span := s.tracer.Start(ctx, "state.UpsertNodeTransaction", trace.Attr("tx.hash", tx.HashHex()))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
 	// Check the signed transaction has a proper signature, the from matches the
 	// signature, and the from and to fields are properly formatted.
@@ -39,11 +62,128 @@ func (s *State) UpsertNodeTransaction(tx database.BlockTx) error {
 		return err
 	}
 
-	if err := s.mempool.Upsert(tx); err != nil {
+	if err := s.upsertMempool(ctx, tx); err != nil {
 		return err
 	}
+	s.txTraces.set(tx.HashHex(), span.SpanContext())
 
 	s.Worker.SignalStartMining()
 
 	return nil
 }
+
+// ProcessTxAnnounce takes a set of transaction hashes announced by the peer
+// with the specified identity public key and requests the transactions this
+// node doesn't have yet. Transactions that are accepted are announced to this
+// node's peers in turn.
+func (s *State) ProcessTxAnnounce(ctx context.Context, publicKey string, ann peer.TxAnnounce) error {
+
+	// The peer is identified by the key that authenticated the request so a
+	// peer can't have another host asked for the transactions or blamed for
+	// the bad ones.
+	pr, err := s.peerByKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	s.evHandler("state: ProcessTxAnnounce: started: peer[%s]: hashes[%d]", pr, len(ann.Hashes))
+	defer s.evHandler("state: ProcessTxAnnounce: completed: peer[%s]", pr)
+
+	// Identify the transactions we have not seen or requested already. The
+	// seen cache makes sure only one peer is asked for a given transaction.
+	var missing []string
+	for _, hash := range ann.Hashes {
+		if s.mempool.Contains(hash) || !s.txSeen.add(hash) {
+			continue
+		}
+		missing = append(missing, hash)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// Request the missing transactions in batches.
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > maxTxRequestBatch {
+			batch = batch[:maxTxRequestBatch]
+		}
+		missing = missing[len(batch):]
+
+		trans, err := s.NetRequestPeerTxs(ctx, pr, batch)
+		if err != nil {
+
+			// Forget these hashes so they can be requested from
+			// another peer that announces them.
+			for _, hash := range append(batch, missing...) {
+				s.txSeen.remove(hash)
+			}
+			return fmt.Errorf("requesting transactions: %w", err)
+		}
+
+		requested := make(map[string]bool, len(batch))
+		for _, hash := range batch {
+			requested[hash] = true
+		}
+
+		for _, tx := range trans {
+			hash := tx.HashHex()
+			if !requested[hash] {
+				s.evHandler("state: ProcessTxAnnounce: WARNING: peer[%s]: unrequested tx[%s]", pr, tx)
+				continue
+			}
+			delete(requested, hash)
+
+			// A transaction with a bad signature means the peer is
+			// misbehaving since it should have validated it.
+			if err := tx.Validate(s.genesis.ChainID); err != nil {
+				s.recordInvalidTx(pr.Host, err)
+				continue
+			}
+
+			if err := s.acceptAnnouncedTx(ctx, pr, ann, tx); err != nil {
+				s.evHandler("state: ProcessTxAnnounce: WARNING: peer[%s]: tx[%s]: %s", pr, tx, err)
+				continue
+			}
+			s.Worker.SignalStartMining()
+
+			// Relay the transaction so it propagates through the network.
+			s.Worker.SignalShareTx(tx)
+		}
+
+		// The peer no longer has these transactions, allow them to be
+		// requested from somebody else.
+		for hash := range requested {
+			s.txSeen.remove(hash)
+		}
+	}
+
+	return nil
+}
+
+// acceptAnnouncedTx adds a transaction requested from a peer to the mempool.
+// The transaction continues the trace the peer provided for it so it can be
+// followed across nodes.
+func (s *State) acceptAnnouncedTx(ctx context.Context, pr peer.Peer, ann peer.TxAnnounce, tx database.BlockTx) error {
+	hash := tx.HashHex()
+
+	txCtx := ctx
+	if sc, err := trace.ParseTraceparent(ann.Traces[hash]); err == nil {
+		txCtx = trace.ContextWithSpanContext(ctx, sc)
+	}
+
+	txCtx, span := s.tracer.Start(txCtx, "state.acceptAnnouncedTx", trace.Attr("tx.hash", hash), trace.Attr("peer.host", pr.Host))
+	defer span.End()
+
+	// The request from the peer may be part of another trace.
+	span.AddLink(trace.SpanContextFromContext(ctx))
+
+	if err := s.upsertMempool(txCtx, tx); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	s.txTraces.set(hash, span.SpanContext())
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/identity"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+// Transport represents the network protocol used to talk to peers. A
+// transport returns an error wrapping peer.ErrRejected when the peer was
+// reached but didn't accept the request.
+type Transport interface {
+	Handshake(ctx context.Context, pr peer.Peer, hs peer.Peer) (peer.Peer, error)
+	Ping(ctx context.Context, pr peer.Peer) error
+	Status(ctx context.Context, pr peer.Peer) (peer.PeerStatus, error)
+	Mempool(ctx context.Context, pr peer.Peer) ([]database.BlockTx, error)
+	AnnounceTxs(ctx context.Context, pr peer.Peer, ann peer.TxAnnounce) error
+	RequestTxs(ctx context.Context, pr peer.Peer, req peer.TxRequest) ([]database.BlockTx, error)
+	AnnounceBlock(ctx context.Context, pr peer.Peer, cb peer.CompactBlock) error
+	RequestBlocks(ctx context.Context, pr peer.Peer, req peer.BlocksRequest) ([]database.BlockData, error)
+	RequestBlockTxs(ctx context.Context, pr peer.Peer, req peer.BlockTxRequest) ([]database.BlockTx, error)
+}
+
+// =============================================================================
+
+// baseURL represents the root of the private API on a peer.
+const baseURL = "%s://%s/v1/node"
+
+// clientTimeout is the longest any request can take. Callers are expected
+// to provide a context with a shorter deadline for each operation.
+const clientTimeout = time.Minute
+
+// maxPinnedClients represents the number of peers a pinned HTTP client is
+// kept for. Past the limit a client is dropped to make room for the new one.
+const maxPinnedClients = 1024
+
+// HTTPTransport talks to peers using the private HTTP API.
+type HTTPTransport struct {
+	identityKey *ecdsa.PrivateKey
+	tls         *tls.Config
+	plain       *http.Client
+
+	mu      sync.Mutex
+	clients map[string]pinnedClient
+}
+
+// pinnedClient represents the HTTP client for a peer that only accepts the
+// certificate for the public key.
+type pinnedClient struct {
+	publicKey string
+	client    *http.Client
+}
+
+// NewHTTPTransport constructs a transport for the private HTTP API. If an
+// identity key is provided, requests are signed. If a TLS configuration is
+// provided, requests are made over mutual TLS.
+func NewHTTPTransport(identityKey *ecdsa.PrivateKey, tlsConfig *tls.Config) *HTTPTransport {
+	return &HTTPTransport{
+		identityKey: identityKey,
+		tls:         tlsConfig,
+		plain:       &http.Client{Timeout: clientTimeout},
+		clients:     make(map[string]pinnedClient),
+	}
+}
+
+// Handshake exchanges handshake information with the peer.
+func (t *HTTPTransport) Handshake(ctx context.Context, pr peer.Peer, hs peer.Peer) (peer.Peer, error) {
+	var resp peer.Peer
+	err := t.send(ctx, pr, http.MethodPost, "/peers", hs, &resp)
+	return resp, err
+}
+
+// Ping checks the peer is responding.
+func (t *HTTPTransport) Ping(ctx context.Context, pr peer.Peer) error {
+	return t.send(ctx, pr, http.MethodGet, "/status", nil, nil)
+}
+
+// Status requests the current status of the peer.
+func (t *HTTPTransport) Status(ctx context.Context, pr peer.Peer) (peer.PeerStatus, error) {
+	var resp peer.PeerStatus
+	err := t.send(ctx, pr, http.MethodGet, "/status", nil, &resp)
+	return resp, err
+}
+
+// Mempool requests the transactions in the peer's mempool.
+func (t *HTTPTransport) Mempool(ctx context.Context, pr peer.Peer) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := t.send(ctx, pr, http.MethodGet, "/tx/list", nil, &resp)
+	return resp, err
+}
+
+// AnnounceTxs announces new transaction hashes to the peer.
+func (t *HTTPTransport) AnnounceTxs(ctx context.Context, pr peer.Peer, ann peer.TxAnnounce) error {
+	return t.send(ctx, pr, http.MethodPost, "/tx/announce", ann, nil)
+}
+
+// RequestTxs requests the transactions that match the hashes.
+func (t *HTTPTransport) RequestTxs(ctx context.Context, pr peer.Peer, req peer.TxRequest) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := t.send(ctx, pr, http.MethodPost, "/tx/request", req, &resp)
+	return resp, err
+}
+
+// AnnounceBlock sends a new block in the compact format to the peer.
+func (t *HTTPTransport) AnnounceBlock(ctx context.Context, pr peer.Peer, cb peer.CompactBlock) error {
+	var status struct {
+		Status string `json:"status"`
+	}
+	return t.send(ctx, pr, http.MethodPost, "/block/compact", cb, &status)
+}
+
+// RequestBlocks requests the blocks starting at the specified block number.
+func (t *HTTPTransport) RequestBlocks(ctx context.Context, pr peer.Peer, req peer.BlocksRequest) ([]database.BlockData, error) {
+	var resp []database.BlockData
+	err := t.send(ctx, pr, http.MethodGet, fmt.Sprintf("/block/list/%d/latest", req.From), nil, &resp)
+	return resp, err
+}
+
+// RequestBlockTxs requests the transactions of a block at the specified
+// positions. This is used to fill in a compact block.
+func (t *HTTPTransport) RequestBlockTxs(ctx context.Context, pr peer.Peer, req peer.BlockTxRequest) ([]database.BlockTx, error) {
+	var resp []database.BlockTx
+	err := t.send(ctx, pr, http.MethodPost, "/block/txs", req, &resp)
+	return resp, err
+}
+
+// send is a helper function to send an HTTP request to a node. If an identity
+// key is provided, the request is signed so the peer can authenticate it.
+func (t *HTTPTransport) send(ctx context.Context, pr peer.Peer, method string, path string, dataSend any, dataRecv any) error {
+	scheme := "http"
+	if t.tls != nil {
+		scheme = "https"
+	}
+	url := fmt.Sprintf(baseURL, scheme, pr.Host) + path
+
+	var data []byte
+	if dataSend != nil {
+		var err error
+		data, err = json.Marshal(dataSend)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	// Propagate the trace so the peer continues it.
+	trace.Inject(ctx, req.Header)
+
+	if t.identityKey != nil {
+		if err := identity.SignRequest(req, t.identityKey, data); err != nil {
+			return err
+		}
+	}
+
+	resp, err := t.client(pr).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		msg, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: status[%d]: %s", peer.ErrRejected, resp.StatusCode, msg)
+	}
+
+	if dataRecv != nil {
+		if err := json.NewDecoder(resp.Body).Decode(dataRecv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// client returns the HTTP client used to talk to the specified peer. With
+// TLS enabled, the client only accepts the certificate for the identity key
+// the peer provided in its handshake. On first contact the key is not known
+// yet and the certificate is trusted, like SSH does with a new host.
+func (t *HTTPTransport) client(pr peer.Peer) *http.Client {
+	if t.tls == nil {
+		return t.plain
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pc, exists := t.clients[pr.Host]
+	if exists && pc.publicKey == pr.PublicKey {
+		return pc.client
+	}
+
+	// A client is kept for each host, so the client pinned to a key the peer
+	// no longer uses is replaced. Once the limit is reached, a client for
+	// some other host is dropped.
+	switch {
+	case exists:
+		pc.client.CloseIdleConnections()
+
+	case len(t.clients) >= maxPinnedClients:
+		for host, pc := range t.clients {
+			pc.client.CloseIdleConnections()
+			delete(t.clients, host)
+			break
+		}
+	}
+
+	client := http.Client{
+		Timeout: clientTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: identity.PinPublicKey(t.tls, pr.PublicKey),
+		},
+	}
+	t.clients[pr.Host] = pinnedClient{publicKey: pr.PublicKey, client: &client}
+
+	return &client
+}
+
+// =============================================================================
+
+// FallbackTransport uses the primary transport to talk to peers and falls
+// back to the secondary transport when the primary can't reach the peer.
+type FallbackTransport struct {
+	primary   Transport
+	secondary Transport
+}
+
+// NewFallbackTransport constructs a transport that prefers the primary
+// transport.
+func NewFallbackTransport(primary Transport, secondary Transport) *FallbackTransport {
+	return &FallbackTransport{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// Handshake exchanges handshake information with the peer.
+func (t *FallbackTransport) Handshake(ctx context.Context, pr peer.Peer, hs peer.Peer) (peer.Peer, error) {
+	resp, err := t.primary.Handshake(ctx, pr, hs)
+	if useFallback(ctx, err) {
+		return t.secondary.Handshake(ctx, pr, hs)
+	}
+	return resp, err
+}
+
+// Ping checks the peer is responding.
+func (t *FallbackTransport) Ping(ctx context.Context, pr peer.Peer) error {
+	err := t.primary.Ping(ctx, pr)
+	if useFallback(ctx, err) {
+		return t.secondary.Ping(ctx, pr)
+	}
+	return err
+}
+
+// Status requests the current status of the peer.
+func (t *FallbackTransport) Status(ctx context.Context, pr peer.Peer) (peer.PeerStatus, error) {
+	resp, err := t.primary.Status(ctx, pr)
+	if useFallback(ctx, err) {
+		return t.secondary.Status(ctx, pr)
+	}
+	return resp, err
+}
+
+// Mempool requests the transactions in the peer's mempool.
+func (t *FallbackTransport) Mempool(ctx context.Context, pr peer.Peer) ([]database.BlockTx, error) {
+	resp, err := t.primary.Mempool(ctx, pr)
+	if useFallback(ctx, err) {
+		return t.secondary.Mempool(ctx, pr)
+	}
+	return resp, err
+}
+
+// AnnounceTxs announces new transaction hashes to the peer.
+func (t *FallbackTransport) AnnounceTxs(ctx context.Context, pr peer.Peer, ann peer.TxAnnounce) error {
+	err := t.primary.AnnounceTxs(ctx, pr, ann)
+	if useFallback(ctx, err) {
+		return t.secondary.AnnounceTxs(ctx, pr, ann)
+	}
+	return err
+}
+
+// RequestTxs requests the transactions that match the hashes.
+func (t *FallbackTransport) RequestTxs(ctx context.Context, pr peer.Peer, req peer.TxRequest) ([]database.BlockTx, error) {
+	resp, err := t.primary.RequestTxs(ctx, pr, req)
+	if useFallback(ctx, err) {
+		return t.secondary.RequestTxs(ctx, pr, req)
+	}
+	return resp, err
+}
+
+// AnnounceBlock sends a new block in the compact format to the peer.
+func (t *FallbackTransport) AnnounceBlock(ctx context.Context, pr peer.Peer, cb peer.CompactBlock) error {
+	err := t.primary.AnnounceBlock(ctx, pr, cb)
+	if useFallback(ctx, err) {
+		return t.secondary.AnnounceBlock(ctx, pr, cb)
+	}
+	return err
+}
+
+// RequestBlocks requests the blocks starting at the specified block number.
+func (t *FallbackTransport) RequestBlocks(ctx context.Context, pr peer.Peer, req peer.BlocksRequest) ([]database.BlockData, error) {
+	resp, err := t.primary.RequestBlocks(ctx, pr, req)
+	if useFallback(ctx, err) {
+		return t.secondary.RequestBlocks(ctx, pr, req)
+	}
+	return resp, err
+}
+
+// RequestBlockTxs requests the transactions of a block at the specified
+// positions.
+func (t *FallbackTransport) RequestBlockTxs(ctx context.Context, pr peer.Peer, req peer.BlockTxRequest) ([]database.BlockTx, error) {
+	resp, err := t.primary.RequestBlockTxs(ctx, pr, req)
+	if useFallback(ctx, err) {
+		return t.secondary.RequestBlockTxs(ctx, pr, req)
+	}
+	return resp, err
+}
+
+// useFallback identifies if the error means the primary transport couldn't
+// reach the peer. A peer that rejected the request is not asked again and
+// nothing is tried once the context is done.
+func useFallback(ctx context.Context, err error) bool {
+	return err != nil && !errors.Is(err, peer.ErrRejected) && ctx.Err() == nil
+}
@@ -97,6 +97,29 @@ func (d *Disk) Reset() error {
 	return os.MkdirAll(d.dbPath, 0755)
 }
 
+// Check validates a file can be written to the blockchain folder. This
+// implements the database.Checker interface.
+func (d *Disk) Check() error {
+	f, err := os.CreateTemp(d.dbPath, ".check-*")
+	if err != nil {
+		return err
+	}
+
+	name := f.Name()
+	if _, err := f.Write([]byte("ok")); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return err
+	}
+
+	return os.Remove(name)
+}
+
 // getPath forms the path to the specified block.
 func (d *Disk) getPath(blockNum uint64) string {
 	name := strconv.FormatUint(blockNum, 10)
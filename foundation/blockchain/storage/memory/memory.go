@@ -49,12 +49,13 @@ func (m *Memory) GetBlock(num uint64) (database.BlockData, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	// Block numbers start at 1 so block N is stored at index N-1.
 	l := uint64(len(m.blocks))
-	if l == 0 || num >= l {
+	if num == 0 || num > l {
 		return database.BlockData{}, errors.New("block does not exist")
 	}
 
-	return m.blocks[num], nil
+	return m.blocks[num-1], nil
 }
 
 // ForEach returns an iterator to walk through all the blocks
@@ -89,13 +90,12 @@ func (mi *memoryIterator) Next() (database.BlockData, error) {
 		return database.BlockData{}, errors.New("end of chain")
 	}
 
+	mi.current++
 	blockData, err := mi.storage.GetBlock(mi.current)
 	if err != nil {
 		mi.eoc = true
 	}
 
-	mi.current++
-
 	return blockData, err
 }
 
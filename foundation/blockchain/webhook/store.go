@@ -0,0 +1,186 @@
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The names of the files and folders kept inside the webhook folder.
+const (
+	hooksFile      = "hooks.json"
+	queueFolder    = "queue"
+	deadLetterFile = "deadletter.log"
+)
+
+// store maintains the hooks, the queue of pending deliveries and the dead
+// letter log on disk. Every pending delivery is kept in its own file so a
+// delivery can be updated without rewriting the whole queue.
+type store struct {
+	dir string
+}
+
+// newStore constructs a store for the specified folder, creating the folder
+// if it doesn't exist.
+func newStore(dir string) (*store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, queueFolder), 0755); err != nil {
+		return nil, err
+	}
+
+	return &store{dir: dir}, nil
+}
+
+// loadHooks reads the hooks from disk. If the file doesn't exist yet, an
+// empty list is returned.
+func (st *store) loadHooks() ([]Hook, error) {
+	data, err := os.ReadFile(filepath.Join(st.dir, hooksFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var hooks []Hook
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// saveHooks writes the hooks to disk ordered by id.
+func (st *store) saveHooks(hooks map[string]Hook) error {
+	list := make([]Hook, 0, len(hooks))
+	for _, h := range hooks {
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(st.dir, hooksFile), data)
+}
+
+// loadQueue reads the pending deliveries from disk.
+func (st *store) loadQueue() ([]Delivery, error) {
+	entries, err := os.ReadDir(filepath.Join(st.dir, queueFolder))
+	if err != nil {
+		return nil, err
+	}
+
+	var dels []Delivery
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(st.dir, queueFolder, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var del Delivery
+		if err := json.Unmarshal(data, &del); err != nil {
+			return nil, err
+		}
+		dels = append(dels, del)
+	}
+
+	return dels, nil
+}
+
+// write saves the pending delivery to disk.
+func (st *store) write(del Delivery) error {
+	data, err := json.Marshal(del)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(st.queuePath(del.ID), data)
+}
+
+// remove deletes the pending delivery from disk.
+func (st *store) remove(id string) error {
+	err := os.Remove(st.queuePath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// deadLetter appends the delivery to the dead letter log and removes it from
+// the queue.
+func (st *store) deadLetter(del Delivery) error {
+	data, err := json.Marshal(del)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(st.dir, deadLetterFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return st.remove(del.ID)
+}
+
+// loadDeadLetters reads the deliveries from the dead letter log.
+func (st *store) loadDeadLetters() ([]Delivery, error) {
+	f, err := os.Open(filepath.Join(st.dir, deadLetterFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var dels []Delivery
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var del Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &del); err != nil {
+			return nil, err
+		}
+		dels = append(dels, del)
+	}
+
+	return dels, scanner.Err()
+}
+
+// queuePath returns the path of the file for the pending delivery.
+func (st *store) queuePath(id string) string {
+	return filepath.Join(st.dir, queueFolder, id+".json")
+}
+
+// writeFile replaces the file atomically so a crash during the write doesn't
+// leave a partial file behind.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
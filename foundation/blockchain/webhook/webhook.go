@@ -0,0 +1,735 @@
+// Package webhook delivers blockchain events to HTTP endpoints registered by
+// the node operator. Deliveries are kept in a durable queue on disk and are
+// retried with backoff until they succeed or are moved to a dead letter log.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/events"
+	"github.com/google/uuid"
+)
+
+// The set of events a webhook can be registered for.
+const (
+	EventBlockAdded       = "block.added"
+	EventTransferIncoming = "transfer.incoming"
+	EventTransferOutgoing = "transfer.outgoing"
+	EventReorgStarted     = "reorg.started"
+	EventReorgCompleted   = "reorg.completed"
+)
+
+// The set of headers sent with every delivery.
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Default settings for delivering payloads.
+const (
+	defaultMaxAttempts = 10
+	defaultBaseBackoff = time.Second
+	defaultMaxBackoff  = 10 * time.Minute
+	defaultTimeout     = 10 * time.Second
+	pollInterval       = time.Second
+)
+
+// ErrNotFound is returned when a webhook doesn't exist.
+var ErrNotFound = errors.New("webhook not found")
+
+// =============================================================================
+
+// Hook represents an endpoint that receives events. Transfer events are only
+// sent for the accounts being watched.
+type Hook struct {
+	ID       string               `json:"id"`
+	URL      string               `json:"url"`
+	Secret   string               `json:"secret"`
+	Events   []string             `json:"events"`
+	Accounts []database.AccountID `json:"accounts,omitempty"`
+}
+
+// Validate checks the hook is properly configured.
+func (h Hook) Validate() error {
+	if h.ID == "" {
+		return errors.New("id is required")
+	}
+
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", h.URL)
+	}
+
+	if h.Secret == "" {
+		return errors.New("secret is required")
+	}
+
+	if len(h.Events) == 0 {
+		return errors.New("at least one event is required")
+	}
+
+	for _, event := range h.Events {
+		switch event {
+		case EventBlockAdded, EventReorgStarted, EventReorgCompleted:
+		case EventTransferIncoming, EventTransferOutgoing:
+			if len(h.Accounts) == 0 {
+				return fmt.Errorf("event %q requires accounts to watch", event)
+			}
+		default:
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+
+	for _, account := range h.Accounts {
+		if !account.IsAccountID() {
+			return fmt.Errorf("invalid account %q", account)
+		}
+	}
+
+	return nil
+}
+
+// wants identifies if the hook is registered for the event.
+func (h Hook) wants(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watches identifies if the hook is watching the account.
+func (h Hook) watches(account database.AccountID) bool {
+	for _, a := range h.Accounts {
+		if a == account {
+			return true
+		}
+	}
+
+	return false
+}
+
+// =============================================================================
+
+// Payload represents the JSON document posted to a webhook.
+type Payload struct {
+	ID      string    `json:"id"`
+	Event   string    `json:"event"`
+	Created time.Time `json:"created"`
+	Data    any       `json:"data"`
+}
+
+// Block represents the data for a block.added event.
+type Block struct {
+	Number        uint64             `json:"number"`
+	Hash          string             `json:"hash"`
+	PrevBlockHash string             `json:"prev_block_hash"`
+	TimeStamp     uint64             `json:"timestamp"`
+	BeneficiaryID database.AccountID `json:"beneficiary"`
+	Txs           int                `json:"txs"`
+}
+
+// Transfer represents the data for a transfer event to or from a watched
+// account.
+type Transfer struct {
+	Account     database.AccountID `json:"account"`
+	BlockNumber uint64             `json:"block_number"`
+	BlockHash   string             `json:"block_hash"`
+	Tx          database.BlockTx   `json:"tx"`
+}
+
+// Reorg represents the data for the reorg events. Depth is the number of
+// blocks to roll back and is only set for the reorg.completed event.
+type Reorg struct {
+	Number uint64 `json:"number"`
+	Depth  uint64 `json:"depth,omitempty"`
+}
+
+// Delivery represents a payload that is waiting to be delivered to a hook
+// or that has been moved to the dead letter log.
+type Delivery struct {
+	ID          string          `json:"id"`
+	HookID      string          `json:"hook_id"`
+	Event       string          `json:"event"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+	FailedAt    *time.Time      `json:"failed_at,omitempty"`
+}
+
+// =============================================================================
+
+// Config represents the configuration required to deliver webhooks.
+type Config struct {
+	Dir         string
+	Events      *events.Events
+	Client      *http.Client
+	Clock       clock.Clock
+	EvHandler   state.EventHandler
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Dispatcher manages the registered hooks and the delivery of payloads.
+type Dispatcher struct {
+	store       *store
+	evts        *events.Events
+	client      *http.Client
+	clock       clock.Clock
+	evHandler   state.EventHandler
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+
+	mu      sync.Mutex
+	hooks   map[string]Hook
+	pending map[string]Delivery
+
+	inboxMu  sync.Mutex
+	inbox    []events.Message
+	received chan struct{}
+	stop     chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New constructs a dispatcher that loads the hooks and any pending deliveries
+// from the specified folder and starts delivering payloads for the events
+// published on the events bus.
+func New(cfg Config) (*Dispatcher, error) {
+	ev := func(v string, args ...any) {
+		if cfg.EvHandler != nil {
+			cfg.EvHandler(v, args...)
+		}
+	}
+
+	st, err := newStore(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks, err := st.loadHooks()
+	if err != nil {
+		return nil, fmt.Errorf("loading hooks: %w", err)
+	}
+
+	pending, err := st.loadQueue()
+	if err != nil {
+		return nil, fmt.Errorf("loading queue: %w", err)
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+
+	clk := cfg.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d := Dispatcher{
+		store:       st,
+		evts:        cfg.Events,
+		client:      client,
+		clock:       clk,
+		evHandler:   ev,
+		maxAttempts: orDefault(cfg.MaxAttempts, defaultMaxAttempts),
+		baseBackoff: orDefault(cfg.BaseBackoff, defaultBaseBackoff),
+		maxBackoff:  orDefault(cfg.MaxBackoff, defaultMaxBackoff),
+		hooks:       make(map[string]Hook),
+		pending:     make(map[string]Delivery),
+		received:    make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		wake:        make(chan struct{}, 1),
+	}
+
+	for _, h := range hooks {
+		if err := h.Validate(); err != nil {
+			cancel()
+			return nil, fmt.Errorf("hook %q: %w", h.ID, err)
+		}
+		d.hooks[h.ID] = h
+	}
+
+	for _, del := range pending {
+		d.pending[del.ID] = del
+	}
+
+	// CORE NOTE: The handler is called while the event is being published
+	// so no event is dropped. Events are published while the state holds its
+	// lock, so the handler only adds the event to the inbox. The intake
+	// goroutine turns the events into deliveries and writes them to disk,
+	// which keeps a slow disk from stalling the blockchain.
+	if d.evts != nil {
+		if _, err := d.evts.Handle("webhook", d.handle, state.TopicBlocks, state.TopicSync); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	ev("webhook: started: hooks[%d]: pending[%d]", len(d.hooks), len(d.pending))
+
+	d.wg.Add(2)
+	go func() {
+		defer d.wg.Done()
+		d.intake()
+	}()
+	go func() {
+		defer d.wg.Done()
+		d.run()
+	}()
+
+	return &d, nil
+}
+
+// Shutdown stops receiving events and waits for the delivery in progress to
+// finish. Events already received are written to disk and pending deliveries
+// remain on disk for the next start.
+func (d *Dispatcher) Shutdown() {
+	d.evHandler("webhook: shutdown: started")
+	defer d.evHandler("webhook: shutdown: completed")
+
+	if d.evts != nil {
+		d.evts.Unsubscribe("webhook")
+	}
+
+	close(d.stop)
+	d.cancel()
+	d.wg.Wait()
+}
+
+// Hooks returns a copy of the registered hooks ordered by id.
+func (d *Dispatcher) Hooks() []Hook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hooks := make([]Hook, 0, len(d.hooks))
+	for _, h := range d.hooks {
+		hooks = append(hooks, h)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+
+	return hooks
+}
+
+// AddHook registers a new hook or replaces the hook with the same id. The
+// set of hooks is saved to disk.
+func (d *Dispatcher) AddHook(h Hook) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.hooks[h.ID] = h
+
+	return d.store.saveHooks(d.hooks)
+}
+
+// RemoveHook removes the hook with the specified id. Deliveries still
+// pending for the hook are moved to the dead letter log.
+func (d *Dispatcher) RemoveHook(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.hooks[id]; !exists {
+		return ErrNotFound
+	}
+
+	delete(d.hooks, id)
+
+	if err := d.store.saveHooks(d.hooks); err != nil {
+		return err
+	}
+
+	failed := d.clock.Now().UTC()
+	for _, del := range d.pending {
+		if del.HookID != id {
+			continue
+		}
+
+		del.LastError = ErrNotFound.Error()
+		del.FailedAt = &failed
+
+		delete(d.pending, del.ID)
+		if err := d.store.deadLetter(del); err != nil {
+			d.evHandler("webhook: dead letter: id[%s]: ERROR: %s", del.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Pending returns a copy of the deliveries waiting to be delivered ordered
+// by the time of the next attempt.
+func (d *Dispatcher) Pending() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending := make([]Delivery, 0, len(d.pending))
+	for _, del := range d.pending {
+		pending = append(pending, del)
+	}
+	sortDeliveries(pending)
+
+	return pending
+}
+
+// DeadLetters returns the deliveries that failed too many times.
+func (d *Dispatcher) DeadLetters() ([]Delivery, error) {
+	return d.store.loadDeadLetters()
+}
+
+// =============================================================================
+
+// handle receives the blockchain events while they are being published. The
+// event is added to the inbox for the intake goroutine, so no disk I/O is
+// performed while the publisher may be holding a lock.
+func (d *Dispatcher) handle(msg events.Message) {
+	d.inboxMu.Lock()
+	d.inbox = append(d.inbox, msg)
+	d.inboxMu.Unlock()
+
+	select {
+	case d.received <- struct{}{}:
+	default:
+	}
+}
+
+// intake converts the events in the inbox into deliveries until the
+// dispatcher is shutdown. The events left in the inbox are converted before
+// returning so they survive a restart of the node.
+func (d *Dispatcher) intake() {
+	for {
+		select {
+		case <-d.received:
+			d.drainInbox()
+		case <-d.stop:
+			d.drainInbox()
+			return
+		}
+	}
+}
+
+// drainInbox converts every event in the inbox into deliveries.
+func (d *Dispatcher) drainInbox() {
+	for {
+		d.inboxMu.Lock()
+		inbox := d.inbox
+		d.inbox = nil
+		d.inboxMu.Unlock()
+
+		if len(inbox) == 0 {
+			return
+		}
+
+		for _, msg := range inbox {
+			d.convert(msg)
+		}
+	}
+}
+
+// convert converts the blockchain event into deliveries for the hooks that
+// are registered for it.
+func (d *Dispatcher) convert(msg events.Message) {
+	switch ev := msg.Data.(type) {
+	case state.BlockAdded:
+		bd := ev.Block
+
+		block := Block{
+			Number:        bd.Header.Number,
+			Hash:          bd.Hash,
+			PrevBlockHash: bd.Header.PrevBlockHash,
+			TimeStamp:     bd.Header.TimeStamp,
+			BeneficiaryID: bd.Header.BeneficiaryID,
+			Txs:           len(bd.Trans),
+		}
+		d.enqueue(EventBlockAdded, block, func(Hook) bool { return true })
+
+		for _, tx := range bd.Trans {
+			for _, dir := range []struct {
+				event   string
+				account database.AccountID
+			}{
+				{EventTransferIncoming, tx.ToID},
+				{EventTransferOutgoing, tx.FromID},
+			} {
+				transfer := Transfer{
+					Account:     dir.account,
+					BlockNumber: bd.Header.Number,
+					BlockHash:   bd.Hash,
+					Tx:          tx,
+				}
+				d.enqueue(dir.event, transfer, func(h Hook) bool { return h.watches(dir.account) })
+			}
+		}
+
+	case state.ReorgStarted:
+		d.enqueue(EventReorgStarted, Reorg{Number: ev.Number}, func(Hook) bool { return true })
+
+	case state.ReorgCompleted:
+		d.enqueue(EventReorgCompleted, Reorg{Number: ev.Number, Depth: ev.Depth}, func(Hook) bool { return true })
+	}
+}
+
+// enqueue creates a delivery of the event for every hook that is registered
+// for the event and matches the filter. The deliveries are written to disk.
+func (d *Dispatcher) enqueue(event string, data any, match func(Hook) bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now().UTC()
+
+	var queued bool
+	for _, h := range d.hooks {
+		if !h.wants(event) || !match(h) {
+			continue
+		}
+
+		payload := Payload{
+			ID:      uuid.NewString(),
+			Event:   event,
+			Created: now,
+			Data:    data,
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			d.evHandler("webhook: enqueue: hook[%s]: event[%s]: ERROR: %s", h.ID, event, err)
+			continue
+		}
+
+		del := Delivery{
+			ID:          payload.ID,
+			HookID:      h.ID,
+			Event:       event,
+			Body:        body,
+			NextAttempt: now,
+		}
+
+		if err := d.store.write(del); err != nil {
+			d.evHandler("webhook: enqueue: hook[%s]: event[%s]: ERROR: %s", h.ID, event, err)
+			continue
+		}
+
+		d.pending[del.ID] = del
+		queued = true
+	}
+
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run delivers the payloads that are due until the dispatcher is shutdown.
+func (d *Dispatcher) run() {
+	ticker := d.clock.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue()
+
+		select {
+		case <-d.wake:
+		case <-ticker.C():
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverDue attempts every delivery whose next attempt is due.
+func (d *Dispatcher) deliverDue() {
+	now := d.clock.Now()
+
+	d.mu.Lock()
+	var due []Delivery
+	for _, del := range d.pending {
+		if !del.NextAttempt.After(now) {
+			due = append(due, del)
+		}
+	}
+	d.mu.Unlock()
+
+	sortDeliveries(due)
+
+	for _, del := range due {
+		if d.ctx.Err() != nil {
+			return
+		}
+		d.attempt(del)
+	}
+}
+
+// attempt posts the payload to the hook and records the outcome.
+func (d *Dispatcher) attempt(del Delivery) {
+	d.mu.Lock()
+	h, exists := d.hooks[del.HookID]
+	d.mu.Unlock()
+
+	var err error
+	switch {
+	case !exists:
+		err = ErrNotFound
+		del.Attempts = d.maxAttempts
+	default:
+		err = d.post(h, del)
+		del.Attempts++
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// The hook was removed while the delivery was being attempted and the
+	// delivery has already been moved to the dead letter log.
+	if _, exists := d.pending[del.ID]; !exists {
+		return
+	}
+
+	if err == nil {
+		d.evHandler("webhook: delivered: hook[%s]: event[%s]: id[%s]: attempts[%d]", del.HookID, del.Event, del.ID, del.Attempts)
+		delete(d.pending, del.ID)
+		if err := d.store.remove(del.ID); err != nil {
+			d.evHandler("webhook: remove: id[%s]: ERROR: %s", del.ID, err)
+		}
+		return
+	}
+
+	// The node is shutting down, the delivery is attempted again on restart.
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	del.LastError = err.Error()
+
+	if del.Attempts >= d.maxAttempts {
+		d.evHandler("webhook: dead letter: hook[%s]: event[%s]: id[%s]: attempts[%d]: %s", del.HookID, del.Event, del.ID, del.Attempts, err)
+
+		failed := d.clock.Now().UTC()
+		del.FailedAt = &failed
+
+		delete(d.pending, del.ID)
+		if err := d.store.deadLetter(del); err != nil {
+			d.evHandler("webhook: dead letter: id[%s]: ERROR: %s", del.ID, err)
+		}
+		return
+	}
+
+	del.NextAttempt = d.clock.Now().Add(d.backoff(del.Attempts)).UTC()
+	d.evHandler("webhook: retry: hook[%s]: event[%s]: id[%s]: attempts[%d]: next[%s]: %s", del.HookID, del.Event, del.ID, del.Attempts, del.NextAttempt.Format(time.RFC3339), err)
+
+	d.pending[del.ID] = del
+	if err := d.store.write(del); err != nil {
+		d.evHandler("webhook: retry: id[%s]: ERROR: %s", del.ID, err)
+	}
+}
+
+// post sends the signed payload to the hook's endpoint. Any response other
+// than a 2xx is a failure.
+func (d *Dispatcher) post(h Hook, del Delivery) error {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, h.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		return err
+	}
+
+	ts := d.clock.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, del.ID)
+	req.Header.Set(HeaderEvent, del.Event)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(h.Secret, ts, del.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// backoff returns the time to wait before the next attempt. The wait doubles
+// with every attempt up to the maximum.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.baseBackoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+
+	return min(wait, d.maxBackoff)
+}
+
+// =============================================================================
+
+// Sign returns the signature for a payload. The signature is the hex encoded
+// HMAC-SHA256 of the timestamp and the body joined by a period, using the
+// hook's secret as the key.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature for a payload received by an endpoint.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// sortDeliveries orders the deliveries by the time of the next attempt.
+func sortDeliveries(dels []Delivery) {
+	sort.Slice(dels, func(i, j int) bool {
+		if dels[i].NextAttempt.Equal(dels[j].NextAttempt) {
+			return dels[i].ID < dels[j].ID
+		}
+		return dels[i].NextAttempt.Before(dels[j].NextAttempt)
+	})
+}
+
+// orDefault returns the value if it's set, otherwise the default.
+func orDefault[T int | time.Duration](v T, def T) T {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
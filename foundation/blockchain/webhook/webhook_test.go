@@ -0,0 +1,440 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
+	"github.com/ardanlabs/blockchain/foundation/events"
+)
+
+const (
+	secret   = "s3cr3t"
+	kennedy  = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+	ceasarID = database.AccountID("0xbEE6ACE826eC3DE1B6349888B9151B92522F7F76")
+)
+
+func Test_Delivery(t *testing.T) {
+	rec := newReceiver(t, 1)
+	defer rec.srv.Close()
+
+	evts := events.New()
+	clk := clock.NewManual(time.Now())
+
+	d, err := webhook.New(webhook.Config{
+		Dir:    t.TempDir(),
+		Events: evts,
+		Clock:  clk,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	hook := webhook.Hook{
+		ID:       "backoffice",
+		URL:      rec.srv.URL,
+		Secret:   secret,
+		Events:   []string{webhook.EventBlockAdded, webhook.EventTransferIncoming},
+		Accounts: []database.AccountID{ceasarID},
+	}
+	if err := d.AddHook(hook); err != nil {
+		t.Fatalf("Should be able to add the hook: %v", err)
+	}
+
+	evts.Publish(newBlockAdded())
+
+	// Every event fails on the first attempt.
+	waitFor(t, "first attempts", func() bool { return rec.count() == 2 })
+	waitFor(t, "retries scheduled", func() bool {
+		pending := d.Pending()
+		return len(pending) == 2 && pending[0].Attempts == 1 && pending[1].Attempts == 1
+	})
+
+	clk.Advance(time.Second)
+
+	waitFor(t, "deliveries", func() bool { return len(d.Pending()) == 0 })
+
+	events := rec.delivered()
+	if len(events) != 2 {
+		t.Fatalf("Should deliver both events, got %v.", events)
+	}
+
+	var transfer webhook.Transfer
+	if err := json.Unmarshal(rec.data(webhook.EventTransferIncoming), &transfer); err != nil {
+		t.Fatalf("Should decode the transfer: %v", err)
+	}
+	if transfer.Account != ceasarID || transfer.BlockNumber != 1 {
+		t.Fatalf("Should deliver the transfer for the watched account, got %+v.", transfer)
+	}
+}
+
+func Test_DeadLetter(t *testing.T) {
+	rec := newReceiver(t, 100)
+	defer rec.srv.Close()
+
+	evts := events.New()
+	clk := clock.NewManual(time.Now())
+
+	d, err := webhook.New(webhook.Config{
+		Dir:         t.TempDir(),
+		Events:      evts,
+		Clock:       clk,
+		MaxAttempts: 2,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	hook := webhook.Hook{
+		ID:     "backoffice",
+		URL:    rec.srv.URL,
+		Secret: secret,
+		Events: []string{webhook.EventReorgStarted},
+	}
+	if err := d.AddHook(hook); err != nil {
+		t.Fatalf("Should be able to add the hook: %v", err)
+	}
+
+	evts.Publish(state.ReorgStarted{Number: 10})
+
+	waitFor(t, "first attempt", func() bool { return rec.count() == 1 })
+	waitFor(t, "retry scheduled", func() bool { return len(d.Pending()) == 1 && d.Pending()[0].Attempts == 1 })
+
+	clk.Advance(time.Second)
+
+	waitFor(t, "dead letter", func() bool { return len(d.Pending()) == 0 })
+
+	dead, err := d.DeadLetters()
+	if err != nil {
+		t.Fatalf("Should be able to read the dead letters: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].Event != webhook.EventReorgStarted || dead[0].FailedAt == nil {
+		t.Fatalf("Should move the delivery to the dead letter log, got %+v.", dead)
+	}
+}
+
+func Test_RemoveHook(t *testing.T) {
+	rec := newReceiver(t, 100)
+	defer rec.srv.Close()
+
+	evts := events.New()
+	clk := clock.NewManual(time.Now())
+
+	d, err := webhook.New(webhook.Config{
+		Dir:    t.TempDir(),
+		Events: evts,
+		Clock:  clk,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	hook := webhook.Hook{
+		ID:     "backoffice",
+		URL:    rec.srv.URL,
+		Secret: secret,
+		Events: []string{webhook.EventReorgStarted},
+	}
+	if err := d.AddHook(hook); err != nil {
+		t.Fatalf("Should be able to add the hook: %v", err)
+	}
+
+	evts.Publish(state.ReorgStarted{Number: 10})
+	waitFor(t, "retry scheduled", func() bool { return len(d.Pending()) == 1 && d.Pending()[0].Attempts == 1 })
+
+	if err := d.RemoveHook(hook.ID); err != nil {
+		t.Fatalf("Should be able to remove the hook: %v", err)
+	}
+
+	if pending := d.Pending(); len(pending) != 0 {
+		t.Fatalf("Should not keep deliveries for a removed hook, got %+v.", pending)
+	}
+
+	dead, err := d.DeadLetters()
+	if err != nil {
+		t.Fatalf("Should be able to read the dead letters: %v", err)
+	}
+	if len(dead) != 1 || dead[0].HookID != hook.ID || dead[0].FailedAt == nil {
+		t.Fatalf("Should move the pending delivery to the dead letter log, got %+v.", dead)
+	}
+}
+
+func Test_ReorgDepth(t *testing.T) {
+	rec := newReceiver(t, 0)
+	defer rec.srv.Close()
+
+	evts := events.New()
+
+	d, err := webhook.New(webhook.Config{
+		Dir:    t.TempDir(),
+		Events: evts,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	hook := webhook.Hook{
+		ID:     "backoffice",
+		URL:    rec.srv.URL,
+		Secret: secret,
+		Events: []string{webhook.EventReorgCompleted},
+	}
+	if err := d.AddHook(hook); err != nil {
+		t.Fatalf("Should be able to add the hook: %v", err)
+	}
+
+	evts.Publish(state.ReorgCompleted{Number: 12, Depth: 3})
+
+	waitFor(t, "delivery", func() bool { return rec.data(webhook.EventReorgCompleted) != nil })
+
+	var reorg webhook.Reorg
+	if err := json.Unmarshal(rec.data(webhook.EventReorgCompleted), &reorg); err != nil {
+		t.Fatalf("Should decode the reorg: %v", err)
+	}
+	if reorg.Number != 12 || reorg.Depth != 3 {
+		t.Fatalf("Should deliver the depth of the reorganization, got %+v.", reorg)
+	}
+}
+
+func Test_Durable(t *testing.T) {
+	rec := newReceiver(t, 100)
+	defer rec.srv.Close()
+
+	dir := t.TempDir()
+	evts := events.New()
+	clk := clock.NewManual(time.Now())
+
+	d, err := webhook.New(webhook.Config{
+		Dir:    dir,
+		Events: evts,
+		Clock:  clk,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher: %v", err)
+	}
+
+	hook := webhook.Hook{
+		ID:     "backoffice",
+		URL:    rec.srv.URL,
+		Secret: secret,
+		Events: []string{webhook.EventBlockAdded},
+	}
+	if err := d.AddHook(hook); err != nil {
+		t.Fatalf("Should be able to add the hook: %v", err)
+	}
+
+	evts.Publish(newBlockAdded())
+	waitFor(t, "retry scheduled", func() bool { return len(d.Pending()) == 1 && d.Pending()[0].Attempts == 1 })
+
+	d.Shutdown()
+
+	// Events published after shutdown are not delivered.
+	evts.Publish(newBlockAdded())
+
+	d, err = webhook.New(webhook.Config{
+		Dir:    dir,
+		Events: evts,
+		Clock:  clk,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher again: %v", err)
+	}
+	defer d.Shutdown()
+
+	if hooks := d.Hooks(); len(hooks) != 1 || hooks[0].ID != hook.ID {
+		t.Fatalf("Should load the hooks from disk, got %+v.", hooks)
+	}
+
+	pending := d.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].Event != webhook.EventBlockAdded {
+		t.Fatalf("Should load the pending delivery from disk, got %+v.", pending)
+	}
+}
+
+func Test_Intake(t *testing.T) {
+	rec := newReceiver(t, 100)
+	defer rec.srv.Close()
+
+	dir := t.TempDir()
+	evts := events.New()
+	clk := clock.NewManual(time.Now())
+
+	d, err := webhook.New(webhook.Config{
+		Dir:    dir,
+		Events: evts,
+		Clock:  clk,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher: %v", err)
+	}
+
+	hook := webhook.Hook{
+		ID:     "backoffice",
+		URL:    rec.srv.URL,
+		Secret: secret,
+		Events: []string{webhook.EventBlockAdded},
+	}
+	if err := d.AddHook(hook); err != nil {
+		t.Fatalf("Should be able to add the hook: %v", err)
+	}
+
+	// Events received right before shutdown are still written to disk.
+	for range 5 {
+		evts.Publish(newBlockAdded())
+	}
+	d.Shutdown()
+
+	d, err = webhook.New(webhook.Config{
+		Dir:   dir,
+		Clock: clk,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the dispatcher again: %v", err)
+	}
+	defer d.Shutdown()
+
+	if pending := d.Pending(); len(pending) != 5 {
+		t.Fatalf("Should write every received event to disk, got %d deliveries.", len(pending))
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	tt := []struct {
+		name string
+		hook webhook.Hook
+	}{
+		{"id", webhook.Hook{URL: "http://localhost", Secret: secret, Events: []string{webhook.EventBlockAdded}}},
+		{"url", webhook.Hook{ID: "a", URL: "ftp://localhost", Secret: secret, Events: []string{webhook.EventBlockAdded}}},
+		{"secret", webhook.Hook{ID: "a", URL: "http://localhost", Events: []string{webhook.EventBlockAdded}}},
+		{"event", webhook.Hook{ID: "a", URL: "http://localhost", Secret: secret, Events: []string{"block.removed"}}},
+		{"accounts", webhook.Hook{ID: "a", URL: "http://localhost", Secret: secret, Events: []string{webhook.EventTransferOutgoing}}},
+		{"account", webhook.Hook{ID: "a", URL: "http://localhost", Secret: secret, Events: []string{webhook.EventTransferOutgoing}, Accounts: []database.AccountID{"bill"}}},
+	}
+
+	for _, tst := range tt {
+		if err := tst.hook.Validate(); err == nil {
+			t.Fatalf("Should reject a hook with an invalid %s.", tst.name)
+		}
+	}
+}
+
+// =============================================================================
+
+// receiver is an endpoint that verifies the signature of every delivery and
+// fails the first attempts for every event.
+type receiver struct {
+	t     *testing.T
+	srv   *httptest.Server
+	fail  int
+	mu    sync.Mutex
+	tries map[string]int
+	ok    map[string][]byte
+	total int
+}
+
+func newReceiver(t *testing.T, fail int) *receiver {
+	rec := receiver{
+		t:     t,
+		fail:  fail,
+		tries: make(map[string]int),
+		ok:    make(map[string][]byte),
+	}
+	rec.srv = httptest.NewServer(http.HandlerFunc(rec.handle))
+
+	return &rec
+}
+
+func (rec *receiver) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	ts, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+	if !webhook.Verify(secret, ts, body, r.Header.Get(webhook.HeaderSignature)) {
+		rec.t.Errorf("Should receive a valid signature for %s.", r.Header.Get(webhook.HeaderID))
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.total++
+
+	id := r.Header.Get(webhook.HeaderID)
+	rec.tries[id]++
+	if rec.tries[id] <= rec.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var payload struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(body, &payload)
+	rec.ok[payload.Event] = payload.Data
+}
+
+func (rec *receiver) count() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.total
+}
+
+func (rec *receiver) delivered() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var events []string
+	for event := range rec.ok {
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func (rec *receiver) data(event string) []byte {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.ok[event]
+}
+
+func newBlockAdded() state.BlockAdded {
+	tx := database.BlockTx{
+		SignedTx: database.SignedTx{
+			Tx: database.Tx{ChainID: 1, Nonce: 1, FromID: kennedy, ToID: ceasarID, Value: 100},
+		},
+	}
+
+	return state.BlockAdded{
+		Block: database.BlockData{
+			Hash:   "0x01",
+			Header: database.BlockHeader{Number: 1},
+			Trans:  []database.BlockTx{tx},
+		},
+	}
+}
+
+func waitFor(t *testing.T, what string, fn func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Should reach %s in time.", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
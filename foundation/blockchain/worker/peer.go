@@ -9,8 +9,13 @@ import (
 // main.go represent the origin node. That node must be running first.
 // All new peer nodes connect to the origin node to identify all other
 // peers on the network. The topology is all nodes having a connection
-// to all other nodes. If a node does not respond to a network call,
-// they are removed from the peer list until the next peer operation.
+// to all other nodes. On first contact, nodes perform a handshake to make
+// sure they are running the same chain. Each peer is scored on its behavior.
+// If a node does not respond to a network call, it's put into an exponential
+// backoff and removed after too many failures in a row. A peer that provides
+// invalid blocks or transactions is banned for a period of time. The known
+// peers are saved to an address book on disk so a restarted node can rejoin
+// the network without depending on the origin node.
 
 // peerOperations handles finding new peers.
 func (w *Worker) peerOperations() {
@@ -26,7 +31,7 @@ func (w *Worker) peerOperations() {
 
 	for {
 		select {
-		case <-w.ticker.C:
+		case <-w.ticker.C():
 			if !w.isShutdown() {
 				w.runPeersOperation()
 			}
@@ -44,14 +49,18 @@ func (w *Worker) runPeersOperation() {
 
 	for _, peer := range w.state.KnownExternalPeers() {
 
-		// Retrieve the status of this peer.
-		peerStatus, err := w.state.NetRequestPeerStatus(peer)
+		// Skip peers that are in backoff after failed network calls.
+		if !w.state.CanContactPeer(peer.Host) {
+			w.evHandler("worker: runPeersOperation: %s: in backoff", peer.Host)
+			continue
+		}
+
+		// Retrieve the status of this peer. The failure is recorded against
+		// the peer's score and the peer is put into backoff. The peer is only
+		// removed from the list after too many failures in a row.
+		peerStatus, err := w.state.NetRequestPeerStatus(w.ctx, peer)
 		if err != nil {
 			w.evHandler("worker: runPeersOperation: requestPeerStatus: %s: ERROR: %s", peer.Host, err)
-
-			// Since this peer is unavailable, remove them from the list.
-			w.state.RemoveKnownPeer(peer)
-
 			continue
 		}
 
@@ -60,7 +69,17 @@ func (w *Worker) runPeersOperation() {
 	}
 
 	// Share with peers this node is available to participate in the network.
-	w.state.NetSendNodeAvailableToPeers()
+	if err := w.state.NetSendNodeAvailableToPeers(w.ctx); err != nil {
+		w.evHandler("worker: runPeersOperation: sendNodeAvailable: WARNING: %s", err)
+	}
+
+	// Forget the scores of peers that are gone.
+	w.state.PrunePeerScores()
+
+	// Save the address book so the node can reconnect on restart.
+	if err := w.state.SavePeers(); err != nil {
+		w.evHandler("worker: runPeersOperation: savePeers: ERROR: %s", err)
+	}
 }
 
 // addNewPeers takes the list of known peers and makes sure they are included
@@ -76,10 +95,24 @@ func (w *Worker) addNewPeers(knownPeers []peer.Peer) error {
 			continue
 		}
 
-		// Only log when the peer is new.
-		if w.state.AddKnownPeer(peer) {
-			w.evHandler("worker: runPeerUpdatesOperation: addNewPeers: add peer nodes: adding peer-node %s", peer.Host)
+		// Nothing to do if we already know about this peer.
+		if _, exists := w.state.KnownPeer(peer.Host); exists {
+			continue
+		}
+
+		// Don't contact peers that are banned or in backoff.
+		if !w.state.CanContactPeer(peer.Host) {
+			continue
 		}
+
+		// Perform the handshake on first contact. The peer is only added
+		// if it's running the same chain as this node.
+		if _, err := w.state.NetHandshake(w.ctx, peer); err != nil {
+			w.evHandler("worker: runPeerUpdatesOperation: addNewPeers: handshake: %s: ERROR: %s", peer.Host, err)
+			continue
+		}
+
+		w.evHandler("worker: runPeerUpdatesOperation: addNewPeers: add peer nodes: adding peer-node %s", peer.Host)
 	}
 
 	return nil
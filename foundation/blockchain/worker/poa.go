@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 )
 
@@ -26,14 +27,17 @@ func (w *Worker) poaOperations() {
 	w.evHandler("worker: poaOperations: G started")
 	defer w.evHandler("worker: poaOperations: G completed")
 
-	ticker := time.NewTicker(cycleDuration)
+	// The ticker is driven by the state's clock so a simulation can move
+	// through the cycles without waiting on the wall clock.
+	ticker := w.clock.NewTicker(cycleDuration)
+	defer ticker.Stop()
 
 	// Start this on a secondsPerCycle mark: ex. MM.00, MM.12, MM.24, MM.36.
-	resetTicker(ticker, secondsPerCycle*time.Second)
+	w.resetTicker(ticker, secondsPerCycle*time.Second)
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			if !w.isShutdown() {
 				w.runPoaOperation()
 			}
@@ -43,7 +47,7 @@ func (w *Worker) poaOperations() {
 		}
 
 		// Reset the ticker for the next cycle.
-		resetTicker(ticker, 0)
+		w.resetTicker(ticker, 0)
 	}
 }
 
@@ -111,9 +115,9 @@ func (w *Worker) runPoaOperation() {
 			wg.Done()
 		}()
 
-		t := time.Now()
+		t := w.clock.Now()
 		block, err := w.state.MineNewBlock(ctx)
-		duration := time.Since(t)
+		duration := w.clock.Now().Sub(t)
 
 		w.evHandler("worker: runMiningOperation: MINING: mining duration[%v]", duration)
 
@@ -131,7 +135,7 @@ func (w *Worker) runPoaOperation() {
 
 		// The block is mined. Propose the new block to the network.
 		// Log the error, but that's it.
-		if err := w.state.NetSendBlockToPeers(block); err != nil {
+		if err := w.state.NetSendBlockToPeers(w.ctx, block); err != nil {
 			w.evHandler("worker: runMiningOperation: MINING: proposeBlockToPeers: WARNING %s", err)
 		}
 	}()
@@ -169,8 +173,8 @@ func (w *Worker) selection() string {
 // =============================================================================
 
 // resetTicker makes sure the next tick happens on the described cadence.
-func resetTicker(ticker *time.Ticker, waitOnSecond time.Duration) {
-	nextTick := time.Now().Add(cycleDuration).Round(waitOnSecond)
-	diff := time.Until(nextTick)
-	ticker.Reset(diff)
+func (w *Worker) resetTicker(ticker clock.Ticker, waitOnSecond time.Duration) {
+	now := w.clock.Now()
+	nextTick := now.Add(cycleDuration).Round(waitOnSecond)
+	ticker.Reset(nextTick.Sub(now))
 }
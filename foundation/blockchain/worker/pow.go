@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"sync"
-	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 )
@@ -98,9 +97,9 @@ func (w *Worker) runPowOperation() {
 			wg.Done()
 		}()
 
-		t := time.Now()
+		t := w.clock.Now()
 		block, err := w.state.MineNewBlock(ctx)
-		duration := time.Since(t)
+		duration := w.clock.Now().Sub(t)
 
 		w.evHandler("worker: runMiningOperation: MINING: mining duration[%v]", duration)
 
@@ -118,7 +117,7 @@ func (w *Worker) runPowOperation() {
 
 		// WOW, we mined a block. Propose the new block to the network.
 		// Log the error, but that's it.
-		if err := w.state.NetSendBlockToPeers(block); err != nil {
+		if err := w.state.NetSendBlockToPeers(w.ctx, block); err != nil {
 			w.evHandler("worker: runMiningOperation: MINING: proposeBlockToPeers: WARNING %s", err)
 		}
 	}()
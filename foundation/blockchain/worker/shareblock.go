@@ -0,0 +1,33 @@
+package worker
+
+// CORE NOTE: Relaying blocks received from peers is performed by this
+// goroutine. When a proposed block is accepted, the request goroutine shares
+// it with this goroutine to gossip it to a random subset of peers. Blocks
+// mined by this node are proposed directly by the mining goroutine.
+
+// maxBlockShareRequests represents the max number of pending block relay
+// requests that can be outstanding before relay requests are dropped. Blocks
+// are produced at a slow rate so this is more than enough.
+const maxBlockShareRequests = 10
+
+// =============================================================================
+
+// shareBlockOperations handles relaying accepted blocks.
+func (w *Worker) shareBlockOperations() {
+	w.evHandler("worker: shareBlockOperations: G started")
+	defer w.evHandler("worker: shareBlockOperations: G completed")
+
+	for {
+		select {
+		case block := <-w.blockSharing:
+			if !w.isShutdown() {
+				if err := w.state.NetSendBlockToPeers(w.ctx, block); err != nil {
+					w.evHandler("worker: shareBlockOperations: relayBlockToPeers: WARNING %s", err)
+				}
+			}
+		case <-w.shut:
+			w.evHandler("worker: shareBlockOperations: received shut signal")
+			return
+		}
+	}
+}
@@ -1,30 +1,43 @@
 package worker
 
-// CORE NOTE: Sharing new transactions received directly by a wallet is
-// performed by this goroutine. When a wallet transaction is received,
-// the request goroutine shares it with this goroutine to send it over the
-// p2p network. Up to 100 transactions can be pending to be sent before new
-// transactions are dropped and not sent.
-
-// maxTxShareRequests represents the max number of pending tx network share
-// requests that can be outstanding before share requests are dropped. To keep
-// this simple, a buffered channel of this arbitrary number is being used. If
-// the channel does become full, requests for new transactions to be shared
-// will not be accepted.
-const maxTxShareRequests = 100
+import (
+	"time"
+)
+
+// CORE NOTE: Sharing new transactions is performed by this goroutine. When a
+// transaction is accepted into the mempool, the hash of the transaction is
+// added to a pending announcement batch. The batch is announced to the p2p
+// network periodically, or sooner when the batch fills up. Peers then request
+// the transactions they don't already have.
+
+// txAnnounceInterval represents the interval of announcing the pending
+// transaction hashes to the known peers.
+const txAnnounceInterval = 500 * time.Millisecond
+
+// maxTxAnnounceBatch represents the max number of transaction hashes that
+// are sent in a single announcement. When the pending batch reaches this
+// size, the batch is announced without waiting for the next interval.
+const maxTxAnnounceBatch = 500
 
 // =============================================================================
 
-// shareTxOperations handles sharing new block transactions.
+// shareTxOperations handles announcing new block transactions.
 func (w *Worker) shareTxOperations() {
 	w.evHandler("worker: shareTxOperations: G started")
 	defer w.evHandler("worker: shareTxOperations: G completed")
 
+	ticker := w.clock.NewTicker(txAnnounceInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case tx := <-w.txSharing:
+		case <-ticker.C():
 			if !w.isShutdown() {
-				w.state.NetSendTxToPeers(tx)
+				w.runShareTxOperation()
+			}
+		case <-w.txFlush:
+			if !w.isShutdown() {
+				w.runShareTxOperation()
 			}
 		case <-w.shut:
 			w.evHandler("worker: shareTxOperations: received shut signal")
@@ -32,3 +45,53 @@ func (w *Worker) shareTxOperations() {
 		}
 	}
 }
+
+// runShareTxOperation announces the pending batch of transaction hashes.
+func (w *Worker) runShareTxOperation() {
+	for {
+		hashes := w.takeTxPending(maxTxAnnounceBatch)
+		if len(hashes) == 0 {
+			return
+		}
+
+		if err := w.state.NetSendTxAnnounceToPeers(w.ctx, hashes); err != nil {
+			w.evHandler("worker: runShareTxOperation: WARNING: %s", err)
+		}
+	}
+}
+
+// addTxPending adds the hash to the pending announcement batch. It returns
+// true when the batch is full and should be announced right away.
+func (w *Worker) addTxPending(hash string) bool {
+	w.txMu.Lock()
+	defer w.txMu.Unlock()
+
+	if _, exists := w.txPendingSet[hash]; exists {
+		return false
+	}
+
+	w.txPendingSet[hash] = struct{}{}
+	w.txPending = append(w.txPending, hash)
+
+	return len(w.txPending) >= maxTxAnnounceBatch
+}
+
+// takeTxPending removes up to max hashes from the pending batch.
+func (w *Worker) takeTxPending(max int) []string {
+	w.txMu.Lock()
+	defer w.txMu.Unlock()
+
+	n := len(w.txPending)
+	if n > max {
+		n = max
+	}
+
+	hashes := w.txPending[:n:n]
+	w.txPending = w.txPending[n:]
+
+	for _, hash := range hashes {
+		delete(w.txPendingSet, hash)
+	}
+
+	return hashes
+}
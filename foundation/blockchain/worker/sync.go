@@ -1,5 +1,11 @@
 package worker
 
+import (
+	"errors"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
 // CORE NOTE: On startup or when reorganizing the chain, the node needs to be
 // in sync with the rest of the network. This includes the mempool and
 // blockchain database. This operation needs to finish before the node can
@@ -10,37 +16,56 @@ func (w *Worker) Sync() {
 	w.evHandler("worker: sync: started")
 	defer w.evHandler("worker: sync: completed")
 
-	for _, peer := range w.state.KnownExternalPeers() {
+	// Peers are ordered by their score so the best peers are used first.
+	for _, pr := range w.state.SyncPeers() {
+
+		// Perform the handshake with every peer, including the peers restored
+		// from the address book. Peers only accept requests signed by an
+		// identity they know, and the handshake is how they learn this node's
+		// identity. A peer that answered and rejected the handshake is dropped.
+		// A peer that couldn't be reached is left to the backoff of its circuit
+		// so a brief outage doesn't empty the address book. Peers running a
+		// different chain are dropped by the handshake itself, and a host that
+		// answers with a different identity keeps the identity it's bound to.
+		if _, err := w.state.NetHandshake(w.ctx, pr); err != nil {
+			w.evHandler("worker: sync: handshake: %s: ERROR: %s", pr.Host, err)
+			if errors.Is(err, peer.ErrRejected) {
+				w.state.RemoveKnownPeer(pr)
+			}
+			continue
+		}
 
 		// Retrieve the status of this peer.
-		peerStatus, err := w.state.NetRequestPeerStatus(peer)
+		peerStatus, err := w.state.NetRequestPeerStatus(w.ctx, pr)
 		if err != nil {
-			w.evHandler("worker: sync: queryPeerStatus: %s: ERROR: %s", peer.Host, err)
+			w.evHandler("worker: sync: queryPeerStatus: %s: ERROR: %s", pr.Host, err)
 		}
 
 		// Add new peers to this nodes list.
 		w.addNewPeers(peerStatus.KnownPeers)
 
 		// Retrieve the mempool from the peer.
-		pool, err := w.state.NetRequestPeerMempool(peer)
+		pool, err := w.state.NetRequestPeerMempool(w.ctx, pr)
 		if err != nil {
-			w.evHandler("worker: sync: retrievePeerMempool: %s: ERROR: %s", peer.Host, err)
+			w.evHandler("worker: sync: retrievePeerMempool: %s: ERROR: %s", pr.Host, err)
 		}
 		for _, tx := range pool {
-			w.evHandler("worker: sync: retrievePeerMempool: %s: Add Tx: %s", peer.Host, tx.SignatureString()[:16])
+			w.evHandler("worker: sync: retrievePeerMempool: %s: Add Tx: %s", pr.Host, tx.SignatureString()[:16])
 			w.state.UpsertMempool(tx)
 		}
 
 		// If this peer has blocks we don't have, we need to add them.
 		if peerStatus.LatestBlockNumber > w.state.LatestBlock().Header.Number {
-			w.evHandler("worker: sync: retrievePeerBlocks: %s: latestBlockNumber[%d]", peer.Host, peerStatus.LatestBlockNumber)
+			w.evHandler("worker: sync: retrievePeerBlocks: %s: latestBlockNumber[%d]", pr.Host, peerStatus.LatestBlockNumber)
 
-			if err := w.state.NetRequestPeerBlocks(peer); err != nil {
-				w.evHandler("worker: sync: retrievePeerBlocks: %s: ERROR %s", peer.Host, err)
+			if err := w.state.NetRequestPeerBlocks(w.ctx, pr); err != nil {
+				w.evHandler("worker: sync: retrievePeerBlocks: %s: ERROR %s", pr.Host, err)
 			}
 		}
 	}
 
 	// Share with peers this node is available to participate in the network.
-	w.state.NetSendNodeAvailableToPeers()
+	if err := w.state.NetSendNodeAvailableToPeers(w.ctx); err != nil {
+		w.evHandler("worker: sync: sendNodeAvailable: WARNING: %s", err)
+	}
 }
@@ -3,9 +3,11 @@
 package worker
 
 import (
+	"context"
 	"sync"
 	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 )
@@ -19,25 +21,42 @@ const peerUpdateInterval = time.Second * 10
 // Worker manages the POW workflows for the blockchain.
 type Worker struct {
 	state        *state.State
+	clock        clock.Clock
+	ctx          context.Context
+	cancel       context.CancelFunc
 	wg           sync.WaitGroup
-	ticker       time.Ticker
+	ticker       clock.Ticker
 	shut         chan struct{}
 	startMining  chan bool
 	cancelMining chan bool
-	txSharing    chan database.BlockTx
+	txFlush      chan bool
+	txMu         sync.Mutex
+	txPending    []string
+	txPendingSet map[string]struct{}
+	blockSharing chan database.Block
 	evHandler    state.EventHandler
 }
 
 // Run creates a worker, registers the worker with the state package, and
 // starts up all the background processes.
 func Run(st *state.State, evHandler state.EventHandler) {
+
+	// The context is cancelled on shutdown so any network calls to peers
+	// that are in flight are abandoned.
+	ctx, cancel := context.WithCancel(context.Background())
+
 	w := Worker{
 		state:        st,
-		ticker:       *time.NewTicker(peerUpdateInterval),
+		ctx:          ctx,
+		cancel:       cancel,
+		clock:        st.Clock(),
+		ticker:       st.Clock().NewTicker(peerUpdateInterval),
 		shut:         make(chan struct{}),
 		startMining:  make(chan bool, 1),
 		cancelMining: make(chan bool, 1),
-		txSharing:    make(chan database.BlockTx, maxTxShareRequests),
+		txFlush:      make(chan bool, 1),
+		txPendingSet: make(map[string]struct{}),
+		blockSharing: make(chan database.Block, maxBlockShareRequests),
 		evHandler:    evHandler,
 	}
 
@@ -57,6 +76,7 @@ func Run(st *state.State, evHandler state.EventHandler) {
 	operations := []func(){
 		w.peerOperations,
 		w.shareTxOperations,
+		w.shareBlockOperations,
 		consensusOperation,
 	}
 
@@ -91,6 +111,9 @@ func (w *Worker) Shutdown() {
 	w.evHandler("worker: shutdown: started")
 	defer w.evHandler("worker: shutdown: completed")
 
+	w.evHandler("worker: shutdown: cancel network calls")
+	w.cancel()
+
 	w.evHandler("worker: shutdown: stop ticker")
 	w.ticker.Stop()
 
@@ -138,14 +161,28 @@ func (w *Worker) SignalCancelMining() {
 	w.evHandler("worker: SignalCancelMining: MINING: CANCEL: signaled")
 }
 
-// SignalShareTx signals a share transaction operation. If
-// maxTxShareRequests signals exist in the channel, we won't send these.
+// SignalShareTx adds the transaction to the next announcement batch. If the
+// batch is full, the announcement is signaled to happen right away.
 func (w *Worker) SignalShareTx(blockTx database.BlockTx) {
+	if !w.addTxPending(blockTx.HashHex()) {
+		return
+	}
+
+	select {
+	case w.txFlush <- true:
+		w.evHandler("worker: SignalShareTx: announce batch signaled")
+	default:
+	}
+}
+
+// SignalShareBlock signals a block relay operation. If maxBlockShareRequests
+// signals exist in the channel, we won't relay these.
+func (w *Worker) SignalShareBlock(block database.Block) {
 	select {
-	case w.txSharing <- blockTx:
-		w.evHandler("worker: SignalShareTx: share Tx signaled")
+	case w.blockSharing <- block:
+		w.evHandler("worker: SignalShareBlock: share block signaled")
 	default:
-		w.evHandler("worker: SignalShareTx: queue full, transactions won't be shared.")
+		w.evHandler("worker: SignalShareBlock: queue full, block won't be relayed.")
 	}
 }
 
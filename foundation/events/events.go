@@ -1,84 +1,318 @@
-// Package events allows for the registering and receiving of events.
+// Package events provides a topic based bus for publishing and receiving
+// typed events.
 package events
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/trace"
 )
 
-// Events maintains a mapping of unique id and channels so goroutines
-// can register and receive events.
+// ErrShutdown is returned when a subscription is requested after the
+// bus has been shutdown.
+var ErrShutdown = errors.New("events: bus is shutdown")
+
+// Topic represents a category of events a subscriber can choose to receive.
+type Topic string
+
+// TopicLog is the topic for the raw log messages produced by the system.
+const TopicLog Topic = "log"
+
+// Event represents a value that can be published on the bus. The topic
+// identifies which subscribers receive the event.
+type Event interface {
+	Topic() Topic
+}
+
+// Log represents a raw log message.
+type Log struct {
+	Message string `json:"message"`
+}
+
+// Topic implements the Event interface.
+func (Log) Topic() Topic {
+	return TopicLog
+}
+
+// =============================================================================
+
+// Message represents an event that was published on the bus. Every message
+// is given a sequence number that is unique across all topics. The trace id
+// is set when the event was published as part of a traced operation.
+type Message struct {
+	Seq     uint64    `json:"seq"`
+	Time    time.Time `json:"time"`
+	Topic   Topic     `json:"topic"`
+	Type    string    `json:"type"`
+	TraceID string    `json:"trace_id,omitempty"`
+	Data    Event     `json:"data"`
+}
+
+// =============================================================================
+
+// Subscription represents a subscriber receiving events from the bus.
+type Subscription struct {
+	id        string
+	topics    map[Topic]bool
+	ch        chan Message
+	fn        func(Message)
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// ID returns the unique id for the subscription.
+func (sub *Subscription) ID() string {
+	return sub.id
+}
+
+// C returns the channel for receiving events. The channel is closed when
+// the subscription is removed or the bus is shutdown.
+func (sub *Subscription) C() <-chan Message {
+	return sub.ch
+}
+
+// Delivered returns the number of events delivered to the subscriber.
+func (sub *Subscription) Delivered() uint64 {
+	return sub.delivered.Load()
+}
+
+// Dropped returns the number of events that were dropped because the
+// subscriber wasn't ready to receive them.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// wants identifies if the subscriber is interested in the topic. A
+// subscriber with no topics receives everything.
+func (sub *Subscription) wants(topic Topic) bool {
+	return len(sub.topics) == 0 || sub.topics[topic]
+}
+
+// deliver provides the message to the subscriber without blocking.
+func (sub *Subscription) deliver(msg Message) {
+	if sub.fn != nil {
+		sub.fn(msg)
+		sub.delivered.Add(1)
+		return
+	}
+
+	select {
+	case sub.ch <- msg:
+		sub.delivered.Add(1)
+	default:
+		sub.dropped.Add(1)
+	}
+}
+
+// Stat represents the delivery statistics for a subscription.
+type Stat struct {
+	ID        string  `json:"id"`
+	Topics    []Topic `json:"topics"`
+	Delivered uint64  `json:"delivered"`
+	Dropped   uint64  `json:"dropped"`
+	Pending   int     `json:"pending"`
+}
+
+// =============================================================================
+
+// Events maintains the set of subscribers that are receiving events.
 type Events struct {
-	m  map[string]chan string
-	mu sync.RWMutex
+	mu     sync.Mutex
+	seq    uint64
+	subs   map[string]*Subscription
+	closed bool
 }
 
-// New constructs an events for registering and receiving events.
+// New constructs an events bus for publishing and receiving events.
 func New() *Events {
-
 	return &Events{
-		m: make(map[string]chan string),
+		subs: make(map[string]*Subscription),
 	}
 }
 
-// Shutdown closes and removes all channels that were provided by
-// the call to Acquire.
+// Shutdown closes and removes all the channel subscriptions. Handlers
+// registered with Handle keep receiving events so messages produced while
+// the system is shutting down are not lost.
 func (evt *Events) Shutdown() {
-	evt.mu.RLock()
-	defer evt.mu.RUnlock()
+	evt.mu.Lock()
+	defer evt.mu.Unlock()
 
-	for id, ch := range evt.m {
-		delete(evt.m, id)
-		close(ch)
+	evt.closed = true
+
+	for id, sub := range evt.subs {
+		if sub.ch != nil {
+			delete(evt.subs, id)
+			close(sub.ch)
+		}
 	}
 }
 
-// Acquire takes a unique id and returns a channel that can be used
-// to receive events.
-func (evt *Events) Acquire(id string) chan string {
-	evt.mu.Lock()
-	defer evt.mu.Unlock()
+// Subscribe takes a unique id and returns a subscription with a channel
+// that receives events for the specified topics. If no topics are specified,
+// all events are received. Events are dropped if the buffer is full.
+func (evt *Events) Subscribe(id string, buffer int, topics ...Topic) (*Subscription, error) {
+	if buffer < 1 {
+		buffer = 1
+	}
 
-	ch, exists := evt.m[id]
-	if exists {
-		return ch
+	sub := Subscription{
+		id:     id,
+		topics: topicSet(topics),
+		ch:     make(chan Message, buffer),
 	}
 
-	// Since a message will be dropped if the websocket receiver is
-	// not ready to receive, this arbitrary buffer should give the receiver
-	// enough time to not lose a message. Websocket send could take long.
-	const messageBuffer = 100
+	if err := evt.add(&sub); err != nil {
+		return nil, err
+	}
 
-	evt.m[id] = make(chan string, messageBuffer)
-	return evt.m[id]
+	return &sub, nil
 }
 
-// Release closes and removes the channel that was provided by
-// the call to Acquire.
-func (evt *Events) Release(id string) error {
+// Handle takes a unique id and registers a function that is called for
+// events on the specified topics. The function is called synchronously
+// while the event is being published so events are never dropped. The
+// function must not publish events or change the subscriptions.
+func (evt *Events) Handle(id string, fn func(Message), topics ...Topic) (*Subscription, error) {
+	sub := Subscription{
+		id:     id,
+		topics: topicSet(topics),
+		fn:     fn,
+	}
+
+	if err := evt.add(&sub); err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// Unsubscribe removes the subscription for the specified id. The channel
+// for the subscription is closed.
+func (evt *Events) Unsubscribe(id string) error {
 	evt.mu.Lock()
 	defer evt.mu.Unlock()
 
-	ch, exists := evt.m[id]
+	sub, exists := evt.subs[id]
 	if !exists {
 		return fmt.Errorf("id %q does not exist", id)
 	}
 
-	delete(evt.m, id)
-	close(ch)
+	delete(evt.subs, id)
+	if sub.ch != nil {
+		close(sub.ch)
+	}
+
 	return nil
 }
 
-// Send signals a message to ever registered channel. Send will not block
-// waiting for a receiver on any given channel.
-func (evt *Events) Send(s string) {
-	evt.mu.RLock()
-	defer evt.mu.RUnlock()
+// Publish sends the event to every subscriber interested in the topic.
+// Publish will not block waiting for a receiver on any given channel.
+func (evt *Events) Publish(ev Event) Message {
+	return evt.PublishContext(context.Background(), ev)
+}
+
+// PublishContext sends the event to every subscriber interested in the
+// topic. The message carries the trace id of the span in the context so
+// the event can be matched to the operation that caused it.
+func (evt *Events) PublishContext(ctx context.Context, ev Event) Message {
+	var traceID string
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		traceID = sc.TraceID.String()
+	}
+
+	evt.mu.Lock()
+	defer evt.mu.Unlock()
+
+	evt.seq++
+	msg := Message{
+		Seq:     evt.seq,
+		Time:    time.Now().UTC(),
+		Topic:   ev.Topic(),
+		Type:    TypeOf(ev),
+		TraceID: traceID,
+		Data:    ev,
+	}
+
+	for _, sub := range evt.subs {
+		if sub.wants(msg.Topic) {
+			sub.deliver(msg)
+		}
+	}
+
+	return msg
+}
+
+// Stats returns the delivery statistics for every subscription ordered
+// by id.
+func (evt *Events) Stats() []Stat {
+	evt.mu.Lock()
+	defer evt.mu.Unlock()
 
-	for _, ch := range evt.m {
-		select {
-		case ch <- s:
-		default:
+	stats := make([]Stat, 0, len(evt.subs))
+	for _, sub := range evt.subs {
+		topics := make([]Topic, 0, len(sub.topics))
+		for topic := range sub.topics {
+			topics = append(topics, topic)
 		}
+		sort.Slice(topics, func(i, j int) bool { return topics[i] < topics[j] })
+
+		stats = append(stats, Stat{
+			ID:        sub.id,
+			Topics:    topics,
+			Delivered: sub.Delivered(),
+			Dropped:   sub.Dropped(),
+			Pending:   len(sub.ch),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+
+	return stats
+}
+
+// add registers the subscription if the id is not already in use.
+func (evt *Events) add(sub *Subscription) error {
+	evt.mu.Lock()
+	defer evt.mu.Unlock()
+
+	if evt.closed && sub.ch != nil {
+		return ErrShutdown
+	}
+
+	if _, exists := evt.subs[sub.id]; exists {
+		return fmt.Errorf("id %q already exists", sub.id)
 	}
+
+	evt.subs[sub.id] = sub
+	return nil
+}
+
+// =============================================================================
+
+// TypeOf returns the name of the event's type which is used to identify
+// the event inside a message.
+func TypeOf(ev Event) string {
+	t := reflect.TypeOf(ev)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
+
+// topicSet converts the list of topics into a set.
+func topicSet(topics []Topic) map[Topic]bool {
+	set := make(map[Topic]bool, len(topics))
+	for _, topic := range topics {
+		set[topic] = true
+	}
+
+	return set
 }
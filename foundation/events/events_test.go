@@ -0,0 +1,142 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/events"
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+type blockEvent struct {
+	Number int
+}
+
+func (blockEvent) Topic() events.Topic { return "blocks" }
+
+type txEvent struct{}
+
+func (txEvent) Topic() events.Topic { return "txs" }
+
+func Test_Topics(t *testing.T) {
+	evts := events.New()
+	defer evts.Shutdown()
+
+	blocks, err := evts.Subscribe("blocks", 10, "blocks")
+	if err != nil {
+		t.Fatalf("Should be able to subscribe: %v", err)
+	}
+
+	all, err := evts.Subscribe("all", 10)
+	if err != nil {
+		t.Fatalf("Should be able to subscribe: %v", err)
+	}
+
+	if _, err := evts.Subscribe("all", 10); err == nil {
+		t.Fatalf("Should not be able to subscribe with the same id twice.")
+	}
+
+	evts.Publish(txEvent{})
+	evts.Publish(blockEvent{Number: 1})
+
+	msg := <-blocks.C()
+	if msg.Type != "blockEvent" || msg.Topic != "blocks" || msg.Seq != 2 {
+		t.Fatalf("Should receive the block event, got %s %s %d.", msg.Type, msg.Topic, msg.Seq)
+	}
+	if ev, ok := msg.Data.(blockEvent); !ok || ev.Number != 1 {
+		t.Fatalf("Should receive the typed event, got %#v.", msg.Data)
+	}
+	if len(blocks.C()) != 0 {
+		t.Fatalf("Should not receive events for other topics.")
+	}
+
+	for _, seq := range []uint64{1, 2} {
+		if msg := <-all.C(); msg.Seq != seq {
+			t.Fatalf("Should receive events in order, got seq %d, exp %d.", msg.Seq, seq)
+		}
+	}
+}
+
+func Test_Dropped(t *testing.T) {
+	evts := events.New()
+	defer evts.Shutdown()
+
+	sub, err := evts.Subscribe("slow", 2)
+	if err != nil {
+		t.Fatalf("Should be able to subscribe: %v", err)
+	}
+
+	var handled int
+	if _, err := evts.Handle("handler", func(events.Message) { handled++ }); err != nil {
+		t.Fatalf("Should be able to register a handler: %v", err)
+	}
+
+	for i := range 5 {
+		evts.Publish(blockEvent{Number: i})
+	}
+
+	if sub.Delivered() != 2 || sub.Dropped() != 3 {
+		t.Fatalf("Should deliver 2 and drop 3 events, got %d and %d.", sub.Delivered(), sub.Dropped())
+	}
+
+	if handled != 5 {
+		t.Fatalf("Should call the handler for every event, got %d.", handled)
+	}
+
+	stats := evts.Stats()
+	if len(stats) != 2 || stats[1].ID != "slow" || stats[1].Dropped != 3 || stats[1].Pending != 2 {
+		t.Fatalf("Should report the stats for every subscription, got %+v.", stats)
+	}
+}
+
+func Test_Shutdown(t *testing.T) {
+	evts := events.New()
+
+	sub, err := evts.Subscribe("sub", 10)
+	if err != nil {
+		t.Fatalf("Should be able to subscribe: %v", err)
+	}
+
+	var handled int
+	if _, err := evts.Handle("handler", func(events.Message) { handled++ }); err != nil {
+		t.Fatalf("Should be able to register a handler: %v", err)
+	}
+
+	evts.Shutdown()
+
+	if _, ok := <-sub.C(); ok {
+		t.Fatalf("Should close the subscription channel on shutdown.")
+	}
+
+	if _, err := evts.Subscribe("late", 10); err == nil {
+		t.Fatalf("Should not be able to subscribe after shutdown.")
+	}
+
+	evts.Publish(events.Log{Message: "shutting down"})
+	if handled != 1 {
+		t.Fatalf("Should keep calling handlers after shutdown, got %d.", handled)
+	}
+
+	if err := evts.Unsubscribe("sub"); err == nil {
+		t.Fatalf("Should not find the subscription after shutdown.")
+	}
+}
+
+func Test_PublishContext(t *testing.T) {
+	evts := events.New()
+	defer evts.Shutdown()
+
+	tracer := trace.New("test")
+	ctx, span := tracer.Start(context.Background(), "publish")
+	defer span.End()
+
+	msg := evts.PublishContext(ctx, blockEvent{Number: 1})
+	if msg.TraceID != span.SpanContext().TraceID.String() {
+		t.Fatalf("Should carry the trace id of the span, got %q.", msg.TraceID)
+	}
+
+	msg = evts.Publish(blockEvent{Number: 2})
+	if msg.TraceID != "" {
+		t.Fatalf("Should not have a trace id without a span, got %q.", msg.TraceID)
+	}
+}
@@ -0,0 +1,347 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// errNull signals a field resolved to null because of an error that has
+// already been recorded. The null moves up to the closest nullable parent.
+var errNull = errors.New("null")
+
+// result holds the fields of an object in the order they were selected.
+type result []entry
+
+// entry is a single field in a result.
+type entry struct {
+	key   string
+	value any
+}
+
+// MarshalJSON implements the json.Marshaler interface so the fields are
+// encoded in the order they were selected.
+func (r result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, e := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// =============================================================================
+
+// group is the set of fields selected under the same response key.
+type group struct {
+	key    string
+	fields []*field
+}
+
+// executor resolves the selections of an operation.
+type executor struct {
+	ctx    context.Context
+	schema *Schema
+	doc    *document
+	src    string
+	vars   map[string]any
+	errs   []*Error
+}
+
+// selectionSet resolves the selections against the source value of the
+// object type.
+func (e *executor) selectionSet(obj *Object, source any, sels []selection, path []any) (result, error) {
+	groups := e.collect(obj, sels, nil, make(map[string]*group), make(map[string]bool))
+
+	out := make(result, 0, len(groups))
+	for _, g := range groups {
+		f := g.fields[0]
+
+		if f.name == "__typename" {
+			out = append(out, entry{key: g.key, value: obj.Name})
+			continue
+		}
+
+		fieldPath := append(path[:len(path):len(path)], g.key)
+
+		v, err := e.field(obj.Fields[f.name], source, g.fields, fieldPath)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entry{key: g.key, value: v})
+	}
+
+	return out, nil
+}
+
+// collect groups the selected fields by their response key, applying the
+// fragments and directives.
+func (e *executor) collect(obj *Object, sels []selection, groups []*group, index map[string]*group, visited map[string]bool) []*group {
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *field:
+			if !e.include(sel.directives) {
+				continue
+			}
+
+			g, exists := index[sel.key()]
+			if !exists {
+				g = &group{key: sel.key()}
+				index[sel.key()] = g
+				groups = append(groups, g)
+			}
+			g.fields = append(g.fields, sel)
+
+		case *fragmentSpread:
+			if visited[sel.name] || !e.include(sel.directives) {
+				continue
+			}
+			visited[sel.name] = true
+
+			frag := e.doc.fragments[sel.name]
+			if frag.on != obj.Name {
+				continue
+			}
+			groups = e.collect(obj, frag.selections, groups, index, visited)
+
+		case *inlineFragment:
+			if !e.include(sel.directives) || (sel.on != "" && sel.on != obj.Name) {
+				continue
+			}
+			groups = e.collect(obj, sel.selections, groups, index, visited)
+		}
+	}
+
+	return groups
+}
+
+// include applies the @skip and @include directives.
+func (e *executor) include(dirs []*directive) bool {
+	for _, d := range dirs {
+		args, err := coerceArgs(directiveArgs[d.name], d.args, e.vars)
+		if err != nil {
+			continue
+		}
+
+		cond, _ := args["if"].(bool)
+		switch d.name {
+		case "skip":
+			if cond {
+				return false
+			}
+		case "include":
+			if !cond {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// field resolves a field and completes the value for its type.
+func (e *executor) field(def *Field, source any, fields []*field, path []any) (any, error) {
+	f := fields[0]
+
+	if err := e.ctx.Err(); err != nil {
+		return e.fieldError(def.Type, err, f.pos, path)
+	}
+
+	args, err := coerceArgs(def.Args, f.args, e.vars)
+	if err != nil {
+		return e.fieldError(def.Type, err, f.pos, path)
+	}
+
+	resolve := def.Resolve
+	if resolve == nil {
+		resolve = defaultResolve
+	}
+
+	v, err := resolve(ResolveParams{
+		Context:   e.ctx,
+		Source:    source,
+		Args:      args,
+		FieldName: f.name,
+	})
+	if err != nil {
+		return e.fieldError(def.Type, err, f.pos, path)
+	}
+
+	return e.complete(def.Type, fields, v, path)
+}
+
+// fieldError records the error for the field. The field is null, which moves
+// up to the parent if the field is non null.
+func (e *executor) fieldError(t Type, err error, pos int, path []any) (any, error) {
+	e.addError(err, pos, path)
+
+	if isNonNull(t) {
+		return nil, errNull
+	}
+
+	return nil, nil
+}
+
+// complete converts the resolved value into the value for the response.
+func (e *executor) complete(t Type, fields []*field, v any, path []any) (any, error) {
+	if nn, ok := t.(*NonNull); ok {
+		r, err := e.completeValue(nn.OfType, fields, v, path)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			e.addError(fmt.Errorf("Cannot return null for non-nullable field."), fields[0].pos, path)
+			return nil, errNull
+		}
+		return r, nil
+	}
+
+	r, err := e.completeValue(t, fields, v, path)
+	if err != nil {
+		return nil, nil
+	}
+
+	return r, nil
+}
+
+// completeValue converts a value for a nullable type. It returns errNull
+// when the value is null because of an error.
+func (e *executor) completeValue(t Type, fields []*field, v any, path []any) (any, error) {
+	if isNil(v) {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		r, err := t.Serialize(v)
+		if err != nil {
+			e.addError(err, fields[0].pos, path)
+			return nil, errNull
+		}
+		return r, nil
+
+	case *List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.addError(fmt.Errorf("Expected a list, got %T.", v), fields[0].pos, path)
+			return nil, errNull
+		}
+
+		list := make([]any, rv.Len())
+		for i := range list {
+			itemPath := append(path[:len(path):len(path)], i)
+			item, err := e.complete(t.OfType, fields, rv.Index(i).Interface(), itemPath)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+
+	case *Object:
+		var sels []selection
+		for _, f := range fields {
+			sels = append(sels, f.selections...)
+		}
+		return e.selectionSet(t, v, sels, path)
+	}
+
+	return nil, fmt.Errorf("unknown type %T", t)
+}
+
+// addError records an error located at the field.
+func (e *executor) addError(err error, pos int, path []any) {
+	e.errs = append(e.errs, &Error{
+		Message:   err.Error(),
+		Locations: []Location{location(e.src, pos)},
+		Path:      path,
+	})
+}
+
+// =============================================================================
+
+// coerceVariables converts the variables provided in the request into the
+// types declared by the operation.
+func (s *Schema) coerceVariables(op *operation, provided map[string]any, src string) (map[string]any, []*Error) {
+	vars := make(map[string]any)
+
+	var errs []*Error
+	for _, def := range op.vars {
+		t, err := s.typeFromRef(def.typ)
+		if err != nil {
+			errs = append(errs, newError(src, def.pos, "Variable \"$%s\" %s", def.name, err))
+			continue
+		}
+
+		value, exists := provided[def.name]
+		if !exists {
+			switch {
+			case def.hasDef:
+				v, err := coerceInput(t, def.defVal, nil)
+				if err != nil {
+					errs = append(errs, newError(src, def.pos, "Variable \"$%s\" has invalid default value: %s", def.name, err))
+					continue
+				}
+				vars[def.name] = v
+
+			case isNonNull(t):
+				errs = append(errs, newError(src, def.pos, "Variable \"$%s\" of required type %q was not provided.", def.name, t))
+			}
+			continue
+		}
+
+		v, err := coerceInput(t, value, nil)
+		if err != nil {
+			errs = append(errs, newError(src, def.pos, "Variable \"$%s\" got invalid value: %s", def.name, err))
+			continue
+		}
+		vars[def.name] = v
+	}
+
+	return vars, errs
+}
+
+// defaultResolve looks up the field in a source that is a map.
+func defaultResolve(p ResolveParams) (any, error) {
+	if m, ok := p.Source.(map[string]any); ok {
+		return m[p.FieldName], nil
+	}
+
+	return nil, fmt.Errorf("no resolver for field %q", p.FieldName)
+}
+
+// isNil identifies if the value is nil, including nil pointers and slices.
+func isNil(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+
+	return false
+}
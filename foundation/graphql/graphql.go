@@ -0,0 +1,401 @@
+// Package graphql provides a small GraphQL query engine. A schema is built
+// from Go values describing the object types and the resolvers for their
+// fields. Only queries are supported, there are no mutations, subscriptions,
+// interfaces, unions or enums.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type represents a GraphQL type. It's a *Scalar, *Object, *List or
+// *NonNull.
+type Type interface {
+	String() string
+}
+
+// Scalar represents a leaf value such as an Int or a String.
+type Scalar struct {
+	Name        string
+	Description string
+
+	// Serialize converts the value returned by a resolver into the value
+	// that is encoded in the JSON response.
+	Serialize func(v any) (any, error)
+
+	// Parse converts a literal from the query or a variable decoded from
+	// JSON into the value provided to resolvers.
+	Parse func(v any) (any, error)
+}
+
+// String returns the name of the scalar.
+func (s *Scalar) String() string {
+	return s.Name
+}
+
+// Object represents a type with a set of fields.
+type Object struct {
+	Name        string
+	Description string
+	Fields      Fields
+}
+
+// String returns the name of the object.
+func (o *Object) String() string {
+	return o.Name
+}
+
+// List represents a list of values of the same type.
+type List struct {
+	OfType Type
+}
+
+// ListOf constructs a list type.
+func ListOf(t Type) *List {
+	return &List{OfType: t}
+}
+
+// String returns the list type in GraphQL notation.
+func (l *List) String() string {
+	return "[" + l.OfType.String() + "]"
+}
+
+// NonNull represents a type that can't be null.
+type NonNull struct {
+	OfType Type
+}
+
+// NonNullOf constructs a non null type.
+func NonNullOf(t Type) *NonNull {
+	return &NonNull{OfType: t}
+}
+
+// String returns the non null type in GraphQL notation.
+func (n *NonNull) String() string {
+	return n.OfType.String() + "!"
+}
+
+// =============================================================================
+
+// Fields maps the field names of an object to their definitions.
+type Fields map[string]*Field
+
+// Field defines a field of an object and how to resolve its value.
+type Field struct {
+	Description string
+	Type        Type
+	Args        Args
+
+	// Resolve returns the value of the field. When there is no resolver,
+	// the field is looked up in the source if it's a map[string]any.
+	Resolve ResolveFunc
+}
+
+// Args maps the argument names of a field to their definitions.
+type Args map[string]*Argument
+
+// Argument defines an argument that can be provided to a field.
+type Argument struct {
+	Description  string
+	Type         Type
+	DefaultValue any
+}
+
+// ResolveFunc returns the value of a field.
+type ResolveFunc func(p ResolveParams) (any, error)
+
+// ResolveParams provides the information for resolving a field.
+type ResolveParams struct {
+	Context context.Context
+
+	// Source is the value the parent field resolved to. It's nil for the
+	// fields of the query type.
+	Source any
+
+	// Args holds the arguments provided for the field after they have been
+	// coerced to their types. Arguments that weren't provided and have no
+	// default aren't in the map.
+	Args map[string]any
+
+	// FieldName is the name of the field being resolved.
+	FieldName string
+}
+
+// =============================================================================
+
+// Location identifies a position in the query document.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error represents an error reported in the response.
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	Path      []any      `json:"path,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if len(e.Locations) == 0 {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s (%d:%d)", e.Message, e.Locations[0].Line, e.Locations[0].Column)
+}
+
+// newError constructs an error located at the specified position in the
+// document.
+func newError(src string, pos int, format string, args ...any) *Error {
+	return &Error{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []Location{location(src, pos)},
+	}
+}
+
+// location converts a position in the document into a line and column.
+func location(src string, pos int) Location {
+	if pos > len(src) {
+		pos = len(src)
+	}
+
+	line := 1 + strings.Count(src[:pos], "\n")
+	column := pos + 1
+	if i := strings.LastIndexByte(src[:pos], '\n'); i >= 0 {
+		column = pos - i
+	}
+
+	return Location{Line: line, Column: column}
+}
+
+// =============================================================================
+
+// Request represents a GraphQL request as posted by a client.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response represents the result of executing a request. Data is nil if
+// the request couldn't be executed.
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// =============================================================================
+
+// MaxDepth is the deepest a selection set can be nested in a query.
+const MaxDepth = 12
+
+// Schema represents the set of types that can be queried.
+type Schema struct {
+	query *Object
+	types map[string]Type
+}
+
+// NewSchema constructs a schema with the specified type as the entry point
+// for queries. Every type reachable from the query type is validated.
+func NewSchema(query *Object) (*Schema, error) {
+	if query == nil {
+		return nil, errors.New("query type is required")
+	}
+
+	s := Schema{
+		query: query,
+		types: make(map[string]Type),
+	}
+
+	for _, scalar := range []*Scalar{Int, Float, String, Boolean, ID} {
+		s.types[scalar.Name] = scalar
+	}
+
+	if err := s.addType(query); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// addType adds the type and every type it references to the schema.
+func (s *Schema) addType(t Type) error {
+	switch t := t.(type) {
+	case *NonNull:
+		if _, ok := t.OfType.(*NonNull); ok {
+			return fmt.Errorf("type %s can't be non null twice", t)
+		}
+		return s.addType(t.OfType)
+
+	case *List:
+		return s.addType(t.OfType)
+
+	case *Scalar:
+		if t.Serialize == nil || t.Parse == nil {
+			return fmt.Errorf("scalar %s requires Serialize and Parse functions", t.Name)
+		}
+		return s.addNamed(t.Name, t)
+
+	case *Object:
+		if existing, exists := s.types[t.Name]; exists {
+			if existing != Type(t) {
+				return fmt.Errorf("type %s is defined more than once", t.Name)
+			}
+			return nil
+		}
+		if len(t.Fields) == 0 {
+			return fmt.Errorf("type %s must define at least one field", t.Name)
+		}
+		s.types[t.Name] = t
+
+		for _, name := range sortedKeys(t.Fields) {
+			f := t.Fields[name]
+			if f.Type == nil {
+				return fmt.Errorf("field %s.%s has no type", t.Name, name)
+			}
+			if strings.HasPrefix(name, "__") {
+				return fmt.Errorf("field %s.%s can't start with __", t.Name, name)
+			}
+			if err := s.addType(f.Type); err != nil {
+				return err
+			}
+
+			for _, argName := range sortedKeys(f.Args) {
+				arg := f.Args[argName]
+				if !isInputType(arg.Type) {
+					return fmt.Errorf("argument %s.%s(%s) must be a scalar or a list of scalars", t.Name, name, argName)
+				}
+				if err := s.addType(arg.Type); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+
+	case nil:
+		return errors.New("type is nil")
+	}
+
+	return fmt.Errorf("unknown type %T", t)
+}
+
+// addNamed adds a named type to the schema, making sure the name is unique.
+func (s *Schema) addNamed(name string, t Type) error {
+	if existing, exists := s.types[name]; exists && existing != t {
+		return fmt.Errorf("type %s is defined more than once", name)
+	}
+	s.types[name] = t
+
+	return nil
+}
+
+// Execute runs the query in the request against the schema. Errors are
+// reported in the response.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return Response{Errors: []*Error{toError(err)}}
+	}
+
+	if errs := s.validate(doc, req.Query); len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return Response{Errors: []*Error{toError(err)}}
+	}
+
+	vars, errs := s.coerceVariables(op, req.Variables, req.Query)
+	if len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+
+	e := executor{
+		ctx:    ctx,
+		schema: s,
+		doc:    doc,
+		src:    req.Query,
+		vars:   vars,
+	}
+
+	data, err := e.selectionSet(s.query, nil, op.selections, nil)
+	if err != nil {
+		return Response{Errors: e.errs}
+	}
+
+	return Response{Data: data, Errors: e.errs}
+}
+
+// selectOperation finds the operation to execute in the document.
+func selectOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) != 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations."}
+		}
+		return doc.operations[0], nil
+	}
+
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+// toError converts an error into an error that can be reported in a
+// response.
+func toError(err error) *Error {
+	var gqlErr *Error
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+
+	return &Error{Message: err.Error()}
+}
+
+// isInputType identifies if the type can be used for an argument.
+func isInputType(t Type) bool {
+	switch t := t.(type) {
+	case *NonNull:
+		return isInputType(t.OfType)
+	case *List:
+		return isInputType(t.OfType)
+	case *Scalar:
+		return true
+	}
+
+	return false
+}
+
+// namedType returns the type without any list or non null wrappers.
+func namedType(t Type) Type {
+	for {
+		switch w := t.(type) {
+		case *NonNull:
+			t = w.OfType
+		case *List:
+			t = w.OfType
+		default:
+			return t
+		}
+	}
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
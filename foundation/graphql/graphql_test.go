@@ -0,0 +1,259 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+)
+
+type person struct {
+	ID      string
+	Name    string
+	Age     int
+	Friends []string
+}
+
+var people = map[string]person{
+	"1": {ID: "1", Name: "Bill", Age: 50, Friends: []string{"2", "3"}},
+	"2": {ID: "2", Name: "Ed", Age: 40, Friends: []string{"1"}},
+	"3": {ID: "3", Name: "Kennedy", Age: 30},
+}
+
+func newSchema(t *testing.T) *graphql.Schema {
+	personType := &graphql.Object{
+		Name:        "Person",
+		Description: "A person with friends.",
+	}
+
+	personType.Fields = graphql.Fields{
+		"id": {
+			Type: graphql.NonNullOf(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(person).ID, nil
+			},
+		},
+		"name": {
+			Type: graphql.NonNullOf(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(person).Name, nil
+			},
+		},
+		"age": {
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(person).Age, nil
+			},
+		},
+		"friends": {
+			Type: graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(personType))),
+			Args: graphql.Args{
+				"first": {Type: graphql.Int, DefaultValue: 10},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				var out []person
+				for _, id := range p.Source.(person).Friends {
+					if len(out) == p.Args["first"].(int) {
+						break
+					}
+					out = append(out, people[id])
+				}
+				return out, nil
+			},
+		},
+		"nickname": {
+			Type: graphql.String,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return nil, errors.New("no nickname")
+			},
+		},
+		"secret": {
+			Type: graphql.NonNullOf(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return nil, errors.New("secret is hidden")
+			},
+		},
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"person": {
+				Type: personType,
+				Args: graphql.Args{
+					"id": {Type: graphql.NonNullOf(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					prs, exists := people[p.Args["id"].(string)]
+					if !exists {
+						return nil, nil
+					}
+					return prs, nil
+				},
+			},
+			"count": {
+				Type: graphql.NonNullOf(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return len(people), nil
+				},
+			},
+		},
+	}
+
+	schema, err := graphql.NewSchema(query)
+	if err != nil {
+		t.Fatalf("Should be able to construct the schema: %s", err)
+	}
+
+	return schema
+}
+
+func Test_Execute(t *testing.T) {
+	type table struct {
+		name  string
+		query string
+		vars  map[string]any
+		exp   string
+	}
+
+	tt := []table{
+		{
+			name:  "basic",
+			query: `{ person(id: "1") { name age } count }`,
+			exp:   `{"data":{"person":{"name":"Bill","age":50},"count":3}}`,
+		},
+		{
+			name:  "alias",
+			query: `{ a: person(id: 2) { who: name } b: person(id: "3") { name } }`,
+			exp:   `{"data":{"a":{"who":"Ed"},"b":{"name":"Kennedy"}}}`,
+		},
+		{
+			name:  "nested",
+			query: `{ person(id: "1") { friends(first: 1) { name friends { id } } } }`,
+			exp:   `{"data":{"person":{"friends":[{"name":"Ed","friends":[{"id":"1"}]}]}}}`,
+		},
+		{
+			name:  "fragments",
+			query: `query { person(id: "2") { ...info ... on Person { id } __typename } } fragment info on Person { name age }`,
+			exp:   `{"data":{"person":{"name":"Ed","age":40,"id":"2","__typename":"Person"}}}`,
+		},
+		{
+			name:  "variables",
+			query: `query Find($id: ID!, $n: Int = 1) { person(id: $id) { friends(first: $n) { name } } }`,
+			vars:  map[string]any{"id": "1"},
+			exp:   `{"data":{"person":{"friends":[{"name":"Ed"}]}}}`,
+		},
+		{
+			name:  "directives",
+			query: `query ($no: Boolean!) { person(id: "1") { name @include(if: $no) age @skip(if: false) } }`,
+			vars:  map[string]any{"no": false},
+			exp:   `{"data":{"person":{"age":50}}}`,
+		},
+		{
+			name:  "null",
+			query: `{ person(id: "9") { name } }`,
+			exp:   `{"data":{"person":null}}`,
+		},
+		{
+			name:  "fieldError",
+			query: `{ person(id: "1") { name nickname } }`,
+			exp:   `{"data":{"person":{"name":"Bill","nickname":null}},"errors":[{"message":"no nickname","locations":[{"line":1,"column":26}],"path":["person","nickname"]}]}`,
+		},
+		{
+			name:  "nonNullError",
+			query: `{ person(id: "1") { name secret } }`,
+			exp:   `{"data":{"person":null},"errors":[{"message":"secret is hidden","locations":[{"line":1,"column":26}],"path":["person","secret"]}]}`,
+		},
+		{
+			name:  "syntax",
+			query: `{ person(id: "1") { name }`,
+			exp:   `{"errors":[{"message":"Syntax Error: Unexpected \u003cEOF\u003e.","locations":[{"line":1,"column":27}]}]}`,
+		},
+		{
+			name:  "unknownField",
+			query: `{ person(id: "1") { height } }`,
+			exp:   `{"errors":[{"message":"Cannot query field \"height\" on type \"Person\".","locations":[{"line":1,"column":21}]}]}`,
+		},
+		{
+			name:  "missingArgument",
+			query: `{ person { name } }`,
+			exp:   `{"errors":[{"message":"Field \"person\" argument \"id\" of type \"ID!\" is required, but it was not provided.","locations":[{"line":1,"column":3}]}]}`,
+		},
+		{
+			name:  "missingSelection",
+			query: `{ person(id: "1") }`,
+			exp:   `{"errors":[{"message":"Field \"person\" of type \"Person\" must have a selection of subfields.","locations":[{"line":1,"column":3}]}]}`,
+		},
+		{
+			name:  "badVariable",
+			query: `query ($id: Int!) { person(id: $id) { name } }`,
+			vars:  map[string]any{"id": 1},
+			exp:   `{"errors":[{"message":"Variable \"$id\" of type \"Int!\" used in position expecting type \"ID!\".","locations":[{"line":1,"column":28}]}]}`,
+		},
+		{
+			name:  "missingVariable",
+			query: `query ($id: ID!) { person(id: $id) { name } }`,
+			exp:   `{"errors":[{"message":"Variable \"$id\" of required type \"ID!\" was not provided.","locations":[{"line":1,"column":8}]}]}`,
+		},
+		{
+			name:  "fragmentCycle",
+			query: `{ person(id: "1") { ...a } } fragment a on Person { friends { ...a } }`,
+			exp:   `{"errors":[{"message":"Cannot spread fragment \"a\" within itself.","locations":[{"line":1,"column":63}]}]}`,
+		},
+		{
+			name:  "mutation",
+			query: `mutation { count }`,
+			exp:   `{"errors":[{"message":"Only queries are supported, mutation operations are not.","locations":[{"line":1,"column":1}]}]}`,
+		},
+	}
+
+	schema := newSchema(t)
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			resp := schema.Execute(context.Background(), graphql.Request{Query: tst.query, Variables: tst.vars})
+
+			data, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatalf("Should be able to marshal the response: %s", err)
+			}
+
+			if string(data) != tst.exp {
+				t.Logf("got: %s", data)
+				t.Logf("exp: %s", tst.exp)
+				t.Fatalf("Should get the expected response.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_MaxDepth(t *testing.T) {
+	schema := newSchema(t)
+
+	query := `{ person(id: "1") ` + strings.Repeat("{ friends ", graphql.MaxDepth) + "{ name }" + strings.Repeat(" }", graphql.MaxDepth) + " }"
+
+	resp := schema.Execute(context.Background(), graphql.Request{Query: query})
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "maximum depth") {
+		t.Fatalf("Should reject a query nested too deeply, got %v.", resp.Errors)
+	}
+}
+
+func Test_SDL(t *testing.T) {
+	sdl := newSchema(t).SDL()
+
+	for _, exp := range []string{
+		"schema {\n  query: Query\n}",
+		"\"A person with friends.\"\ntype Person {",
+		"  friends(first: Int = 10): [Person!]!",
+		"  person(id: ID!): Person",
+	} {
+		if !strings.Contains(sdl, exp) {
+			t.Fatalf("Should contain %q in the SDL, got:\n%s", exp, sdl)
+		}
+	}
+}
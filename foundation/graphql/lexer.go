@@ -0,0 +1,278 @@
+package graphql
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind identifies the kind of lexical token in a document.
+type tokenKind int
+
+// The set of token kinds in a document.
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+// token represents a single lexical token and where it starts in the source.
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// lexer breaks a document into tokens.
+type lexer struct {
+	src string
+	pos int
+}
+
+// next returns the next token in the document.
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '.':
+		if !strings.HasPrefix(l.src[l.pos:], "...") {
+			return token{}, newError(l.src, start, "Unexpected character %q.", c)
+		}
+		l.pos += 3
+		return token{kind: tokPunct, value: "...", pos: start}, nil
+
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, value: string(c), pos: start}, nil
+
+	case isNameStart(c):
+		for l.pos < len(l.src) && isNameContinue(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokName, value: l.src[start:l.pos], pos: start}, nil
+
+	case c == '-' || isDigit(c):
+		return l.number()
+
+	case c == '"':
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			return l.blockString()
+		}
+		return l.string()
+	}
+
+	return token{}, newError(l.src, start, "Unexpected character %q.", c)
+}
+
+// skipIgnored moves past white space, commas and comments.
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case ' ', '\t', '\n', '\r', ',':
+			l.pos++
+
+		case '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+
+		default:
+			if strings.HasPrefix(l.src[l.pos:], "\ufeff") {
+				l.pos += len("\ufeff")
+				continue
+			}
+			return
+		}
+	}
+}
+
+// number reads an integer or float value.
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := tokInt
+
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	if !l.digits() {
+		return token{}, newError(l.src, start, "Invalid number, expected digit.")
+	}
+
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokFloat
+		l.pos++
+		if !l.digits() {
+			return token{}, newError(l.src, start, "Invalid number, expected digit after \".\".")
+		}
+	}
+
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if !l.digits() {
+			return token{}, newError(l.src, start, "Invalid number, expected digit in exponent.")
+		}
+	}
+
+	if l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || l.src[l.pos] == '.') {
+		return token{}, newError(l.src, l.pos, "Invalid number, unexpected character %q.", l.src[l.pos])
+	}
+
+	return token{kind: kind, value: l.src[start:l.pos], pos: start}, nil
+}
+
+// digits moves past a run of digits and reports if there were any.
+func (l *lexer) digits() bool {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+
+	return l.pos > start
+}
+
+// string reads a quoted string value and resolves the escape sequences.
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	l.pos++
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokString, value: b.String(), pos: start}, nil
+
+		case '\n', '\r':
+			return token{}, newError(l.src, l.pos, "Unterminated string.")
+
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, newError(l.src, l.pos, "Unterminated string.")
+			}
+			esc := l.src[l.pos+1]
+			l.pos += 2
+
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.src) {
+					return token{}, newError(l.src, l.pos, "Invalid unicode escape sequence.")
+				}
+				r, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return token{}, newError(l.src, l.pos, "Invalid unicode escape sequence.")
+				}
+				b.WriteRune(rune(r))
+				l.pos += 4
+			default:
+				return token{}, newError(l.src, l.pos-2, "Invalid character escape sequence \\%c.", esc)
+			}
+
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			b.WriteRune(r)
+			l.pos += size
+		}
+	}
+
+	return token{}, newError(l.src, l.pos, "Unterminated string.")
+}
+
+// blockString reads a triple quoted string and removes the common
+// indentation from its lines.
+func (l *lexer) blockString() (token, error) {
+	start := l.pos
+	l.pos += 3
+
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], `"""`):
+			l.pos += 3
+			return token{kind: tokString, value: dedent(b.String()), pos: start}, nil
+
+		case strings.HasPrefix(l.src[l.pos:], `\"""`):
+			b.WriteString(`"""`)
+			l.pos += 4
+
+		default:
+			b.WriteByte(l.src[l.pos])
+			l.pos++
+		}
+	}
+
+	return token{}, newError(l.src, l.pos, "Unterminated string.")
+}
+
+// dedent removes the common indentation and the leading and trailing blank
+// lines from a block string.
+func dedent(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+
+	common := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if indent := len(line) - len(trimmed); common == -1 || indent < common {
+			common = indent
+		}
+	}
+
+	if common > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= common {
+				lines[i] = lines[i][common:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
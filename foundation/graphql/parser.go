@@ -0,0 +1,678 @@
+package graphql
+
+import (
+	"strconv"
+)
+
+// document is the parsed form of a GraphQL request document.
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation is a query, mutation or subscription in a document.
+type operation struct {
+	kind       string
+	name       string
+	vars       []*varDef
+	directives []*directive
+	selections []selection
+	pos        int
+}
+
+// varDef is the definition of a variable for an operation.
+type varDef struct {
+	name   string
+	typ    *typeRef
+	defVal any
+	hasDef bool
+	pos    int
+}
+
+// typeRef is a reference to an input type in a variable definition.
+type typeRef struct {
+	name    string
+	elem    *typeRef
+	nonNull bool
+}
+
+// String returns the type reference in GraphQL notation.
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+
+	return s
+}
+
+// selection is a field, fragment spread or inline fragment.
+type selection any
+
+// field is a field selected from an object.
+type field struct {
+	alias      string
+	name       string
+	args       []*argument
+	directives []*directive
+	selections []selection
+	pos        int
+}
+
+// key returns the name of the field in the response.
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+
+	return f.name
+}
+
+// argument is a named value provided to a field or directive.
+type argument struct {
+	name  string
+	value any
+	pos   int
+}
+
+// directive is an annotation such as @skip or @include.
+type directive struct {
+	name string
+	args []*argument
+	pos  int
+}
+
+// fragmentSpread includes a named fragment in a selection set.
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	pos        int
+}
+
+// inlineFragment is an unnamed fragment within a selection set.
+type inlineFragment struct {
+	on         string
+	directives []*directive
+	selections []selection
+	pos        int
+}
+
+// fragment is a named fragment definition.
+type fragment struct {
+	name       string
+	on         string
+	selections []selection
+	pos        int
+}
+
+// The set of values in a document that don't map onto a Go value.
+type (
+	variable  string
+	enumValue string
+	nullValue struct{}
+)
+
+// objectValue is an input object literal with its fields in order.
+type objectValue []*argument
+
+// =============================================================================
+
+// parser builds a document from the tokens provided by the lexer.
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+// parse parses the source into a document.
+func parse(src string) (*document, error) {
+	p := parser{lex: &lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := document{
+		fragments: make(map[string]*fragment),
+	}
+
+	if p.tok.kind == tokEOF {
+		return nil, p.errorf(p.tok.pos, "Syntax Error: Unexpected <EOF>.")
+	}
+
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.peek("{"):
+			pos := p.tok.pos
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: sels, pos: pos})
+
+		case p.tok.kind == tokName && p.tok.value == "fragment":
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.fragments[frag.name]; exists {
+				return nil, p.errorf(frag.pos, "There can be only one fragment named %q.", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+
+		case p.tok.kind == tokName && (p.tok.value == "query" || p.tok.value == "mutation" || p.tok.value == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	return &doc, nil
+}
+
+// operation parses a named or anonymous operation.
+func (p *parser) operation() (*operation, error) {
+	op := operation{kind: p.tok.value, pos: p.tok.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind == tokName {
+		op.name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek("(") {
+		vars, err := p.varDefs()
+		if err != nil {
+			return nil, err
+		}
+		op.vars = vars
+	}
+
+	dirs, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	op.directives = dirs
+
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = sels
+
+	return &op, nil
+}
+
+// varDefs parses the variable definitions of an operation.
+func (p *parser) varDefs() ([]*varDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var defs []*varDef
+	for !p.peek(")") {
+		pos := p.tok.pos
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+
+		def := varDef{name: name, typ: typ, pos: pos}
+		if p.peek("=") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v, err := p.value(true)
+			if err != nil {
+				return nil, err
+			}
+			def.defVal = v
+			def.hasDef = true
+		}
+
+		defs = append(defs, &def)
+	}
+
+	return defs, p.advance()
+}
+
+// typeRef parses a type reference such as [Int!]!.
+func (p *parser) typeRef() (*typeRef, error) {
+	var t typeRef
+
+	switch {
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		elem, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		t.elem = elem
+
+	default:
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		t.name = name
+	}
+
+	if p.peek("!") {
+		t.nonNull = true
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// fragment parses a named fragment definition.
+func (p *parser) fragment() (*fragment, error) {
+	frag := fragment{pos: p.tok.pos}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.errorf(frag.pos, "Syntax Error: Unexpected Name \"on\".")
+	}
+	frag.name = name
+
+	if err := p.keyword("on"); err != nil {
+		return nil, err
+	}
+	on, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	frag.on = on
+
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	frag.selections = sels
+
+	return &frag, nil
+}
+
+// selectionSet parses a set of selections between braces.
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var sels []selection
+	for !p.peek("}") {
+		if p.tok.kind == tokEOF {
+			return nil, p.unexpected()
+		}
+
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+
+	if len(sels) == 0 {
+		return nil, p.errorf(p.tok.pos, "Syntax Error: Expected Name, found \"}\".")
+	}
+
+	return sels, p.advance()
+}
+
+// selection parses a field or a fragment.
+func (p *parser) selection() (selection, error) {
+	if p.peek("...") {
+		return p.fragmentSelection()
+	}
+
+	f := field{pos: p.tok.pos}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	f.name = name
+
+	if p.peek("(") {
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		f.args = args
+	}
+
+	dirs, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	f.directives = dirs
+
+	if p.peek("{") {
+		sels, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		f.selections = sels
+	}
+
+	return &f, nil
+}
+
+// fragmentSelection parses a fragment spread or an inline fragment.
+func (p *parser) fragmentSelection() (selection, error) {
+	pos := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind == tokName && p.tok.value != "on" {
+		spread := fragmentSpread{name: p.tok.value, pos: pos}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		dirs, err := p.directives()
+		if err != nil {
+			return nil, err
+		}
+		spread.directives = dirs
+
+		return &spread, nil
+	}
+
+	inline := inlineFragment{pos: pos}
+	if p.tok.kind == tokName {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		on, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		inline.on = on
+	}
+
+	dirs, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	inline.directives = dirs
+
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	inline.selections = sels
+
+	return &inline, nil
+}
+
+// arguments parses a list of arguments between parentheses.
+func (p *parser) arguments() ([]*argument, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var args []*argument
+	for !p.peek(")") {
+		pos := p.tok.pos
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, &argument{name: name, value: v, pos: pos})
+	}
+
+	return args, p.advance()
+}
+
+// directives parses the directives applied to an operation, field or
+// fragment.
+func (p *parser) directives() ([]*directive, error) {
+	var dirs []*directive
+	for p.peek("@") {
+		pos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+
+		d := directive{name: name, pos: pos}
+		if p.peek("(") {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			d.args = args
+		}
+		dirs = append(dirs, &d)
+	}
+
+	return dirs, nil
+}
+
+// value parses an input value. Variables aren't allowed in constant values
+// such as variable defaults.
+func (p *parser) value(constant bool) (any, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "Int cannot represent value %s.", tok.value)
+		}
+		return n, p.advance()
+
+	case tokFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "Float cannot represent value %s.", tok.value)
+		}
+		return f, p.advance()
+
+	case tokString:
+		return tok.value, p.advance()
+
+	case tokName:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nullValue{}, nil
+		}
+		return enumValue(tok.value), nil
+
+	case tokPunct:
+		switch tok.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected()
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return variable(name), nil
+
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			list := []any{}
+			for !p.peek("]") {
+				if p.tok.kind == tokEOF {
+					return nil, p.unexpected()
+				}
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, p.advance()
+
+		case "{":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			obj := objectValue{}
+			for !p.peek("}") {
+				pos := p.tok.pos
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, &argument{name: name, value: v, pos: pos})
+			}
+			return obj, p.advance()
+		}
+	}
+
+	return nil, p.unexpected()
+}
+
+// =============================================================================
+
+// advance moves to the next token.
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+
+	return nil
+}
+
+// peek identifies if the current token is the specified punctuator.
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.value == punct
+}
+
+// expect moves past the specified punctuator or fails.
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.errorf(p.tok.pos, "Syntax Error: Expected %q, found %s.", punct, describe(p.tok))
+	}
+
+	return p.advance()
+}
+
+// keyword moves past the specified name or fails.
+func (p *parser) keyword(value string) error {
+	if p.tok.kind != tokName || p.tok.value != value {
+		return p.errorf(p.tok.pos, "Syntax Error: Expected %q, found %s.", value, describe(p.tok))
+	}
+
+	return p.advance()
+}
+
+// name returns the current name token and moves past it.
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.errorf(p.tok.pos, "Syntax Error: Expected Name, found %s.", describe(p.tok))
+	}
+	name := p.tok.value
+
+	return name, p.advance()
+}
+
+// unexpected reports the current token as unexpected.
+func (p *parser) unexpected() error {
+	return p.errorf(p.tok.pos, "Syntax Error: Unexpected %s.", describe(p.tok))
+}
+
+// errorf constructs an error located at the specified position.
+func (p *parser) errorf(pos int, format string, args ...any) error {
+	return newError(p.lex.src, pos, format, args...)
+}
+
+// describe returns a description of a token for error messages.
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "<EOF>"
+	case tokName:
+		return "Name " + strconv.Quote(tok.value)
+	case tokInt:
+		return "Int " + tok.value
+	case tokFloat:
+		return "Float " + tok.value
+	case tokString:
+		return "String " + strconv.Quote(tok.value)
+	}
+
+	return strconv.Quote(tok.value)
+}
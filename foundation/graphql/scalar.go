@@ -0,0 +1,183 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// The set of built in scalars.
+var (
+	Int = &Scalar{
+		Name:        "Int",
+		Description: "A signed 32-bit integer.",
+		Serialize:   serializeInt,
+		Parse:       parseInt,
+	}
+
+	Float = &Scalar{
+		Name:        "Float",
+		Description: "A double precision floating point value.",
+		Serialize:   serializeFloat,
+		Parse:       parseFloat,
+	}
+
+	String = &Scalar{
+		Name:        "String",
+		Description: "A UTF-8 character sequence.",
+		Serialize:   serializeString,
+		Parse:       parseString,
+	}
+
+	Boolean = &Scalar{
+		Name:        "Boolean",
+		Description: "Either true or false.",
+		Serialize:   serializeBoolean,
+		Parse:       parseBoolean,
+	}
+
+	ID = &Scalar{
+		Name:        "ID",
+		Description: "A unique identifier serialized as a string.",
+		Serialize:   serializeString,
+		Parse:       parseID,
+	}
+)
+
+// =============================================================================
+
+func serializeInt(v any) (any, error) {
+	n, ok := toInt64(v)
+	if !ok || n < math.MinInt32 || n > math.MaxInt32 {
+		return nil, fmt.Errorf("Int cannot represent value: %v", v)
+	}
+
+	return n, nil
+}
+
+func parseInt(v any) (any, error) {
+	n, ok := toInt64(v)
+	if !ok || n < math.MinInt32 || n > math.MaxInt32 {
+		return nil, fmt.Errorf("Int cannot represent value: %v", v)
+	}
+
+	return int(n), nil
+}
+
+func serializeFloat(v any) (any, error) {
+	f, ok := toFloat64(v)
+	if !ok {
+		return nil, fmt.Errorf("Float cannot represent value: %v", v)
+	}
+
+	return f, nil
+}
+
+func parseFloat(v any) (any, error) {
+	return serializeFloat(v)
+}
+
+func serializeString(v any) (any, error) {
+	switch v := v.(type) {
+	case fmt.Stringer:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	}
+
+	return nil, fmt.Errorf("String cannot represent value: %v", v)
+}
+
+func parseString(v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("String cannot represent a non string value: %v", v)
+	}
+
+	return s, nil
+}
+
+func serializeBoolean(v any) (any, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("Boolean cannot represent a non boolean value: %v", v)
+	}
+
+	return b, nil
+}
+
+func parseBoolean(v any) (any, error) {
+	return serializeBoolean(v)
+}
+
+func parseID(v any) (any, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	if n, ok := toInt64(v); ok {
+		return strconv.FormatInt(n, 10), nil
+	}
+
+	return nil, fmt.Errorf("ID cannot represent value: %v", v)
+}
+
+// =============================================================================
+
+// toInt64 converts an integer value, including an integral float decoded
+// from JSON, into an int64.
+func toInt64(v any) (int64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(rv.Uint()), true
+	}
+
+	return 0, false
+}
+
+// toFloat64 converts a numeric value into a float64.
+func toFloat64(v any) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+
+	if n, ok := toInt64(v); ok {
+		return float64(n), true
+	}
+
+	return 0, false
+}
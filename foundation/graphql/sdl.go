@@ -0,0 +1,107 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The scalars every schema has, which aren't printed in the SDL.
+var builtinScalars = map[string]bool{
+	"Int":     true,
+	"Float":   true,
+	"String":  true,
+	"Boolean": true,
+	"ID":      true,
+}
+
+// SDL returns the schema in the GraphQL schema definition language. Clients
+// can use it to generate code or explore the API.
+func (s *Schema) SDL() string {
+	var b strings.Builder
+
+	b.WriteString("schema {\n  query: ")
+	b.WriteString(s.query.Name)
+	b.WriteString("\n}\n")
+
+	for _, name := range sortedKeys(s.types) {
+		switch t := s.types[name].(type) {
+		case *Scalar:
+			if builtinScalars[name] {
+				continue
+			}
+			b.WriteString("\n")
+			writeDescription(&b, t.Description, "")
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+
+		case *Object:
+			b.WriteString("\n")
+			writeDescription(&b, t.Description, "")
+			fmt.Fprintf(&b, "type %s {\n", t.Name)
+
+			for _, fieldName := range sortedKeys(t.Fields) {
+				f := t.Fields[fieldName]
+				writeDescription(&b, f.Description, "  ")
+				fmt.Fprintf(&b, "  %s%s: %s\n", fieldName, writeArgs(f.Args), f.Type)
+			}
+
+			b.WriteString("}\n")
+		}
+	}
+
+	return b.String()
+}
+
+// writeArgs returns the argument definitions of a field.
+func writeArgs(args Args) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	list := make([]string, 0, len(args))
+	for _, name := range sortedKeys(args) {
+		arg := args[name]
+
+		s := fmt.Sprintf("%s: %s", name, arg.Type)
+		if arg.DefaultValue != nil {
+			s += " = " + literal(arg.DefaultValue)
+		}
+		list = append(list, s)
+	}
+
+	return "(" + strings.Join(list, ", ") + ")"
+}
+
+// writeDescription writes the description as a block string.
+func writeDescription(b *strings.Builder, description string, indent string) {
+	if description == "" {
+		return
+	}
+
+	if !strings.Contains(description, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, strconv.Quote(description))
+		return
+	}
+
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+	for _, line := range strings.Split(description, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, strings.ReplaceAll(line, `"""`, `\"""`))
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+}
+
+// literal returns a default value in GraphQL notation.
+func literal(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = literal(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	return fmt.Sprint(v)
+}
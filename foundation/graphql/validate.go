@@ -0,0 +1,433 @@
+package graphql
+
+import (
+	"fmt"
+)
+
+// The directives supported in a query.
+var directiveArgs = map[string]Args{
+	"skip":    {"if": {Type: NonNullOf(Boolean)}},
+	"include": {"if": {Type: NonNullOf(Boolean)}},
+}
+
+// varUsage records where a variable is used and the type expected there.
+type varUsage struct {
+	name    string
+	locType Type
+	pos     int
+}
+
+// fragInfo records what was learned validating a fragment so a fragment
+// spread many times is only validated once.
+type fragInfo struct {
+	depth  int
+	usages []varUsage
+}
+
+// validator checks a document against the schema before it's executed.
+type validator struct {
+	schema *Schema
+	doc    *document
+	src    string
+	errs   []*Error
+	seen   map[string]bool
+	frags  map[string]*fragInfo
+	stack  map[string]bool
+	used   map[string]bool
+}
+
+// validate checks the document against the schema and returns every
+// problem found.
+func (s *Schema) validate(doc *document, src string) []*Error {
+	v := validator{
+		schema: s,
+		doc:    doc,
+		src:    src,
+		seen:   make(map[string]bool),
+		frags:  make(map[string]*fragInfo),
+		stack:  make(map[string]bool),
+		used:   make(map[string]bool),
+	}
+
+	names := make(map[string]bool)
+	for _, op := range doc.operations {
+		switch {
+		case op.name == "" && len(doc.operations) > 1:
+			v.errorf(op.pos, "This anonymous operation must be the only defined operation.")
+		case op.name != "" && names[op.name]:
+			v.errorf(op.pos, "There can be only one operation named %q.", op.name)
+		}
+		names[op.name] = true
+
+		v.operation(op)
+	}
+
+	for _, name := range sortedKeys(doc.fragments) {
+		frag := doc.fragments[name]
+		if !v.used[name] {
+			v.errorf(frag.pos, "Fragment %q is never used.", name)
+		}
+
+		// Fragments that aren't used still need to be valid.
+		v.fragment(frag)
+	}
+
+	return v.errs
+}
+
+// operation validates an operation and the variables it uses.
+func (v *validator) operation(op *operation) {
+	if op.kind != "query" {
+		v.errorf(op.pos, "Only queries are supported, %s operations are not.", op.kind)
+		return
+	}
+
+	for _, d := range op.directives {
+		v.errorf(d.pos, "Directive \"@%s\" may not be used on QUERY.", d.name)
+	}
+
+	defs := make(map[string]*varDef)
+	types := make(map[string]Type)
+	for _, def := range op.vars {
+		if defs[def.name] != nil {
+			v.errorf(def.pos, "There can be only one variable named \"$%s\".", def.name)
+			continue
+		}
+		defs[def.name] = def
+
+		t, err := v.schema.typeFromRef(def.typ)
+		if err != nil {
+			v.errorf(def.pos, "Variable \"$%s\" %s", def.name, err)
+			continue
+		}
+		types[def.name] = t
+
+		if def.hasDef {
+			if _, err := coerceInput(t, def.defVal, nil); err != nil {
+				v.errorf(def.pos, "Variable \"$%s\" has invalid default value: %s", def.name, err)
+			}
+		}
+	}
+
+	var usages []varUsage
+	depth := v.selections(v.schema.query, op.selections, &usages)
+	if depth > MaxDepth {
+		v.errorf(op.pos, "Query exceeds the maximum depth of %d.", MaxDepth)
+	}
+
+	usedVars := make(map[string]bool)
+	for _, u := range usages {
+		usedVars[u.name] = true
+
+		def, exists := defs[u.name]
+		if !exists {
+			v.errorf(u.pos, "Variable \"$%s\" is not defined.", u.name)
+			continue
+		}
+
+		varType, exists := types[u.name]
+		if !exists {
+			continue
+		}
+
+		// A nullable variable with a default can be used where a non null
+		// value is expected.
+		if nn, ok := u.locType.(*NonNull); ok && !isNonNull(varType) && def.hasDef && !isNullValue(def.defVal) {
+			if typeCompatible(varType, nn.OfType) {
+				continue
+			}
+		}
+
+		if !typeCompatible(varType, u.locType) {
+			v.errorf(u.pos, "Variable \"$%s\" of type %q used in position expecting type %q.", u.name, varType, u.locType)
+		}
+	}
+
+	for _, def := range op.vars {
+		if !usedVars[def.name] {
+			v.errorf(def.pos, "Variable \"$%s\" is never used.", def.name)
+		}
+	}
+}
+
+// selections validates a selection set against the object type and returns
+// how deeply the selections are nested.
+func (v *validator) selections(obj *Object, sels []selection, usages *[]varUsage) int {
+	var depth int
+
+	for _, sel := range sels {
+		var d int
+
+		switch sel := sel.(type) {
+		case *field:
+			v.directives(sel.directives, usages)
+			d = v.field(obj, sel, usages)
+
+		case *fragmentSpread:
+			v.directives(sel.directives, usages)
+			d = v.spread(obj, sel, usages)
+
+		case *inlineFragment:
+			v.directives(sel.directives, usages)
+			if sel.on != "" && !v.condition(obj, sel.on, sel.pos) {
+				continue
+			}
+			d = v.selections(obj, sel.selections, usages)
+		}
+
+		depth = max(depth, d)
+	}
+
+	return depth
+}
+
+// field validates a field selected from the object type.
+func (v *validator) field(obj *Object, f *field, usages *[]varUsage) int {
+	if f.name == "__typename" {
+		if len(f.args) > 0 {
+			v.errorf(f.args[0].pos, "Unknown argument %q on field %q.", f.args[0].name, f.name)
+		}
+		if len(f.selections) > 0 {
+			v.errorf(f.pos, "Field %q must not have a selection since type \"String!\" has no subfields.", f.name)
+		}
+		return 1
+	}
+
+	def, exists := obj.Fields[f.name]
+	if !exists {
+		v.errorf(f.pos, "Cannot query field %q on type %q.", f.name, obj.Name)
+		return 1
+	}
+
+	v.arguments(fmt.Sprintf("Field %q", f.name), def.Args, f.args, f.pos, usages)
+
+	switch t := namedType(def.Type).(type) {
+	case *Object:
+		if len(f.selections) == 0 {
+			v.errorf(f.pos, "Field %q of type %q must have a selection of subfields.", f.name, def.Type)
+			return 1
+		}
+		return 1 + v.selections(t, f.selections, usages)
+
+	default:
+		if len(f.selections) > 0 {
+			v.errorf(f.pos, "Field %q must not have a selection since type %q has no subfields.", f.name, def.Type)
+		}
+		return 1
+	}
+}
+
+// spread validates a fragment spread. The fragment itself is validated the
+// first time it's spread.
+func (v *validator) spread(obj *Object, s *fragmentSpread, usages *[]varUsage) int {
+	frag, exists := v.doc.fragments[s.name]
+	if !exists {
+		v.errorf(s.pos, "Unknown fragment %q.", s.name)
+		return 0
+	}
+	v.used[s.name] = true
+
+	if v.stack[s.name] {
+		v.errorf(s.pos, "Cannot spread fragment %q within itself.", s.name)
+		return 0
+	}
+
+	if !v.condition(obj, frag.on, s.pos) {
+		return 0
+	}
+
+	info := v.fragment(frag)
+	*usages = append(*usages, info.usages...)
+
+	return info.depth
+}
+
+// fragment validates a fragment definition once and records its depth and
+// the variables it uses.
+func (v *validator) fragment(frag *fragment) *fragInfo {
+	if info, exists := v.frags[frag.name]; exists {
+		return info
+	}
+
+	info := fragInfo{}
+	v.frags[frag.name] = &info
+
+	t, exists := v.schema.types[frag.on]
+	if !exists {
+		v.errorf(frag.pos, "Unknown type %q.", frag.on)
+		return &info
+	}
+	obj, ok := t.(*Object)
+	if !ok {
+		v.errorf(frag.pos, "Fragment %q cannot condition on non composite type %q.", frag.name, frag.on)
+		return &info
+	}
+
+	v.stack[frag.name] = true
+	info.depth = v.selections(obj, frag.selections, &info.usages)
+	delete(v.stack, frag.name)
+
+	return &info
+}
+
+// condition validates the type condition of a fragment can apply to the
+// object type.
+func (v *validator) condition(obj *Object, on string, pos int) bool {
+	t, exists := v.schema.types[on]
+	if !exists {
+		v.errorf(pos, "Unknown type %q.", on)
+		return false
+	}
+
+	if t != Type(obj) {
+		v.errorf(pos, "Fragment cannot be spread here as objects of type %q can never be of type %q.", obj.Name, on)
+		return false
+	}
+
+	return true
+}
+
+// directives validates the directives applied to a selection.
+func (v *validator) directives(dirs []*directive, usages *[]varUsage) {
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		defs, exists := directiveArgs[d.name]
+		if !exists {
+			v.errorf(d.pos, "Unknown directive \"@%s\".", d.name)
+			continue
+		}
+		if seen[d.name] {
+			v.errorf(d.pos, "The directive \"@%s\" can only be used once at this location.", d.name)
+		}
+		seen[d.name] = true
+
+		v.arguments(fmt.Sprintf("Directive \"@%s\"", d.name), defs, d.args, d.pos, usages)
+	}
+}
+
+// arguments validates the arguments provided against their definitions.
+func (v *validator) arguments(owner string, defs Args, args []*argument, pos int, usages *[]varUsage) {
+	provided := make(map[string]bool)
+	for _, arg := range args {
+		if provided[arg.name] {
+			v.errorf(arg.pos, "There can be only one argument named %q.", arg.name)
+			continue
+		}
+		provided[arg.name] = true
+
+		def, exists := defs[arg.name]
+		if !exists {
+			v.errorf(arg.pos, "Unknown argument %q on %s.", arg.name, owner)
+			continue
+		}
+
+		v.value(def.Type, arg.value, arg.name, arg.pos, usages)
+	}
+
+	for _, name := range sortedKeys(defs) {
+		def := defs[name]
+		if !provided[name] && isNonNull(def.Type) && def.DefaultValue == nil {
+			v.errorf(pos, "%s argument %q of type %q is required, but it was not provided.", owner, name, def.Type)
+		}
+	}
+}
+
+// value validates a literal against the type expected, recording any
+// variables used within it.
+func (v *validator) value(t Type, val any, name string, pos int, usages *[]varUsage) {
+	if ref, ok := val.(variable); ok {
+		*usages = append(*usages, varUsage{name: string(ref), locType: t, pos: pos})
+		return
+	}
+
+	if !hasVariable(val) {
+		if _, err := coerceInput(t, val, nil); err != nil {
+			v.errorf(pos, "Argument %q has invalid value: %s", name, err)
+		}
+		return
+	}
+
+	// The value is a list holding variables.
+	elem := t
+	if nn, ok := elem.(*NonNull); ok {
+		elem = nn.OfType
+	}
+	list, ok := elem.(*List)
+	if !ok {
+		v.errorf(pos, "Argument %q has invalid value: expected type %q.", name, t)
+		return
+	}
+	for _, item := range val.([]any) {
+		v.value(list.OfType, item, name, pos, usages)
+	}
+}
+
+// errorf records an error located at the specified position. The same error
+// is only recorded once.
+func (v *validator) errorf(pos int, format string, args ...any) {
+	err := newError(v.src, pos, format, args...)
+
+	key := err.Error()
+	if v.seen[key] {
+		return
+	}
+	v.seen[key] = true
+
+	v.errs = append(v.errs, err)
+}
+
+// =============================================================================
+
+// typeFromRef resolves a type reference from a variable definition.
+func (s *Schema) typeFromRef(ref *typeRef) (Type, error) {
+	var t Type
+
+	switch {
+	case ref.elem != nil:
+		elem, err := s.typeFromRef(ref.elem)
+		if err != nil {
+			return nil, err
+		}
+		t = ListOf(elem)
+
+	default:
+		named, exists := s.types[ref.name]
+		if !exists {
+			return nil, fmt.Errorf("has unknown type %q.", ref.name)
+		}
+		if _, ok := named.(*Scalar); !ok {
+			return nil, fmt.Errorf("cannot be non-input type %q.", ref.name)
+		}
+		t = named
+	}
+
+	if ref.nonNull {
+		t = NonNullOf(t)
+	}
+
+	return t, nil
+}
+
+// hasVariable identifies if the literal holds a variable.
+func hasVariable(val any) bool {
+	switch val := val.(type) {
+	case variable:
+		return true
+
+	case []any:
+		for _, item := range val {
+			if hasVariable(item) {
+				return true
+			}
+		}
+
+	case objectValue:
+		for _, f := range val {
+			if hasVariable(f.value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
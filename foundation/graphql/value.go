@@ -0,0 +1,156 @@
+package graphql
+
+import (
+	"fmt"
+)
+
+// coerceInput converts a literal from the document, or a value decoded from
+// JSON, into the value of the specified input type.
+func coerceInput(t Type, v any, vars map[string]any) (any, error) {
+	if name, ok := v.(variable); ok {
+		v = vars[string(name)]
+		if v == nil {
+			if nn, ok := t.(*NonNull); ok {
+				return nil, fmt.Errorf("Expected value of non-null type %q, found null.", nn)
+			}
+			return nil, nil
+		}
+
+		// Variables are coerced to their own type before execution.
+		return v, nil
+	}
+
+	if nn, ok := t.(*NonNull); ok {
+		if isNullValue(v) {
+			return nil, fmt.Errorf("Expected value of non-null type %q, found null.", nn)
+		}
+		return coerceInput(nn.OfType, v, vars)
+	}
+
+	if isNullValue(v) {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items, ok := v.([]any)
+		if !ok {
+			item, err := coerceInput(t.OfType, v, vars)
+			if err != nil {
+				return nil, err
+			}
+			return []any{item}, nil
+		}
+
+		list := make([]any, len(items))
+		for i, item := range items {
+			value, err := coerceInput(t.OfType, item, vars)
+			if err != nil {
+				return nil, fmt.Errorf("In element #%d: %w", i, err)
+			}
+			list[i] = value
+		}
+		return list, nil
+
+	case *Scalar:
+		switch v := v.(type) {
+		case enumValue:
+			return nil, fmt.Errorf("%s cannot represent value: %s", t.Name, string(v))
+		case objectValue, map[string]any:
+			return nil, fmt.Errorf("%s cannot represent an object value", t.Name)
+		}
+		return t.Parse(v)
+	}
+
+	return nil, fmt.Errorf("Type %q is not an input type.", t)
+}
+
+// isNullValue identifies if the value is null in the document or in the
+// JSON variables.
+func isNullValue(v any) bool {
+	if v == nil {
+		return true
+	}
+	_, ok := v.(nullValue)
+
+	return ok
+}
+
+// typeCompatible identifies if a variable of the specified type can be used
+// where a value of the location type is expected.
+func typeCompatible(varType Type, locType Type) bool {
+	if ln, ok := locType.(*NonNull); ok {
+		vn, ok := varType.(*NonNull)
+		if !ok {
+			return false
+		}
+		return typeCompatible(vn.OfType, ln.OfType)
+	}
+
+	if vn, ok := varType.(*NonNull); ok {
+		return typeCompatible(vn.OfType, locType)
+	}
+
+	if ll, ok := locType.(*List); ok {
+		vl, ok := varType.(*List)
+		if !ok {
+			return false
+		}
+		return typeCompatible(vl.OfType, ll.OfType)
+	}
+
+	if _, ok := varType.(*List); ok {
+		return false
+	}
+
+	return varType == locType
+}
+
+// =============================================================================
+
+// coerceArgs converts the arguments provided for a field or directive into
+// their types, applying the defaults for the arguments not provided.
+func coerceArgs(defs Args, args []*argument, vars map[string]any) (map[string]any, error) {
+	values := make(map[string]any, len(defs))
+
+	for name, def := range defs {
+		var arg *argument
+		for _, a := range args {
+			if a.name == name {
+				arg = a
+				break
+			}
+		}
+
+		provided := arg != nil
+		if provided {
+			if ref, ok := arg.value.(variable); ok {
+				_, provided = vars[string(ref)]
+			}
+		}
+
+		if !provided {
+			switch {
+			case def.DefaultValue != nil:
+				values[name] = def.DefaultValue
+			case isNonNull(def.Type):
+				return nil, fmt.Errorf("Argument %q of required type %q was not provided.", name, def.Type)
+			}
+			continue
+		}
+
+		v, err := coerceInput(def.Type, arg.value, vars)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %q has invalid value: %w", name, err)
+		}
+		values[name] = v
+	}
+
+	return values, nil
+}
+
+// isNonNull identifies if the type is a non null type.
+func isNonNull(t Type) bool {
+	_, ok := t.(*NonNull)
+	return ok
+}
@@ -0,0 +1,328 @@
+// Package openapi builds an OpenAPI 3 document that describes a set of HTTP
+// routes. The schemas for the request and response bodies are generated from
+// their Go types, using the json tags for the property names and the validate
+// tags for the constraints the values are checked against.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Version is the version of the OpenAPI specification the document follows.
+const Version = "3.0.3"
+
+// Info provides metadata about the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a location the API is served from.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem describes the operations available on a path, keyed by the
+// method in lower case.
+type PathItem map[string]*Operation
+
+// Operation describes a single route.
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+	Servers     []Server              `json:"servers,omitempty"`
+
+	// Request and Response are values of the types the operation accepts
+	// and returns as JSON. They are converted to schemas when the operation
+	// is added to the document. The request body is required unless the
+	// operation describes it. The status of the response defaults to 200.
+	Request  any `json:"-"`
+	Response any `json:"-"`
+	Status   int `json:"-"`
+}
+
+// Parameter describes a path, query or header parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// Set of locations for a parameter.
+const (
+	InPath   = "path"
+	InQuery  = "query"
+	InHeader = "header"
+)
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response describes a response for a status code.
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header describes a header sent with a response.
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// MediaType provides the schema for a content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// SecurityRequirement lists the security schemes that must be satisfied
+// together. An empty requirement means no credentials are required.
+type SecurityRequirement map[string][]string
+
+// SecurityScheme describes how a client provides credentials.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Components holds the schemas and security schemes that operations refer to.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// ContentJSON is the content type of the request and response bodies.
+const ContentJSON = "application/json"
+
+// =============================================================================
+
+// Document is an OpenAPI document. It's safe to add operations while the
+// document is being served.
+type Document struct {
+	mu         sync.RWMutex
+	info       Info
+	servers    []Server
+	paths      map[string]PathItem
+	components Components
+	fallback   *Response
+}
+
+// New constructs an empty document for the API.
+func New(info Info, servers ...Server) *Document {
+	return &Document{
+		info:    info,
+		servers: servers,
+		paths:   make(map[string]PathItem),
+		components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+	}
+}
+
+// SecurityScheme adds a security scheme operations can require by name.
+func (d *Document) SecurityScheme(name string, scheme SecurityScheme) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.components.SecuritySchemes[name] = scheme
+}
+
+// DefaultResponse sets the response for the status codes an operation
+// doesn't describe, which is how the API reports errors.
+func (d *Document) DefaultResponse(description string, v any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.fallback = &Response{
+		Description: description,
+		Content:     d.content(v),
+	}
+}
+
+// Add describes the route for the method and path. The path can use the
+// :name and *name parameters of the router, which are described as path
+// parameters unless the operation already describes them.
+func (d *Document) Add(method string, path string, op Operation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path, params := convertPath(path)
+
+	// The slices and maps of the operation can be shared with other
+	// operations so they are copied before anything is added.
+	op.Parameters = append([]Parameter(nil), op.Parameters...)
+	for _, name := range params {
+		if !hasParameter(op.Parameters, name, InPath) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     name,
+				In:       InPath,
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+
+	if op.Request != nil {
+		body := RequestBody{Required: true}
+		if op.RequestBody != nil {
+			body = *op.RequestBody
+		}
+		if body.Content == nil {
+			body.Content = d.content(op.Request)
+		}
+		op.RequestBody = &body
+	}
+
+	responses := make(map[string]Response, len(op.Responses)+2)
+	for code, resp := range op.Responses {
+		responses[code] = resp
+	}
+	op.Responses = responses
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	code := strconv.Itoa(status)
+	if _, exists := op.Responses[code]; !exists {
+		op.Responses[code] = Response{
+			Description: http.StatusText(status),
+			Content:     d.content(op.Response),
+		}
+	}
+
+	if _, exists := op.Responses["default"]; !exists && d.fallback != nil {
+		op.Responses["default"] = *d.fallback
+	}
+
+	item, exists := d.paths[path]
+	if !exists {
+		item = make(PathItem)
+		d.paths[path] = item
+	}
+	item[strings.ToLower(method)] = &op
+}
+
+// Operation returns the operation for the method and path.
+func (d *Document) Operation(method string, path string) (Operation, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	path, _ = convertPath(path)
+
+	op, exists := d.paths[path][strings.ToLower(method)]
+	if !exists {
+		return Operation{}, false
+	}
+
+	return *op, true
+}
+
+// Schema returns the schema for the Go value. Named struct types are added
+// to the components of the document and a reference to them is returned.
+func (d *Document) Schema(v any) *Schema {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.schemaOf(v)
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d *Document) MarshalJSON() ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	doc := struct {
+		OpenAPI    string              `json:"openapi"`
+		Info       Info                `json:"info"`
+		Servers    []Server            `json:"servers,omitempty"`
+		Paths      map[string]PathItem `json:"paths"`
+		Components Components          `json:"components"`
+	}{
+		OpenAPI:    Version,
+		Info:       d.info,
+		Servers:    d.servers,
+		Paths:      d.paths,
+		Components: d.components,
+	}
+
+	return json.Marshal(doc)
+}
+
+// ServeHTTP implements the http.Handler interface so the document can be
+// served as JSON.
+func (d *Document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// =============================================================================
+
+// content returns the JSON content for the value or nil if there is no value.
+func (d *Document) content(v any) map[string]MediaType {
+	if v == nil {
+		return nil
+	}
+
+	return map[string]MediaType{
+		ContentJSON: {Schema: d.schemaOf(v)},
+	}
+}
+
+// routeParam matches the named parameters of the router.
+var routeParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// convertPath converts the parameters in a router path to the OpenAPI
+// format and returns their names.
+func convertPath(path string) (string, []string) {
+	var params []string
+	path = routeParam.ReplaceAllStringFunc(path, func(s string) string {
+		params = append(params, s[1:])
+		return "{" + s[1:] + "}"
+	})
+
+	return path, params
+}
+
+// hasParameter reports whether the parameter is in the list.
+func hasParameter(params []Parameter, name string, in string) bool {
+	for _, p := range params {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,179 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/openapi"
+)
+
+type base struct {
+	ID   string `json:"id" validate:"required,len=42,startswith=0x,hexadecimal"`
+	Kind string `json:"kind" validate:"omitempty,oneof=a b"`
+}
+
+type node struct {
+	base
+	Value    uint64            `json:"value" validate:"required,max=10"`
+	Sig      *big.Int          `json:"sig" validate:"required"`
+	Data     []byte            `json:"data"`
+	Tags     []string          `json:"tags" validate:"min=1,dive,required"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Created  time.Time         `json:"created"`
+	Count    int64             `json:"count,string"`
+	Children []node            `json:"children"`
+	Ignored  string            `json:"-"`
+	internal string
+}
+
+func Test_Schema(t *testing.T) {
+	doc := openapi.New(openapi.Info{Title: "test", Version: "1"})
+
+	ref := doc.Schema(node{})
+	if ref.Ref != "#/components/schemas/openapi_test.node" {
+		t.Fatalf("Should reference the named struct, got %q.", ref.Ref)
+	}
+
+	var out struct {
+		Components struct {
+			Schemas map[string]openapi.Schema `json:"schemas"`
+		} `json:"components"`
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Should be able to marshal the document: %s", err)
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Should be able to unmarshal the document: %s", err)
+	}
+
+	s, exists := out.Components.Schemas["openapi_test.node"]
+	if !exists {
+		t.Fatalf("Should add the struct to the components.")
+	}
+
+	for _, name := range []string{"id", "kind", "value", "sig", "data", "tags", "labels", "created", "count", "children"} {
+		if _, exists := s.Properties[name]; !exists {
+			t.Fatalf("Should have property %q.", name)
+		}
+	}
+	if len(s.Properties) != 10 {
+		t.Fatalf("Should skip ignored and unexported fields, got %d properties.", len(s.Properties))
+	}
+
+	slices.Sort(s.Required)
+	if !slices.Equal(s.Required, []string{"id", "sig", "value"}) {
+		t.Fatalf("Should require the fields tagged as required, got %v.", s.Required)
+	}
+
+	id := s.Properties["id"]
+	if id.Type != "string" || *id.MinLength != 42 || *id.MaxLength != 42 || id.Pattern != "^0x[0-9a-fA-F]+$" {
+		t.Fatalf("Should apply the validate tags to the embedded id, got %+v.", id)
+	}
+
+	if kind := s.Properties["kind"]; len(kind.Enum) != 2 {
+		t.Fatalf("Should list the values for oneof, got %v.", kind.Enum)
+	}
+
+	value := s.Properties["value"]
+	if value.Type != "integer" || value.Format != "int64" || *value.Minimum != 0 || *value.Maximum != 10 {
+		t.Fatalf("Should describe an unsigned number with a maximum, got %+v.", value)
+	}
+
+	if sig := s.Properties["sig"]; sig.Type != "integer" {
+		t.Fatalf("Should describe a big integer as an integer, got %+v.", sig)
+	}
+
+	if data := s.Properties["data"]; data.Type != "string" || data.Format != "byte" {
+		t.Fatalf("Should describe bytes as a base64 string, got %+v.", data)
+	}
+
+	tags := s.Properties["tags"]
+	if tags.Type != "array" || tags.Items.Type != "string" || *tags.MinItems != 1 {
+		t.Fatalf("Should describe the array and its minimum items, got %+v.", tags)
+	}
+
+	if labels := s.Properties["labels"]; labels.Type != "object" || labels.AdditionalProperties.Type != "string" {
+		t.Fatalf("Should describe a map as an object, got %+v.", labels)
+	}
+
+	if created := s.Properties["created"]; created.Type != "string" || created.Format != "date-time" {
+		t.Fatalf("Should describe a time as a date-time, got %+v.", created)
+	}
+
+	if count := s.Properties["count"]; count.Type != "string" {
+		t.Fatalf("Should describe a number with the string option as a string, got %+v.", count)
+	}
+
+	if children := s.Properties["children"]; children.Items.Ref != ref.Ref {
+		t.Fatalf("Should reference the struct that refers to itself, got %+v.", children.Items)
+	}
+}
+
+func Test_Add(t *testing.T) {
+	type errResp struct {
+		Error string `json:"error"`
+	}
+
+	doc := openapi.New(openapi.Info{Title: "test", Version: "1"}, openapi.Server{URL: "http://localhost:8080"})
+	doc.DefaultResponse("error", errResp{})
+
+	doc.Add(http.MethodPost, "/v1/items/:id/parts/:part", openapi.Operation{
+		Summary:  "add part",
+		Request:  node{},
+		Response: []node{},
+		Status:   http.StatusCreated,
+		Parameters: []openapi.Parameter{
+			{Name: "part", In: openapi.InPath, Required: true, Schema: &openapi.Schema{Type: "integer"}},
+		},
+	})
+
+	op, exists := doc.Operation(http.MethodPost, "/v1/items/:id/parts/:part")
+	if !exists {
+		t.Fatalf("Should find the operation by the router path.")
+	}
+
+	if len(op.Parameters) != 2 {
+		t.Fatalf("Should add the missing path parameter, got %d parameters.", len(op.Parameters))
+	}
+	if op.Parameters[0].Schema.Type != "integer" || op.Parameters[1].Name != "id" {
+		t.Fatalf("Should keep the described parameter and add the other, got %+v.", op.Parameters)
+	}
+
+	if op.RequestBody == nil || op.RequestBody.Content[openapi.ContentJSON].Schema.Ref == "" {
+		t.Fatalf("Should describe the request body.")
+	}
+
+	created, exists := op.Responses["201"]
+	if !exists || created.Content[openapi.ContentJSON].Schema.Type != "array" {
+		t.Fatalf("Should describe the response for the status, got %+v.", op.Responses)
+	}
+
+	if _, exists := op.Responses["default"]; !exists {
+		t.Fatalf("Should add the default response.")
+	}
+
+	w := httptest.NewRecorder()
+	doc.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var out struct {
+		OpenAPI string                     `json:"openapi"`
+		Servers []openapi.Server           `json:"servers"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatalf("Should serve the document as JSON: %s", err)
+	}
+
+	if out.OpenAPI != openapi.Version || len(out.Servers) != 1 {
+		t.Fatalf("Should serve the version and servers, got %s %v.", out.OpenAPI, out.Servers)
+	}
+	if _, exists := out.Paths["/v1/items/{id}/parts/{part}"]; !exists {
+		t.Fatalf("Should convert the router parameters in the path, got %v.", out.Paths)
+	}
+}
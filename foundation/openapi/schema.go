@@ -0,0 +1,325 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"math/big"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema describes the JSON representation of a value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// Set of types that don't marshal based on their kind.
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	bigIntType    = reflect.TypeOf(big.Int{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaOf returns the schema for the value. The caller must hold the lock.
+func (d *Document) schemaOf(v any) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+
+	return d.schemaFor(reflect.TypeOf(v))
+}
+
+// schemaFor returns the schema for the type.
+func (d *Document) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+
+	case bigIntType:
+		return &Schema{Type: "integer"}
+
+	case rawType:
+		return &Schema{}
+	}
+
+	// Types that marshal themselves can't be described from their fields.
+	// Those that marshal to text are at least known to be strings.
+	ptr := reflect.PointerTo(t)
+	switch {
+	case t.Implements(marshalerType) || ptr.Implements(marshalerType):
+		return &Schema{}
+
+	case t.Implements(textType) || ptr.Implements(textType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer", Format: intFormat(t)}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: intFormat(t), Minimum: &zero}
+
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+
+	case reflect.String:
+		return &Schema{Type: "string"}
+
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaFor(t.Elem())}
+
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaFor(t.Elem())}
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+
+		// Named structs are described once in the components. The entry is
+		// added before the fields are described so a type that refers to
+		// itself doesn't recurse forever.
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, exists := d.components.Schemas[name]; !exists {
+			d.components.Schemas[name] = &Schema{}
+			*d.components.Schemas[name] = *d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	// Interfaces and the kinds that can't be marshaled can hold anything.
+	return &Schema{}
+}
+
+// structSchema describes the exported fields of the struct. The fields of
+// embedded structs are promoted like the json package does.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+
+	for i := range t.NumField() {
+		fld := t.Field(i)
+
+		name, opts, _ := strings.Cut(fld.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		if fld.Anonymous && name == "" {
+			ft := fld.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded := d.structSchema(ft)
+				for n, p := range embedded.Properties {
+					s.Properties[n] = p
+				}
+				s.Required = append(s.Required, embedded.Required...)
+				continue
+			}
+		}
+
+		if !fld.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = fld.Name
+		}
+
+		p := d.schemaFor(fld.Type)
+
+		// The string option marshals a number or bool as a string.
+		if strings.Contains(","+opts+",", ",string,") {
+			switch p.Type {
+			case "integer", "number", "boolean":
+				p = &Schema{Type: "string", Format: p.Type}
+			}
+		}
+
+		if applyValidate(p, fld.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+
+		s.Properties[name] = p
+	}
+
+	return &s
+}
+
+// hexPattern is the pattern for the hexadecimal validate tag.
+const hexPattern = "[0-9a-fA-F]+"
+
+// applyValidate adds the constraints of the validate tag to the schema and
+// reports whether the field is required. Only the tags that have an
+// equivalent in the schema are used and the tags for the elements of a
+// collection are ignored.
+func applyValidate(s *Schema, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	// A reference can't carry constraints in this version of the
+	// specification so only the required tag applies.
+	if s.Ref != "" {
+		return strings.Contains(","+tag+",", ",required,")
+	}
+
+	// The rules after dive apply to the elements of a collection.
+	rules := strings.Split(tag, ",")
+	if i := slices.Index(rules, "dive"); i >= 0 {
+		rules = rules[:i]
+	}
+
+	var required, hex bool
+	var prefix string
+
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "required":
+			required = true
+
+		case "min", "gte":
+			setBound(s, param, true, false)
+
+		case "max", "lte":
+			setBound(s, param, false, false)
+
+		case "gt":
+			setBound(s, param, true, true)
+
+		case "lt":
+			setBound(s, param, false, true)
+
+		case "len":
+			setBound(s, param, true, false)
+			setBound(s, param, false, false)
+
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				if s.Type == "integer" || s.Type == "number" {
+					if n, err := strconv.ParseFloat(v, 64); err == nil {
+						s.Enum = append(s.Enum, n)
+						continue
+					}
+				}
+				s.Enum = append(s.Enum, v)
+			}
+
+		case "hexadecimal":
+			hex = true
+
+		case "startswith":
+			prefix = param
+
+		case "url", "uri":
+			s.Format = "uri"
+
+		case "email":
+			s.Format = "email"
+		}
+	}
+
+	switch {
+	case hex && prefix != "":
+		s.Pattern = "^" + regexp.QuoteMeta(prefix) + hexPattern + "$"
+
+	case hex:
+		s.Pattern = "^(0[xX])?" + hexPattern + "$"
+
+	case prefix != "":
+		s.Pattern = "^" + regexp.QuoteMeta(prefix)
+	}
+
+	return required
+}
+
+// setBound sets the lower or upper bound for the schema. The bound applies
+// to the length of strings, the number of items in arrays and the value of
+// numbers.
+func setBound(s *Schema, param string, lower bool, exclusive bool) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		v := int(n)
+		if lower {
+			s.MinLength = &v
+		} else {
+			s.MaxLength = &v
+		}
+
+	case "array":
+		v := int(n)
+		if lower {
+			s.MinItems = &v
+		} else {
+			s.MaxItems = &v
+		}
+
+	case "integer", "number":
+		if lower {
+			s.Minimum = &n
+			s.ExclusiveMinimum = exclusive
+		} else {
+			s.Maximum = &n
+			s.ExclusiveMaximum = exclusive
+		}
+	}
+}
+
+// intFormat returns the format for an integer type.
+func intFormat(t reflect.Type) string {
+	if t.Size() == 8 {
+		return "int64"
+	}
+
+	return "int32"
+}
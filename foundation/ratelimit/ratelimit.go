@@ -0,0 +1,139 @@
+// Package ratelimit provides token bucket rate limiting for a set of clients
+// identified by a key, such as an API key or an IP address.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+)
+
+// maxBuckets represents the number of clients tracked before buckets that
+// have refilled are dropped. A full bucket holds no information.
+const maxBuckets = 100_000
+
+// Limit represents the rate tokens are added to a bucket every second and
+// the number of tokens the bucket can hold. A rate of zero means there is
+// no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result represents the outcome of a request against a bucket.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// bucket represents the tokens available to a single client.
+type bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter maintains a token bucket for every client.
+type Limiter struct {
+	mu      sync.Mutex
+	clock   clock.Clock
+	buckets map[string]*bucket
+}
+
+// New constructs a limiter that uses the clock to refill the buckets. If no
+// clock is provided, the system clock is used.
+func New(clk clock.Clock) *Limiter {
+	if clk == nil {
+		clk = clock.New()
+	}
+
+	return &Limiter{
+		clock:   clk,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket for the key. The limit is provided on
+// every call so different clients can be given different limits.
+func (l *Limiter) Allow(key string, limit Limit) Result {
+	return l.check(key, limit, true)
+}
+
+// Peek reports if a request for the key would be allowed without taking a
+// token from the bucket.
+func (l *Limiter) Peek(key string, limit Limit) Result {
+	return l.check(key, limit, false)
+}
+
+// check refills the bucket for the key and reports if a request is allowed,
+// taking a token when specified.
+func (l *Limiter) check(key string, limit Limit, take bool) Result {
+	if limit.Rate <= 0 {
+		return Result{Allowed: true}
+	}
+
+	burst := max(limit.Burst, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+
+	b, exists := l.buckets[key]
+	if !exists {
+
+		// A missing bucket is full, there is nothing to track for a peek.
+		if !take {
+			return Result{Allowed: true, Limit: burst, Remaining: burst}
+		}
+
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+
+		b = &bucket{tokens: float64(burst), updated: now}
+		l.buckets[key] = b
+	}
+
+	// Add the tokens earned since the last request.
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	b.limit = limit
+
+	res := Result{
+		Limit: burst,
+	}
+
+	if b.tokens >= 1 {
+		if take {
+			b.tokens--
+		}
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(burst) - b.tokens) / limit.Rate)
+
+	return res
+}
+
+// prune drops the buckets that have refilled since they were last used.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate >= float64(max(b.limit.Burst, 1)) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// seconds converts a number of seconds into a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,80 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/clock"
+	"github.com/ardanlabs/blockchain/foundation/ratelimit"
+)
+
+func Test_Allow(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	lim := ratelimit.New(clk)
+	limit := ratelimit.Limit{Rate: 1, Burst: 3}
+
+	for i := range 3 {
+		res := lim.Allow("client1", limit)
+		if !res.Allowed {
+			t.Fatalf("Should allow request %d within the burst.", i+1)
+		}
+		if res.Limit != 3 || res.Remaining != 2-i {
+			t.Fatalf("Should have %d tokens remaining, got %d.", 2-i, res.Remaining)
+		}
+	}
+
+	res := lim.Allow("client1", limit)
+	if res.Allowed {
+		t.Fatalf("Should not allow a request once the bucket is empty.")
+	}
+	if res.RetryAfter != time.Second {
+		t.Fatalf("Should retry after a second, got %s.", res.RetryAfter)
+	}
+	if res.Reset != 3*time.Second {
+		t.Fatalf("Should be full again after 3 seconds, got %s.", res.Reset)
+	}
+
+	if !lim.Allow("client2", limit).Allowed {
+		t.Fatalf("Should give every client its own bucket.")
+	}
+
+	clk.Advance(time.Second)
+	if !lim.Allow("client1", limit).Allowed {
+		t.Fatalf("Should allow a request once a token is added.")
+	}
+	if lim.Allow("client1", limit).Allowed {
+		t.Fatalf("Should only add one token a second.")
+	}
+
+	clk.Advance(time.Hour)
+	if res := lim.Allow("client1", limit); res.Remaining != 2 {
+		t.Fatalf("Should not fill the bucket past the burst, got %d remaining.", res.Remaining)
+	}
+}
+
+func Test_Peek(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	lim := ratelimit.New(clk)
+	limit := ratelimit.Limit{Rate: 1, Burst: 1}
+
+	for range 3 {
+		if !lim.Peek("client1", limit).Allowed {
+			t.Fatalf("Should not take a token when peeking.")
+		}
+	}
+
+	lim.Allow("client1", limit)
+	if lim.Peek("client1", limit).Allowed {
+		t.Fatalf("Should report the bucket is empty.")
+	}
+}
+
+func Test_NoLimit(t *testing.T) {
+	lim := ratelimit.New(nil)
+
+	for range 100 {
+		if !lim.Allow("client1", ratelimit.Limit{}).Allowed {
+			t.Fatalf("Should allow every request without a limit.")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Recorder is an exporter that keeps the latest completed spans in memory.
+// It's used by tests and to look at the traces of a running node.
+type Recorder struct {
+	mu    sync.RWMutex
+	max   int
+	spans []SpanData
+}
+
+// NewRecorder constructs a recorder that keeps up to max spans. Once the max
+// is reached, the oldest spans are dropped.
+func NewRecorder(max int) *Recorder {
+	return &Recorder{max: max}
+}
+
+// Export implements the Exporter interface.
+func (r *Recorder) Export(span SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = append(r.spans, span)
+	if r.max > 0 && len(r.spans) > r.max {
+		r.spans = append([]SpanData(nil), r.spans[len(r.spans)-r.max:]...)
+	}
+}
+
+// Spans returns a copy of the recorded spans in the order they completed.
+func (r *Recorder) Spans() []SpanData {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]SpanData(nil), r.spans...)
+}
+
+// Trace returns the recorded spans for the specified trace. Spans that link
+// to the trace are included as well.
+func (r *Recorder) Trace(traceID string) []SpanData {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var spans []SpanData
+	for _, span := range r.spans {
+		if span.TraceID == traceID {
+			spans = append(spans, span)
+			continue
+		}
+
+		for _, link := range span.Links {
+			if link.TraceID == traceID {
+				spans = append(spans, span)
+				break
+			}
+		}
+	}
+
+	return spans
+}
+
+// ServeHTTP implements the http.Handler interface so the recorded spans can
+// be looked at on a running node. A trace_id query parameter limits the
+// response to a single trace.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	spans := r.Spans()
+	if traceID := req.URL.Query().Get("trace_id"); traceID != "" {
+		spans = r.Trace(traceID)
+	}
+
+	if spans == nil {
+		spans = []SpanData{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spans)
+}
+
+// =============================================================================
+
+// WriterExporter is an exporter that writes every completed span as a line
+// of JSON, such as to stdout.
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter constructs an exporter that writes to the writer.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// Export implements the Exporter interface.
+func (we *WriterExporter) Export(span SpanData) {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+
+	we.mu.Lock()
+	defer we.mu.Unlock()
+
+	we.w.Write(append(data, '\n'))
+}
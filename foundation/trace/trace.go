@@ -0,0 +1,349 @@
+// Package trace provides support for tracing work across the node and across
+// nodes. Spans are identified using the W3C trace context format so a trace
+// can be propagated to peers and to any system that speaks the standard.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderTraceparent is the W3C trace context header used to propagate a
+// span to another process.
+const HeaderTraceparent = "traceparent"
+
+// ErrInvalidTraceparent is returned when a traceparent value can't be parsed.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the hex encoding of the trace id.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid identifies if the trace id is set.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the hex encoding of the span id.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid identifies if the span id is set.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// =============================================================================
+
+// SpanContext represents the identity of a span that can be propagated.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// IsValid identifies if the span context identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns the span context in the W3C traceparent format. Every
+// span is recorded so the sampled flag is always set.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+// ParseTraceparent parses a span context in the W3C traceparent format.
+func ParseTraceparent(v string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	// Version 00 has exactly four fields. Later versions can add more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	var sc SpanContext
+	if n, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || n != len(sc.TraceID) || len(parts[1]) != 32 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if n, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || n != len(sc.SpanID) || len(parts[2]) != 16 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if len(parts[3]) != 2 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	return sc, nil
+}
+
+// =============================================================================
+
+type ctxKey int
+
+const (
+	spanKey ctxKey = iota + 1
+	remoteKey
+)
+
+// ContextWithSpanContext returns a context that uses the span context as the
+// parent of the spans started from it. This is used for a span that was
+// started in another process or earlier in the life of a transaction.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// SpanContextFromContext returns the span context of the current span in the
+// context. If there is no span, the zero value is returned.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span, ok := ctx.Value(spanKey).(*Span); ok {
+		return span.sc
+	}
+
+	if sc, ok := ctx.Value(remoteKey).(SpanContext); ok {
+		return sc
+	}
+
+	return SpanContext{}
+}
+
+// SpanFromContext returns the current span in the context. If there is no
+// span, nil is returned which is safe to use.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// Inject adds the traceparent header for the current span in the context.
+func Inject(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set(HeaderTraceparent, sc.Traceparent())
+	}
+}
+
+// Extract returns a context with the span context from the traceparent
+// header as the parent for new spans. An invalid header is ignored.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(HeaderTraceparent))
+	if err != nil {
+		return ctx
+	}
+
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// =============================================================================
+
+// Attribute represents a key/value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr constructs an attribute.
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Link represents a relationship between a span and a span in another trace.
+type Link struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// SpanData represents a completed span as it's provided to exporters.
+type SpanData struct {
+	Service    string         `json:"service"`
+	Name       string         `json:"name"`
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Duration   time.Duration  `json:"duration"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Links      []Link         `json:"links,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Span represents a unit of work being traced. A nil span is valid and does
+// nothing so code doesn't need to check if tracing is turned on.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the identity of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.sc
+}
+
+// SetAttributes adds the attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any, len(attrs))
+	}
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+// AddLink relates the span to a span in another trace.
+func (s *Span) AddLink(sc SpanContext) {
+	if s == nil || !sc.IsValid() || sc.TraceID == s.sc.TraceID {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Links = append(s.data.Links, Link{TraceID: sc.TraceID.String(), SpanID: sc.SpanID.String()})
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Error = err.Error()
+}
+
+// End completes the span and hands it to the exporters. Calling End more than
+// once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	s.data.Duration = s.data.End.Sub(s.data.Start)
+	data := s.data
+	s.mu.Unlock()
+
+	for _, exp := range s.tracer.exporters {
+		exp.Export(data)
+	}
+}
+
+// =============================================================================
+
+// Exporter represents the behavior required to receive completed spans.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer starts spans for a service. A nil tracer is valid and starts nil
+// spans, which turns tracing off.
+type Tracer struct {
+	service   string
+	exporters []Exporter
+	now       func() time.Time
+}
+
+// New constructs a tracer for the service that sends completed spans to
+// the exporters.
+func New(service string, exporters ...Exporter) *Tracer {
+	return &Tracer{
+		service:   service,
+		exporters: exporters,
+		now:       time.Now,
+	}
+}
+
+// Start begins a new span. If the context holds a span, the new span is its
+// child. Otherwise the new span starts a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+
+	span := Span{
+		tracer: t,
+		sc: SpanContext{
+			TraceID: parent.TraceID,
+			SpanID:  newSpanID(),
+		},
+	}
+	if !parent.TraceID.IsValid() {
+		span.sc.TraceID = newTraceID()
+	}
+
+	span.data = SpanData{
+		Service: t.service,
+		Name:    name,
+		TraceID: span.sc.TraceID.String(),
+		SpanID:  span.sc.SpanID.String(),
+		Start:   t.now(),
+	}
+	if parent.SpanID.IsValid() {
+		span.data.ParentID = parent.SpanID.String()
+	}
+	span.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, spanKey, &span), &span
+}
+
+// newTraceID generates a random trace id.
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+// newSpanID generates a random span id.
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
@@ -0,0 +1,179 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/trace"
+)
+
+func Test_Traceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := trace.ParseTraceparent(tp)
+	if err != nil {
+		t.Fatalf("Should be able to parse the traceparent: %s", err)
+	}
+
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Should get back the trace id, got %s.", sc.TraceID)
+	}
+
+	if sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("Should get back the span id, got %s.", sc.SpanID)
+	}
+
+	if sc.Traceparent() != tp {
+		t.Fatalf("Should get back the same traceparent, got %s.", sc.Traceparent())
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+
+	for _, v := range invalid {
+		if _, err := trace.ParseTraceparent(v); !errors.Is(err, trace.ErrInvalidTraceparent) {
+			t.Fatalf("Should not be able to parse %q.", v)
+		}
+	}
+}
+
+func Test_Spans(t *testing.T) {
+	rec := trace.NewRecorder(10)
+	tracer := trace.New("node1", rec)
+
+	ctx, root := tracer.Start(context.Background(), "root", trace.Attr("key", "value"))
+	_, child := tracer.Start(ctx, "child")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	root.End()
+	root.End()
+
+	spans := rec.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Should record 2 spans, got %d.", len(spans))
+	}
+
+	if spans[0].Name != "child" || spans[0].Error != "failed" {
+		t.Fatalf("Should record the child first with its error, got %+v.", spans[0])
+	}
+
+	if spans[0].TraceID != spans[1].TraceID {
+		t.Fatalf("Should record the child in the same trace as the root.")
+	}
+
+	if spans[0].ParentID != spans[1].SpanID {
+		t.Fatalf("Should record the root as the parent of the child.")
+	}
+
+	if spans[1].ParentID != "" || spans[1].Attributes["key"] != "value" {
+		t.Fatalf("Should record the root without a parent and with its attributes, got %+v.", spans[1])
+	}
+
+	if spans[1].Service != "node1" {
+		t.Fatalf("Should record the service, got %s.", spans[1].Service)
+	}
+}
+
+func Test_Propagation(t *testing.T) {
+	rec1 := trace.NewRecorder(10)
+	rec2 := trace.NewRecorder(10)
+	node1 := trace.New("node1", rec1)
+	node2 := trace.New("node2", rec2)
+
+	ctx, span := node1.Start(context.Background(), "send")
+	h := make(http.Header)
+	trace.Inject(ctx, h)
+	span.End()
+
+	ctx = trace.Extract(context.Background(), h)
+	_, remote := node2.Start(ctx, "receive")
+	remote.End()
+
+	sent := rec1.Spans()[0]
+	received := rec2.Spans()[0]
+
+	if sent.TraceID != received.TraceID || received.ParentID != sent.SpanID {
+		t.Fatalf("Should continue the trace on the other node, got %+v and %+v.", sent, received)
+	}
+
+	ctx = trace.Extract(context.Background(), http.Header{trace.HeaderTraceparent: {"bad"}})
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatalf("Should ignore an invalid traceparent header.")
+	}
+}
+
+func Test_Links(t *testing.T) {
+	rec := trace.NewRecorder(10)
+	tracer := trace.New("node1", rec)
+
+	_, span1 := tracer.Start(context.Background(), "tx1")
+	_, span2 := tracer.Start(context.Background(), "tx2")
+	span1.End()
+	span2.End()
+
+	ctx := trace.ContextWithSpanContext(context.Background(), span1.SpanContext())
+	_, batch := tracer.Start(ctx, "batch")
+	batch.AddLink(span2.SpanContext())
+	batch.End()
+
+	spans := rec.Trace(span2.SpanContext().TraceID.String())
+	if len(spans) != 2 {
+		t.Fatalf("Should find the span and the linked span, got %d.", len(spans))
+	}
+}
+
+func Test_NoTracer(t *testing.T) {
+	var tracer *trace.Tracer
+
+	ctx, span := tracer.Start(context.Background(), "noop")
+	span.SetAttributes(trace.Attr("key", "value"))
+	span.RecordError(errors.New("failed"))
+	span.End()
+
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatalf("Should not have a span without a tracer.")
+	}
+}
+
+func Test_WriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := trace.New("node1", trace.NewWriterExporter(&buf))
+
+	_, span := tracer.Start(context.Background(), "write")
+	span.End()
+
+	var data trace.SpanData
+	if err := json.Unmarshal(buf.Bytes(), &data); err != nil {
+		t.Fatalf("Should write the span as json: %s", err)
+	}
+
+	if data.Name != "write" {
+		t.Fatalf("Should write the span, got %+v.", data)
+	}
+}
+
+func Test_RecorderMax(t *testing.T) {
+	rec := trace.NewRecorder(2)
+	tracer := trace.New("node1", rec)
+
+	for _, name := range []string{"one", "two", "three"} {
+		_, span := tracer.Start(context.Background(), name)
+		span.End()
+	}
+
+	spans := rec.Spans()
+	if len(spans) != 2 || spans[0].Name != "two" {
+		t.Fatalf("Should drop the oldest span, got %+v.", spans)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/trace"
 	"github.com/dimfeld/httptreemux/v5"
 	"github.com/google/uuid"
 )
@@ -16,28 +17,31 @@ import (
 // framework.
 type Handler func(ctx context.Context, w http.ResponseWriter, r *http.Request) error
 
+// Route is a method and path handled by the application.
+type Route struct {
+	Method string
+	Path   string
+}
+
 // App is the entrypoint into our application and what configures our context
 // object for each of our http handlers. Feel free to add any configuration
 // data/logic on this App struct.
 type App struct {
 	*httptreemux.ContextMux
 	shutdown chan os.Signal
+	tracer   *trace.Tracer
 	mw       []Middleware
+	routes   []Route
 }
 
 // NewApp creates an App value that handle a set of routes for the application.
-func NewApp(shutdown chan os.Signal, mw ...Middleware) *App {
-
-	// Create an OpenTelemetry HTTP Handler which wraps our router. This will start
-	// the initial span and annotate it with information about the request/response.
-	//
-	// This is configured to use the W3C TraceContext standard to set the remote
-	// parent if a client request includes the appropriate headers.
-	// https://w3c.github.io/trace-context/
-
+// The tracer is optional and when provided, every request is handled inside
+// a span.
+func NewApp(shutdown chan os.Signal, tracer *trace.Tracer, mw ...Middleware) *App {
 	return &App{
 		ContextMux: httptreemux.NewContextMux(),
 		shutdown:   shutdown,
+		tracer:     tracer,
 		mw:         mw,
 	}
 }
@@ -48,6 +52,12 @@ func (a *App) SignalShutdown() {
 	a.shutdown <- syscall.SIGTERM
 }
 
+// Routes returns the routes handled by the application in the order they
+// were added.
+func (a *App) Routes() []Route {
+	return append([]Route(nil), a.routes...)
+}
+
 // Handle sets a handler function for a given HTTP method and path pair
 // to the application server mux.
 func (a *App) Handle(method string, group string, path string, handler Handler, mw ...Middleware) {
@@ -58,6 +68,11 @@ func (a *App) Handle(method string, group string, path string, handler Handler,
 	// Add the application's general middleware to the handler chain.
 	handler = wrapMiddleware(a.mw, handler)
 
+	finalPath := path
+	if group != "" {
+		finalPath = "/" + group + path
+	}
+
 	// The function to execute for each request.
 	h := func(w http.ResponseWriter, r *http.Request) {
 
@@ -65,24 +80,39 @@ func (a *App) Handle(method string, group string, path string, handler Handler,
 		// use it as a separate parameter.
 		ctx := r.Context()
 
+		// Start the initial span for the request. This uses the W3C
+		// TraceContext standard to set the remote parent if a client
+		// request includes the appropriate headers.
+		// https://w3c.github.io/trace-context/
+		ctx = trace.Extract(ctx, r.Header)
+		ctx, span := a.tracer.Start(ctx, method+" "+finalPath,
+			trace.Attr("http.method", method),
+			trace.Attr("http.route", finalPath),
+			trace.Attr("http.remote", r.RemoteAddr),
+		)
+		defer span.End()
+
 		// Set the context with the required values to
-		// process the request.
+		// process the request. The trace id of the span
+		// is used so logs can be matched to the trace.
 		v := Values{
 			TraceID: uuid.New().String(),
 			Now:     time.Now().UTC(),
 		}
+		if sc := span.SpanContext(); sc.IsValid() {
+			v.TraceID = sc.TraceID.String()
+		}
 		ctx = context.WithValue(ctx, key, &v)
 
 		// Call the wrapped handler functions.
-		if err := handler(ctx, w, r); err != nil {
+		err := handler(ctx, w, r)
+		span.SetAttributes(trace.Attr("http.status_code", v.StatusCode))
+		if err != nil {
+			span.RecordError(err)
 			a.SignalShutdown()
 			return
 		}
 	}
-
-	finalPath := path
-	if group != "" {
-		finalPath = "/" + group + path
-	}
 	a.ContextMux.Handle(method, finalPath, h)
+	a.routes = append(a.routes, Route{Method: method, Path: finalPath})
 }